@@ -0,0 +1,240 @@
+// Package bm25 is an in-memory keyword index ranked with Okapi BM25. It complements
+// semantic search, which tends to miss exact tokens such as course codes
+// ("CS 61B") that carry little meaning for an embedding model.
+package bm25
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// BM25 parameters: k1 controls how quickly repeated terms stop adding to the score,
+// b how much long documents are penalised.
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// stopWords are left out of documents and queries.
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true,
+	"by": true, "for": true, "from": true, "i": true, "in": true, "is": true, "it": true,
+	"me": true, "my": true, "of": true, "on": true, "or": true, "so": true, "that": true,
+	"the": true, "this": true, "to": true, "with": true, "you": true,
+}
+
+// Tokenize splits text into lower-case, lightly stemmed terms. A word followed by a
+// term starting with a digit also yields the two joined, so "CS 61B" and "CS61B"
+// match each other.
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, 0, len(words))
+	for i, word := range words {
+		if !stopWords[word] {
+			terms = append(terms, stem(word))
+		}
+		if i > 0 && startsWithDigit(word) && !startsWithDigit(words[i-1]) {
+			terms = append(terms, words[i-1]+word)
+		}
+	}
+	return terms
+}
+
+// stem strips the most common English suffixes so "tutoring", "tutored" and
+// "tutors" all match "tutor". It is deliberately crude; codes and short words are
+// left alone.
+func stem(word string) string {
+	if len(word) <= 4 || startsWithDigit(word) {
+		return word
+	}
+	switch {
+	case strings.HasSuffix(word, "ies"):
+		return word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "ing") && len(word) > 5:
+		return word[:len(word)-3]
+	case strings.HasSuffix(word, "ed"):
+		return word[:len(word)-2]
+	case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss"):
+		return word[:len(word)-1]
+	}
+	return word
+}
+
+func startsWithDigit(s string) bool {
+	for _, r := range s {
+		return unicode.IsDigit(r)
+	}
+	return false
+}
+
+// Result is a search hit with the query terms the document contains.
+type Result[K comparable] struct {
+	ID      K
+	Score   float64
+	Matched []string
+}
+
+type document[M any] struct {
+	length int
+	terms  map[string]int
+	meta   M
+}
+
+// Index maps terms to the documents containing them. It is safe for concurrent use.
+type Index[K comparable, M any] struct {
+	mu          sync.RWMutex
+	docs        map[K]*document[M]
+	postings    map[string]map[K]int // term -> document -> term frequency
+	totalLength int
+}
+
+// New returns an empty index.
+func New[K comparable, M any]() *Index[K, M] {
+	return &Index[K, M]{docs: make(map[K]*document[M]), postings: make(map[string]map[K]int)}
+}
+
+// Len returns the number of documents.
+func (x *Index[K, M]) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.docs)
+}
+
+// Add indexes text under id, replacing any document with the same id.
+func (x *Index[K, M]) Add(id K, text string, meta M) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.remove(id)
+	terms := Tokenize(text)
+	doc := &document[M]{length: len(terms), terms: make(map[string]int), meta: meta}
+	for _, term := range terms {
+		doc.terms[term]++
+	}
+	for term, tf := range doc.terms {
+		if x.postings[term] == nil {
+			x.postings[term] = make(map[K]int)
+		}
+		x.postings[term][id] = tf
+	}
+	x.docs[id] = doc
+	x.totalLength += doc.length
+}
+
+// Remove deletes a document. It reports whether the document existed.
+func (x *Index[K, M]) Remove(id K) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.remove(id)
+}
+
+func (x *Index[K, M]) remove(id K) bool {
+	doc, ok := x.docs[id]
+	if !ok {
+		return false
+	}
+	for term := range doc.terms {
+		delete(x.postings[term], id)
+		if len(x.postings[term]) == 0 {
+			delete(x.postings, term)
+		}
+	}
+	delete(x.docs, id)
+	x.totalLength -= doc.length
+	return true
+}
+
+// SetMeta replaces the metadata of a document. It reports whether it exists.
+func (x *Index[K, M]) SetMeta(id K, meta M) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	doc, ok := x.docs[id]
+	if ok {
+		doc.meta = meta
+	}
+	return ok
+}
+
+// Search returns up to k documents that pass filter and contain at least one
+// query term, best first. A nil filter accepts every document.
+func (x *Index[K, M]) Search(query string, k int, filter func(M) bool) []Result[K] {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	if k <= 0 || len(x.docs) == 0 {
+		return nil
+	}
+	n := float64(len(x.docs))
+	avgLength := float64(x.totalLength) / n
+	if avgLength == 0 {
+		avgLength = 1
+	}
+
+	hits := make(map[K]*Result[K])
+	seen := make(map[string]bool)
+	for _, term := range Tokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		postings := x.postings[term]
+		df := float64(len(postings))
+		if df == 0 {
+			continue
+		}
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for id, tf := range postings {
+			doc := x.docs[id]
+			if filter != nil && !filter(doc.meta) {
+				continue
+			}
+			hit := hits[id]
+			if hit == nil {
+				hit = &Result[K]{ID: id}
+				hits[id] = hit
+			}
+			f := float64(tf)
+			hit.Score += idf * f * (k1 + 1) / (f + k1*(1-b+b*float64(doc.length)/avgLength))
+			hit.Matched = append(hit.Matched, term)
+		}
+	}
+
+	top := &resultHeap[K]{}
+	for _, hit := range hits {
+		if top.Len() < k {
+			heap.Push(top, *hit)
+		} else if hit.Score > (*top)[0].Score {
+			(*top)[0] = *hit
+			heap.Fix(top, 0)
+		}
+	}
+	results := make([]Result[K], top.Len())
+	for i := len(results) - 1; i >= 0; i-- {
+		results[i] = heap.Pop(top).(Result[K])
+		sort.Strings(results[i].Matched)
+	}
+	return results
+}
+
+// resultHeap keeps the lowest score on top.
+type resultHeap[K comparable] []Result[K]
+
+func (h resultHeap[K]) Len() int            { return len(h) }
+func (h resultHeap[K]) Less(i, j int) bool  { return h[i].Score < h[j].Score }
+func (h resultHeap[K]) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *resultHeap[K]) Push(v interface{}) { *h = append(*h, v.(Result[K])) }
+func (h *resultHeap[K]) Pop() interface{} {
+	old := *h
+	v := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return v
+}
@@ -0,0 +1,184 @@
+package bm25
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", []string{}},
+		{"The tutor", []string{"tutor"}},
+		{"Tutoring, tutored & TUTORS!", []string{"tutor", "tutor", "tutor"}},
+		{"Studies", []string{"study"}},
+		{"glass class", []string{"glass", "class"}},
+		{"bus cat", []string{"bus", "cat"}},
+		{"CS 61B", []string{"cs", "61b", "cs61b"}},
+		{"CS61B", []string{"cs61b"}},
+		{"math 1 2", []string{"math", "1", "math1", "2"}},
+		{"help with a 2024 essay", []string{"help", "2024", "a2024", "essay"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := Tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+type doc struct {
+	id, text string
+}
+
+func newIndex(docs ...doc) *Index[string, string] {
+	x := New[string, string]()
+	for _, d := range docs {
+		x.Add(d.id, d.text, d.id)
+	}
+	return x
+}
+
+func ids(results []Result[string]) []string {
+	out := make([]string, len(results))
+	for i, r := range results {
+		out[i] = r.ID
+	}
+	return out
+}
+
+func TestSearchScore(t *testing.T) {
+	x := newIndex(
+		doc{"a", "calculus tutoring"},
+		doc{"b", "guitar lessons"},
+		doc{"c", "physics tutoring"},
+	)
+
+	results := x.Search("calculus", 10, nil)
+	if len(results) != 1 || results[0].ID != "a" {
+		t.Fatalf("Search(calculus) = %v, want [a]", ids(results))
+	}
+
+	// One matching term of a document of average length: the score reduces to idf.
+	n, df := 3.0, 1.0
+	want := math.Log(1 + (n-df+0.5)/(df+0.5))
+	if got := results[0].Score; math.Abs(got-want) > 1e-9 {
+		t.Errorf("score = %v, want %v", got, want)
+	}
+	if !reflect.DeepEqual(results[0].Matched, []string{"calculu"}) {
+		t.Errorf("Matched = %q, want the stemmed term [calculu]", results[0].Matched)
+	}
+}
+
+func TestSearchRanking(t *testing.T) {
+	tests := []struct {
+		name  string
+		docs  []doc
+		query string
+		want  []string
+	}{
+		{
+			name:  "more matching terms rank higher",
+			docs:  []doc{{"one", "calculus notes"}, {"two", "calculus tutoring"}, {"none", "guitar"}},
+			query: "calculus tutoring",
+			want:  []string{"two", "one"},
+		},
+		{
+			name:  "shorter documents rank higher",
+			docs:  []doc{{"long", "calculus help for students in every single course offered"}, {"short", "calculus help"}, {"other", "guitar"}},
+			query: "calculus",
+			want:  []string{"short", "long"},
+		},
+		{
+			name:  "course codes match with or without a space",
+			docs:  []doc{{"spaced", "CS 61B tutoring"}, {"joined", "CS61B notes"}, {"other", "CS 70"}},
+			query: "cs61b",
+			want:  []string{"joined", "spaced"},
+		},
+		{
+			name:  "stop words are ignored",
+			docs:  []doc{{"a", "the guitar"}, {"b", "the piano"}},
+			query: "the",
+			want:  []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x := newIndex(tt.docs...)
+			got := ids(x.Search(tt.query, 10, nil))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchRareTermsWeighMore(t *testing.T) {
+	x := newIndex(
+		doc{"common", "tutoring help"},
+		doc{"rare", "tutoring calculus"},
+		doc{"x", "help guitar"},
+		doc{"y", "help piano"},
+	)
+	results := x.Search("help calculus", 10, nil)
+	if len(results) != 4 || results[0].ID != "rare" {
+		t.Fatalf("Search = %v, want rare first of 4", ids(results))
+	}
+	if results[0].Score <= results[1].Score {
+		t.Errorf("rare term scored %v, common term %v", results[0].Score, results[1].Score)
+	}
+}
+
+func TestSearchLimitAndFilter(t *testing.T) {
+	x := newIndex(
+		doc{"a", "tutor tutor tutor"},
+		doc{"b", "tutor tutor"},
+		doc{"c", "tutor"},
+		doc{"d", "guitar"},
+	)
+
+	if got := ids(x.Search("tutor", 2, nil)); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("Search k=2 = %v, want [a b]", got)
+	}
+	if got := x.Search("tutor", 0, nil); got != nil {
+		t.Errorf("Search k=0 = %v, want nil", got)
+	}
+	skipA := func(meta string) bool { return meta != "a" }
+	if got := ids(x.Search("tutor", 10, skipA)); !reflect.DeepEqual(got, []string{"b", "c"}) {
+		t.Errorf("filtered Search = %v, want [b c]", got)
+	}
+}
+
+func TestIndexUpdates(t *testing.T) {
+	x := newIndex(doc{"a", "calculus"}, doc{"b", "physics"})
+
+	x.Add("a", "guitar", "a")
+	if got := ids(x.Search("calculus", 10, nil)); len(got) != 0 {
+		t.Errorf("replaced document still matches its old text: %v", got)
+	}
+	if got := ids(x.Search("guitar", 10, nil)); !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("Search(guitar) = %v, want [a]", got)
+	}
+
+	if !x.Remove("b") || x.Remove("b") {
+		t.Error("Remove should report whether the document existed")
+	}
+	if x.Len() != 1 {
+		t.Errorf("Len = %d, want 1", x.Len())
+	}
+	if got := x.Search("physics", 10, nil); len(got) != 0 {
+		t.Errorf("removed document still matches: %v", ids(got))
+	}
+
+	if !x.SetMeta("a", "hidden") || x.SetMeta("missing", "x") {
+		t.Error("SetMeta should report whether the document exists")
+	}
+	visible := func(meta string) bool { return meta != "hidden" }
+	if got := x.Search("guitar", 10, visible); len(got) != 0 {
+		t.Errorf("filter ignored the new metadata: %v", ids(got))
+	}
+}
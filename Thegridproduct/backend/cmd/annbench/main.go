@@ -0,0 +1,210 @@
+// Command annbench measures the vector index used by semantic search against the
+// brute-force loop it replaces, on synthetic clustered vectors. It reports query
+// latency and recall@k (the share of the exact top k the index returns) with and
+// without a campus visibility filter.
+//
+// The brute-force numbers only cover the similarity loop itself; the handlers also
+// had to load every visible vector from MongoDB on each query, which the index
+// avoids as well.
+//
+//	go run ./cmd/annbench
+//	go run ./cmd/annbench -n 100000 -dim 1536 -queries 200
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"Thegridproduct/backend/vectorindex"
+)
+
+// campusMeta mirrors what the handlers filter on.
+type campusMeta struct {
+	university string
+	flexible   bool
+}
+
+func main() {
+	n := flag.Int("n", 20000, "number of indexed vectors")
+	dim := flag.Int("dim", 256, "vector dimension")
+	queries := flag.Int("queries", 500, "number of queries")
+	k := flag.Int("k", 10, "results per query")
+	clusters := flag.Int("clusters", 100, "number of clusters the vectors are drawn around")
+	campuses := flag.Int("campuses", 20, "number of universities for the filtered run")
+	m := flag.Int("m", vectorindex.DefaultOptions().M, "HNSW links per node")
+	efConstruction := flag.Int("ef-construction", vectorindex.DefaultOptions().EfConstruction, "HNSW candidate list size while inserting")
+	efSearch := flag.Int("ef-search", vectorindex.DefaultOptions().EfSearch, "HNSW candidate list size while searching")
+	seed := flag.Int64("seed", 1, "random seed")
+	flag.Parse()
+
+	rng := rand.New(rand.NewSource(*seed))
+	centres := make([][]float32, *clusters)
+	for i := range centres {
+		centres[i] = randomVector(rng, *dim, nil, 0)
+	}
+	sample := func() []float32 {
+		return randomVector(rng, *dim, centres[rng.Intn(len(centres))], 0.35)
+	}
+
+	vectors := make([][]float32, *n)
+	metas := make([]campusMeta, *n)
+	for i := range vectors {
+		vectors[i] = sample()
+		metas[i] = campusMeta{university: fmt.Sprintf("campus-%d", rng.Intn(*campuses)), flexible: rng.Float64() < 0.2}
+	}
+	queryVectors := make([][]float32, *queries)
+	for i := range queryVectors {
+		queryVectors[i] = sample()
+	}
+
+	index := vectorindex.New[int, campusMeta](*dim, vectorindex.Options{
+		M: *m, EfConstruction: *efConstruction, EfSearch: *efSearch, Seed: *seed,
+	})
+	start := time.Now()
+	for i, v := range vectors {
+		if err := index.Add(i, v, metas[i]); err != nil {
+			log.Fatalf("Error adding vector: %v", err)
+		}
+	}
+	build := time.Since(start)
+	log.Printf("Indexed %d vectors of dimension %d in %s (%.0f inserts/s)", *n, *dim, build.Round(time.Millisecond), float64(*n)/build.Seconds())
+
+	visible := func(meta campusMeta) bool { return meta.flexible || meta.university == "campus-0" }
+
+	for _, run := range []struct {
+		name   string
+		filter func(campusMeta) bool
+	}{
+		{"unfiltered", nil},
+		{"campus filter", visible},
+	} {
+		bruteForce := measure(queryVectors, func(q []float32) []int {
+			return bruteForceLoop(q, vectors, metas, run.filter, *k)
+		})
+		exact := make([][]int, len(queryVectors))
+		for i, q := range queryVectors {
+			exact[i] = bruteForceLoop(q, vectors, metas, run.filter, *k)
+		}
+
+		var recall float64
+		approx := measure(queryVectors, func(q []float32) []int {
+			results, err := index.Search(q, *k, run.filter)
+			if err != nil {
+				log.Fatalf("Error searching: %v", err)
+			}
+			ids := make([]int, len(results))
+			for i, r := range results {
+				ids[i] = r.ID
+			}
+			return ids
+		})
+		for i, q := range queryVectors {
+			results, _ := index.Search(q, *k, run.filter)
+			recall += overlap(exact[i], results) / float64(len(queryVectors))
+		}
+
+		log.Printf("%s:", run.name)
+		log.Printf("  brute force  p50 %-10s p99 %-10s", bruteForce.p50, bruteForce.p99)
+		log.Printf("  hnsw         p50 %-10s p99 %-10s recall@%d %.3f speedup %.1fx",
+			approx.p50, approx.p99, *k, recall, float64(bruteForce.p50)/float64(approx.p50))
+	}
+}
+
+type latency struct {
+	p50, p99 time.Duration
+}
+
+// measure runs search for every query and returns the latency percentiles.
+func measure(queries [][]float32, search func([]float32) []int) latency {
+	durations := make([]time.Duration, len(queries))
+	for i, q := range queries {
+		start := time.Now()
+		search(q)
+		durations[i] = time.Since(start)
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	percentile := func(p float64) time.Duration {
+		return durations[int(p*float64(len(durations)-1))].Round(time.Microsecond)
+	}
+	return latency{p50: percentile(0.5), p99: percentile(0.99)}
+}
+
+// bruteForceLoop is what the search handlers did before the index: compute the
+// cosine similarity with every visible vector, then sort.
+func bruteForceLoop(q []float32, vectors [][]float32, metas []campusMeta, filter func(campusMeta) bool, k int) []int {
+	type match struct {
+		id         int
+		similarity float64
+	}
+	var matches []match
+	for i, v := range vectors {
+		if filter != nil && !filter(metas[i]) {
+			continue
+		}
+		matches = append(matches, match{id: i, similarity: cosineSimilarity(q, v)})
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].similarity > matches[j].similarity })
+	if len(matches) > k {
+		matches = matches[:k]
+	}
+	ids := make([]int, len(matches))
+	for i, m := range matches {
+		ids[i] = m.id
+	}
+	return ids
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	var dotProduct, normA, normB float64
+	for i := range a {
+		dotProduct += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dotProduct / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// overlap is the share of exact that results contain.
+func overlap(exact []int, results []vectorindex.Result[int]) float64 {
+	if len(exact) == 0 {
+		return 1
+	}
+	found := make(map[int]bool, len(results))
+	for _, r := range results {
+		found[r.ID] = true
+	}
+	hits := 0
+	for _, id := range exact {
+		if found[id] {
+			hits++
+		}
+	}
+	return float64(hits) / float64(len(exact))
+}
+
+// randomVector returns a unit vector, scattered around centre by noise when given.
+func randomVector(rng *rand.Rand, dim int, centre []float32, noise float64) []float32 {
+	v := make([]float32, dim)
+	var norm float64
+	for i := range v {
+		f := rng.NormFloat64()
+		if centre != nil {
+			f = float64(centre[i]) + f*noise/math.Sqrt(float64(dim))
+		}
+		v[i] = float32(f)
+		norm += f * f
+	}
+	norm = math.Sqrt(norm)
+	for i := range v {
+		v[i] = float32(float64(v[i]) / norm)
+	}
+	return v
+}
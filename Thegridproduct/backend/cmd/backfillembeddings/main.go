@@ -0,0 +1,205 @@
+// Command backfillembeddings computes the search embeddings of the products or gigs
+// that do not have an up to date one yet. New and edited listings get their
+// embedding when they are saved; this command catches up the ones listed before
+// that, retries gigs whose embedding failed, and re-embeds every listing after
+// EMBEDDINGS_PROVIDER or EMBEDDINGS_MODEL changes, since search only compares
+// vectors of the configured model. The server's reembed-listings job does the same
+// in batches; this command is for catching up all at once.
+//
+// Listings are processed in _id order and only those still needing an embedding
+// are picked up, so the command can be stopped and started again at any time.
+//
+//	go run ./cmd/backfillembeddings -dry-run
+//	go run ./cmd/backfillembeddings -collection gigs -delay 200ms
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"Thegridproduct/backend/db"
+	"Thegridproduct/backend/embeddings"
+	"Thegridproduct/backend/models"
+
+	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// target describes how to backfill one collection.
+type target struct {
+	// filter matches the documents that need an embedding.
+	filter bson.M
+	// text decodes a document and returns its ID and the text to embed.
+	text func(cursor *mongo.Cursor) (primitive.ObjectID, string, error)
+	// done and failed build the updates recording the outcome.
+	done   func(vector []float32) bson.M
+	failed func(err error) bson.M
+}
+
+func targets(embedder embeddings.Embedder) map[string]target {
+	return map[string]target{
+		"products": {
+			filter: embeddings.StaleFilter(embedder),
+			text: func(cursor *mongo.Cursor) (primitive.ObjectID, string, error) {
+				var product models.Product
+				err := cursor.Decode(&product)
+				return product.ID, embeddings.ProductText(product), err
+			},
+			done: func(vector []float32) bson.M {
+				return bson.M{"$set": embeddings.Fields(embedder, vector)}
+			},
+		},
+		"gigs": {
+			filter: bson.M{"$or": []bson.M{
+				embeddings.StaleFilter(embedder),
+				{"embeddingStatus": bson.M{"$in": []string{models.EmbeddingStatusPending, models.EmbeddingStatusFailed}}},
+			}},
+			text: func(cursor *mongo.Cursor) (primitive.ObjectID, string, error) {
+				var gig models.Gig
+				err := cursor.Decode(&gig)
+				return gig.ID, embeddings.GigText(gig), err
+			},
+			done: func(vector []float32) bson.M {
+				fields := embeddings.Fields(embedder, vector)
+				fields["embeddingStatus"] = models.EmbeddingStatusReady
+				fields["embeddingUpdatedAt"] = time.Now()
+				return bson.M{
+					"$set":   fields,
+					"$unset": bson.M{"embeddingError": ""},
+				}
+			},
+			failed: func(err error) bson.M {
+				return bson.M{"$set": bson.M{
+					"embeddingStatus":    models.EmbeddingStatusFailed,
+					"embeddingError":     err.Error(),
+					"embeddingUpdatedAt": time.Now(),
+				}}
+			},
+		},
+	}
+}
+
+func main() {
+	collectionName := flag.String("collection", "products", "collection to backfill: products or gigs")
+	dryRun := flag.Bool("dry-run", false, "count the listings that need an embedding without computing anything")
+	limit := flag.Int64("limit", 0, "stop after this many listings (0 means no limit)")
+	delay := flag.Duration("delay", 100*time.Millisecond, "pause between embeddings API calls")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("Error loading .env file, proceeding with system environment variables")
+	}
+
+	embedder, err := embeddings.FromEnv()
+	if err != nil {
+		log.Fatalf("Embeddings configuration error: %v", err)
+	}
+	t, ok := targets(embedder)[*collectionName]
+	if !ok {
+		log.Fatalf("Unknown collection %q, expected products or gigs", *collectionName)
+	}
+	log.Printf("Embedding %s with %s (%d dimensions)", *collectionName, embedder.Model(), embedder.Dimensions())
+
+	db.ConnectDB()
+	defer db.DisconnectDB()
+
+	ctx := context.Background()
+	collection := db.GetCollection("gridlyapp", *collectionName)
+
+	if *dryRun {
+		count, err := collection.CountDocuments(ctx, t.filter)
+		if err != nil {
+			log.Fatalf("Error counting %s: %v", *collectionName, err)
+		}
+		log.Printf("Dry run: %d %s need an embedding", count, *collectionName)
+		if *collectionName == "gigs" {
+			logStatusCounts(ctx, collection)
+		}
+		return
+	}
+
+	opts := options.Find().SetSort(bson.M{"_id": 1})
+	if *limit > 0 {
+		opts.SetLimit(*limit)
+	}
+	cursor, err := collection.Find(ctx, t.filter, opts)
+	if err != nil {
+		log.Fatalf("Error fetching %s: %v", *collectionName, err)
+	}
+	defer cursor.Close(ctx)
+
+	var done, failed int
+	for cursor.Next(ctx) {
+		id, text, err := t.text(cursor)
+		if err != nil {
+			log.Printf("Error decoding document: %v", err)
+			failed++
+			continue
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		vector, err := embedder.Embed(callCtx, text)
+		cancel()
+		if err != nil {
+			log.Printf("Error generating embedding for %s: %v", id.Hex(), err)
+			if t.failed != nil {
+				if _, err := collection.UpdateOne(ctx, bson.M{"_id": id}, t.failed(err)); err != nil {
+					log.Printf("Error storing embedding status for %s: %v", id.Hex(), err)
+				}
+			}
+			failed++
+			time.Sleep(*delay)
+			continue
+		}
+
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": id}, t.done(vector)); err != nil {
+			log.Printf("Error storing embedding for %s: %v", id.Hex(), err)
+			failed++
+			continue
+		}
+
+		done++
+		if done%100 == 0 {
+			log.Printf("%d %s embedded so far, last %s", done, *collectionName, id.Hex())
+		}
+		time.Sleep(*delay)
+	}
+	if err := cursor.Err(); err != nil {
+		log.Fatalf("Error iterating %s: %v", *collectionName, err)
+	}
+
+	log.Printf("Embedded %d %s, %d failed", done, *collectionName, failed)
+}
+
+// logStatusCounts prints how many gigs are in each embedding state.
+func logStatusCounts(ctx context.Context, collection *mongo.Collection) {
+	cursor, err := collection.Aggregate(ctx, []bson.M{
+		{"$group": bson.M{"_id": "$embeddingStatus", "count": bson.M{"$sum": 1}}},
+	})
+	if err != nil {
+		log.Printf("Error counting embedding states: %v", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var counts []struct {
+		Status *string `bson:"_id"`
+		Count  int     `bson:"count"`
+	}
+	if err := cursor.All(ctx, &counts); err != nil {
+		log.Printf("Error counting embedding states: %v", err)
+		return
+	}
+	for _, c := range counts {
+		status := "unknown"
+		if c.Status != nil {
+			status = *c.Status
+		}
+		log.Printf("  %s: %d", status, c.Count)
+	}
+}
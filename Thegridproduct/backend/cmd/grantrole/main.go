@@ -0,0 +1,76 @@
+// Command grantrole grants or revokes a role for a user identified by email.
+// It is used to bootstrap the first admin, after which roles can be managed
+// through PUT /admin/users/{id}/roles.
+//
+//	go run ./cmd/grantrole -email someone@school.edu -role admin
+//	go run ./cmd/grantrole -email someone@school.edu -role admin -revoke
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"Thegridproduct/backend/db"
+	"Thegridproduct/backend/models"
+
+	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func main() {
+	email := flag.String("email", "", "email of the user to update")
+	role := flag.String("role", models.RoleAdmin, "role to grant or revoke")
+	revoke := flag.Bool("revoke", false, "revoke the role instead of granting it")
+	flag.Parse()
+
+	if *email == "" {
+		log.Fatal("-email is required")
+	}
+	validRole := false
+	for _, r := range models.ValidRoles {
+		if r == *role {
+			validRole = true
+		}
+	}
+	if !validRole {
+		log.Fatalf("Unknown role %q; valid roles are %v", *role, models.ValidRoles)
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("Error loading .env file, proceeding with system environment variables")
+	}
+
+	db.ConnectDB()
+	defer db.DisconnectDB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	update := bson.M{"$addToSet": bson.M{"roles": *role}}
+	if *revoke {
+		update = bson.M{"$pull": bson.M{"roles": *role}}
+	}
+
+	user, err := db.Users.GetByEmail(ctx, *email)
+	if err == db.ErrUserNotFound {
+		log.Fatalf("No user found with email %s", *email)
+	} else if err != nil {
+		log.Fatalf("Error fetching user: %v", err)
+	}
+
+	if err := db.Users.Update(ctx, user.ID, update); err != nil {
+		log.Fatalf("Error updating user: %v", err)
+	}
+
+	if *revoke {
+		// Make the change effective immediately instead of at the next token refresh.
+		if _, err := db.RevokeUserSessions(ctx, user.ID); err != nil {
+			log.Printf("Error revoking sessions: %v", err)
+		}
+		log.Printf("Revoked role %q from %s (%s)", *role, *email, user.ID.Hex())
+	} else {
+		log.Printf("Granted role %q to %s (%s); it applies from the next login or token refresh", *role, *email, user.ID.Hex())
+	}
+}
@@ -0,0 +1,214 @@
+// Command migratechats copies the messages stored in the messages array of every
+// Firestore chat room into the MongoDB messages collection, one document per
+// message. Messages keep their _id, so the copy can be checked against Firestore
+// and clients that kept message IDs around still find them.
+//
+// The command is safe to run more than once, and should be run again right after
+// the backend starts storing messages in MongoDB to pick up messages clients sent
+// in between: messages already copied are skipped. Rooms without a chat in
+// MongoDB, left behind by deleted chats, are reported and not copied. Firestore is
+// never modified.
+//
+// The read receipts clients kept in the lastRead map of each room are copied as
+// read positions: each user has read up to the last message sent at or before
+// their lastRead time. Positions already further along are kept.
+//
+//	go run ./cmd/migratechats -dry-run
+//	go run ./cmd/migratechats
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"Thegridproduct/backend/db"
+	"Thegridproduct/backend/handlers"
+	"Thegridproduct/backend/models"
+
+	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/api/iterator"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report what would be migrated without writing anything")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("Error loading .env file, proceeding with system environment variables")
+	}
+
+	db.ConnectDB()
+	defer db.DisconnectDB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+	defer cancel()
+
+	chats := db.GetCollection("gridlyapp", "chats")
+	rooms := handlers.FirestoreClient().Collection("chatRooms").Documents(ctx)
+	defer rooms.Stop()
+
+	var roomCount, migrated, found, invalid, reads int
+	var orphans []string
+	for {
+		doc, err := rooms.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			log.Fatalf("Error reading chat rooms: %v", err)
+		}
+		roomCount++
+
+		chatID, err := primitive.ObjectIDFromHex(doc.Ref.ID)
+		if err != nil {
+			orphans = append(orphans, doc.Ref.ID)
+			continue
+		}
+		count, err := chats.CountDocuments(ctx, bson.M{"_id": chatID})
+		if err != nil {
+			log.Fatalf("Error checking chat %s: %v", doc.Ref.ID, err)
+		}
+		if count == 0 {
+			orphans = append(orphans, doc.Ref.ID)
+			continue
+		}
+
+		raw, _ := doc.Data()["messages"].([]interface{})
+		messages := make([]models.Message, 0, len(raw))
+		for i, entry := range raw {
+			msg, ok := legacyMessage(chatID, i, entry)
+			if !ok {
+				log.Printf("Skipping malformed message %d in chat room %s", i, doc.Ref.ID)
+				invalid++
+				continue
+			}
+			messages = append(messages, msg)
+		}
+
+		positions := legacyReads(doc.Data()["lastRead"], messages)
+
+		if *dryRun {
+			migrated += len(messages)
+			reads += len(positions)
+			continue
+		}
+		inserted, err := db.Messages.Import(ctx, messages)
+		if err != nil {
+			log.Fatalf("Error importing messages of chat %s: %v", doc.Ref.ID, err)
+		}
+		migrated += int(inserted)
+		found += len(messages) - int(inserted)
+
+		for userID, msg := range positions {
+			if _, _, _, err := db.MarkChatRead(ctx, userID, msg); err != nil {
+				log.Fatalf("Error importing read state of chat %s: %v", doc.Ref.ID, err)
+			}
+			reads++
+		}
+	}
+
+	if *dryRun {
+		log.Printf("Dry run: %d messages and %d read positions in %d chat rooms would be migrated, %d malformed, %d rooms without a chat", migrated, reads, roomCount, invalid, len(orphans))
+	} else {
+		log.Printf("Migrated %d messages and %d read positions from %d chat rooms, %d messages already migrated, %d malformed, %d rooms without a chat", migrated, reads, roomCount, found, invalid, len(orphans))
+	}
+	for _, id := range orphans {
+		log.Printf("Chat room without a chat: %s", id)
+	}
+}
+
+// legacyMessage converts an entry of a Firestore messages array. Clients wrote
+// timestamps as RFC 3339 strings, but Firestore timestamps are accepted too.
+func legacyMessage(chatID primitive.ObjectID, index int, entry interface{}) (models.Message, bool) {
+	fields, ok := entry.(map[string]interface{})
+	if !ok {
+		return models.Message{}, false
+	}
+	senderID, _ := fields["senderId"].(string)
+	content, _ := fields["content"].(string)
+	if senderID == "" || content == "" {
+		return models.Message{}, false
+	}
+
+	var timestamp time.Time
+	switch ts := fields["timestamp"].(type) {
+	case string:
+		parsed, err := time.Parse(time.RFC3339, ts)
+		if err != nil {
+			return models.Message{}, false
+		}
+		timestamp = parsed
+	case time.Time:
+		timestamp = ts
+	default:
+		return models.Message{}, false
+	}
+
+	rawID, _ := fields["_id"].(string)
+	id, err := primitive.ObjectIDFromHex(rawID)
+	if err != nil {
+		id = derivedMessageID(chatID, index, rawID, timestamp)
+	}
+
+	return models.Message{
+		ID:        id,
+		ChatID:    chatID,
+		SenderID:  senderID,
+		Content:   content,
+		Timestamp: timestamp.UTC().Truncate(time.Millisecond),
+	}, true
+}
+
+// legacyReads converts the lastRead map of a Firestore chat room, user ID to RFC
+// 3339 time, into the last message each user had read.
+func legacyReads(lastRead interface{}, messages []models.Message) map[primitive.ObjectID]models.Message {
+	entries, _ := lastRead.(map[string]interface{})
+	positions := make(map[primitive.ObjectID]models.Message, len(entries))
+	for rawUserID, value := range entries {
+		userID, err := primitive.ObjectIDFromHex(rawUserID)
+		if err != nil {
+			continue
+		}
+		var readTime time.Time
+		switch ts := value.(type) {
+		case string:
+			if readTime, err = time.Parse(time.RFC3339, ts); err != nil {
+				continue
+			}
+		case time.Time:
+			readTime = ts
+		default:
+			continue
+		}
+
+		var last *models.Message
+		for i := range messages {
+			msg := &messages[i]
+			if msg.Timestamp.After(readTime) {
+				continue
+			}
+			if last == nil || !(models.ChatRead{LastReadAt: last.Timestamp, LastReadMessageID: last.ID}).Covers(*msg) {
+				last = msg
+			}
+		}
+		if last != nil {
+			positions[userID] = *last
+		}
+	}
+	return positions
+}
+
+// derivedMessageID returns an ObjectID for a message whose _id is not one. It
+// carries the message's time like any ObjectID and is the same on every run, so
+// the message is not copied twice.
+func derivedMessageID(chatID primitive.ObjectID, index int, rawID string, timestamp time.Time) primitive.ObjectID {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s/%d/%s", chatID.Hex(), index, rawID)))
+	id := primitive.NewObjectIDFromTimestamp(timestamp)
+	copy(id[4:], sum[:8])
+	return id
+}
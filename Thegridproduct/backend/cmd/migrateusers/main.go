@@ -0,0 +1,149 @@
+// Command migrateusers copies every document from the legacy university_users and
+// highschool_users collections into the single users collection, setting
+// studentType from the collection the user came from. Users keep their _id, so
+// tokens, listings and chats that reference them keep working.
+//
+// The command is safe to run more than once: users already present in the users
+// collection are skipped. Two accounts sharing an email cannot both be moved
+// because of the unique email index; they are reported as conflicts and left in
+// place for manual review. The legacy collections are never modified.
+//
+//	go run ./cmd/migrateusers -dry-run
+//	go run ./cmd/migrateusers
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"Thegridproduct/backend/db"
+
+	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// legacyCollections maps each legacy collection to the student type of its users.
+var legacyCollections = []struct {
+	name        string
+	studentType string
+}{
+	{"university_users", "university"},
+	{"highschool_users", "highschool"},
+}
+
+// conflict describes a legacy user that could not be moved because its email is taken.
+type conflict struct {
+	email      string
+	collection string
+	id         interface{}
+	existingID interface{}
+}
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report what would be migrated without writing anything")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("Error loading .env file, proceeding with system environment variables")
+	}
+
+	db.ConnectDB()
+	defer db.DisconnectDB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	users := db.GetCollection("gridlyapp", db.UsersCollection)
+
+	// Emails claimed during this run, so dry runs also catch conflicts between the two legacy collections.
+	claimed := map[string]interface{}{}
+	var migrated, skipped int
+	var conflicts []conflict
+
+	for _, legacy := range legacyCollections {
+		cursor, err := db.GetCollection("gridlyapp", legacy.name).Find(ctx, bson.M{})
+		if err != nil {
+			log.Fatalf("Error reading %s: %v", legacy.name, err)
+		}
+
+		for cursor.Next(ctx) {
+			var doc bson.M
+			if err := cursor.Decode(&doc); err != nil {
+				log.Printf("Error decoding document in %s: %v", legacy.name, err)
+				continue
+			}
+			id := doc["_id"]
+			email, _ := doc["email"].(string)
+
+			if studentType, _ := doc["studentType"].(string); studentType == "" {
+				doc["studentType"] = legacy.studentType
+			}
+
+			// Already migrated by a previous run.
+			err := users.FindOne(ctx, bson.M{"_id": id}).Err()
+			if err == nil {
+				skipped++
+				claimed[email] = id
+				continue
+			} else if err != mongo.ErrNoDocuments {
+				log.Fatalf("Error checking user %v: %v", id, err)
+			}
+
+			existingID, taken := claimed[email]
+			if !taken {
+				var existing bson.M
+				err := users.FindOne(ctx, bson.M{"email": email}).Decode(&existing)
+				if err == nil {
+					existingID, taken = existing["_id"], true
+				} else if err != mongo.ErrNoDocuments {
+					log.Fatalf("Error checking email %s: %v", email, err)
+				}
+			}
+			if taken {
+				conflicts = append(conflicts, conflict{email, legacy.name, id, existingID})
+				continue
+			}
+
+			if !*dryRun {
+				if _, err := users.InsertOne(ctx, doc); err != nil {
+					if mongo.IsDuplicateKeyError(err) {
+						conflicts = append(conflicts, conflict{email, legacy.name, id, nil})
+						continue
+					}
+					log.Fatalf("Error inserting user %v: %v", id, err)
+				}
+			}
+			claimed[email] = id
+			migrated++
+		}
+		if err := cursor.Err(); err != nil {
+			log.Fatalf("Error iterating %s: %v", legacy.name, err)
+		}
+		cursor.Close(ctx)
+	}
+
+	if *dryRun {
+		log.Printf("Dry run: %d users would be migrated, %d already migrated, %d conflicts", migrated, skipped, len(conflicts))
+	} else {
+		log.Printf("Migrated %d users, %d already migrated, %d conflicts", migrated, skipped, len(conflicts))
+	}
+	for _, c := range conflicts {
+		log.Printf("Conflict: %s from %s (%s) clashes with existing user %s", c.email, c.collection, hexID(c.id), hexID(c.existingID))
+	}
+}
+
+// hexID formats a document ID for the report.
+func hexID(id interface{}) string {
+	switch v := id.(type) {
+	case primitive.ObjectID:
+		return v.Hex()
+	case nil:
+		return "unknown"
+	default:
+		return "?"
+	}
+}
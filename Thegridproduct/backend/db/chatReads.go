@@ -0,0 +1,90 @@
+package db
+
+import (
+	"Thegridproduct/backend/models"
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MarkChatRead moves the read position of a user in a chat forward to msg. It never
+// moves back, so out of order requests are harmless. It returns the stored position,
+// whether it changed and, when it did, the position it replaced, which is nil if the
+// user had not read the chat before.
+func MarkChatRead(ctx context.Context, userID primitive.ObjectID, msg models.Message) (*models.ChatRead, bool, *models.ChatRead, error) {
+	col := GetCollection("gridlyapp", "chat_reads")
+
+	filter := bson.M{
+		"chatId": msg.ChatID,
+		"userId": userID,
+		"$or": []bson.M{
+			{"lastReadAt": bson.M{"$lt": msg.Timestamp}},
+			{"lastReadAt": msg.Timestamp, "lastReadMessageId": bson.M{"$lt": msg.ID}},
+		},
+	}
+	readAt := time.Now().UTC().Truncate(time.Millisecond)
+	update := bson.M{"$set": bson.M{
+		"lastReadMessageId": msg.ID,
+		"lastReadAt":        msg.Timestamp,
+		"readAt":            readAt,
+	}}
+	// Return the replaced position, so callers know which messages were newly read
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)
+
+	var previous models.ChatRead
+	err := col.FindOneAndUpdate(ctx, filter, update, opts).Decode(&previous)
+	if err == nil || err == mongo.ErrNoDocuments {
+		read := models.ChatRead{
+			ID:                previous.ID,
+			ChatID:            msg.ChatID,
+			UserID:            userID,
+			LastReadMessageID: msg.ID,
+			LastReadAt:        msg.Timestamp,
+			ReadAt:            readAt,
+		}
+		if err == mongo.ErrNoDocuments {
+			// Upserted: the user had not read the chat before
+			return &read, true, nil, nil
+		}
+		return &read, true, &previous, nil
+	}
+	// The upsert collides with the unique index when the user already read further.
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, false, nil, fmt.Errorf("error marking chat read: %v", err)
+	}
+	var read models.ChatRead
+	if err := col.FindOne(ctx, bson.M{"chatId": msg.ChatID, "userId": userID}).Decode(&read); err != nil {
+		return nil, false, nil, fmt.Errorf("error fetching read state: %v", err)
+	}
+	return &read, false, nil, nil
+}
+
+// GetChatReads returns the read positions of the participants of a chat who read it.
+func GetChatReads(ctx context.Context, chatID primitive.ObjectID) ([]models.ChatRead, error) {
+	col := GetCollection("gridlyapp", "chat_reads")
+
+	cursor, err := col.Find(ctx, bson.M{"chatId": chatID})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching read state: %v", err)
+	}
+	var reads []models.ChatRead
+	if err := cursor.All(ctx, &reads); err != nil {
+		return nil, fmt.Errorf("error decoding read state: %v", err)
+	}
+	return reads, nil
+}
+
+// DeleteChatReads removes the read positions of a chat.
+func DeleteChatReads(ctx context.Context, chatID primitive.ObjectID) error {
+	col := GetCollection("gridlyapp", "chat_reads")
+
+	if _, err := col.DeleteMany(ctx, bson.M{"chatId": chatID}); err != nil {
+		return fmt.Errorf("error deleting read state: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package db
+
+import (
+	"Thegridproduct/backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrDataExportNotFound is returned when no data export matches the lookup.
+var ErrDataExportNotFound = errors.New("data export not found")
+
+// dataExportBucket is the GridFS bucket holding export archives.
+const dataExportBucket = "data_exports"
+
+// DataExportBucket returns the GridFS bucket export archives are stored in.
+func DataExportBucket() (*gridfs.Bucket, error) {
+	return gridfs.NewBucket(MongoDBClient.Database("gridlyapp"), options.GridFSBucket().SetName(dataExportBucket))
+}
+
+// CreateDataExport stores a new pending export.
+func CreateDataExport(ctx context.Context, export *models.DataExport) error {
+	col := GetCollection("gridlyapp", "data_exports")
+
+	if export.ID.IsZero() {
+		export.ID = primitive.NewObjectID()
+	}
+	if export.CreatedAt.IsZero() {
+		export.CreatedAt = time.Now()
+	}
+	if export.UpdatedAt.IsZero() {
+		export.UpdatedAt = export.CreatedAt
+	}
+	if export.Status == "" {
+		export.Status = models.ExportStatusPending
+	}
+
+	if _, err := col.InsertOne(ctx, export); err != nil {
+		return fmt.Errorf("failed to create data export: %v", err)
+	}
+	return nil
+}
+
+// GetDataExport returns the export with the given ID if it belongs to the user.
+func GetDataExport(ctx context.Context, id, userID primitive.ObjectID) (*models.DataExport, error) {
+	return findDataExport(ctx, bson.M{"_id": id, "userId": userID})
+}
+
+// FindActiveDataExport returns the user's export that is still being built, if any.
+// Exports that have not moved since staleBefore do not count.
+func FindActiveDataExport(ctx context.Context, userID primitive.ObjectID, staleBefore time.Time) (*models.DataExport, error) {
+	return findDataExport(ctx, bson.M{
+		"userId": userID,
+		"status": bson.M{"$in": []string{models.ExportStatusPending, models.ExportStatusProcessing}},
+		"$nor":   []bson.M{lastUpdatedBefore(staleBefore)},
+	})
+}
+
+// FailStaleDataExports marks the exports matching filter that are still pending or
+// processing but have not moved since staleBefore as failed. It returns how many it
+// marked.
+func FailStaleDataExports(ctx context.Context, filter bson.M, staleBefore time.Time) (int, error) {
+	col := GetCollection("gridlyapp", "data_exports")
+
+	res, err := col.UpdateMany(ctx,
+		bson.M{"$and": []bson.M{
+			filter,
+			{"status": bson.M{"$in": []string{models.ExportStatusPending, models.ExportStatusProcessing}}},
+			lastUpdatedBefore(staleBefore),
+		}},
+		bson.M{"$set": bson.M{
+			"status":    models.ExportStatusFailed,
+			"error":     "The archive could not be generated. Please try again later.",
+			"updatedAt": time.Now(),
+		}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fail stale data exports: %v", err)
+	}
+	return int(res.ModifiedCount), nil
+}
+
+// lastUpdatedBefore matches exports last updated before t. Exports created before
+// updatedAt was recorded go by their creation time.
+func lastUpdatedBefore(t time.Time) bson.M {
+	return bson.M{"$or": []bson.M{
+		{"updatedAt": bson.M{"$lt": t}},
+		{"updatedAt": bson.M{"$exists": false}, "createdAt": bson.M{"$lt": t}},
+	}}
+}
+
+func findDataExport(ctx context.Context, filter bson.M) (*models.DataExport, error) {
+	col := GetCollection("gridlyapp", "data_exports")
+
+	var export models.DataExport
+	if err := col.FindOne(ctx, filter).Decode(&export); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrDataExportNotFound
+		}
+		return nil, fmt.Errorf("error fetching data export: %v", err)
+	}
+	return &export, nil
+}
+
+// UpdateDataExport sets the given fields on an export that is still in one of the
+// given states, or in any state when none are given. It returns
+// ErrDataExportNotFound when no such export exists.
+func UpdateDataExport(ctx context.Context, id primitive.ObjectID, fields bson.M, states ...string) error {
+	col := GetCollection("gridlyapp", "data_exports")
+
+	filter := bson.M{"_id": id}
+	if len(states) > 0 {
+		filter["status"] = bson.M{"$in": states}
+	}
+	set := bson.M{"updatedAt": time.Now()}
+	for k, v := range fields {
+		set[k] = v
+	}
+	res, err := col.UpdateOne(ctx, filter, bson.M{"$set": set})
+	if err != nil {
+		return fmt.Errorf("failed to update data export: %v", err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrDataExportNotFound
+	}
+	return nil
+}
+
+// DeleteDataExports removes the exports matching the filter together with their
+// archives, and returns how many it removed.
+func DeleteDataExports(ctx context.Context, filter bson.M) (int, error) {
+	col := GetCollection("gridlyapp", "data_exports")
+
+	cursor, err := col.Find(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("error fetching data exports: %v", err)
+	}
+	var exports []models.DataExport
+	if err := cursor.All(ctx, &exports); err != nil {
+		return 0, fmt.Errorf("error decoding data exports: %v", err)
+	}
+	if len(exports) == 0 {
+		return 0, nil
+	}
+
+	bucket, err := DataExportBucket()
+	if err != nil {
+		return 0, fmt.Errorf("error opening export bucket: %v", err)
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(exports))
+	for _, export := range exports {
+		if !export.FileID.IsZero() {
+			if err := bucket.DeleteContext(ctx, export.FileID); err != nil && err != gridfs.ErrFileNotFound {
+				return 0, fmt.Errorf("error deleting export archive %s: %v", export.FileID.Hex(), err)
+			}
+		}
+		ids = append(ids, export.ID)
+	}
+
+	res, err := col.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, fmt.Errorf("error deleting data exports: %v", err)
+	}
+	return int(res.DeletedCount), nil
+}
@@ -42,6 +42,8 @@ func ConnectDB() {
 
 	log.Println("Connected to MongoDB successfully")
 	MongoDBClient = client
+	Users = NewMongoUserRepository(client.Database("gridlyapp"))
+	Messages = NewMongoMessageStore(client.Database("gridlyapp"))
 
 	// Create any needed indexes
 	if err := setupIndexes(ctx); err != nil {
@@ -49,28 +51,206 @@ func ConnectDB() {
 	}
 }
 
-// setupIndexes creates necessary indexes for the chats collection
+// setupIndexes creates necessary indexes for the collections that are queried by key
 func setupIndexes(ctx context.Context) error {
-	collection := GetCollection("gridlyapp", "chats")
-
-	indexes := []mongo.IndexModel{
-		{
-			Keys:    bson.D{{Key: "buyerId", Value: 1}},
-			Options: options.Index().SetName("buyerId_index"),
+	indexes := map[string][]mongo.IndexModel{
+		"chats": {
+			{
+				Keys:    bson.D{{Key: "buyerId", Value: 1}},
+				Options: options.Index().SetName("buyerId_index"),
+			},
+			{
+				Keys:    bson.D{{Key: "sellerId", Value: 1}},
+				Options: options.Index().SetName("sellerId_index"),
+			},
+			{
+				Keys:    bson.D{{Key: "productId", Value: 1}},
+				Options: options.Index().SetName("productId_index"),
+			},
+		},
+		MessagesCollection: {
+			{
+				// A chat's history is read in timestamp order
+				Keys:    bson.D{{Key: "chatId", Value: 1}, {Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}},
+				Options: options.Index().SetName("chatId_timestamp_index"),
+			},
+		},
+		"chat_reads": {
+			{
+				// One read position per participant
+				Keys:    bson.D{{Key: "chatId", Value: 1}, {Key: "userId", Value: 1}},
+				Options: options.Index().SetName("chatId_userId_index").SetUnique(true),
+			},
+		},
+		"inbox": {
+			{
+				Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "chatId", Value: 1}},
+				Options: options.Index().SetName("userId_chatId_index").SetUnique(true),
+			},
+			{
+				// Used to update both participants of a chat
+				Keys:    bson.D{{Key: "chatId", Value: 1}},
+				Options: options.Index().SetName("chatId_index"),
+			},
+		},
+		// Feed indexes: the filter fields first, then the sort field and _id so
+		// cursor pagination can walk the index in order.
+		"products": {
+			{
+				Keys:    bson.D{{Key: "university", Value: 1}, {Key: "status", Value: 1}, {Key: "postedDate", Value: -1}, {Key: "_id", Value: -1}},
+				Options: options.Index().SetName("feed_newest_index"),
+			},
+			{
+				Keys:    bson.D{{Key: "university", Value: 1}, {Key: "status", Value: 1}, {Key: "price", Value: 1}, {Key: "_id", Value: 1}},
+				Options: options.Index().SetName("feed_price_index"),
+			},
+			{
+				Keys:    bson.D{{Key: "university", Value: 1}, {Key: "status", Value: 1}, {Key: "likeCount", Value: -1}, {Key: "_id", Value: -1}},
+				Options: options.Index().SetName("feed_most_liked_index"),
+			},
+			{
+				// Out-of-campus mode does not filter by university
+				Keys:    bson.D{{Key: "status", Value: 1}, {Key: "postedDate", Value: -1}, {Key: "_id", Value: -1}},
+				Options: options.Index().SetName("status_newest_index"),
+			},
+			{
+				// Used by the expiry and reminder jobs
+				Keys:    bson.D{{Key: "status", Value: 1}, {Key: "expired", Value: 1}, {Key: "expiresAt", Value: 1}},
+				Options: options.Index().SetName("status_expiresAt_index"),
+			},
+			{
+				// Used by product search; a collection can only have one text index
+				Keys: bson.D{{Key: "title", Value: "text"}, {Key: "description", Value: "text"}, {Key: "selectedTags", Value: "text"}},
+				Options: options.Index().SetName("search_text_index").
+					SetWeights(bson.D{{Key: "title", Value: 10}, {Key: "selectedTags", Value: 5}, {Key: "description", Value: 1}}),
+			},
+		},
+		"gigs": {
+			{
+				Keys:    bson.D{{Key: "status", Value: 1}, {Key: "expired", Value: 1}, {Key: "postedDate", Value: -1}, {Key: "_id", Value: -1}},
+				Options: options.Index().SetName("feed_newest_index"),
+			},
+			{
+				Keys:    bson.D{{Key: "status", Value: 1}, {Key: "expired", Value: 1}, {Key: "likeCount", Value: -1}, {Key: "_id", Value: -1}},
+				Options: options.Index().SetName("feed_most_liked_index"),
+			},
+		},
+		"product_requests": {
+			{
+				Keys:    bson.D{{Key: "institution", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}},
+				Options: options.Index().SetName("feed_newest_index"),
+			},
+		},
+		UsersCollection: {
+			{
+				Keys:    bson.D{{Key: "email", Value: 1}},
+				Options: options.Index().SetName("email_unique").SetUnique(true),
+			},
+		},
+		"sessions": {
+			{
+				Keys:    bson.D{{Key: "userId", Value: 1}},
+				Options: options.Index().SetName("userId_index"),
+			},
+			{
+				Keys:    bson.D{{Key: "refreshTokenHash", Value: 1}},
+				Options: options.Index().SetName("refreshTokenHash_index"),
+			},
+			{
+				Keys:    bson.D{{Key: "previousTokenHash", Value: 1}},
+				Options: options.Index().SetName("previousTokenHash_index").SetSparse(true),
+			},
+			{
+				// Let MongoDB drop sessions once the refresh token can no longer be used
+				Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+				Options: options.Index().SetName("expiresAt_ttl").SetExpireAfterSeconds(0),
+			},
 		},
-		{
-			Keys:    bson.D{{Key: "sellerId", Value: 1}},
-			Options: options.Index().SetName("sellerId_index"),
+		"institutions": {
+			{
+				Keys:    bson.D{{Key: "normalizedName", Value: 1}},
+				Options: options.Index().SetName("normalizedName_unique").SetUnique(true),
+			},
+			{
+				Keys:    bson.D{{Key: "normalizedAliases", Value: 1}},
+				Options: options.Index().SetName("normalizedAliases_index"),
+			},
 		},
-		{
-			Keys:    bson.D{{Key: "productId", Value: 1}},
-			Options: options.Index().SetName("productId_index"),
+		"auth_attempts": {
+			{
+				// Counters are only useful while their window is open
+				Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+				Options: options.Index().SetName("expiresAt_ttl").SetExpireAfterSeconds(0),
+			},
+		},
+		"data_exports": {
+			{
+				Keys:    bson.D{{Key: "userId", Value: 1}},
+				Options: options.Index().SetName("userId_index"),
+			},
+			{
+				// Used to find stuck and expired exports
+				Keys:    bson.D{{Key: "status", Value: 1}, {Key: "updatedAt", Value: 1}},
+				Options: options.Index().SetName("status_updatedAt_index"),
+			},
+		},
+		"chat_requests": {
+			{
+				// Used to purge requests nobody answered
+				Keys:    bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: 1}},
+				Options: options.Index().SetName("status_createdAt_index"),
+			},
+			{
+				// Used to count the pending requests a seller received
+				Keys:    bson.D{{Key: "sellerId", Value: 1}, {Key: "status", Value: 1}},
+				Options: options.Index().SetName("sellerId_status_index"),
+			},
+		},
+		"pending_users": {
+			{
+				Keys:    bson.D{{Key: "email", Value: 1}},
+				Options: options.Index().SetName("email_index"),
+			},
+			{
+				Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+				Options: options.Index().SetName("expiresAt_index"),
+			},
+		},
+		"uploads": {
+			{
+				// Image references are checked by owner and URL
+				Keys:    bson.D{{Key: "userId", Value: 1}, {Key: "url", Value: 1}},
+				Options: options.Index().SetName("userId_url_index"),
+			},
+		},
+		"job_runs": {
+			{
+				Keys:    bson.D{{Key: "job", Value: 1}, {Key: "startedAt", Value: -1}},
+				Options: options.Index().SetName("job_startedAt_index"),
+			},
+			{
+				// Keep a month of run history
+				Keys:    bson.D{{Key: "startedAt", Value: 1}},
+				Options: options.Index().SetName("startedAt_ttl").SetExpireAfterSeconds(30 * 24 * 60 * 60),
+			},
+		},
+		"password_resets": {
+			{
+				Keys:    bson.D{{Key: "email", Value: 1}},
+				Options: options.Index().SetName("email_index"),
+			},
+			{
+				Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+				Options: options.Index().SetName("expiresAt_ttl").SetExpireAfterSeconds(0),
+			},
 		},
 	}
 
-	_, err := collection.Indexes().CreateMany(ctx, indexes)
-	if err != nil {
-		return fmt.Errorf("error creating indexes: %v", err)
+	for collectionName, indexModels := range indexes {
+		collection := GetCollection("gridlyapp", collectionName)
+		if _, err := collection.Indexes().CreateMany(ctx, indexModels); err != nil {
+			return fmt.Errorf("error creating indexes for %s: %v", collectionName, err)
+		}
 	}
 
 	log.Println("Indexes created successfully")
@@ -201,29 +381,6 @@ func FindChatsByUser(userID string) ([]models.Chat, error) {
 	return chats, nil
 }
 
-// AddMessageToChat pushes a new message into the messages array of the chat, using a string chatID
-func AddMessageToChat(chatID string, message models.Message) error {
-	col := GetCollection("gridlyapp", "chats")
-
-	// Make sure chat exists
-	var chat models.Chat
-	if err := col.FindOne(context.Background(), bson.M{"_id": chatID}).Decode(&chat); err != nil {
-		if err == mongo.ErrNoDocuments {
-			log.Printf("Chat with ID '%s' not found", chatID)
-			return errors.New("chat not found")
-		}
-		log.Printf("Error finding chat '%s': %v", chatID, err)
-		return fmt.Errorf("failed to find chat: %v", err)
-	}
-
-	// Push the message into the existing chat doc
-	update := bson.M{"$push": bson.M{"messages": message}}
-	if _, err := col.UpdateOne(context.Background(), bson.M{"_id": chatID}, update); err != nil {
-		log.Printf("Error adding message to chat '%s': %v", chatID, err)
-		return fmt.Errorf("failed to add message: %v", err)
-	}
-	return nil
-}
 func GetChatByID(chatID string) (*models.Chat, error) {
 	col := GetCollection("gridlyapp", "chats")
 
@@ -273,28 +430,8 @@ func GetChatByReferenceID(referenceIDStr, referenceType string) (*models.Chat, e
 	return &chat, nil
 }
 
-// GetUserByID attempts to find a user in both university_users and highschool_users by string userID
+// GetUserByID finds a user by string userID
 func GetUserByID(userID string) (*models.User, error) {
-	// Attempt in 'university_users' first
-	user, err := findUserInCollection("gridlyapp", "university_users", userID)
-	if err == nil {
-		return user, nil
-	}
-
-	// If not found, attempt in 'highschool_users'
-	user, err = findUserInCollection("gridlyapp", "highschool_users", userID)
-	if err == nil {
-		return user, nil
-	}
-
-	log.Printf("User with ID '%s' not found in any user collection", userID)
-	return nil, errors.New("user not found")
-}
-
-// findUserInCollection is a helper that queries a single collection by string userID
-func findUserInCollection(dbName, collName, userID string) (*models.User, error) {
-	col := GetCollection(dbName, collName)
-
 	// Convert the hex string to objectID for the user doc
 	objID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
@@ -302,15 +439,11 @@ func findUserInCollection(dbName, collName, userID string) (*models.User, error)
 		return nil, fmt.Errorf("invalid user ID format: %v", err)
 	}
 
-	var usr models.User
-	if err := col.FindOne(context.Background(), bson.M{"_id": objID}).Decode(&usr); err != nil {
-		if err == mongo.ErrNoDocuments {
-			// Not found in this particular collection
-			return nil, errors.New("user not found")
-		}
-		return nil, fmt.Errorf("error fetching user: %v", err)
+	user, err := Users.GetByID(context.Background(), objID)
+	if err == ErrUserNotFound {
+		log.Printf("User with ID '%s' not found", userID)
 	}
-	return &usr, nil
+	return user, err
 }
 
 // GetProductRequestByID fetches a product request by its ID.
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"Thegridproduct/backend/models"
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RecordInboxMessage updates the inbox entries of both participants of a chat for a
+// new message: it becomes their latest message unless a later one got there first,
+// and counts as unread for the participant who did not send it. Chats get their
+// entries from SeedChatInbox when they are created; participants of older chats
+// without an entry are skipped, and BackfillInboxEntry adds the messages they missed
+// once their inbox is read.
+func RecordInboxMessage(ctx context.Context, chat *models.Chat, msg models.Message) error {
+	col := GetCollection("gridlyapp", "inbox")
+
+	recipientID := chat.BuyerID
+	if msg.SenderID == chat.BuyerID.Hex() {
+		recipientID = chat.SellerID
+	}
+
+	updates := []mongo.WriteModel{
+		mongo.NewUpdateManyModel().
+			SetFilter(bson.M{"chatId": chat.ID}).
+			SetUpdate([]bson.M{{"$set": bson.M{"lastMessage": laterMessage(msg)}}}),
+		mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"chatId": chat.ID, "userId": recipientID}).
+			SetUpdate(bson.M{"$inc": bson.M{"unreadCount": 1}}),
+	}
+	if _, err := col.BulkWrite(ctx, updates, options.BulkWrite().SetOrdered(false)); err != nil {
+		return fmt.Errorf("error updating inbox: %v", err)
+	}
+	return nil
+}
+
+// laterMessage is an update expression that keeps the lastMessage of an inbox entry
+// unless msg comes after it in (timestamp, _id) order, so that concurrent sends
+// never move it backwards.
+func laterMessage(msg models.Message) bson.M {
+	return bson.M{"$cond": []interface{}{
+		bson.M{"$or": []interface{}{
+			bson.M{"$lt": []interface{}{"$lastMessage.timestamp", msg.Timestamp}},
+			bson.M{"$and": []interface{}{
+				bson.M{"$eq": []interface{}{"$lastMessage.timestamp", msg.Timestamp}},
+				bson.M{"$lt": []interface{}{"$lastMessage._id", msg.ID}},
+			}},
+		}},
+		bson.M{"$literal": msg},
+		"$lastMessage",
+	}}
+}
+
+// ReadInboxMessages takes count newly read messages off the unread count of a
+// participant's inbox entry, never going below zero. Being a relative update, it
+// does not undo messages RecordInboxMessage counts at the same time.
+func ReadInboxMessages(ctx context.Context, chatID, userID primitive.ObjectID, count int64) error {
+	col := GetCollection("gridlyapp", "inbox")
+
+	_, err := col.UpdateOne(ctx,
+		bson.M{"chatId": chatID, "userId": userID},
+		[]bson.M{{"$set": bson.M{"unreadCount": bson.M{
+			"$max": []interface{}{0, bson.M{"$subtract": []interface{}{"$unreadCount", count}}},
+		}}}},
+	)
+	if err != nil {
+		return fmt.Errorf("error updating inbox: %v", err)
+	}
+	return nil
+}
+
+// SeedChatInbox creates the empty inbox entries of both participants of a new chat,
+// so that every message sent to it is counted from the first one.
+func SeedChatInbox(ctx context.Context, chat *models.Chat) error {
+	for _, userID := range []primitive.ObjectID{chat.BuyerID, chat.SellerID} {
+		if _, err := SeedInboxEntry(ctx, models.InboxEntry{ChatID: chat.ID, UserID: userID}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SeedInboxEntry stores entry unless the participant already has an entry for the
+// chat, which is then left alone. It reports whether entry was stored.
+func SeedInboxEntry(ctx context.Context, entry models.InboxEntry) (bool, error) {
+	col := GetCollection("gridlyapp", "inbox")
+
+	entry.ID = primitive.ObjectID{}
+	res, err := col.UpdateOne(ctx,
+		bson.M{"chatId": entry.ChatID, "userId": entry.UserID},
+		bson.M{"$setOnInsert": entry},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error seeding inbox: %v", err)
+	}
+	return res.UpsertedCount == 1, nil
+}
+
+// BackfillInboxEntry adds unread messages that were sent before a participant's
+// entry existed to its unread count, and makes lastMessage its latest message
+// unless RecordInboxMessage already stored a later one. It returns the updated
+// entry.
+func BackfillInboxEntry(ctx context.Context, chatID, userID primitive.ObjectID, unread int64, lastMessage *models.Message) (*models.InboxEntry, error) {
+	col := GetCollection("gridlyapp", "inbox")
+
+	set := bson.M{"unreadCount": bson.M{"$add": []interface{}{"$unreadCount", unread}}}
+	if lastMessage != nil {
+		set["lastMessage"] = laterMessage(*lastMessage)
+	}
+	var entry models.InboxEntry
+	err := col.FindOneAndUpdate(ctx,
+		bson.M{"chatId": chatID, "userId": userID},
+		[]bson.M{{"$set": set}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&entry)
+	if err != nil {
+		return nil, fmt.Errorf("error backfilling inbox: %v", err)
+	}
+	return &entry, nil
+}
+
+// GetInboxEntry returns the inbox entry of a participant for a chat.
+func GetInboxEntry(ctx context.Context, chatID, userID primitive.ObjectID) (*models.InboxEntry, error) {
+	col := GetCollection("gridlyapp", "inbox")
+
+	var entry models.InboxEntry
+	if err := col.FindOne(ctx, bson.M{"chatId": chatID, "userId": userID}).Decode(&entry); err != nil {
+		return nil, fmt.Errorf("error fetching inbox entry: %v", err)
+	}
+	return &entry, nil
+}
+
+// GetInbox returns the inbox entries of a user.
+func GetInbox(ctx context.Context, userID primitive.ObjectID) ([]models.InboxEntry, error) {
+	col := GetCollection("gridlyapp", "inbox")
+
+	cursor, err := col.Find(ctx, bson.M{"userId": userID})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching inbox: %v", err)
+	}
+	var entries []models.InboxEntry
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, fmt.Errorf("error decoding inbox: %v", err)
+	}
+	return entries, nil
+}
+
+// DeleteInboxEntries removes the inbox entries of a chat.
+func DeleteInboxEntries(ctx context.Context, chatID primitive.ObjectID) error {
+	col := GetCollection("gridlyapp", "inbox")
+
+	if _, err := col.DeleteMany(ctx, bson.M{"chatId": chatID}); err != nil {
+		return fmt.Errorf("error deleting inbox entries: %v", err)
+	}
+	return nil
+}
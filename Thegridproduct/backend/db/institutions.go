@@ -0,0 +1,192 @@
+package db
+
+import (
+	"Thegridproduct/backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInstitutionNotFound is returned when no registry entry matches the lookup.
+var ErrInstitutionNotFound = errors.New("institution not found")
+
+// NormalizeInstitutionName lowercases a name and collapses whitespace so that
+// "UC  Berkeley" and "uc berkeley" resolve to the same registry entry.
+func NormalizeInstitutionName(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
+
+// NormalizeEmailDomain lowercases a domain and strips a leading "@" or ".".
+func NormalizeEmailDomain(domain string) string {
+	return strings.TrimLeft(strings.ToLower(strings.TrimSpace(domain)), "@.")
+}
+
+// prepareInstitution fills the normalized lookup fields from the display fields.
+func prepareInstitution(inst *models.Institution) {
+	inst.Name = strings.TrimSpace(inst.Name)
+	inst.NormalizedName = NormalizeInstitutionName(inst.Name)
+
+	aliases := []string{}
+	normalizedAliases := []string{}
+	for _, alias := range inst.Aliases {
+		alias = strings.TrimSpace(alias)
+		if alias == "" {
+			continue
+		}
+		aliases = append(aliases, alias)
+		normalizedAliases = append(normalizedAliases, NormalizeInstitutionName(alias))
+	}
+	inst.Aliases = aliases
+	inst.NormalizedAliases = normalizedAliases
+
+	domains := []string{}
+	for _, domain := range inst.EmailDomains {
+		if d := NormalizeEmailDomain(domain); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	inst.EmailDomains = domains
+}
+
+// FindInstitutionByName resolves a canonical name or alias to its registry entry.
+func FindInstitutionByName(ctx context.Context, name string) (*models.Institution, error) {
+	normalized := NormalizeInstitutionName(name)
+	if normalized == "" {
+		return nil, ErrInstitutionNotFound
+	}
+
+	col := GetCollection("gridlyapp", "institutions")
+	filter := bson.M{"$or": []bson.M{
+		{"normalizedName": normalized},
+		{"normalizedAliases": normalized},
+	}}
+
+	var inst models.Institution
+	if err := col.FindOne(ctx, filter).Decode(&inst); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrInstitutionNotFound
+		}
+		return nil, fmt.Errorf("error fetching institution: %v", err)
+	}
+	return &inst, nil
+}
+
+// GetInstitutionByID loads a registry entry by its ObjectID.
+func GetInstitutionByID(ctx context.Context, id primitive.ObjectID) (*models.Institution, error) {
+	col := GetCollection("gridlyapp", "institutions")
+
+	var inst models.Institution
+	if err := col.FindOne(ctx, bson.M{"_id": id}).Decode(&inst); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrInstitutionNotFound
+		}
+		return nil, fmt.Errorf("error fetching institution: %v", err)
+	}
+	return &inst, nil
+}
+
+// ListInstitutions returns every registry entry sorted by name, optionally limited to a student type.
+func ListInstitutions(ctx context.Context, studentType string) ([]models.Institution, error) {
+	col := GetCollection("gridlyapp", "institutions")
+
+	filter := bson.M{}
+	if studentType != "" {
+		filter["studentType"] = studentType
+	}
+
+	cursor, err := col.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching institutions: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	institutions := []models.Institution{}
+	if err := cursor.All(ctx, &institutions); err != nil {
+		return nil, fmt.Errorf("error decoding institutions: %v", err)
+	}
+	return institutions, nil
+}
+
+// CreateInstitution inserts a new registry entry.
+func CreateInstitution(ctx context.Context, inst *models.Institution) error {
+	col := GetCollection("gridlyapp", "institutions")
+
+	prepareInstitution(inst)
+	inst.ID = primitive.NewObjectID()
+	inst.CreatedAt = time.Now()
+	inst.UpdatedAt = inst.CreatedAt
+
+	if _, err := col.InsertOne(ctx, inst); err != nil {
+		return fmt.Errorf("failed to create institution: %v", err)
+	}
+	return nil
+}
+
+// ReplaceInstitution overwrites the editable fields of an existing registry entry.
+func ReplaceInstitution(ctx context.Context, inst *models.Institution) error {
+	col := GetCollection("gridlyapp", "institutions")
+
+	prepareInstitution(inst)
+	inst.UpdatedAt = time.Now()
+
+	update := bson.M{"$set": bson.M{
+		"name":              inst.Name,
+		"normalizedName":    inst.NormalizedName,
+		"aliases":           inst.Aliases,
+		"normalizedAliases": inst.NormalizedAliases,
+		"emailDomains":      inst.EmailDomains,
+		"studentType":       inst.StudentType,
+		"updatedAt":         inst.UpdatedAt,
+	}}
+
+	res, err := col.UpdateOne(ctx, bson.M{"_id": inst.ID}, update)
+	if err != nil {
+		return fmt.Errorf("failed to update institution: %v", err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrInstitutionNotFound
+	}
+	return nil
+}
+
+// DeleteInstitution removes a registry entry.
+func DeleteInstitution(ctx context.Context, id primitive.ObjectID) error {
+	col := GetCollection("gridlyapp", "institutions")
+
+	res, err := col.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete institution: %v", err)
+	}
+	if res.DeletedCount == 0 {
+		return ErrInstitutionNotFound
+	}
+	return nil
+}
+
+// EmailAllowedForInstitution reports whether the email's domain (or a subdomain of it)
+// is one of the institution's allowed domains. Institutions without domains accept no email.
+func EmailAllowedForInstitution(email string, inst *models.Institution) bool {
+	if len(inst.EmailDomains) == 0 {
+		return false
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 || at == len(email)-1 {
+		return false
+	}
+	domain := NormalizeEmailDomain(email[at+1:])
+
+	for _, allowed := range inst.EmailDomains {
+		if domain == allowed || strings.HasSuffix(domain, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package db
+
+import (
+	"testing"
+
+	"Thegridproduct/backend/models"
+)
+
+func TestEmailAllowedForInstitution(t *testing.T) {
+	berkeley := &models.Institution{Name: "UC Berkeley", EmailDomains: []string{"berkeley.edu"}}
+	tests := []struct {
+		name  string
+		email string
+		inst  *models.Institution
+		want  bool
+	}{
+		{"exact domain", "sam@berkeley.edu", berkeley, true},
+		{"subdomain", "sam@eecs.berkeley.edu", berkeley, true},
+		{"mixed case", "Sam@Berkeley.EDU", berkeley, true},
+		{"other domain", "sam@stanford.edu", berkeley, false},
+		{"lookalike suffix", "sam@notberkeley.edu", berkeley, false},
+		{"no domain", "sam@", berkeley, false},
+		{"no at sign", "berkeley.edu", berkeley, false},
+		{"institution without domains", "sam@berkeley.edu", &models.Institution{Name: "Unconfigured"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EmailAllowedForInstitution(tt.email, tt.inst); got != tt.want {
+				t.Errorf("EmailAllowedForInstitution(%q) = %v, want %v", tt.email, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+package db
+
+import (
+	"Thegridproduct/backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MessagesCollection holds chat messages, one document per message.
+const MessagesCollection = "messages"
+
+// MessageStore is the only way handlers read and write chat messages.
+type MessageStore interface {
+	// Append stores a new message, filling in its ID and timestamp when unset.
+	Append(ctx context.Context, msg *models.Message) error
+	// List returns the messages of a chat selected by query, and whether more
+	// messages matched than query.Limit allowed. It returns ErrMessageNotFound when
+	// query.Before or query.After is not a message of the chat.
+	List(ctx context.Context, chatID primitive.ObjectID, query MessageQuery) ([]models.Message, bool, error)
+	// Latest returns the newest message of each of the chats that has one.
+	Latest(ctx context.Context, chatIDs []primitive.ObjectID) (map[primitive.ObjectID]models.Message, error)
+	// Get returns a message of a chat, or ErrMessageNotFound.
+	Get(ctx context.Context, chatID, id primitive.ObjectID) (*models.Message, error)
+	// CountSince counts the messages of a chat ordered after the message sinceID sent
+	// at since, leaving out those sent by excludeSender. A zero since counts them all.
+	CountSince(ctx context.Context, chatID primitive.ObjectID, since time.Time, sinceID primitive.ObjectID, excludeSender string) (int64, error)
+	// CountBetween is CountSince limited to the messages ordered at or before the
+	// message untilID sent at until.
+	CountBetween(ctx context.Context, chatID primitive.ObjectID, since time.Time, sinceID primitive.ObjectID, until time.Time, untilID primitive.ObjectID, excludeSender string) (int64, error)
+	// Import stores existing messages under their own IDs. Messages that are already
+	// stored are left alone, so importing twice is harmless. It returns how many
+	// messages were new.
+	Import(ctx context.Context, msgs []models.Message) (int64, error)
+	// DeleteChat removes every message of a chat.
+	DeleteChat(ctx context.Context, chatID primitive.ObjectID) error
+}
+
+// Messages is the store handlers use; it is set up by ConnectDB.
+var Messages MessageStore
+
+// ErrMessageNotFound is returned when a message used as a cursor does not exist in the chat.
+var ErrMessageNotFound = errors.New("message not found")
+
+// MessageQuery selects messages of a chat. Messages are ordered by timestamp, ties
+// broken by _id.
+type MessageQuery struct {
+	// Before and After, when set, only select messages older or newer than the
+	// message with that ID.
+	Before primitive.ObjectID
+	After  primitive.ObjectID
+
+	// Limit caps the number of messages; zero selects all of them. The messages
+	// closest to After are picked when it is set, otherwise those closest to
+	// Before, or the newest ones.
+	Limit int64
+
+	// Ascending returns the messages oldest first instead of newest first.
+	Ascending bool
+}
+
+// mongoMessageStore keeps messages in the messages collection, indexed by chat
+// and timestamp.
+type mongoMessageStore struct {
+	col *mongo.Collection
+}
+
+// NewMongoMessageStore returns a MessageStore backed by the messages collection of the given database.
+func NewMongoMessageStore(database *mongo.Database) MessageStore {
+	return &mongoMessageStore{col: database.Collection(MessagesCollection)}
+}
+
+func (s *mongoMessageStore) Append(ctx context.Context, msg *models.Message) error {
+	if msg.ID.IsZero() {
+		msg.ID = primitive.NewObjectID()
+	}
+	if msg.Timestamp.IsZero() {
+		// MongoDB keeps milliseconds; truncating keeps the returned message identical
+		// to the stored one.
+		msg.Timestamp = time.Now().UTC().Truncate(time.Millisecond)
+	}
+	if _, err := s.col.InsertOne(ctx, msg); err != nil {
+		return fmt.Errorf("error storing message: %v", err)
+	}
+	return nil
+}
+
+func (s *mongoMessageStore) List(ctx context.Context, chatID primitive.ObjectID, query MessageQuery) ([]models.Message, bool, error) {
+	conditions := []bson.M{{"chatId": chatID}}
+	for _, bound := range []struct {
+		id primitive.ObjectID
+		op string
+	}{{query.Before, "$lt"}, {query.After, "$gt"}} {
+		if bound.id.IsZero() {
+			continue
+		}
+		condition, err := s.positionFilter(ctx, chatID, bound.id, bound.op)
+		if err != nil {
+			return nil, false, err
+		}
+		conditions = append(conditions, condition)
+	}
+
+	// Walk the index away from the cursor, so the limit keeps the messages
+	// closest to it.
+	forward := !query.After.IsZero() || (query.Before.IsZero() && query.Ascending)
+	direction := -1
+	if forward {
+		direction = 1
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: direction}, {Key: "_id", Value: direction}})
+	if query.Limit > 0 {
+		// One extra message tells whether there are more.
+		opts.SetLimit(query.Limit + 1)
+	}
+
+	cursor, err := s.col.Find(ctx, bson.M{"$and": conditions}, opts)
+	if err != nil {
+		return nil, false, fmt.Errorf("error fetching messages: %v", err)
+	}
+	messages := []models.Message{}
+	if err := cursor.All(ctx, &messages); err != nil {
+		return nil, false, fmt.Errorf("error decoding messages: %v", err)
+	}
+
+	more := query.Limit > 0 && int64(len(messages)) > query.Limit
+	if more {
+		messages = messages[:query.Limit]
+	}
+	if forward != query.Ascending {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+	return messages, more, nil
+}
+
+// positionFilter matches the messages ordered before ("$lt") or after ("$gt") the
+// message id of the chat.
+func (s *mongoMessageStore) positionFilter(ctx context.Context, chatID, id primitive.ObjectID, op string) (bson.M, error) {
+	anchor, err := s.Get(ctx, chatID, id)
+	if err != nil {
+		return nil, err
+	}
+	return bson.M{"$or": position(op, anchor.Timestamp, anchor.ID)}, nil
+}
+
+// after matches the messages ordered after the message id sent at timestamp.
+func after(timestamp time.Time, id primitive.ObjectID) []bson.M {
+	return position("$gt", timestamp, id)
+}
+
+// position matches the messages ordered before ("$lt") or after ("$gt") the
+// message id sent at timestamp.
+func position(op string, timestamp time.Time, id primitive.ObjectID) []bson.M {
+	return []bson.M{
+		{"timestamp": bson.M{op: timestamp}},
+		{"timestamp": timestamp, "_id": bson.M{op: id}},
+	}
+}
+
+func (s *mongoMessageStore) Latest(ctx context.Context, chatIDs []primitive.ObjectID) (map[primitive.ObjectID]models.Message, error) {
+	latest := make(map[primitive.ObjectID]models.Message, len(chatIDs))
+	if len(chatIDs) == 0 {
+		return latest, nil
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"chatId": bson.M{"$in": chatIDs}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "chatId", Value: 1}, {Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$chatId", "message": bson.M{"$first": "$$ROOT"}}}},
+	}
+	cursor, err := s.col.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching latest messages: %v", err)
+	}
+	var results []struct {
+		Message models.Message `bson:"message"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, fmt.Errorf("error decoding latest messages: %v", err)
+	}
+	for _, result := range results {
+		latest[result.Message.ChatID] = result.Message
+	}
+	return latest, nil
+}
+
+func (s *mongoMessageStore) Get(ctx context.Context, chatID, id primitive.ObjectID) (*models.Message, error) {
+	var msg models.Message
+	err := s.col.FindOne(ctx, bson.M{"_id": id, "chatId": chatID}).Decode(&msg)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrMessageNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("error fetching message: %v", err)
+	}
+	return &msg, nil
+}
+
+func (s *mongoMessageStore) CountSince(ctx context.Context, chatID primitive.ObjectID, since time.Time, sinceID primitive.ObjectID, excludeSender string) (int64, error) {
+	filter := bson.M{
+		"chatId":   chatID,
+		"senderId": bson.M{"$ne": excludeSender},
+	}
+	if !since.IsZero() {
+		filter["$or"] = after(since, sinceID)
+	}
+	count, err := s.col.CountDocuments(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("error counting messages: %v", err)
+	}
+	return count, nil
+}
+
+func (s *mongoMessageStore) CountBetween(ctx context.Context, chatID primitive.ObjectID, since time.Time, sinceID primitive.ObjectID, until time.Time, untilID primitive.ObjectID, excludeSender string) (int64, error) {
+	filter := bson.M{
+		"chatId":   chatID,
+		"senderId": bson.M{"$ne": excludeSender},
+		"$nor":     after(until, untilID),
+	}
+	if !since.IsZero() {
+		filter["$or"] = after(since, sinceID)
+	}
+	count, err := s.col.CountDocuments(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("error counting messages: %v", err)
+	}
+	return count, nil
+}
+
+func (s *mongoMessageStore) Import(ctx context.Context, msgs []models.Message) (int64, error) {
+	if len(msgs) == 0 {
+		return 0, nil
+	}
+	writes := make([]mongo.WriteModel, 0, len(msgs))
+	for _, msg := range msgs {
+		id := msg.ID
+		msg.ID = primitive.NilObjectID // taken from the filter on insert
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": id}).
+			SetUpdate(bson.M{"$setOnInsert": msg}).
+			SetUpsert(true))
+	}
+	result, err := s.col.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return 0, fmt.Errorf("error importing messages: %v", err)
+	}
+	return result.UpsertedCount, nil
+}
+
+func (s *mongoMessageStore) DeleteChat(ctx context.Context, chatID primitive.ObjectID) error {
+	if _, err := s.col.DeleteMany(ctx, bson.M{"chatId": chatID}); err != nil {
+		return fmt.Errorf("error deleting messages: %v", err)
+	}
+	return nil
+}
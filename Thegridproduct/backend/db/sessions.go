@@ -0,0 +1,132 @@
+package db
+
+import (
+	"Thegridproduct/backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrSessionNotFound is returned when no session matches the lookup.
+var ErrSessionNotFound = errors.New("session not found")
+
+// CreateSession stores a new refresh-token session.
+func CreateSession(ctx context.Context, session *models.Session) error {
+	col := GetCollection("gridlyapp", "sessions")
+
+	if session.ID.IsZero() {
+		session.ID = primitive.NewObjectID()
+	}
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
+	}
+	session.LastUsedAt = session.CreatedAt
+
+	if _, err := col.InsertOne(ctx, session); err != nil {
+		return fmt.Errorf("failed to create session: %v", err)
+	}
+	return nil
+}
+
+// FindSessionByRefreshHash returns the session whose current refresh token hash matches.
+func FindSessionByRefreshHash(ctx context.Context, hash string) (*models.Session, error) {
+	return findSession(ctx, bson.M{"refreshTokenHash": hash})
+}
+
+// FindSessionByPreviousHash returns the session whose previous (already rotated) refresh token hash matches.
+func FindSessionByPreviousHash(ctx context.Context, hash string) (*models.Session, error) {
+	return findSession(ctx, bson.M{"previousTokenHash": hash})
+}
+
+func findSession(ctx context.Context, filter bson.M) (*models.Session, error) {
+	col := GetCollection("gridlyapp", "sessions")
+
+	var session models.Session
+	if err := col.FindOne(ctx, filter).Decode(&session); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("error fetching session: %v", err)
+	}
+	return &session, nil
+}
+
+// IsSessionActive reports whether the session exists, has not been revoked and has not expired.
+func IsSessionActive(ctx context.Context, sessionID string) (bool, error) {
+	objID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return false, nil
+	}
+
+	col := GetCollection("gridlyapp", "sessions")
+	count, err := col.CountDocuments(ctx, bson.M{
+		"_id":       objID,
+		"revokedAt": bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		return false, fmt.Errorf("error checking session: %v", err)
+	}
+	return count > 0, nil
+}
+
+// RotateSession swaps the refresh token hash of an active session. The update only
+// applies if the presented hash is still current, so two concurrent refreshes with
+// the same token cannot both succeed.
+func RotateSession(ctx context.Context, sessionID primitive.ObjectID, oldHash, newHash string, expiresAt time.Time) error {
+	col := GetCollection("gridlyapp", "sessions")
+
+	filter := bson.M{
+		"_id":              sessionID,
+		"refreshTokenHash": oldHash,
+		"revokedAt":        bson.M{"$exists": false},
+	}
+	update := bson.M{"$set": bson.M{
+		"refreshTokenHash":  newHash,
+		"previousTokenHash": oldHash,
+		"lastUsedAt":        time.Now(),
+		"expiresAt":         expiresAt,
+	}}
+
+	res, err := col.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return fmt.Errorf("failed to rotate session: %v", err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeSession marks a single session as revoked.
+func RevokeSession(ctx context.Context, sessionID primitive.ObjectID) error {
+	col := GetCollection("gridlyapp", "sessions")
+
+	_, err := col.UpdateOne(ctx,
+		bson.M{"_id": sessionID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %v", err)
+	}
+	return nil
+}
+
+// RevokeUserSessions revokes every outstanding session for a user and returns how many were revoked.
+func RevokeUserSessions(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	col := GetCollection("gridlyapp", "sessions")
+
+	res, err := col.UpdateMany(ctx,
+		bson.M{"userId": userID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke user sessions: %v", err)
+	}
+	return res.ModifiedCount, nil
+}
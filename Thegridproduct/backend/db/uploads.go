@@ -0,0 +1,54 @@
+package db
+
+import (
+	"Thegridproduct/backend/models"
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CreateUpload records a stored image.
+func CreateUpload(ctx context.Context, upload *models.Upload) error {
+	col := GetCollection("gridlyapp", "uploads")
+
+	if upload.ID.IsZero() {
+		upload.ID = primitive.NewObjectID()
+	}
+	if upload.CreatedAt.IsZero() {
+		upload.CreatedAt = time.Now()
+	}
+
+	if _, err := col.InsertOne(ctx, upload); err != nil {
+		return fmt.Errorf("failed to create upload: %v", err)
+	}
+	return nil
+}
+
+// FindUploads returns the uploads matching filter.
+func FindUploads(ctx context.Context, filter bson.M) ([]models.Upload, error) {
+	col := GetCollection("gridlyapp", "uploads")
+
+	cursor, err := col.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching uploads: %v", err)
+	}
+	var uploads []models.Upload
+	if err := cursor.All(ctx, &uploads); err != nil {
+		return nil, fmt.Errorf("error decoding uploads: %v", err)
+	}
+	return uploads, nil
+}
+
+// DeleteUploads removes the records of the uploads matching filter. The stored
+// blobs are the caller's to delete.
+func DeleteUploads(ctx context.Context, filter bson.M) error {
+	col := GetCollection("gridlyapp", "uploads")
+
+	if _, err := col.DeleteMany(ctx, filter); err != nil {
+		return fmt.Errorf("failed to delete uploads: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"Thegridproduct/backend/models"
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UsersCollection holds every user regardless of student type.
+const UsersCollection = "users"
+
+var (
+	// ErrUserNotFound is returned when no user matches the lookup.
+	ErrUserNotFound = errors.New("user not found")
+
+	// ErrEmailTaken is returned when creating a user whose email is already registered.
+	ErrEmailTaken = errors.New("email already registered")
+)
+
+// UserRepository is the only way handlers read and write users.
+type UserRepository interface {
+	// GetByID loads a user. Options can be used to project the returned fields.
+	GetByID(ctx context.Context, id primitive.ObjectID, opts ...*options.FindOneOptions) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	EmailExists(ctx context.Context, email string) (bool, error)
+	Find(ctx context.Context, filter bson.M) ([]models.User, error)
+	Create(ctx context.Context, user *models.User) error
+	// Update applies an update document (e.g. {"$set": ...}) to a single user.
+	Update(ctx context.Context, id primitive.ObjectID, update bson.M) error
+	// UpdateOneWhere applies an update to the first user matching filter and reports
+	// whether one matched, so callers can compare-and-set on a single account.
+	UpdateOneWhere(ctx context.Context, filter, update bson.M) (bool, error)
+	UpdateMany(ctx context.Context, filter, update bson.M) (int64, error)
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// Users is the repository handlers use; it is set up by ConnectDB.
+var Users UserRepository
+
+// mongoUserRepository stores users in the single "users" collection.
+type mongoUserRepository struct {
+	col *mongo.Collection
+}
+
+// NewMongoUserRepository returns a UserRepository backed by the users collection of the given database.
+func NewMongoUserRepository(database *mongo.Database) UserRepository {
+	return &mongoUserRepository{col: database.Collection(UsersCollection)}
+}
+
+func (r *mongoUserRepository) findOne(ctx context.Context, filter bson.M, opts ...*options.FindOneOptions) (*models.User, error) {
+	var user models.User
+	if err := r.col.FindOne(ctx, filter, opts...).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("error fetching user: %v", err)
+	}
+	return &user, nil
+}
+
+func (r *mongoUserRepository) GetByID(ctx context.Context, id primitive.ObjectID, opts ...*options.FindOneOptions) (*models.User, error) {
+	return r.findOne(ctx, bson.M{"_id": id}, opts...)
+}
+
+func (r *mongoUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return r.findOne(ctx, bson.M{"email": email})
+}
+
+func (r *mongoUserRepository) EmailExists(ctx context.Context, email string) (bool, error) {
+	count, err := r.col.CountDocuments(ctx, bson.M{"email": email}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("error checking email: %v", err)
+	}
+	return count > 0, nil
+}
+
+func (r *mongoUserRepository) Find(ctx context.Context, filter bson.M) ([]models.User, error) {
+	cursor, err := r.col.Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching users: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	users := []models.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("error decoding users: %v", err)
+	}
+	return users, nil
+}
+
+func (r *mongoUserRepository) Create(ctx context.Context, user *models.User) error {
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	if _, err := r.col.InsertOne(ctx, user); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrEmailTaken
+		}
+		return fmt.Errorf("failed to create user: %v", err)
+	}
+	return nil
+}
+
+func (r *mongoUserRepository) Update(ctx context.Context, id primitive.ObjectID, update bson.M) error {
+	res, err := r.col.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return fmt.Errorf("failed to update user: %v", err)
+	}
+	if res.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *mongoUserRepository) UpdateOneWhere(ctx context.Context, filter, update bson.M) (bool, error) {
+	res, err := r.col.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, fmt.Errorf("failed to update user: %v", err)
+	}
+	return res.MatchedCount == 1, nil
+}
+
+func (r *mongoUserRepository) UpdateMany(ctx context.Context, filter, update bson.M) (int64, error) {
+	res, err := r.col.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update users: %v", err)
+	}
+	return res.ModifiedCount, nil
+}
+
+func (r *mongoUserRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	res, err := r.col.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %v", err)
+	}
+	if res.DeletedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
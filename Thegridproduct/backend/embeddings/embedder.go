@@ -0,0 +1,110 @@
+// Package embeddings turns listing text into vectors for semantic search. The
+// provider is chosen by configuration: OpenAI in production, or a local hashed
+// n-gram model that needs no network access for tests and development.
+//
+// Every stored vector is saved together with the model and dimension it was
+// computed with, so vectors of different models are never compared and a model
+// switch marks the old vectors as stale (see CurrentFilter and StaleFilter).
+package embeddings
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Embedder computes embeddings.
+type Embedder interface {
+	// Embed returns the vector of text.
+	Embed(ctx context.Context, text string) ([]float32, error)
+	// Model names the model; it is stored next to each vector.
+	Model() string
+	// Dimensions is the length of the vectors Embed returns.
+	Dimensions() int
+	// MinSimilarity is the cosine similarity from which two texts count as related.
+	MinSimilarity() float64
+}
+
+// FromEnv builds the Embedder selected by EMBEDDINGS_PROVIDER:
+//
+//	openai (default) the OpenAI embeddings API with OPENAI_API_KEY
+//	hash   hashed word and character n-grams, computed locally
+//
+// EMBEDDINGS_MODEL picks the OpenAI model (default text-embedding-ada-002) and
+// EMBEDDINGS_DIMENSIONS the vector length, where the model allows choosing one.
+// EMBEDDINGS_MIN_SIMILARITY overrides the provider's match threshold.
+func FromEnv() (Embedder, error) {
+	dimensions := 0
+	if v := os.Getenv("EMBEDDINGS_DIMENSIONS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid EMBEDDINGS_DIMENSIONS %q", v)
+		}
+		dimensions = n
+	}
+	minSimilarity := 0.0
+	if v := os.Getenv("EMBEDDINGS_MIN_SIMILARITY"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < -1 || f > 1 {
+			return nil, fmt.Errorf("invalid EMBEDDINGS_MIN_SIMILARITY %q", v)
+		}
+		minSimilarity = f
+	}
+
+	switch provider := os.Getenv("EMBEDDINGS_PROVIDER"); provider {
+	case "", "openai":
+		model := os.Getenv("EMBEDDINGS_MODEL")
+		if model == "" {
+			model = DefaultOpenAIModel
+		}
+		e := NewOpenAIEmbedder(os.Getenv("OPENAI_API_KEY"), model, dimensions)
+		if minSimilarity != 0 {
+			e.minSimilarity = minSimilarity
+		}
+		return e, nil
+	case "hash":
+		if dimensions == 0 {
+			dimensions = DefaultHashDimensions
+		}
+		e := NewHashEmbedder(dimensions)
+		if minSimilarity != 0 {
+			e.minSimilarity = minSimilarity
+		}
+		return e, nil
+	default:
+		return nil, fmt.Errorf("unknown EMBEDDINGS_PROVIDER %q", provider)
+	}
+}
+
+var (
+	defaultOnce     sync.Once
+	defaultEmbedder Embedder
+)
+
+// Default returns the process-wide Embedder. It is configured from the environment
+// on first use unless SetDefault was called before.
+func Default() Embedder {
+	defaultOnce.Do(func() {
+		e, err := FromEnv()
+		if err != nil {
+			log.Printf("Embeddings configuration error, using OpenAI defaults: %v", err)
+			e = NewOpenAIEmbedder(os.Getenv("OPENAI_API_KEY"), DefaultOpenAIModel, 0)
+		}
+		defaultEmbedder = e
+	})
+	return defaultEmbedder
+}
+
+// SetDefault replaces the process-wide Embedder. Call it at startup.
+func SetDefault(e Embedder) {
+	defaultOnce.Do(func() {})
+	defaultEmbedder = e
+}
+
+// GetEmbeddingForText embeds text with the default Embedder.
+func GetEmbeddingForText(ctx context.Context, text string) ([]float32, error) {
+	return Default().Embed(ctx, text)
+}
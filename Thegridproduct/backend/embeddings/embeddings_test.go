@@ -0,0 +1,256 @@
+package embeddings
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"Thegridproduct/backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func cosine(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+func embed(t *testing.T, e Embedder, text string) []float32 {
+	t.Helper()
+	vector, err := e.Embed(context.Background(), text)
+	if err != nil {
+		t.Fatalf("Embed(%q): %v", text, err)
+	}
+	return vector
+}
+
+func TestHashEmbedder(t *testing.T) {
+	e := NewHashEmbedder(DefaultHashDimensions)
+
+	v := embed(t, e, "Road bike, barely used")
+	if len(v) != DefaultHashDimensions {
+		t.Fatalf("len = %d, want %d", len(v), DefaultHashDimensions)
+	}
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	if math.Abs(norm-1) > 1e-5 {
+		t.Errorf("squared norm = %v, want 1", norm)
+	}
+
+	if again := embed(t, e, "Road bike, barely used"); !reflect.DeepEqual(v, again) {
+		t.Error("Embed is not deterministic")
+	}
+	if same := embed(t, e, "ROAD BIKE barely-used"); !reflect.DeepEqual(v, same) {
+		t.Error("Embed depends on case or punctuation")
+	}
+
+	for _, text := range []string{"", "  ", "!?"} {
+		for _, x := range embed(t, e, text) {
+			if x != 0 {
+				t.Errorf("Embed(%q) is not all zeros", text)
+				break
+			}
+		}
+	}
+}
+
+func TestHashEmbedderSimilarity(t *testing.T) {
+	e := NewHashEmbedder(DefaultHashDimensions)
+	query := embed(t, e, "road bike")
+
+	related := cosine(query, embed(t, e, "Road bikes\nLightweight road bike, barely used"))
+	unrelated := cosine(query, embed(t, e, "Calculus textbook, third edition"))
+	if related <= unrelated {
+		t.Errorf("related similarity %v <= unrelated %v", related, unrelated)
+	}
+	if related < e.MinSimilarity() {
+		t.Errorf("related similarity %v below MinSimilarity %v", related, e.MinSimilarity())
+	}
+	if unrelated >= e.MinSimilarity() {
+		t.Errorf("unrelated similarity %v reaches MinSimilarity %v", unrelated, e.MinSimilarity())
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	tests := []struct {
+		name          string
+		env           map[string]string
+		model         string
+		dimensions    int
+		minSimilarity float64
+		wantErr       bool
+	}{
+		{"default", nil, DefaultOpenAIModel, 1536, 0.6, false},
+		{"openai model", map[string]string{"EMBEDDINGS_MODEL": "text-embedding-3-large"}, "text-embedding-3-large", 3072, 0.6, false},
+		{"openai shortened", map[string]string{"EMBEDDINGS_MODEL": "text-embedding-3-small", "EMBEDDINGS_DIMENSIONS": "256"}, "text-embedding-3-small", 256, 0.6, false},
+		{"hash", map[string]string{"EMBEDDINGS_PROVIDER": "hash"}, HashModel, DefaultHashDimensions, 0.3, false},
+		{"hash with options", map[string]string{"EMBEDDINGS_PROVIDER": "hash", "EMBEDDINGS_DIMENSIONS": "64", "EMBEDDINGS_MIN_SIMILARITY": "0.5"}, HashModel, 64, 0.5, false},
+		{"unknown provider", map[string]string{"EMBEDDINGS_PROVIDER": "magic"}, "", 0, 0, true},
+		{"bad dimensions", map[string]string{"EMBEDDINGS_DIMENSIONS": "-1"}, "", 0, 0, true},
+		{"bad min similarity", map[string]string{"EMBEDDINGS_MIN_SIMILARITY": "2"}, "", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"EMBEDDINGS_PROVIDER", "EMBEDDINGS_MODEL", "EMBEDDINGS_DIMENSIONS", "EMBEDDINGS_MIN_SIMILARITY"} {
+				t.Setenv(name, tt.env[name])
+			}
+			e, err := FromEnv()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("FromEnv() = %v, want an error", e)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FromEnv: %v", err)
+			}
+			if e.Model() != tt.model || e.Dimensions() != tt.dimensions || e.MinSimilarity() != tt.minSimilarity {
+				t.Errorf("FromEnv() = %s/%d/%v, want %s/%d/%v",
+					e.Model(), e.Dimensions(), e.MinSimilarity(), tt.model, tt.dimensions, tt.minSimilarity)
+			}
+		})
+	}
+}
+
+// matches evaluates the subset of MongoDB queries used by CurrentFilter and
+// StaleFilter against doc.
+func matches(t *testing.T, filter bson.M, doc bson.M) bool {
+	t.Helper()
+	for key, cond := range filter {
+		switch key {
+		case "$or":
+			any := false
+			for _, f := range cond.([]bson.M) {
+				any = any || matches(t, f, doc)
+			}
+			if !any {
+				return false
+			}
+		case "$nor":
+			for _, f := range cond.([]bson.M) {
+				if matches(t, f, doc) {
+					return false
+				}
+			}
+		default:
+			value, present := doc[key]
+			if op, ok := cond.(bson.M); ok {
+				if exists, ok := op["$exists"]; ok && len(op) == 1 {
+					if present != exists.(bool) {
+						return false
+					}
+					continue
+				}
+				t.Fatalf("unsupported condition %v on %s", op, key)
+			}
+			if !present || value != cond {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestCurrentAndStaleFilter(t *testing.T) {
+	ada := NewOpenAIEmbedder("", DefaultOpenAIModel, 0)
+	small := NewOpenAIEmbedder("", "text-embedding-3-small", 0)
+	smallShort := NewOpenAIEmbedder("", "text-embedding-3-small", 256)
+	hash := NewHashEmbedder(DefaultHashDimensions)
+
+	vector := []float32{0.1, 0.2}
+	legacy := bson.M{"embeddings": vector}
+	none := bson.M{"title": "no embedding"}
+	adaDoc := bson.M{"embeddings": vector, "embeddingModel": DefaultOpenAIModel, "embeddingDimensions": 1536}
+	smallDoc := bson.M{"embeddings": vector, "embeddingModel": "text-embedding-3-small", "embeddingDimensions": 1536}
+	hashDoc := bson.M{"embeddings": vector, "embeddingModel": HashModel, "embeddingDimensions": DefaultHashDimensions}
+
+	tests := []struct {
+		name    string
+		e       Embedder
+		doc     bson.M
+		current bool
+	}{
+		{"legacy vector counts as ada", ada, legacy, true},
+		{"ada vector", ada, adaDoc, true},
+		{"no vector", ada, none, false},
+		{"model switch", small, adaDoc, false},
+		{"legacy vector after model switch", small, legacy, false},
+		{"same model", small, smallDoc, true},
+		{"dimensions switch", smallShort, smallDoc, false},
+		{"provider switch", hash, adaDoc, false},
+		{"hash vector", hash, hashDoc, true},
+		{"legacy vector with hash", hash, legacy, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matches(t, CurrentFilter(tt.e), tt.doc); got != tt.current {
+				t.Errorf("CurrentFilter matches = %v, want %v", got, tt.current)
+			}
+			if got := matches(t, StaleFilter(tt.e), tt.doc); got != !tt.current {
+				t.Errorf("StaleFilter matches = %v, want %v", got, !tt.current)
+			}
+		})
+	}
+}
+
+func TestFieldsAreCurrent(t *testing.T) {
+	for _, e := range []Embedder{
+		NewOpenAIEmbedder("", DefaultOpenAIModel, 0),
+		NewOpenAIEmbedder("", "text-embedding-3-small", 256),
+		NewHashEmbedder(64),
+	} {
+		doc := Fields(e, make([]float32, e.Dimensions()))
+		if !matches(t, CurrentFilter(e), doc) {
+			t.Errorf("%s: stored fields %v do not match CurrentFilter", e.Model(), doc)
+		}
+	}
+}
+
+func TestProductText(t *testing.T) {
+	p := models.Product{
+		Title:        "Desk lamp",
+		Description:  "Warm light",
+		SelectedTags: []string{"Furniture", "Dorm"},
+		Condition:    "Like New",
+		Price:        20,
+	}
+	text := ProductText(p)
+	for _, want := range []string{"Desk lamp", "Warm light", "Furniture, Dorm", "Like New"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("ProductText() = %q, missing %q", text, want)
+		}
+	}
+
+	changed := p
+	changed.Price = 5
+	changed.Status = "sold"
+	if ProductText(changed) != text {
+		t.Error("ProductText depends on price or status")
+	}
+	changed.Condition = "Used"
+	if ProductText(changed) == text {
+		t.Error("ProductText ignores the condition")
+	}
+}
+
+func TestGigText(t *testing.T) {
+	g := models.Gig{Title: "Math tutoring", Description: "Calculus and algebra", Category: "Tutoring"}
+	text := GigText(g)
+	for _, want := range []string{"Math tutoring", "Calculus and algebra", "Category: Tutoring"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("GigText() = %q, missing %q", text, want)
+		}
+	}
+}
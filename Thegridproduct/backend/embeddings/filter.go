@@ -0,0 +1,35 @@
+package embeddings
+
+import "go.mongodb.org/mongo-driver/bson"
+
+// Fields are the document fields to $set when storing vector computed by e.
+func Fields(e Embedder, vector []float32) bson.M {
+	return bson.M{
+		"embeddings":          vector,
+		"embeddingModel":      e.Model(),
+		"embeddingDimensions": len(vector),
+	}
+}
+
+// CurrentFilter matches documents whose embedding was computed by e's model, so
+// it can be compared with query vectors from e. Documents embedded before the
+// model was recorded count as DefaultOpenAIModel vectors.
+func CurrentFilter(e Embedder) bson.M {
+	current := bson.M{"embeddingModel": e.Model()}
+	if d := e.Dimensions(); d > 0 {
+		current["embeddingDimensions"] = d
+	}
+	if e.Model() != DefaultOpenAIModel || e.Dimensions() != openAIDimensions[DefaultOpenAIModel] {
+		return current
+	}
+	return bson.M{"$or": []bson.M{
+		current,
+		{"embeddingModel": bson.M{"$exists": false}, "embeddings": bson.M{"$exists": true}},
+	}}
+}
+
+// StaleFilter matches documents that have no embedding from e's model yet and
+// need to be (re-)embedded.
+func StaleFilter(e Embedder) bson.M {
+	return bson.M{"$nor": []bson.M{CurrentFilter(e)}}
+}
@@ -0,0 +1,95 @@
+package embeddings
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+const (
+	// HashModel is the model name stored for hashed n-gram vectors. Bump the
+	// version whenever the features below change so old vectors become stale.
+	HashModel = "hash-ngram-v1"
+
+	// DefaultHashDimensions is the vector length of the hash model.
+	DefaultHashDimensions = 512
+)
+
+// Feature weights of the hash model. Whole words carry most of the meaning;
+// character trigrams let inflections and typos ("bike", "bikes", "bicycle")
+// still land close together.
+const (
+	hashWordWeight    = 1.0
+	hashBigramWeight  = 0.7
+	hashTrigramWeight = 0.4
+)
+
+// HashEmbedder embeds text locally by hashing its words, word pairs and character
+// trigrams into a fixed number of buckets. It is deterministic and needs no
+// network access, which makes it suitable for tests and local development; it
+// only captures shared vocabulary, not meaning.
+type HashEmbedder struct {
+	dimensions    int
+	minSimilarity float64
+}
+
+// NewHashEmbedder returns a hash Embedder producing vectors of the given length.
+func NewHashEmbedder(dimensions int) *HashEmbedder {
+	return &HashEmbedder{dimensions: dimensions, minSimilarity: 0.3}
+}
+
+// Embed implements Embedder. The vector has unit length, or is all zeros for text
+// without any words.
+func (e *HashEmbedder) Embed(_ context.Context, text string) ([]float32, error) {
+	vector := make([]float64, e.dimensions)
+	add := func(feature string, weight float64) {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		// The top bit picks the sign so collisions tend to cancel out.
+		if sum>>63 == 1 {
+			weight = -weight
+		}
+		vector[sum%uint64(e.dimensions)] += weight
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		add("w:"+word, hashWordWeight)
+		if i > 0 {
+			add("b:"+words[i-1]+" "+word, hashBigramWeight)
+		}
+		padded := []rune("^" + word + "$")
+		for j := 0; j+3 <= len(padded); j++ {
+			add("c:"+string(padded[j:j+3]), hashTrigramWeight)
+		}
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += v * v
+	}
+	norm = math.Sqrt(norm)
+
+	result := make([]float32, e.dimensions)
+	if norm == 0 {
+		return result, nil
+	}
+	for i, v := range vector {
+		result[i] = float32(v / norm)
+	}
+	return result, nil
+}
+
+// Model implements Embedder.
+func (e *HashEmbedder) Model() string { return HashModel }
+
+// Dimensions implements Embedder.
+func (e *HashEmbedder) Dimensions() int { return e.dimensions }
+
+// MinSimilarity implements Embedder.
+func (e *HashEmbedder) MinSimilarity() float64 { return e.minSimilarity }
@@ -3,24 +3,47 @@ package embeddings
 import (
 	"context"
 	"fmt"
-	"os"
 
 	openai "github.com/sashabaranov/go-openai"
 )
 
-func GetEmbeddingForText(ctx context.Context, text string) ([]float32, error) {
-	// Initialize the OpenAI client
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
+// DefaultOpenAIModel is the model listings were embedded with before the model
+// was configurable. Vectors stored without a model name were computed with it.
+const DefaultOpenAIModel = string(openai.AdaEmbeddingV2)
+
+// openAIDimensions are the native vector lengths of the OpenAI embedding models.
+var openAIDimensions = map[string]int{
+	string(openai.AdaEmbeddingV2):  1536,
+	string(openai.SmallEmbedding3): 1536,
+	string(openai.LargeEmbedding3): 3072,
+}
+
+// OpenAIEmbedder computes embeddings with the OpenAI embeddings API.
+type OpenAIEmbedder struct {
+	apiKey        string
+	model         string
+	dimensions    int // 0 keeps the model's native length
+	minSimilarity float64
+}
+
+// NewOpenAIEmbedder returns an Embedder for an OpenAI model. dimensions shortens
+// the vectors of models that support it; 0 keeps their native length.
+func NewOpenAIEmbedder(apiKey, model string, dimensions int) *OpenAIEmbedder {
+	return &OpenAIEmbedder{apiKey: apiKey, model: model, dimensions: dimensions, minSimilarity: 0.6}
+}
+
+// Embed implements Embedder.
+func (e *OpenAIEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	if e.apiKey == "" {
 		return nil, fmt.Errorf("missing OPENAI_API_KEY environment variable")
 	}
 
-	client := openai.NewClient(apiKey)
+	client := openai.NewClient(e.apiKey)
 
-	// Call the embeddings API
 	resp, err := client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
-		Model: openai.AdaEmbeddingV2, // or "text-embedding-ada-002" for the standard embedding model
-		Input: []string{text},        // You can pass multiple strings if you like
+		Model:      openai.EmbeddingModel(e.model),
+		Input:      []string{text},
+		Dimensions: e.dimensions,
 	})
 	if err != nil {
 		return nil, err
@@ -33,3 +56,18 @@ func GetEmbeddingForText(ctx context.Context, text string) ([]float32, error) {
 	// resp.Data[0].Embedding is []float32
 	return resp.Data[0].Embedding, nil
 }
+
+// Model implements Embedder.
+func (e *OpenAIEmbedder) Model() string { return e.model }
+
+// Dimensions implements Embedder. It is 0 for unknown models that were not given
+// an explicit length.
+func (e *OpenAIEmbedder) Dimensions() int {
+	if e.dimensions > 0 {
+		return e.dimensions
+	}
+	return openAIDimensions[e.model]
+}
+
+// MinSimilarity implements Embedder.
+func (e *OpenAIEmbedder) MinSimilarity() float64 { return e.minSimilarity }
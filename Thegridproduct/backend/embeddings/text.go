@@ -0,0 +1,29 @@
+package embeddings
+
+import (
+	"strings"
+
+	"Thegridproduct/backend/models"
+)
+
+// ProductText is the text embedded for a product. Only fields a buyer would
+// search by are included, so price or status changes do not need a new embedding.
+func ProductText(p models.Product) string {
+	parts := []string{p.Title, p.Description}
+	if len(p.SelectedTags) > 0 {
+		parts = append(parts, "Tags: "+strings.Join(p.SelectedTags, ", "))
+	}
+	if p.Condition != "" {
+		parts = append(parts, "Condition: "+p.Condition)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// GigText is the text embedded for a gig: what is offered and in which category.
+func GigText(g models.Gig) string {
+	parts := []string{g.Title, g.Description}
+	if g.Category != "" {
+		parts = append(parts, "Category: "+g.Category)
+	}
+	return strings.Join(parts, "\n")
+}
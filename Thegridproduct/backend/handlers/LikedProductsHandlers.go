@@ -11,7 +11,6 @@ import (
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func AddLikedProductHandler(w http.ResponseWriter, r *http.Request) {
@@ -50,45 +49,18 @@ func AddLikedProductHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	// Find user collection
-	var userCollection *mongo.Collection
-	collections := []string{"university_users", "highschool_users"}
-
-	for _, colName := range collections {
-		collection := db.GetCollection("gridlyapp", colName)
-		if collection == nil {
-			log.Printf("Collection %s not found", colName)
-			continue
-		}
-
-		err := collection.FindOne(ctx, bson.M{"_id": userObjID}).Err()
-		if err == nil {
-			userCollection = collection
-			log.Printf("User found in collection: %s", colName)
-			break
-		}
-		if err != mongo.ErrNoDocuments {
-			log.Printf("Error querying collection %s: %v", colName, err)
-			http.Error(w, "Database error", http.StatusInternalServerError)
-			return
-		}
-		log.Printf("User not found in collection: %s", colName)
-	}
-
-	if userCollection == nil {
-		log.Printf("User with ID %s not found in any collection", userObjID.Hex())
-		http.Error(w, "User not found", http.StatusNotFound)
-		return
-	}
-
 	// Update user's liked products
 	updateUser := bson.M{
 		"$addToSet": bson.M{
 			"likedProducts": productID,
 		},
 	}
-	_, err = userCollection.UpdateOne(ctx, bson.M{"_id": userObjID}, updateUser)
-	if err != nil {
+	err = db.Users.Update(ctx, userObjID, updateUser)
+	if err == db.ErrUserNotFound {
+		log.Printf("User with ID %s not found", userObjID.Hex())
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
 		http.Error(w, "Failed to update liked products", http.StatusInternalServerError)
 		return
 	}
@@ -143,33 +115,6 @@ func RemoveLikedProductHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Resolve user collection dynamically
-	var userCollectionName string
-	universityUsers := db.GetCollection("gridlyapp", "university_users")
-	highschoolUsers := db.GetCollection("gridlyapp", "highschool_users")
-
-	// Check university_users first
-	err = universityUsers.FindOne(ctx, bson.M{"_id": userObjID}).Err()
-	if err == nil {
-		userCollectionName = "university_users"
-	} else if err == mongo.ErrNoDocuments {
-		// If not found in university_users, check highschool_users
-		err = highschoolUsers.FindOne(ctx, bson.M{"_id": userObjID}).Err()
-		if err == nil {
-			userCollectionName = "highschool_users"
-		} else if err == mongo.ErrNoDocuments {
-			http.Error(w, "User not found", http.StatusNotFound)
-			return
-		} else {
-			http.Error(w, "Error querying user collections", http.StatusInternalServerError)
-			return
-		}
-	} else {
-		http.Error(w, "Error querying user collections", http.StatusInternalServerError)
-		return
-	}
-
-	userCollection := db.GetCollection("gridlyapp", userCollectionName)
 	productCollection := db.GetCollection("gridlyapp", "products")
 
 	// Remove product from the user's likedProducts
@@ -178,8 +123,11 @@ func RemoveLikedProductHandler(w http.ResponseWriter, r *http.Request) {
 			"likedProducts": productID,
 		},
 	}
-	_, err = userCollection.UpdateOne(ctx, bson.M{"_id": userObjID}, updateUser)
-	if err != nil {
+	err = db.Users.Update(ctx, userObjID, updateUser)
+	if err == db.ErrUserNotFound {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
 		http.Error(w, "Failed to update liked products", http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,500 @@
+// handlers/accountDeletion.go
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"Thegridproduct/backend/db"
+	"Thegridproduct/backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// defaultAccountDeletionGraceDays is used when ACCOUNT_DELETION_GRACE_DAYS is not set.
+const defaultAccountDeletionGraceDays = 30
+
+// accountDeletionGracePeriod returns how long a deleted account can still be restored.
+func accountDeletionGracePeriod() time.Duration {
+	days := defaultAccountDeletionGraceDays
+	if v := os.Getenv("ACCOUNT_DELETION_GRACE_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			days = n
+		} else {
+			log.Printf("Invalid ACCOUNT_DELETION_GRACE_DAYS %q, using %d", v, defaultAccountDeletionGraceDays)
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// listingCollections are the collections holding listings owned through a userId field.
+var listingCollections = []string{"products", "gigs", "product_requests"}
+
+// setListingsOwnerDeleted hides or shows again every listing owned by the user.
+func setListingsOwnerDeleted(ctx context.Context, userID primitive.ObjectID, deleted bool) error {
+	update := bson.M{"$set": bson.M{"ownerDeleted": true}}
+	if !deleted {
+		update = bson.M{"$unset": bson.M{"ownerDeleted": ""}}
+	}
+	for _, colName := range listingCollections {
+		if _, err := db.GetCollection("gridlyapp", colName).UpdateMany(ctx, bson.M{"userId": userID}, update); err != nil {
+			return fmt.Errorf("error updating %s: %v", colName, err)
+		}
+	}
+	return nil
+}
+
+// DeleteAccountHandler schedules the caller's account for deletion. The account is
+// hidden and logged out immediately, can be restored during the grace period, and is
+// then purged together with all associated data by the purge-deleted-accounts job.
+func DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodDelete {
+		WriteJSONError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userIDStr, ok := r.Context().Value(userIDKey).(string)
+	if !ok || userIDStr == "" {
+		WriteJSONError(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		WriteJSONError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	purgeAfter := now.Add(accountDeletionGracePeriod())
+
+	err = db.Users.Update(ctx, userID, bson.M{"$set": bson.M{
+		"deletedAt":  now,
+		"purgeAfter": purgeAfter,
+		"updatedAt":  now,
+	}})
+	if err == db.ErrUserNotFound {
+		WriteJSONError(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error scheduling account deletion: %v", err)
+		WriteJSONError(w, "Error deleting account", http.StatusInternalServerError)
+		return
+	}
+
+	// Hide the user's listings while the account waits to be purged.
+	if err := setListingsOwnerDeleted(ctx, userID, true); err != nil {
+		log.Printf("Error hiding listings of deleted user %s: %v", userIDStr, err)
+		// Log error but proceed.
+	}
+
+	// Invalidate every outstanding token for the deleted user.
+	if _, err := db.RevokeUserSessions(ctx, userID); err != nil {
+		log.Printf("Error revoking user's sessions: %v", err)
+		// Log error but proceed.
+	}
+
+	WriteJSON(w, map[string]interface{}{
+		"message":    "Account scheduled for deletion. You can restore it by logging in through account restore before it is purged.",
+		"purgeAfter": purgeAfter,
+	}, http.StatusOK)
+}
+
+// RestoreAccountRequest represents the payload for restoring a deleted account.
+type RestoreAccountRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// RestoreAccountHandler cancels a pending account deletion and logs the user back in.
+// It is a public route because deleting the account revokes every session.
+func RestoreAccountHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		WriteJSONError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RestoreAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteJSONError(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if req.Email == "" || req.Password == "" {
+		WriteJSONError(w, "Email and password are required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Restoring checks a password, so it shares the login throttle.
+	ip := clientIP(r)
+	lockedUntil, err := checkLockouts(ctx, map[throttlePolicy]string{
+		loginAccountPolicy: req.Email,
+		loginIPPolicy:      ip,
+	})
+	if err != nil {
+		log.Printf("Error checking login lockout: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !lockedUntil.IsZero() {
+		writeTooManyRequests(w, "Too many failed login attempts.", time.Until(lockedUntil))
+		return
+	}
+
+	user, err := db.Users.GetByEmail(ctx, req.Email)
+	if err == db.ErrUserNotFound {
+		recordLoginFailure(ctx, req.Email, ip)
+		WriteJSONError(w, "Invalid email or password", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		log.Printf("Error finding user: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)) != nil {
+		recordLoginFailure(ctx, req.Email, ip)
+		WriteJSONError(w, "Invalid email or password", http.StatusUnauthorized)
+		return
+	}
+
+	if err := loginAccountPolicy.reset(ctx, req.Email); err != nil {
+		log.Printf("Error resetting login attempts: %v", err)
+	}
+
+	if !restorable(w, user) {
+		return
+	}
+
+	// Nothing changes until the second factor is verified at /account/restore/2fa.
+	if user.TwoFactorEnabled {
+		challenge, err := generateTwoFactorChallenge(user.ID, twoFactorRestoreAudience)
+		if err != nil {
+			log.Printf("Error generating two-factor challenge: %v", err)
+			WriteJSONError(w, "Could not generate token", http.StatusInternalServerError)
+			return
+		}
+		WriteJSON(w, map[string]interface{}{
+			"twoFactorRequired": true,
+			"challengeToken":    challenge,
+			"expiresIn":         int64(twoFactorChallengeTTL.Seconds()),
+		}, http.StatusOK)
+		return
+	}
+
+	restoreAccount(ctx, w, r, user)
+}
+
+// RestoreAccountTwoFactorHandler completes the restore of an account with two-factor
+// authentication by exchanging the challenge token from RestoreAccountHandler and a code.
+// Endpoint: POST /account/restore/2fa
+func RestoreAccountTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChallengeToken == "" || req.Code == "" {
+		WriteJSONError(w, "Challenge token and code are required", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := parseTwoFactorChallenge(req.ChallengeToken, twoFactorRestoreAudience)
+	if err != nil {
+		WriteJSONError(w, "Invalid or expired challenge token", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := db.Users.GetByID(ctx, userID)
+	if err == db.ErrUserNotFound {
+		WriteJSONError(w, "Invalid or expired challenge token", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		log.Printf("Error finding user: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !user.TwoFactorEnabled {
+		WriteJSONError(w, "Invalid or expired challenge token", http.StatusUnauthorized)
+		return
+	}
+	if !restorable(w, user) {
+		return
+	}
+	if !verifySecondFactor(ctx, w, user, req.Code) {
+		return
+	}
+
+	restoreAccount(ctx, w, r, user)
+}
+
+// restorable reports whether the user's deletion can still be cancelled, writing
+// the error response when it cannot.
+func restorable(w http.ResponseWriter, user *models.User) bool {
+	if user.DeletedAt == nil {
+		WriteJSONError(w, "Account is not scheduled for deletion", http.StatusBadRequest)
+		return false
+	}
+	if user.PurgeAfter != nil && time.Now().After(*user.PurgeAfter) {
+		WriteJSONError(w, "The restore period for this account has ended", http.StatusGone)
+		return false
+	}
+	return true
+}
+
+// restoreAccount cancels the user's pending deletion, brings back their listings
+// and responds with a new session.
+func restoreAccount(ctx context.Context, w http.ResponseWriter, r *http.Request, user *models.User) {
+	err := db.Users.Update(ctx, user.ID, bson.M{
+		"$unset": bson.M{"deletedAt": "", "purgeAfter": ""},
+		"$set":   bson.M{"updatedAt": time.Now()},
+	})
+	if err != nil {
+		log.Printf("Error restoring account %s: %v", user.ID.Hex(), err)
+		WriteJSONError(w, "Error restoring account", http.StatusInternalServerError)
+		return
+	}
+
+	if err := setListingsOwnerDeleted(ctx, user.ID, false); err != nil {
+		log.Printf("Error restoring listings of user %s: %v", user.ID.Hex(), err)
+	}
+
+	tokens, err := issueSession(ctx, r, user.ID, user.Institution, user.StudentType, user.Roles)
+	if err != nil {
+		log.Printf("Error generating token: %v", err)
+		WriteJSONError(w, "Could not generate token", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, map[string]interface{}{
+		"message":      "Account restored successfully.",
+		"token":        tokens.AccessToken,
+		"refreshToken": tokens.RefreshToken,
+		"expiresIn":    tokens.ExpiresIn,
+		"userId":       user.ID.Hex(),
+		"institution":  user.Institution,
+		"studentType":  user.StudentType,
+		"roles":        user.Roles,
+	}, http.StatusOK)
+}
+
+// PurgeDeletedAccounts permanently removes every account whose grace period has ended
+// and returns how many were purged. A user that fails to purge is left in place and
+// retried on the next run.
+func PurgeDeletedAccounts(ctx context.Context) (int, error) {
+	users, err := db.Users.Find(ctx, bson.M{"purgeAfter": bson.M{"$lte": time.Now()}})
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, user := range users {
+		if err := purgeUser(ctx, user.ID); err != nil {
+			log.Printf("Error purging user %s: %v", user.ID.Hex(), err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// ownedIDs returns the IDs of every document in the collection owned by the user.
+func ownedIDs(ctx context.Context, colName string, userID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	cursor, err := db.GetCollection("gridlyapp", colName).Find(ctx,
+		bson.M{"userId": userID},
+		options.Find().SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(docs))
+	for _, d := range docs {
+		ids = append(ids, d.ID)
+	}
+	return ids, nil
+}
+
+// purgeUser deletes a user and everything that references them. The user document
+// goes last so an interrupted purge is picked up again on the next run.
+func purgeUser(ctx context.Context, userID primitive.ObjectID) error {
+	owned := map[string][]primitive.ObjectID{}
+	var ownedAll []primitive.ObjectID
+	for _, colName := range listingCollections {
+		ids, err := ownedIDs(ctx, colName, userID)
+		if err != nil {
+			return fmt.Errorf("error listing %s: %v", colName, err)
+		}
+		owned[colName] = ids
+		ownedAll = append(ownedAll, ids...)
+	}
+
+	// Chats the user took part in, plus chats about the user's listings.
+	chatsCol := db.GetCollection("gridlyapp", "chats")
+	chatFilter := bson.M{"$or": []bson.M{
+		{"buyerId": userID},
+		{"sellerId": userID},
+		{"referenceId": bson.M{"$in": ownedAll}},
+	}}
+	cursor, err := chatsCol.Find(ctx, chatFilter)
+	if err != nil {
+		return fmt.Errorf("error listing chats: %v", err)
+	}
+	var chats []models.Chat
+	if err := cursor.All(ctx, &chats); err != nil {
+		return fmt.Errorf("error decoding chats: %v", err)
+	}
+
+	ownedSet := map[primitive.ObjectID]bool{}
+	for _, id := range ownedAll {
+		ownedSet[id] = true
+	}
+	for _, chat := range chats {
+		if _, err := fsClient.Collection("chatRooms").Doc(chat.ID.Hex()).Delete(ctx); err != nil {
+			return fmt.Errorf("error deleting Firestore chat room %s: %v", chat.ID.Hex(), err)
+		}
+		if _, err := chatsCol.DeleteOne(ctx, bson.M{"_id": chat.ID}); err != nil {
+			return fmt.Errorf("error deleting chat %s: %v", chat.ID.Hex(), err)
+		}
+		if err := db.Messages.DeleteChat(ctx, chat.ID); err != nil {
+			return fmt.Errorf("error deleting messages of chat %s: %v", chat.ID.Hex(), err)
+		}
+		if err := db.DeleteChatReads(ctx, chat.ID); err != nil {
+			return fmt.Errorf("error deleting read state of chat %s: %v", chat.ID.Hex(), err)
+		}
+		if err := db.DeleteInboxEntries(ctx, chat.ID); err != nil {
+			return fmt.Errorf("error deleting inbox entries of chat %s: %v", chat.ID.Hex(), err)
+		}
+
+		// Keep chat counters right on listings that survive the purge.
+		if ownedSet[chat.ReferenceID] {
+			continue
+		}
+		if refCol := chatReferenceCollection(chat.ReferenceType); refCol != "" {
+			_, err := db.GetCollection("gridlyapp", refCol).UpdateOne(ctx,
+				bson.M{"_id": chat.ReferenceID, "chatCount": bson.M{"$gt": 0}},
+				bson.M{"$inc": bson.M{"chatCount": -1}},
+			)
+			if err != nil {
+				log.Printf("Error updating chatCount for referenceID %s: %v", chat.ReferenceID.Hex(), err)
+			}
+		}
+	}
+
+	_, err = db.GetCollection("gridlyapp", "chat_requests").DeleteMany(ctx, bson.M{"$or": []bson.M{
+		{"buyerId": userID},
+		{"sellerId": userID},
+		{"referenceId": bson.M{"$in": ownedAll}},
+	}})
+	if err != nil {
+		return fmt.Errorf("error deleting chat requests: %v", err)
+	}
+
+	// References to the user on other people's listings.
+	for _, colName := range listingCollections {
+		_, err := db.GetCollection("gridlyapp", colName).UpdateMany(ctx,
+			bson.M{"requestedBy": userID},
+			bson.M{"$pull": bson.M{"requestedBy": userID}},
+		)
+		if err != nil {
+			return fmt.Errorf("error removing user from %s requests: %v", colName, err)
+		}
+	}
+	_, err = db.GetCollection("gridlyapp", "products").UpdateMany(ctx,
+		bson.M{"buyerId": userID},
+		bson.M{"$unset": bson.M{"buyerId": ""}},
+	)
+	if err != nil {
+		return fmt.Errorf("error removing user from purchased products: %v", err)
+	}
+
+	// References to the user's products from other users.
+	productIDs := owned["products"]
+	if len(productIDs) > 0 {
+		_, err := db.Users.UpdateMany(ctx,
+			bson.M{"likedProducts": bson.M{"$in": productIDs}},
+			bson.M{"$pull": bson.M{"likedProducts": bson.M{"$in": productIDs}}},
+		)
+		if err != nil {
+			return fmt.Errorf("error removing liked products: %v", err)
+		}
+		_, err = db.GetCollection("gridlyapp", "carts").UpdateMany(ctx,
+			bson.M{"items.productId": bson.M{"$in": productIDs}},
+			bson.M{"$pull": bson.M{"items": bson.M{"productId": bson.M{"$in": productIDs}}}},
+		)
+		if err != nil {
+			return fmt.Errorf("error removing products from carts: %v", err)
+		}
+	}
+
+	// Everything the user owns.
+	for _, colName := range append(listingCollections, "carts", "sessions", "password_resets") {
+		if _, err := db.GetCollection("gridlyapp", colName).DeleteMany(ctx, bson.M{"userId": userID}); err != nil {
+			return fmt.Errorf("error deleting user's %s: %v", colName, err)
+		}
+	}
+	removeListingVectors("products", owned["products"]...)
+	removeListingVectors("gigs", owned["gigs"]...)
+
+	if _, err := db.DeleteDataExports(ctx, bson.M{"userId": userID}); err != nil {
+		return err
+	}
+
+	uploads, err := db.FindUploads(ctx, bson.M{"userId": userID})
+	if err != nil {
+		return err
+	}
+	for _, upload := range uploads {
+		deleteUploadBlobs(ctx, upload)
+	}
+	if err := db.DeleteUploads(ctx, bson.M{"userId": userID}); err != nil {
+		return err
+	}
+
+	if err := db.Users.Delete(ctx, userID); err != nil && err != db.ErrUserNotFound {
+		return err
+	}
+
+	log.Printf("Purged user %s", userID.Hex())
+	return nil
+}
+
+// chatReferenceCollection maps a chat reference type to the collection holding the listing.
+func chatReferenceCollection(referenceType string) string {
+	switch referenceType {
+	case "product":
+		return "products"
+	case "gig":
+		return "gigs"
+	case "product_request":
+		return "product_requests"
+	}
+	return ""
+}
@@ -0,0 +1,103 @@
+// handlers/adminHandlers.go
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"Thegridproduct/backend/db"
+	"Thegridproduct/backend/models"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UpdateRolesRequest represents the payload for replacing a user's roles.
+type UpdateRolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+// UpdateUserRolesHandler replaces the roles of a user.
+// Granted roles take effect on the user's next token refresh; when a role is taken
+// away every session of the user is revoked so the old token stops working at once.
+// Endpoint: PUT /admin/users/{id}/roles
+func UpdateUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	callerID, ok := r.Context().Value(userIDKey).(string)
+	if !ok || callerID == "" {
+		WriteJSONError(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	targetID := mux.Vars(r)["id"]
+	targetObjID, err := primitive.ObjectIDFromHex(targetID)
+	if err != nil {
+		WriteJSONError(w, "Invalid user ID format", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateRolesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteJSONError(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+
+	roles := []string{}
+	for _, role := range req.Roles {
+		if !hasRole(models.ValidRoles, role) {
+			WriteJSONError(w, "Unknown role: "+role, http.StatusBadRequest)
+			return
+		}
+		if !hasRole(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+
+	// Stop admins from locking themselves out; another admin has to demote them.
+	if targetID == callerID && !hasRole(roles, models.RoleAdmin) {
+		WriteJSONError(w, "You cannot remove your own admin role", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := db.Users.GetByID(ctx, targetObjID)
+	if err == db.ErrUserNotFound {
+		WriteJSONError(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error fetching user %s: %v", targetID, err)
+		WriteJSONError(w, "Error fetching user", http.StatusInternalServerError)
+		return
+	}
+
+	update := bson.M{"$set": bson.M{"roles": roles, "updatedAt": time.Now()}}
+	if err := db.Users.Update(ctx, targetObjID, update); err != nil {
+		log.Printf("Error updating roles for user %s: %v", targetID, err)
+		WriteJSONError(w, "Failed to update roles", http.StatusInternalServerError)
+		return
+	}
+
+	for _, role := range user.Roles {
+		if !hasRole(roles, role) {
+			if _, err := db.RevokeUserSessions(ctx, targetObjID); err != nil {
+				log.Printf("Error revoking sessions for user %s: %v", targetID, err)
+			}
+			break
+		}
+	}
+
+	log.Printf("User %s set roles of user %s to %v", callerID, targetID, roles)
+
+	WriteJSON(w, map[string]interface{}{
+		"userId": targetID,
+		"roles":  roles,
+	}, http.StatusOK)
+}
@@ -77,7 +77,7 @@ func ProcessAIInput(w http.ResponseWriter, r *http.Request) {
 			orFilters = append(orFilters, bson.M{"description": bson.M{"$regex": keyword, "$options": "i"}})
 		}
 
-		filter := bson.M{"status": "active", "$or": orFilters}
+		filter := bson.M{"status": "active", "ownerDeleted": bson.M{"$ne": true}, "$or": orFilters}
 		cursor, err := collection.Find(ctx, filter)
 		if err != nil {
 			log.Printf("Database query error: %v", err)
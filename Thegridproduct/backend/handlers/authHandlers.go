@@ -4,16 +4,18 @@ package handlers
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"log"
-	"math/rand"
+	"math/big"
 	"net/http"
-	"net/smtp"
 	"os"
 	"time"
 
 	"Thegridproduct/backend/db"
+	"Thegridproduct/backend/mailer"
 	"Thegridproduct/backend/models"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -30,6 +32,9 @@ const (
 	StudentTypeUniversity = "university"
 )
 
+// verificationCodeTTL is how long an emailed signup verification code stays valid.
+const verificationCodeTTL = 15 * time.Minute
+
 // LoginRequest represents the expected login payload.
 type LoginRequest struct {
 	Email    string `json:"email"`
@@ -44,16 +49,18 @@ type SignupRequest struct {
 	LastName    string `json:"lastName"`
 	StudentType string `json:"studentType"`          // "highschool" or "university"
 	Institution string `json:"institution"`          // Name of high school or university
-	ProfilePic  string `json:"profilePic,omitempty"` // Optional profile picture URL
+	ProfilePic  string `json:"profilePic,omitempty"` // Dropped unless validateImageRefs accepts it
 }
 
-// generateToken creates a JWT token for the authenticated user.
-func generateToken(userID primitive.ObjectID, institution string, studentType string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+// generateToken creates a short-lived JWT access token tied to a session.
+func generateToken(userID primitive.ObjectID, institution string, studentType string, roles []string, sessionID primitive.ObjectID) (string, error) {
+	expirationTime := time.Now().Add(accessTokenTTL)
 	claims := &Claims{
 		UserID:      userID.Hex(),
 		Institution: institution,
 		StudentType: studentType,
+		SessionID:   sessionID.Hex(),
+		Roles:       roles,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: expirationTime.Unix(),
 			IssuedAt:  time.Now().Unix(),
@@ -97,98 +104,136 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Attempt to find user in highschool_users collection
-	highSchoolCollection := db.GetCollection("gridlyapp", "highschool_users")
-	universityCollection := db.GetCollection("gridlyapp", "university_users")
-
-	var user models.User
-	var studentType string
-
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	err := highSchoolCollection.FindOne(ctx, bson.M{"email": creds.Email}).Decode(&user)
-	if err == nil {
-		studentType = StudentTypeHighSchool
-	} else if err != mongo.ErrNoDocuments {
-		log.Printf("Error finding user in highschool_users: %v", err)
+	// Refuse outright while the account or the caller's IP is locked out
+	ip := clientIP(r)
+	lockedUntil, err := checkLockouts(ctx, map[throttlePolicy]string{
+		loginAccountPolicy: creds.Email,
+		loginIPPolicy:      ip,
+	})
+	if err != nil {
+		log.Printf("Error checking login lockout: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !lockedUntil.IsZero() {
+		writeTooManyRequests(w, "Too many failed login attempts.", time.Until(lockedUntil))
+		return
+	}
+
+	user, err := db.Users.GetByEmail(ctx, creds.Email)
+	if err == db.ErrUserNotFound {
+		// Count unknown emails like a wrong password so lockouts do not
+		// reveal which emails are registered.
+		recordLoginFailure(ctx, creds.Email, ip)
+		WriteJSONError(w, "Invalid email or password", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		log.Printf("Error finding user: %v", err)
 		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
 		return
-	} else {
-		// Attempt to find user in university_users collection
-		err = universityCollection.FindOne(ctx, bson.M{"email": creds.Email}).Decode(&user)
-		if err == nil {
-			studentType = StudentTypeUniversity
-		} else if err != mongo.ErrNoDocuments {
-			log.Printf("Error finding user in university_users: %v", err)
-			WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
-			return
-		} else {
-			// User not found in either collection
-			WriteJSONError(w, "Invalid email or password", http.StatusUnauthorized)
-			return
-		}
 	}
 
 	// Compare the hashed password
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(creds.Password))
 	if err != nil {
+		recordLoginFailure(ctx, creds.Email, ip)
 		WriteJSONError(w, "Invalid email or password", http.StatusUnauthorized)
 		return
 	}
 
-	// Generate JWT Token, now including studentType
-	tokenString, err := generateToken(user.ID, user.Institution, studentType)
+	if err := loginAccountPolicy.reset(ctx, creds.Email); err != nil {
+		log.Printf("Error resetting login attempts: %v", err)
+	}
+
+	// Deleted accounts can only be brought back through POST /account/restore.
+	if user.DeletedAt != nil {
+		WriteJSON(w, map[string]interface{}{
+			"error":      "This account is scheduled for deletion. Restore it to log in again.",
+			"restorable": user.PurgeAfter == nil || time.Now().Before(*user.PurgeAfter),
+			"purgeAfter": user.PurgeAfter,
+		}, http.StatusForbidden)
+		return
+	}
+
+	// With two-factor authentication on, the password only earns a challenge token
+	// that POST /login/2fa exchanges for a session together with a code.
+	if user.TwoFactorEnabled {
+		challenge, err := generateTwoFactorChallenge(user.ID, twoFactorChallengeAudience)
+		if err != nil {
+			log.Printf("Error generating two-factor challenge: %v", err)
+			WriteJSONError(w, "Could not generate token", http.StatusInternalServerError)
+			return
+		}
+		WriteJSON(w, map[string]interface{}{
+			"twoFactorRequired": true,
+			"challengeToken":    challenge,
+			"expiresIn":         int64(twoFactorChallengeTTL.Seconds()),
+		}, http.StatusOK)
+		return
+	}
+
+	// Start a session and issue the access/refresh token pair
+	tokens, err := issueSession(ctx, r, user.ID, user.Institution, user.StudentType, user.Roles)
 	if err != nil {
 		log.Printf("Error generating token: %v", err)
 		WriteJSONError(w, "Could not generate token", http.StatusInternalServerError)
 		return
 	}
 
-	// Respond with the token and user information including studentType
+	// Respond with the tokens and user information including studentType
 	response := map[string]interface{}{
-		"token":       tokenString,
-		"userId":      user.ID.Hex(),
-		"institution": user.Institution,
-		"studentType": studentType,
+		"token":        tokens.AccessToken,
+		"refreshToken": tokens.RefreshToken,
+		"expiresIn":    tokens.ExpiresIn,
+		"userId":       user.ID.Hex(),
+		"institution":  user.Institution,
+		"studentType":  user.StudentType,
+		"roles":        user.Roles,
 	}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
 
-// generateVerificationCode creates a random 6-digit code.
-func generateVerificationCode() string {
-	rand.Seed(time.Now().UnixNano())
-	return fmt.Sprintf("%06d", rand.Intn(1000000))
+// recordLoginFailure counts a failed login against both the account and the IP.
+func recordLoginFailure(ctx context.Context, email, ip string) {
+	if err := loginAccountPolicy.recordFailure(ctx, email); err != nil {
+		log.Printf("Error recording failed login for account: %v", err)
+	}
+	if err := loginIPPolicy.recordFailure(ctx, ip); err != nil {
+		log.Printf("Error recording failed login for IP: %v", err)
+	}
 }
 
-// sendVerificationEmail sends an email with the verification code.
-func sendVerificationEmail(email string, code string) error {
-	smtpHost := os.Getenv("SMTP_HOST")
-	smtpPort := os.Getenv("SMTP_PORT")
-	senderEmail := os.Getenv("SMTP_USER")
-	senderPassword := os.Getenv("SMTP_PASS")
-
-	auth := smtp.PlainAuth("", senderEmail, senderPassword, smtpHost)
-
-	// Email content
-	subject := "Your Gridly Verification Code"
-	body := fmt.Sprintf("Your verification code is: %s", code)
-	message := []byte("Subject: " + subject + "\r\n" +
-		"From: " + senderEmail + "\r\n" +
-		"To: " + email + "\r\n" +
-		"Content-Type: text/plain; charset=UTF-8\r\n\r\n" +
-		body)
-
-	// Send email
-	err := smtp.SendMail(smtpHost+":"+smtpPort, auth, senderEmail, []string{email}, message)
+// generateVerificationCode creates a random 6-digit code from a cryptographically secure source.
+func generateVerificationCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
 	if err != nil {
-		log.Printf("Error sending email: %v", err)
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// sendVerificationEmail queues an email with the verification code.
+func sendVerificationEmail(email string, code string) error {
+	data := mailer.CodeData{Code: code, ExpiresInMinutes: int(verificationCodeTTL.Minutes())}
+	if err := mailer.SendTemplate(mailer.TemplateVerification, data, email); err != nil {
+		log.Printf("Error queueing verification email: %v", err)
 		return err
 	}
+	return nil
+}
 
-	log.Println("Verification email sent to:", email)
+// sendPasswordResetEmail queues an email with a password reset code.
+func sendPasswordResetEmail(email string, code string) error {
+	data := mailer.CodeData{Code: code, ExpiresInMinutes: int(passwordResetCodeTTL.Minutes())}
+	if err := mailer.SendTemplate(mailer.TemplatePasswordReset, data, email); err != nil {
+		log.Printf("Error queueing password reset email: %v", err)
+		return err
+	}
 	return nil
 }
 
@@ -204,6 +249,7 @@ type PendingUser struct {
 	LastName         string             `bson:"lastName"`
 	StudentType      string             `bson:"studentType"`
 	Institution      string             `bson:"institution"`
+	InstitutionID    primitive.ObjectID `bson:"institutionId,omitempty"`
 	ProfilePic       string             `bson:"profilePic,omitempty"`
 	VerificationCode string             `bson:"verificationCode"`
 	ExpiresAt        time.Time          `bson:"expiresAt"`
@@ -217,6 +263,11 @@ type VerifyRequest struct {
 	Code  string `json:"code"`
 }
 
+// ResendVerificationRequest represents the payload for requesting a new verification code.
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
 // ----- Modified SignupHandler -----
 
 // SignupHandler now creates a pending user record and sends a verification email.
@@ -240,6 +291,32 @@ func SignupHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	registryCtx, registryCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer registryCancel()
+
+	// Resolve the institution against the registry and make sure the email belongs to it.
+	institution, err := db.FindInstitutionByName(registryCtx, req.Institution)
+	if err == db.ErrInstitutionNotFound {
+		WriteJSONError(w, "Institution not recognized", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("Error resolving institution %q: %v", req.Institution, err)
+		WriteJSONError(w, "Error checking institution", http.StatusInternalServerError)
+		return
+	}
+	if institution.StudentType != "" && req.StudentType != institution.StudentType {
+		WriteJSONError(w, "Institution does not match the selected student type", http.StatusBadRequest)
+		return
+	}
+	if len(institution.EmailDomains) == 0 {
+		WriteJSONError(w, "Signups for "+institution.Name+" are not open yet", http.StatusBadRequest)
+		return
+	}
+	if !db.EmailAllowedForInstitution(req.Email, institution) {
+		WriteJSONError(w, "Please sign up with your "+institution.Name+" email address", http.StatusBadRequest)
+		return
+	}
+
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -247,41 +324,63 @@ func SignupHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if the user already exists in the actual user collections.
-	highSchoolCollection := db.GetCollection("gridlyapp", "highschool_users")
-	universityCollection := db.GetCollection("gridlyapp", "university_users")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	countHS, err := highSchoolCollection.CountDocuments(ctx, bson.M{"email": req.Email})
+	// Check if the user already exists.
+	exists, err := db.Users.EmailExists(ctx, req.Email)
 	if err != nil {
 		WriteJSONError(w, "Error checking existing user", http.StatusInternalServerError)
 		return
 	}
-	countUni, err := universityCollection.CountDocuments(ctx, bson.M{"email": req.Email})
-	if err != nil {
-		WriteJSONError(w, "Error checking existing user", http.StatusInternalServerError)
+	if exists {
+		WriteJSONError(w, "User already exists", http.StatusConflict)
 		return
 	}
-	if countHS > 0 || countUni > 0 {
-		WriteJSONError(w, "User already exists", http.StatusConflict)
+
+	// The pending record's ID becomes the account's ID once verified.
+	userID := primitive.NewObjectID()
+
+	// Uploads need an account, but clients still send the picture they stored
+	// where images went before this service. That one is kept; any other reference
+	// is dropped rather than failing the signup, and a picture can be uploaded once
+	// the email is verified.
+	profilePic := req.ProfilePic
+	if profilePic != "" {
+		refs := []string{profilePic}
+		if err := validateImageRefs(ctx, userID, refs, legacyImageRefs(refs)); err == errInvalidImageRef {
+			log.Printf("Ignoring profile picture of signup %s: not an uploaded image", req.Email)
+			profilePic = ""
+		} else if err != nil {
+			writeImageRefError(w, err)
+			return
+		}
+	}
+
+	// Signing up again sends a new email, so it shares the resend limit.
+	if !allowVerificationEmail(ctx, w, req.Email, clientIP(r)) {
 		return
 	}
 
 	// Generate a verification code and create a pending user record.
-	verificationCode := generateVerificationCode()
-	// Set the verification code to expire in 15 minutes.
-	expiresAt := time.Now().Add(15 * time.Minute)
+	verificationCode, err := generateVerificationCode()
+	if err != nil {
+		log.Printf("Error generating verification code: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	expiresAt := time.Now().Add(verificationCodeTTL)
 
 	pendingUser := PendingUser{
-		ID:               primitive.NewObjectID(),
+		ID:               userID,
 		Email:            req.Email,
 		Password:         string(hashedPassword),
 		FirstName:        req.FirstName,
 		LastName:         req.LastName,
 		StudentType:      req.StudentType,
-		Institution:      req.Institution,
-		ProfilePic:       req.ProfilePic, // Store profile picture
+		Institution:      institution.Name, // Canonical registry name
+		InstitutionID:    institution.ID,
+		ProfilePic:       profilePic,
 		VerificationCode: verificationCode,
 		ExpiresAt:        expiresAt,
 		Grids:            0,
@@ -299,8 +398,11 @@ func SignupHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Send the verification email asynchronously.
-	go sendVerificationEmail(req.Email, verificationCode)
+	// Queue the verification email; delivery happens in the background.
+	if err := sendVerificationEmail(req.Email, verificationCode); err != nil {
+		WriteJSONError(w, "Error sending verification email", http.StatusInternalServerError)
+		return
+	}
 
 	// Respond to the client.
 	response := map[string]interface{}{
@@ -311,6 +413,79 @@ func SignupHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// allowVerificationEmail applies the verification email rate limits and writes a 429 when they are exceeded.
+func allowVerificationEmail(ctx context.Context, w http.ResponseWriter, email, ip string) bool {
+	return allowRateLimits(ctx, w, "Too many verification emails requested.", map[rateLimit]string{
+		verificationEmailLimit:   email,
+		verificationEmailIPLimit: ip,
+	})
+}
+
+// ResendVerificationHandler emails a fresh verification code for a pending signup.
+// It responds the same way whether or not a pending signup exists.
+func ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		WriteJSONError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ResendVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteJSONError(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if req.Email == "" {
+		WriteJSONError(w, "Email is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if !allowVerificationEmail(ctx, w, req.Email, clientIP(r)) {
+		return
+	}
+
+	response := map[string]string{
+		"message": "If a signup is pending for this email, a new verification code has been sent.",
+	}
+
+	verificationCode, err := generateVerificationCode()
+	if err != nil {
+		log.Printf("Error generating verification code: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	pendingCollection := db.GetCollection("gridlyapp", "pending_users")
+	res, err := pendingCollection.UpdateOne(ctx,
+		bson.M{"email": req.Email},
+		bson.M{"$set": bson.M{
+			"verificationCode": verificationCode,
+			"expiresAt":        time.Now().Add(verificationCodeTTL),
+		}},
+	)
+	if err != nil {
+		log.Printf("Error updating pending user: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if res.MatchedCount == 0 {
+		WriteJSON(w, response, http.StatusOK)
+		return
+	}
+
+	// Queue the verification email; delivery happens in the background.
+	if err := sendVerificationEmail(req.Email, verificationCode); err != nil {
+		WriteJSONError(w, "Error sending verification email", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, response, http.StatusOK)
+}
+
 // ----- New VerifyEmailHandler Endpoint -----
 
 // VerifyEmailHandler accepts the email and verification code,
@@ -339,8 +514,24 @@ func VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	// Refuse outright while the email or the caller's IP is locked out
+	ip := clientIP(r)
+	lockedUntil, err := checkLockouts(ctx, map[throttlePolicy]string{
+		verifyAccountPolicy: req.Email,
+		verifyIPPolicy:      ip,
+	})
+	if err != nil {
+		log.Printf("Error checking verification lockout: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !lockedUntil.IsZero() {
+		writeTooManyRequests(w, "Too many incorrect verification codes.", time.Until(lockedUntil))
+		return
+	}
+
 	var pendingUser PendingUser
-	err := pendingCollection.FindOne(ctx, bson.M{"email": req.Email}).Decode(&pendingUser)
+	err = pendingCollection.FindOne(ctx, bson.M{"email": req.Email}).Decode(&pendingUser)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			WriteJSONError(w, "No pending signup found for this email", http.StatusNotFound)
@@ -351,48 +542,49 @@ func VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate the verification code.
-	if pendingUser.VerificationCode != req.Code {
-		WriteJSONError(w, "Invalid verification code", http.StatusUnauthorized)
+	// Check if the verification code has expired. The pending signup is kept so a new code can be requested.
+	if time.Now().After(pendingUser.ExpiresAt) {
+		WriteJSONError(w, "Verification code expired. Please request a new code.", http.StatusUnauthorized)
 		return
 	}
 
-	// Check if the verification code has expired.
-	if time.Now().After(pendingUser.ExpiresAt) {
-		_, delErr := pendingCollection.DeleteOne(ctx, bson.M{"email": req.Email})
-		if delErr != nil {
-			log.Printf("Error deleting expired pending user: %v", delErr)
+	// Validate the verification code.
+	if subtle.ConstantTimeCompare([]byte(pendingUser.VerificationCode), []byte(req.Code)) != 1 {
+		if err := verifyAccountPolicy.recordFailure(ctx, req.Email); err != nil {
+			log.Printf("Error recording failed verification for account: %v", err)
 		}
-		WriteJSONError(w, "Verification code expired. Please sign up again.", http.StatusUnauthorized)
+		if err := verifyIPPolicy.recordFailure(ctx, ip); err != nil {
+			log.Printf("Error recording failed verification for IP: %v", err)
+		}
+		WriteJSONError(w, "Invalid verification code", http.StatusUnauthorized)
 		return
 	}
 
+	if err := verifyAccountPolicy.reset(ctx, req.Email); err != nil {
+		log.Printf("Error resetting verification attempts: %v", err)
+	}
+
 	// Create a new user object
 	newUser := models.User{
-		ID:          pendingUser.ID,
-		Email:       pendingUser.Email,
-		Password:    pendingUser.Password,
-		FirstName:   pendingUser.FirstName,
-		LastName:    pendingUser.LastName,
-		StudentType: pendingUser.StudentType,
-		Institution: pendingUser.Institution,
-		ProfilePic:  pendingUser.ProfilePic,
-		CreatedAt:   time.Now(),
-		Grids:       pendingUser.Grids,
-		UpdatedAt:   time.Now(),
-	}
-
-	// Determine the correct collection
-	var collectionName string
-	if pendingUser.StudentType == StudentTypeUniversity {
-		collectionName = "university_users"
-	} else {
-		collectionName = "highschool_users"
-	}
-	userCollection := db.GetCollection("gridlyapp", collectionName)
-
-	_, err = userCollection.InsertOne(ctx, newUser)
-	if err != nil {
+		ID:            pendingUser.ID,
+		Email:         pendingUser.Email,
+		Password:      pendingUser.Password,
+		FirstName:     pendingUser.FirstName,
+		LastName:      pendingUser.LastName,
+		StudentType:   pendingUser.StudentType,
+		Institution:   pendingUser.Institution,
+		InstitutionID: pendingUser.InstitutionID,
+		ProfilePic:    pendingUser.ProfilePic,
+		CreatedAt:     time.Now(),
+		Grids:         pendingUser.Grids,
+		UpdatedAt:     time.Now(),
+	}
+
+	err = db.Users.Create(ctx, &newUser)
+	if err == db.ErrEmailTaken {
+		WriteJSONError(w, "User already exists", http.StatusConflict)
+		return
+	} else if err != nil {
 		log.Printf("Error creating user: %v", err)
 		WriteJSONError(w, "Error creating user account", http.StatusInternalServerError)
 		return
@@ -404,118 +596,31 @@ func VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Error deleting pending user record: %v", delErr)
 	}
 
-	// 🔥 **Generate JWT Token**
-	tokenString, err := generateToken(newUser.ID, newUser.Institution, newUser.StudentType)
+	// 🔥 **Start a session and generate the token pair**
+	tokens, err := issueSession(ctx, r, newUser.ID, newUser.Institution, newUser.StudentType, newUser.Roles)
 	if err != nil {
 		log.Printf("Error generating token: %v", err)
 		WriteJSONError(w, "Could not generate token", http.StatusInternalServerError)
 		return
 	}
 
-	// 🔥 **Send Token in Response**
+	// 🔥 **Send Tokens in Response**
 	response := map[string]interface{}{
-		"message":     "Email verified successfully. Your account is now active.",
-		"userId":      newUser.ID.Hex(),
-		"institution": newUser.Institution,
-		"studentType": newUser.StudentType,
-		"profilePic":  newUser.ProfilePic,
-		"token":       tokenString, // ✅ Include the token
-		"grids":       newUser.Grids,
+		"message":      "Email verified successfully. Your account is now active.",
+		"userId":       newUser.ID.Hex(),
+		"institution":  newUser.Institution,
+		"studentType":  newUser.StudentType,
+		"profilePic":   newUser.ProfilePic,
+		"token":        tokens.AccessToken, // ✅ Include the token
+		"refreshToken": tokens.RefreshToken,
+		"expiresIn":    tokens.ExpiresIn,
+		"grids":        newUser.Grids,
 	}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
 
-// DeleteAccountHandler handles deletion of the user account along with all associated data.
-func DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	if r.Method != http.MethodDelete {
-		WriteJSONError(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// Extract token from header.
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		WriteJSONError(w, "Authorization token required", http.StatusUnauthorized)
-		return
-	}
-	// Expecting "Bearer <token>"
-	tokenString := authHeader[len("Bearer "):]
-	jwtKey := []byte(os.Getenv("JWT_SECRET_KEY"))
-
-	// Parse and validate JWT.
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
-	if err != nil || !token.Valid {
-		WriteJSONError(w, "Invalid or expired token", http.StatusUnauthorized)
-		return
-	}
-
-	// Convert user ID from the token.
-	userID, err := primitive.ObjectIDFromHex(claims.UserID)
-	if err != nil {
-		WriteJSONError(w, "Invalid user ID", http.StatusBadRequest)
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	// Determine the user's collection.
-	var userCollectionName string
-	if claims.StudentType == StudentTypeUniversity {
-		userCollectionName = "university_users"
-	} else {
-		userCollectionName = "highschool_users"
-	}
-	userCollection := db.GetCollection("gridlyapp", userCollectionName)
-
-	// Delete the user document.
-	_, err = userCollection.DeleteOne(ctx, bson.M{"_id": userID})
-	if err != nil {
-		log.Printf("Error deleting user account: %v", err)
-		WriteJSONError(w, "Error deleting account", http.StatusInternalServerError)
-		return
-	}
-
-	// Delete all products associated with the user.
-	productsCollection := db.GetCollection("gridlyapp", "products")
-	_, err = productsCollection.DeleteMany(ctx, bson.M{"userId": userID})
-	if err != nil {
-		log.Printf("Error deleting user's products: %v", err)
-		// Log error but proceed.
-	}
-
-	// Delete all gigs associated with the user.
-	gigsCollection := db.GetCollection("gridlyapp", "gigs")
-	_, err = gigsCollection.DeleteMany(ctx, bson.M{"userId": userID})
-	if err != nil {
-		log.Printf("Error deleting user's gigs: %v", err)
-		// Log error but proceed.
-	}
-
-	// Delete all product requests associated with the user.
-	// This uses the "product_requests" collection and deletes documents where "userId" matches.
-	requestsCollection := db.GetCollection("gridlyapp", "product_requests")
-	_, err = requestsCollection.DeleteMany(ctx, bson.M{"userId": userID})
-	if err != nil {
-		log.Printf("Error deleting user's product requests: %v", err)
-		// Log error but proceed.
-	}
-
-	// Respond with success.
-	response := map[string]interface{}{
-		"message": "Account and all associated data deleted successfully.",
-	}
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
-}
-
 // UpdateProfilePicHandler allows users to update their profile picture.
 func UpdateProfilePicHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -569,21 +674,17 @@ func UpdateProfilePicHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Determine the correct collection.
-	var userCollectionName string
-	if claims.StudentType == StudentTypeUniversity {
-		userCollectionName = "university_users"
-	} else {
-		userCollectionName = "highschool_users"
-	}
-	userCollection := db.GetCollection("gridlyapp", userCollectionName)
-
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	if err := validateImageRefs(ctx, userID, []string{req.ProfilePic}, nil); err != nil {
+		writeImageRefError(w, err)
+		return
+	}
+
 	// Update the user's profile picture.
 	update := bson.M{"$set": bson.M{"profilePic": req.ProfilePic}}
-	_, err = userCollection.UpdateOne(ctx, bson.M{"_id": userID}, update)
+	err = db.Users.Update(ctx, userID, update)
 	if err != nil {
 		log.Printf("Error updating profile picture: %v", err)
 		WriteJSONError(w, "Failed to update profile picture", http.StatusInternalServerError)
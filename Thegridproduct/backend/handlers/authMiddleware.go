@@ -9,11 +9,16 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
+
+	"Thegridproduct/backend/db"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/gorilla/mux"
 )
 
-// AuthMiddleware validates JWT tokens and sets userID, institution, and studentType in the context.
+// AuthMiddleware validates JWT tokens, checks that their session is still active,
+// and sets userID, institution, studentType, sessionID and roles in the context.
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -58,11 +63,26 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		// Check required claims
 		if strings.TrimSpace(claims.UserID) == "" ||
 			strings.TrimSpace(claims.Institution) == "" ||
-			strings.TrimSpace(claims.StudentType) == "" {
+			strings.TrimSpace(claims.StudentType) == "" ||
+			strings.TrimSpace(claims.SessionID) == "" {
 			WriteJSONError(w, "Invalid or missing claims in token", http.StatusUnauthorized)
 			return
 		}
 
+		// Reject tokens whose session was revoked (logout, password change, account deletion)
+		sessionCtx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		active, err := db.IsSessionActive(sessionCtx, claims.SessionID)
+		cancel()
+		if err != nil {
+			log.Printf("Error checking session %s: %v", claims.SessionID, err)
+			WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !active {
+			WriteJSONError(w, "Session has been revoked", http.StatusUnauthorized)
+			return
+		}
+
 		// Debug logs for development (optional, remove in production)
 		log.Printf("Authenticated UserID: %s, Institution: %s, StudentType: %s", claims.UserID, claims.Institution, claims.StudentType)
 
@@ -70,8 +90,39 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		ctx := context.WithValue(r.Context(), userIDKey, claims.UserID)
 		ctx = context.WithValue(ctx, userInstitution, claims.Institution)
 		ctx = context.WithValue(ctx, userStudentType, claims.StudentType)
+		ctx = context.WithValue(ctx, sessionIDKey, claims.SessionID)
+		ctx = context.WithValue(ctx, userRolesKey, claims.Roles)
 
 		// Proceed with the next handler
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// RequireRole returns a middleware that only lets through users holding at least one
+// of the given roles. It reads the roles AuthMiddleware put in the context, so it must
+// be mounted on a subrouter that already runs AuthMiddleware.
+func RequireRole(roles ...string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userRoles, _ := r.Context().Value(userRolesKey).([]string)
+			for _, role := range roles {
+				if hasRole(userRoles, role) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			WriteJSONError(w, "You do not have permission to access this resource", http.StatusForbidden)
+		})
+	}
+}
+
+// hasRole reports whether role is among roles.
+func hasRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"Thegridproduct/backend/models"
+)
+
+func TestRequireRole(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	moderation := RequireRole(models.RoleAdmin, models.RoleModerator)(next)
+	admin := RequireRole(models.RoleAdmin)(next)
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		roles   []string
+		want    int
+	}{
+		{"moderator on moderation routes", moderation, []string{models.RoleModerator}, http.StatusNoContent},
+		{"admin on moderation routes", moderation, []string{models.RoleAdmin}, http.StatusNoContent},
+		{"member on moderation routes", moderation, nil, http.StatusForbidden},
+		{"moderator on admin routes", admin, []string{models.RoleModerator}, http.StatusForbidden},
+		{"admin among other roles", admin, []string{models.RoleModerator, models.RoleAdmin}, http.StatusNoContent},
+		{"unknown role", admin, []string{"superuser"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("DELETE", "/moderation/products/1", nil)
+			if tt.roles != nil {
+				r = r.WithContext(context.WithValue(r.Context(), userRolesKey, tt.roles))
+			}
+			w := httptest.NewRecorder()
+			tt.handler.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
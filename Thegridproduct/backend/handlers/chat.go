@@ -11,6 +11,7 @@ import (
 
 	"Thegridproduct/backend/db"
 	"Thegridproduct/backend/models"
+	"Thegridproduct/backend/realtime"
 
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson"
@@ -63,57 +64,56 @@ func (e *AppError) Error() string {
 	return e.Message
 }
 
-// GetChatHandler fetches chat details by reference ID (product or gig).
+// GetChatHandler fetches a chat the caller takes part in, with a page of its messages.
+// Without history parameters it returns the newest messages; older ones are paged in
+// with the same before/after/since cursors the messages endpoint accepts.
+// Endpoint: GET /chats/{chatId}
 func GetChatHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	referenceIDStr, ok := vars["referenceId"] // Can be either ProductID or GigID
-	if !ok || referenceIDStr == "" {
-		WriteJSONError(w, "Reference ID is required", http.StatusBadRequest)
-		return
-	}
-
-	referenceType, ok := vars["referenceType"]
-	if !ok || (referenceType != "product" && referenceType != "gig" && referenceType != "product_request") {
-		WriteJSONError(w, "Valid referenceType (product, gig, or product_request) is required", http.StatusBadRequest)
-		return
-	}
+	w.Header().Set("Content-Type", "application/json")
 
-	// Fetch chat from MongoDB
-	chat, err := db.GetChatByReferenceID(referenceIDStr, referenceType)
+	page, err := parseMessagePage(r)
 	if err != nil {
-		WriteJSONError(w, "Chat not found", http.StatusNotFound)
+		WriteJSONError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if !page.paginate {
+		page = messagePage{paginate: true, query: db.MessageQuery{Limit: defaultPageSize}}
+	}
 
-	// Use global Firestore client
-	ctx := context.Background()
-	chatDocRef := fsClient.Collection("chatRooms").Doc(chat.ID.Hex())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	docSnap, err := chatDocRef.Get(ctx)
-	if err != nil {
-		log.Printf("Firestore chat not found: %v", err)
-		WriteJSONError(w, "Chat not found in Firestore", http.StatusNotFound)
+	chat, _, ok := participantChat(ctx, w, r)
+	if !ok {
 		return
 	}
 
-	var firestoreData map[string]interface{}
-	if err := docSnap.DataTo(&firestoreData); err != nil {
-		log.Printf("Failed to parse Firestore chat: %v", err)
+	messages, more, err := db.Messages.List(ctx, chat.ID, page.query)
+	if err == db.ErrMessageNotFound {
+		WriteJSONError(w, "Cursor is not a message of this chat", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("Failed to fetch messages for chat %s: %v", chat.ID.Hex(), err)
+		WriteJSONError(w, "Error retrieving chat details", http.StatusInternalServerError)
+		return
+	}
+	views, err := messageViews(ctx, chat, messages)
+	if err != nil {
+		log.Printf("Failed to fetch read state for chat %s: %v", chat.ID.Hex(), err)
 		WriteJSONError(w, "Error retrieving chat details", http.StatusInternalServerError)
 		return
 	}
-
-	// Extract messages from Firestore
-	messages, _ := firestoreData["messages"].([]interface{})
 
 	// Construct response
 	enrichedChat := map[string]interface{}{
-		"chatID":        chat.ID.Hex(),
-		"referenceID":   chat.ReferenceID.Hex(),
-		"referenceType": chat.ReferenceType,
-		"buyerID":       chat.BuyerID.Hex(),
-		"sellerID":      chat.SellerID.Hex(),
-		"messages":      messages,
+		"chatID":          chat.ID.Hex(),
+		"referenceID":     chat.ReferenceID.Hex(),
+		"referenceType":   chat.ReferenceType,
+		"buyerID":         chat.BuyerID.Hex(),
+		"sellerID":        chat.SellerID.Hex(),
+		"messages":        views,
+		"hasMoreMessages": more,
+		"messagesCursor":  nextMessageCursor(page, messages, more),
 	}
 
 	WriteJSON(w, enrichedChat, http.StatusOK)
@@ -135,7 +135,20 @@ func GetChatsByUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	chatIDs := make([]primitive.ObjectID, 0, len(chats))
+	for _, c := range chats {
+		chatIDs = append(chatIDs, c.ID)
+	}
+	latestMessages, err := db.Messages.Latest(ctx, chatIDs)
+	if err != nil {
+		log.Printf("❌ Failed to fetch latest messages for user %s: %v", userIDStr, err)
+		WriteJSONError(w, "Failed to fetch chats", http.StatusInternalServerError)
+		return
+	}
+
 	var enrichedChats []EnrichedChat
 
 	for _, c := range chats {
@@ -192,70 +205,17 @@ func GetChatsByUserHandler(w http.ResponseWriter, r *http.Request) {
 			otherUser = User{FirstName: userData.FirstName, LastName: userData.LastName}
 		}
 
-		// Fetch messages from Firestore using the global Firestore client
-		chatDocRef := fsClient.Collection("chatRooms").Doc(c.ID.Hex())
-		docSnap, err := chatDocRef.Get(ctx)
-		if err != nil {
-			log.Printf("⚠️ No Firestore chat found for chatID %s: %v", c.ID.Hex(), err)
-			continue
-		}
-
-		// Parse Firestore messages
-		var messages []models.Message
-		messagesData, exists := docSnap.Data()["messages"]
-		if !exists {
-			log.Printf("ℹ️ No messages found for chatID %s", c.ID.Hex())
-			continue
-		}
-
-		messageSlice, ok := messagesData.([]interface{})
-		if !ok {
-			log.Printf("❌ Failed to parse messages for chatID %s (Type Assertion Failed)", c.ID.Hex())
-			continue
-		}
-
-		// Iterate over messages properly
-		for _, msg := range messageSlice {
-			msgMap, ok := msg.(map[string]interface{})
-			if !ok {
-				log.Printf("⚠️ Skipping message due to type mismatch in chatID %s", c.ID.Hex())
-				continue
-			}
-
-			// Parse the timestamp
-			timestampStr, ok := msgMap["timestamp"].(string)
-			if !ok {
-				log.Printf("⚠️ Skipping message due to missing timestamp in chatID %s", c.ID.Hex())
-				continue
-			}
-
-			parsedTime, err := time.Parse(time.RFC3339, timestampStr)
-			if err != nil {
-				log.Printf("⚠️ Skipping message due to timestamp parsing error in chatID %s: %v", c.ID.Hex(), err)
-				continue
-			}
-
-			// Create a Message struct
-			message := models.Message{
-				ID:        msgMap["_id"].(string),
-				SenderID:  msgMap["senderId"].(string),
-				Content:   msgMap["content"].(string),
-				Timestamp: parsedTime,
-			}
-			messages = append(messages, message)
-		}
-
-		latestMessage, latestTimestamp := getLatestMessageAndTimestamp(messages)
-
 		// Append enriched chat details
 		enrichedChat := EnrichedChat{
-			ChatID:          c.ID.Hex(),
-			ReferenceID:     c.ReferenceID.Hex(),
-			ReferenceTitle:  referenceTitle,
-			ReferenceType:   referenceType,
-			User:            otherUser, // ✅ Now handles anonymous case
-			LatestMessage:   latestMessage,
-			LatestTimestamp: latestTimestamp,
+			ChatID:         c.ID.Hex(),
+			ReferenceID:    c.ReferenceID.Hex(),
+			ReferenceTitle: referenceTitle,
+			ReferenceType:  referenceType,
+			User:           otherUser, // ✅ Now handles anonymous case
+		}
+		if latest, ok := latestMessages[c.ID]; ok {
+			enrichedChat.LatestMessage = latest.Content
+			enrichedChat.LatestTimestamp = latest.Timestamp.Format(time.RFC3339)
 		}
 
 		enrichedChats = append(enrichedChats, enrichedChat)
@@ -279,80 +239,65 @@ func init() {
 	log.Println("✅ Firestore client initialized successfully")
 }
 
+// AddMessageHandler stores a message from the caller and sends the other
+// participant a push notification.
+// Endpoint: POST /chats/{chatId}/messages
 func AddMessageHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	chatID := vars["chatId"]
-	if chatID == "" {
-		WriteJSONError(w, "Chat ID is required", http.StatusBadRequest)
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	chat, userID, ok := participantChat(ctx, w, r)
+	if !ok {
 		return
 	}
 
-	var message models.Message
-	if err := json.NewDecoder(r.Body).Decode(&message); err != nil {
+	var req struct {
+		SenderID string `json:"senderId"`
+		Content  string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		WriteJSONError(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
 
 	// Ensure required fields exist.
-	if message.SenderID == "" || message.Content == "" {
-		WriteJSONError(w, "Sender ID and content are required", http.StatusBadRequest)
+	if req.Content == "" {
+		WriteJSONError(w, "Content is required", http.StatusBadRequest)
 		return
 	}
-
-	message.Timestamp = time.Now().UTC()
-
-	ctx := context.Background()
-	chatDocRef := fsClient.Collection("chatRooms").Doc(chatID)
-
-	// Generate a unique ID for the message.
-	messageData := map[string]interface{}{
-		"_id":       primitive.NewObjectID().Hex(),
-		"senderId":  message.SenderID,
-		"content":   message.Content,
-		"timestamp": message.Timestamp.Format(time.RFC3339),
-	}
-
-	// Update Firestore chat room with the new message.
-	_, err := chatDocRef.Update(ctx, []firestore.Update{
-		{Path: "messages", Value: firestore.ArrayUnion(messageData)},
-	})
-	if err != nil {
-		log.Printf("❌ Failed to add message to Firestore: %v", err)
-		WriteJSONError(w, "Failed to send message", http.StatusInternalServerError)
+	// Clients still send their own ID along; it has to be the caller's.
+	if req.SenderID != "" && req.SenderID != userID {
+		WriteJSONError(w, "SenderID does not match the authenticated user", http.StatusForbidden)
 		return
 	}
 
-	log.Printf("✅ Message added to chat room: %s", chatID)
-
-	// 🔹 Fetch chat document to determine recipient
-	docSnap, err := chatDocRef.Get(ctx)
-	if err != nil {
-		log.Printf("❌ Failed to retrieve chat document: %v", err)
-		WriteJSONError(w, "Failed to fetch chat details", http.StatusInternalServerError)
+	message := models.Message{
+		ChatID:   chat.ID,
+		SenderID: userID,
+		Content:  req.Content,
+	}
+	if err := db.Messages.Append(ctx, &message); err != nil {
+		log.Printf("❌ Failed to store message: %v", err)
+		WriteJSONError(w, "Failed to send message", http.StatusInternalServerError)
 		return
 	}
 
-	chatData := docSnap.Data()
-	buyerID, okBuyer := chatData["buyerID"].(string)
-	sellerID, okSeller := chatData["sellerID"].(string)
-	if !okBuyer || !okSeller {
-		WriteJSONError(w, "Chat document missing buyerID or sellerID", http.StatusInternalServerError)
-		return
+	log.Printf("✅ Message added to chat room: %s", chat.ID.Hex())
+	if err := db.RecordInboxMessage(ctx, chat, message); err != nil {
+		log.Printf("Error updating inbox for chat %s: %v", chat.ID.Hex(), err)
 	}
+	publishEvent(realtime.EventMessage, message, chat.BuyerID, chat.SellerID)
 
-	// Determine recipient (the user who is NOT the sender)
-	var recipientID string
-	if message.SenderID == buyerID {
-		recipientID = sellerID
-	} else if message.SenderID == sellerID {
-		recipientID = buyerID
-	} else {
-		WriteJSONError(w, "SenderID does not match any chat participant", http.StatusBadRequest)
-		return
+	// The recipient is the participant who is not the sender
+	recipientID := chat.BuyerID
+	if userID == chat.BuyerID.Hex() {
+		recipientID = chat.SellerID
 	}
 
 	// 🔹 Fetch recipient details (for push token)
-	recipient, err := db.GetUserByID(recipientID)
+	recipient, err := db.Users.GetByID(ctx, recipientID)
 	if err != nil {
 		log.Printf("❌ Failed to fetch recipient user: %v", err)
 		WriteJSONError(w, "Failed to find recipient", http.StatusInternalServerError)
@@ -370,7 +315,7 @@ func AddMessageHandler(w http.ResponseWriter, r *http.Request) {
 	notificationBody := "You have a new message in your chat."
 
 	err = SendPushNotification(recipient.ExpoPushToken, notificationTitle, notificationBody, map[string]string{
-		"chatId": chatID,
+		"chatId": chat.ID.Hex(),
 	})
 	if err != nil {
 		log.Printf("❌ Error sending push notification: %v", err)
@@ -379,34 +324,58 @@ func AddMessageHandler(w http.ResponseWriter, r *http.Request) {
 	WriteJSON(w, map[string]string{"message": "Message sent successfully"}, http.StatusOK)
 }
 
+// GetMessagesHandler returns the history of a chat the caller takes part in. With
+// limit, before, after or since (see parseMessagePage) it responds with one page
+// in the paginated envelope; nextCursor continues in the same direction. Without
+// them it returns every message, oldest first.
+// Endpoint: GET /chats/{chatId}/messages
 func GetMessagesHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	chatIDStr, ok := vars["chatId"]
-	if !ok || chatIDStr == "" {
-		WriteJSONError(w, "Chat ID is required", http.StatusBadRequest)
-		return
-	}
+	w.Header().Set("Content-Type", "application/json")
 
-	// Use global Firestore client
-	ctx := context.Background()
-	chatDocRef := fsClient.Collection("chatRooms").Doc(chatIDStr)
-	docSnap, err := chatDocRef.Get(ctx)
+	page, err := parseMessagePage(r)
 	if err != nil {
-		log.Printf("Chat room not found in Firestore: %v", err)
-		WriteJSONError(w, "Chat room does not exist", http.StatusNotFound)
+		WriteJSONError(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if !page.paginate {
+		page.query = db.MessageQuery{Ascending: true}
+	}
 
-	// Parse messages from Firestore document
-	chatData := docSnap.Data()
-	messages, ok := chatData["messages"].([]interface{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	chat, _, ok := participantChat(ctx, w, r)
 	if !ok {
-		messages = []interface{}{}
+		return
 	}
 
-	// Return messages as JSON response
-	WriteJSON(w, messages, http.StatusOK)
+	messages, more, err := db.Messages.List(ctx, chat.ID, page.query)
+	if err == db.ErrMessageNotFound {
+		WriteJSONError(w, "Cursor is not a message of this chat", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("Error fetching messages for chat %s: %v", chat.ID.Hex(), err)
+		WriteJSONError(w, "Error fetching messages", http.StatusInternalServerError)
+		return
+	}
+	views, err := messageViews(ctx, chat, messages)
+	if err != nil {
+		log.Printf("Error fetching read state for chat %s: %v", chat.ID.Hex(), err)
+		WriteJSONError(w, "Error fetching messages", http.StatusInternalServerError)
+		return
+	}
+
+	if !page.paginate {
+		WriteJSON(w, views, http.StatusOK)
+		return
+	}
+	WriteJSON(w, pageResponse{
+		Items:      views,
+		NextCursor: nextMessageCursor(page, messages, more),
+		HasMore:    more,
+	}, http.StatusOK)
 }
+
 func RequestChatHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -459,6 +428,9 @@ func RequestChatHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer session.EndSession(context.Background())
 
+	// The new request, captured for the realtime event sent after the transaction.
+	var createdRequest models.ChatRequest
+
 	callback := func(sessCtx mongo.SessionContext) (interface{}, error) {
 		chatRequests := db.GetCollection("gridlyapp", "chat_requests")
 		var referenceTitle string
@@ -558,22 +530,13 @@ func RequestChatHandler(w http.ResponseWriter, r *http.Request) {
 		if err != nil {
 			return nil, err
 		}
+		createdRequest = chatRequest
 
 		// Fetch seller details to get the Expo push token.
-		usersCol := db.GetCollection("gridlyapp", "university_users")
-		var seller models.User
-		err = usersCol.FindOne(sessCtx, bson.M{"_id": sellerObjectID}).Decode(&seller)
-
+		seller, err := db.Users.GetByID(sessCtx, sellerObjectID)
 		if err != nil {
-			log.Printf("❌ Seller not found in university_users. Checking highschool_users...")
-
-			// If not found, check highschool_users
-			usersCol = db.GetCollection("gridlyapp", "highschool_users")
-			err = usersCol.FindOne(sessCtx, bson.M{"_id": sellerObjectID}).Decode(&seller)
-			if err != nil {
-				log.Printf("❌ Seller not found in highschool_users either. No push notification will be sent.")
-				return map[string]interface{}{"message": "Chat request sent successfully"}, nil
-			}
+			log.Printf("❌ Seller not found. No push notification will be sent.")
+			return map[string]interface{}{"message": "Chat request sent successfully"}, nil
 		}
 
 		// If seller has a push token, send notification
@@ -605,6 +568,7 @@ func RequestChatHandler(w http.ResponseWriter, r *http.Request) {
 		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	publishEvent(realtime.EventChatRequest, createdRequest, createdRequest.SellerID)
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(res)
@@ -696,6 +660,11 @@ func AcceptChatRequestHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		newChat.ID = res.InsertedID.(primitive.ObjectID)
 
+		// Seed the inbox with the chat, so no message sent to it goes uncounted
+		if err := db.SeedChatInbox(sessCtx, newChat); err != nil {
+			return nil, err
+		}
+
 		return nil, nil
 	}
 
@@ -710,17 +679,19 @@ func AcceptChatRequestHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create the corresponding Firestore chat room
-	err = createFirestoreChatRoom(
-		newChat.ID.Hex(),
-		newChat.BuyerID.Hex(),
-		newChat.SellerID.Hex(),
-		newChat.ReferenceID.Hex(),
-		newChat.ReferenceType,
-	)
-	if err != nil {
-		log.Printf("Chat created in MongoDB but failed to create Firestore chat room: %v", err)
-		// Optionally, you can handle this error differently if needed.
+	// Create the Firestore chat room new messages are mirrored to
+	if FirestoreMirrorEnabled() {
+		err = createFirestoreChatRoom(
+			newChat.ID.Hex(),
+			newChat.BuyerID.Hex(),
+			newChat.SellerID.Hex(),
+			newChat.ReferenceID.Hex(),
+			newChat.ReferenceType,
+		)
+		if err != nil {
+			log.Printf("Chat created in MongoDB but failed to create Firestore chat room: %v", err)
+			// Optionally, you can handle this error differently if needed.
+		}
 	}
 
 	var recipientID string
@@ -748,6 +719,14 @@ func AcceptChatRequestHandler(w http.ResponseWriter, r *http.Request) {
 		log.Println("🚫 Recipient does not have a push token; skipping notification.")
 	}
 
+	publishEvent(realtime.EventChatRequestAccepted, chatRequestOutcome{
+		RequestID:     acceptedRequest.ID.Hex(),
+		ChatID:        newChat.ID.Hex(),
+		ReferenceID:   acceptedRequest.ReferenceID.Hex(),
+		ReferenceType: acceptedRequest.ReferenceType,
+		Status:        models.ChatRequestStatusAccepted,
+	}, acceptedRequest.BuyerID, acceptedRequest.SellerID)
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "Chat request accepted and chat room created successfully",
@@ -857,6 +836,13 @@ func RejectChatRequestHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	publishEvent(realtime.EventChatRequestRejected, chatRequestOutcome{
+		RequestID:     rejectedRequest.ID.Hex(),
+		ReferenceID:   rejectedRequest.ReferenceID.Hex(),
+		ReferenceType: rejectedRequest.ReferenceType,
+		Status:        models.ChatRequestStatusRejected,
+	}, rejectedRequest.BuyerID, rejectedRequest.SellerID)
+
 	// --- After the transaction, send a push notification to the other party ---
 	var recipientID string
 	// Determine the recipient: if the current user is the buyer, then the recipient is the seller, and vice versa.
@@ -888,16 +874,6 @@ func RejectChatRequestHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// getLatestMessageAndTimestamp returns the content and timestamp of the last message.
-func getLatestMessageAndTimestamp(messages []models.Message) (string, string) {
-	if len(messages) == 0 {
-		return "", ""
-	}
-	latestMsg := messages[len(messages)-1].Content
-	latestTime := messages[len(messages)-1].Timestamp.Format(time.RFC3339)
-	return latestMsg, latestTime
-}
-
 func GetChatRequestsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -1088,40 +1064,32 @@ func TestSendMessageHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ctx := context.Background()
-	chatDocRef := fsClient.Collection("chatRooms").Doc(req.ChatID)
 
-	// Get the chat room document so we can determine the buyer and seller.
-	docSnap, err := chatDocRef.Get(ctx)
+	// Get the chat so we can determine the buyer and seller.
+	chat, err := db.GetChatByID(req.ChatID)
 	if err != nil {
-		log.Printf("Chat room not found in Firestore: %s", req.ChatID)
+		log.Printf("Chat not found: %s", req.ChatID)
 		http.Error(w, "Chat room does not exist", http.StatusNotFound)
 		return
 	}
-	data := docSnap.Data()
-	buyerID, ok1 := data["buyerID"].(string)
-	sellerID, ok2 := data["sellerID"].(string)
-	if !ok1 || !ok2 {
-		http.Error(w, "Chat room missing buyer/seller information", http.StatusInternalServerError)
-		return
-	}
+	buyerID := chat.BuyerID.Hex()
+	sellerID := chat.SellerID.Hex()
 
-	// Create the new message payload.
-	newMessage := map[string]interface{}{
-		"_id":       primitive.NewObjectID().Hex(),
-		"senderId":  req.SenderID,
-		"content":   req.Content,
-		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	// Store the new message.
+	newMessage := models.Message{
+		ChatID:   chat.ID,
+		SenderID: req.SenderID,
+		Content:  req.Content,
 	}
-
-	// Update Firestore by adding the new message.
-	_, err = chatDocRef.Update(ctx, []firestore.Update{
-		{Path: "messages", Value: firestore.ArrayUnion(newMessage)},
-	})
-	if err != nil {
-		log.Printf("❌ Failed to add message to Firestore: %v", err)
+	if err := db.Messages.Append(ctx, &newMessage); err != nil {
+		log.Printf("❌ Failed to store message: %v", err)
 		http.Error(w, "Failed to send message", http.StatusInternalServerError)
 		return
 	}
+	if err := db.RecordInboxMessage(ctx, chat, newMessage); err != nil {
+		log.Printf("Error updating inbox for chat %s: %v", chat.ID.Hex(), err)
+	}
+	publishEvent(realtime.EventMessage, newMessage, chat.BuyerID, chat.SellerID)
 
 	// Determine the recipient: if the sender is the buyer, the recipient is the seller, and vice versa.
 	var recipientID string
@@ -1140,23 +1108,13 @@ func TestSendMessageHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Look up the recipient in university_users first.
-	usersCol := db.GetCollection("gridlyapp", "university_users")
-	var recipient models.User
-	err = usersCol.FindOne(ctx, bson.M{"_id": recipientObjID}).Decode(&recipient)
-
+	// Look up the recipient to get the Expo push token.
+	recipient, err := db.Users.GetByID(ctx, recipientObjID)
 	if err != nil {
-		log.Printf("❌ Recipient not found in university_users. Checking highschool_users...")
-
-		// If not found, check highschool_users
-		usersCol = db.GetCollection("gridlyapp", "highschool_users")
-		err = usersCol.FindOne(ctx, bson.M{"_id": recipientObjID}).Decode(&recipient)
-		if err != nil {
-			log.Printf("❌ Recipient not found in highschool_users either. No push notification will be sent.")
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(map[string]string{"status": "success"})
-			return
-		}
+		log.Printf("❌ Recipient not found. No push notification will be sent.")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+		return
 	}
 
 	// If recipient has a push token, send the notification
@@ -1240,6 +1198,15 @@ func DeleteChatHandler(w http.ResponseWriter, r *http.Request) {
 		WriteJSONError(w, "Error deleting chat", http.StatusInternalServerError)
 		return
 	}
+	if err := db.Messages.DeleteChat(ctx, chatObjID); err != nil {
+		log.Printf("Error deleting messages of chat %s: %v", chatIDStr, err)
+	}
+	if err := db.DeleteChatReads(ctx, chatObjID); err != nil {
+		log.Printf("Error deleting read state of chat %s: %v", chatIDStr, err)
+	}
+	if err := db.DeleteInboxEntries(ctx, chatObjID); err != nil {
+		log.Printf("Error deleting inbox entries of chat %s: %v", chatIDStr, err)
+	}
 
 	// --- Step 2: Delete the Firestore chat room ---
 	fsCtx := context.Background()
@@ -1352,85 +1319,55 @@ func MarkChatCompletedHandler(w http.ResponseWriter, r *http.Request) {
 		"message": fmt.Sprintf("Reference status updated to '%s' successfully", newStatus),
 	}, http.StatusOK)
 }
+
+// GetUnreadMessagesCountHandler counts the messages of a chat the caller has not
+// read yet, from the read position recorded by MarkChatReadHandler.
+// Endpoint: GET /chats/{chatId}/{userId}/unread
 func GetUnreadMessagesCountHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	vars := mux.Vars(r)
-	userID := vars["userId"]
-	chatID := vars["chatId"] // Now we take chatId to focus on a single chat room.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	if userID == "" || chatID == "" {
-		WriteJSONError(w, "User ID and Chat ID are required", http.StatusBadRequest)
+	chat, userID, ok := participantChat(ctx, w, r)
+	if !ok {
 		return
 	}
-
-	ctx := context.Background()
-
-	// Fetch the specific chat room
-	chatDocRef := fsClient.Collection("chatRooms").Doc(chatID)
-	docSnap, err := chatDocRef.Get(ctx)
+	if mux.Vars(r)["userId"] != userID {
+		WriteJSONError(w, "You can only view your own unread messages", http.StatusForbidden)
+		return
+	}
+	userObjID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
-		log.Printf("❌ Chat room %s not found in Firestore: %v", chatID, err)
-		WriteJSONError(w, "Chat room not found", http.StatusNotFound)
+		WriteJSONError(w, "Invalid user ID", http.StatusBadRequest)
 		return
 	}
 
-	chatData := docSnap.Data()
-	lastReadTime := time.Time{} // default zero time
-
-	// Extract user's last read timestamp
-	if lrMap, ok := chatData["lastRead"].(map[string]interface{}); ok {
-		if lrVal, exists := lrMap[userID]; exists {
-			if lrStr, ok := lrVal.(string); ok && lrStr != "" {
-				parsed, err := time.Parse(time.RFC3339, lrStr)
-				if err == nil {
-					lastReadTime = parsed
-				} else {
-					log.Printf("⚠️ Error parsing last read time for user %s: %v", userID, err)
-				}
-			}
-		}
+	reads, err := db.GetChatReads(ctx, chat.ID)
+	if err != nil {
+		log.Printf("❌ Error fetching read state of chat %s: %v", chat.ID.Hex(), err)
+		WriteJSONError(w, "Error counting unread messages", http.StatusInternalServerError)
+		return
 	}
-
-	// If there's no last read timestamp, assume all messages are unread.
-	if lastReadTime.IsZero() {
-		lastReadTime = time.Time{} // Start from zero time (all messages are unread)
+	// Without a read position every message is unread.
+	var since time.Time
+	var sinceID primitive.ObjectID
+	if read := readOf(reads, userObjID); read != nil {
+		since, sinceID = read.LastReadAt, read.LastReadMessageID
 	}
 
-	// Count unread messages for the user in this chat room
-	unreadCount := 0
-	messages, exists := chatData["messages"].([]interface{})
-	if exists {
-		for _, m := range messages {
-			msgMap, ok := m.(map[string]interface{})
-			if !ok {
-				continue
-			}
-
-			tsStr, tsExists := msgMap["timestamp"].(string)
-			if !tsExists {
-				continue
-			}
-
-			msgTime, err := time.Parse(time.RFC3339, tsStr)
-			if err != nil {
-				continue
-			}
-
-			senderId, senderExists := msgMap["senderId"].(string)
-			if !senderExists || senderId == userID {
-				continue // Skip messages sent by the user
-			}
-
-			if msgTime.After(lastReadTime) {
-				unreadCount++
-			}
-		}
+	// Count unread messages for the user in this chat room, skipping their own
+	unreadCount, err := db.Messages.CountSince(ctx, chat.ID, since, sinceID, userID)
+	if err != nil {
+		log.Printf("❌ Error counting unread messages in chat %s: %v", chat.ID.Hex(), err)
+		WriteJSONError(w, "Error counting unread messages", http.StatusInternalServerError)
+		return
 	}
 
 	// Return the unread count for this specific chat room
-	WriteJSON(w, map[string]int{"unreadCount": unreadCount}, http.StatusOK)
+	WriteJSON(w, map[string]int64{"unreadCount": unreadCount}, http.StatusOK)
 }
+
 func DeleteChatRequestHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
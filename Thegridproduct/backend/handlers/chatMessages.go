@@ -0,0 +1,183 @@
+// handlers/chatMessages.go
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"Thegridproduct/backend/db"
+	"Thegridproduct/backend/models"
+
+	"cloud.google.com/go/firestore"
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// FirestoreClient returns the client for the Firestore project chat rooms live in,
+// for commands that need to reach it with the backend's credentials.
+func FirestoreClient() *firestore.Client {
+	return fsClient
+}
+
+// FirestoreMirrorEnabled reports whether new messages are copied into the Firestore
+// chat rooms, which clients that have not moved to the messages endpoints still
+// read. It is on unless CHAT_FIRESTORE_MIRROR is false.
+func FirestoreMirrorEnabled() bool {
+	v := os.Getenv("CHAT_FIRESTORE_MIRROR")
+	if v == "" {
+		return true
+	}
+	enabled, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("Invalid CHAT_FIRESTORE_MIRROR %q, mirroring messages to Firestore", v)
+		return true
+	}
+	return enabled
+}
+
+// firestoreMirror is a MessageStore that also appends every new message to the
+// messages array of the chat's Firestore room. MongoDB stays the source of truth:
+// a failed mirror write is logged and the message is still sent.
+type firestoreMirror struct {
+	db.MessageStore
+	client *firestore.Client
+}
+
+// NewFirestoreMirror wraps store so new messages are mirrored to Firestore.
+func NewFirestoreMirror(store db.MessageStore) db.MessageStore {
+	return &firestoreMirror{MessageStore: store, client: fsClient}
+}
+
+func (m *firestoreMirror) Append(ctx context.Context, msg *models.Message) error {
+	if err := m.MessageStore.Append(ctx, msg); err != nil {
+		return err
+	}
+
+	// Same shape as the messages clients wrote before the backend owned them.
+	legacy := map[string]interface{}{
+		"_id":       msg.ID.Hex(),
+		"senderId":  msg.SenderID,
+		"content":   msg.Content,
+		"timestamp": msg.Timestamp.UTC().Format(time.RFC3339),
+	}
+	_, err := m.client.Collection("chatRooms").Doc(msg.ChatID.Hex()).Update(ctx, []firestore.Update{
+		{Path: "messages", Value: firestore.ArrayUnion(legacy)},
+	})
+	if err != nil {
+		log.Printf("Error mirroring message %s to Firestore: %v", msg.ID.Hex(), err)
+	}
+	return nil
+}
+
+// participantChat loads the chat named by the chatId route variable and checks
+// that the caller takes part in it. It writes the error response and returns
+// false when the caller may not use the chat.
+func participantChat(ctx context.Context, w http.ResponseWriter, r *http.Request) (*models.Chat, string, bool) {
+	userID, ok := r.Context().Value(userIDKey).(string)
+	if !ok || userID == "" {
+		WriteJSONError(w, "User not authenticated", http.StatusUnauthorized)
+		return nil, "", false
+	}
+
+	chatID, err := primitive.ObjectIDFromHex(mux.Vars(r)["chatId"])
+	if err != nil {
+		WriteJSONError(w, "Invalid Chat ID format", http.StatusBadRequest)
+		return nil, "", false
+	}
+
+	var chat models.Chat
+	err = db.GetCollection("gridlyapp", "chats").FindOne(ctx, bson.M{"_id": chatID}).Decode(&chat)
+	if err == mongo.ErrNoDocuments {
+		WriteJSONError(w, "Chat not found", http.StatusNotFound)
+		return nil, "", false
+	} else if err != nil {
+		log.Printf("Error fetching chat %s: %v", chatID.Hex(), err)
+		WriteJSONError(w, "Error fetching chat", http.StatusInternalServerError)
+		return nil, "", false
+	}
+
+	if chat.BuyerID.Hex() != userID && chat.SellerID.Hex() != userID {
+		WriteJSONError(w, "You are not part of this chat", http.StatusForbidden)
+		return nil, "", false
+	}
+	return &chat, userID, true
+}
+
+// messagePage holds the query parameters of a chat history request.
+type messagePage struct {
+	paginate bool // Old app versions send no parameters and get every message, oldest first
+	since    bool
+	query    db.MessageQuery
+}
+
+// parseMessagePage reads the history parameters from the query string. Cursors
+// are message IDs:
+//
+//	before=<id>  messages older than id, newest first
+//	after=<id>   messages newer than id, newest first
+//	since=<id>   messages newer than id, oldest first, for incremental sync
+//
+// limit sizes the page; without a cursor it returns the newest messages.
+func parseMessagePage(r *http.Request) (messagePage, error) {
+	q := r.URL.Query()
+	page := messagePage{query: db.MessageQuery{Limit: defaultPageSize}}
+
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.ParseInt(l, 10, 64)
+		if err != nil || n < 1 {
+			return page, errors.New("limit must be a positive number")
+		}
+		if n > maxPageSize {
+			n = maxPageSize
+		}
+		page.query.Limit, page.paginate = n, true
+	}
+
+	for _, param := range []struct {
+		name string
+		id   *primitive.ObjectID
+	}{{"before", &page.query.Before}, {"after", &page.query.After}, {"since", &page.query.After}} {
+		v := q.Get(param.name)
+		if v == "" {
+			continue
+		}
+		id, err := primitive.ObjectIDFromHex(v)
+		if err != nil {
+			return page, fmt.Errorf("%s must be a message ID", param.name)
+		}
+		*param.id, page.paginate = id, true
+	}
+
+	if q.Get("since") != "" {
+		if q.Get("before") != "" || q.Get("after") != "" {
+			return page, errors.New("since cannot be combined with before or after")
+		}
+		page.since, page.query.Ascending = true, true
+		if q.Get("limit") == "" {
+			page.query.Limit = maxPageSize
+		}
+	}
+	return page, nil
+}
+
+// nextMessageCursor returns the cursor continuing a page in the direction it was
+// requested: the newest message when paging forward with after, the last message
+// otherwise.
+func nextMessageCursor(page messagePage, messages []models.Message, more bool) string {
+	if !more || len(messages) == 0 {
+		return ""
+	}
+	if !page.since && !page.query.After.IsZero() {
+		return messages[0].ID.Hex()
+	}
+	return messages[len(messages)-1].ID.Hex()
+}
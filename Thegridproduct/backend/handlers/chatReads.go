@@ -0,0 +1,146 @@
+// handlers/chatReads.go
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"Thegridproduct/backend/db"
+	"Thegridproduct/backend/models"
+	"Thegridproduct/backend/realtime"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// messageView is a chat message as returned to clients. Read tells whether the
+// recipient of the message has read it, so senders can show read receipts.
+type messageView struct {
+	models.Message
+	Read bool `json:"read"`
+}
+
+// messageViews adds the read state of the chat's participants to messages.
+func messageViews(ctx context.Context, chat *models.Chat, messages []models.Message) ([]messageView, error) {
+	reads, err := db.GetChatReads(ctx, chat.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	views := make([]messageView, len(messages))
+	for i, msg := range messages {
+		recipient := chat.BuyerID
+		if msg.SenderID == chat.BuyerID.Hex() {
+			recipient = chat.SellerID
+		}
+		views[i] = messageView{Message: msg}
+		if read := readOf(reads, recipient); read != nil {
+			views[i].Read = read.Covers(msg)
+		}
+	}
+	return views, nil
+}
+
+// readOf returns the read position of a user among reads, or nil when the user
+// never read the chat.
+func readOf(reads []models.ChatRead, userID primitive.ObjectID) *models.ChatRead {
+	for i := range reads {
+		if reads[i].UserID == userID {
+			return &reads[i]
+		}
+	}
+	return nil
+}
+
+// MarkChatReadHandler records that the caller has read a chat up to and including
+// a message: the one given by the optional body {"messageId": "..."}, or else the
+// newest message of the chat. The read position only moves forward. When it does,
+// both participants receive a read event carrying the new position.
+// Endpoint: POST /chats/{chatId}/read
+func MarkChatReadHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req struct {
+		MessageID string `json:"messageId"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			WriteJSONError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	chat, userID, ok := participantChat(ctx, w, r)
+	if !ok {
+		return
+	}
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		WriteJSONError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var msg models.Message
+	if req.MessageID != "" {
+		messageID, err := primitive.ObjectIDFromHex(req.MessageID)
+		if err != nil {
+			WriteJSONError(w, "Invalid Message ID format", http.StatusBadRequest)
+			return
+		}
+		found, err := db.Messages.Get(ctx, chat.ID, messageID)
+		if err == db.ErrMessageNotFound {
+			WriteJSONError(w, "Message not found in this chat", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error fetching message %s: %v", req.MessageID, err)
+			WriteJSONError(w, "Error marking chat as read", http.StatusInternalServerError)
+			return
+		}
+		msg = *found
+	} else {
+		latest, err := db.Messages.Latest(ctx, []primitive.ObjectID{chat.ID})
+		if err != nil {
+			log.Printf("Error fetching latest message of chat %s: %v", chat.ID.Hex(), err)
+			WriteJSONError(w, "Error marking chat as read", http.StatusInternalServerError)
+			return
+		}
+		var found bool
+		if msg, found = latest[chat.ID]; !found {
+			// Nothing to read yet
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	read, advanced, previous, err := db.MarkChatRead(ctx, userObjID, msg)
+	if err != nil {
+		log.Printf("Error marking chat %s read for user %s: %v", chat.ID.Hex(), userID, err)
+		WriteJSONError(w, "Error marking chat as read", http.StatusInternalServerError)
+		return
+	}
+
+	if advanced {
+		// Decrement by the newly read messages rather than setting a recount, which
+		// would drop messages that arrive while it runs.
+		var since time.Time
+		var sinceID primitive.ObjectID
+		if previous != nil {
+			since, sinceID = previous.LastReadAt, previous.LastReadMessageID
+		}
+		newlyRead, err := db.Messages.CountBetween(ctx, chat.ID, since, sinceID, read.LastReadAt, read.LastReadMessageID, userID)
+		if err == nil && newlyRead > 0 {
+			err = db.ReadInboxMessages(ctx, chat.ID, userObjID, newlyRead)
+		}
+		if err != nil {
+			log.Printf("Error updating inbox of user %s for chat %s: %v", userID, chat.ID.Hex(), err)
+		}
+		publishEvent(realtime.EventRead, read, chat.BuyerID, chat.SellerID)
+	}
+	WriteJSON(w, read, http.StatusOK)
+}
@@ -0,0 +1,450 @@
+// handlers/dataExportHandlers.go
+
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"Thegridproduct/backend/db"
+	"Thegridproduct/backend/models"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// dataExportTTL is how long a finished archive can be downloaded.
+const dataExportTTL = 7 * 24 * time.Hour
+
+// dataExportStaleAfter is how long an export can go without progress before it is
+// considered stuck and marked failed. Building one is given far less time.
+const dataExportStaleAfter = 30 * time.Minute
+
+// dataExportLimit caps how many archives a user can request.
+var dataExportLimit = rateLimit{scope: "data-export", limit: 3, window: 24 * time.Hour}
+
+// exportProfile is the profile written to the archive. Credentials and device
+// tokens are left out on purpose.
+type exportProfile struct {
+	ID            string     `json:"id"`
+	Email         string     `json:"email"`
+	FirstName     string     `json:"firstName"`
+	LastName      string     `json:"lastName"`
+	StudentType   string     `json:"studentType"`
+	Institution   string     `json:"institution"`
+	ProfilePic    string     `json:"profilePic,omitempty"`
+	Grids         int        `json:"grids"`
+	Roles         []string   `json:"roles,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	UpdatedAt     time.Time  `json:"updatedAt"`
+	DeletedAt     *time.Time `json:"deletedAt,omitempty"`
+	LikedProducts []string   `json:"likedProducts,omitempty"`
+}
+
+// exportLikedProduct describes a liked product in the archive.
+type exportLikedProduct struct {
+	ID    string  `json:"id"`
+	Title string  `json:"title"`
+	Price float64 `json:"price"`
+}
+
+// exportChat is a conversation with its message history.
+type exportChat struct {
+	ChatID        string           `json:"chatId"`
+	ReferenceID   string           `json:"referenceId"`
+	ReferenceType string           `json:"referenceType"`
+	Role          string           `json:"role"` // "buyer" or "seller"
+	CreatedAt     time.Time        `json:"createdAt"`
+	Messages      []models.Message `json:"messages"`
+}
+
+// RequestDataExportHandler starts building a personal data archive for the caller.
+// The archive is built in the background; the user gets a push notification when it
+// is ready and can then download it from GET /user/export/{id}/download.
+// Endpoint: POST /user/export
+func RequestDataExportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userIDStr, ok := r.Context().Value(userIDKey).(string)
+	if !ok || userIDStr == "" {
+		WriteJSONError(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		WriteJSONError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// An export stuck since a crash must not block new requests forever.
+	staleBefore := time.Now().Add(-dataExportStaleAfter)
+	if _, err := db.FailStaleDataExports(ctx, bson.M{"userId": userID}, staleBefore); err != nil {
+		log.Printf("Error failing stale data exports: %v", err)
+	}
+
+	// Hand back the export already in progress instead of starting another one.
+	if active, err := db.FindActiveDataExport(ctx, userID, staleBefore); err == nil {
+		WriteJSON(w, active, http.StatusAccepted)
+		return
+	} else if err != db.ErrDataExportNotFound {
+		log.Printf("Error checking data exports: %v", err)
+		WriteJSONError(w, "Error requesting data export", http.StatusInternalServerError)
+		return
+	}
+
+	allowed, retryAfter, err := dataExportLimit.allow(ctx, userIDStr)
+	if err != nil {
+		log.Printf("Error checking data export limit: %v", err)
+		WriteJSONError(w, "Error requesting data export", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		writeTooManyRequests(w, "Too many data export requests.", retryAfter)
+		return
+	}
+
+	// Only the newest archive is kept.
+	if _, err := db.DeleteDataExports(ctx, bson.M{"userId": userID}); err != nil {
+		log.Printf("Error removing previous data exports: %v", err)
+	}
+
+	export := &models.DataExport{UserID: userID}
+	if err := db.CreateDataExport(ctx, export); err != nil {
+		log.Printf("Error creating data export: %v", err)
+		WriteJSONError(w, "Error requesting data export", http.StatusInternalServerError)
+		return
+	}
+
+	go buildDataExport(export.ID, userID)
+
+	WriteJSON(w, export, http.StatusAccepted)
+}
+
+// GetDataExportHandler reports the status of one of the caller's exports.
+// Endpoint: GET /user/export/{id}
+func GetDataExportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	export, ok := loadDataExport(w, r)
+	if !ok {
+		return
+	}
+
+	WriteJSON(w, export, http.StatusOK)
+}
+
+// DownloadDataExportHandler streams a finished archive to the caller.
+// Endpoint: GET /user/export/{id}/download
+func DownloadDataExportHandler(w http.ResponseWriter, r *http.Request) {
+	export, ok := loadDataExport(w, r)
+	if !ok {
+		return
+	}
+
+	if export.Status != models.ExportStatusReady {
+		WriteJSONError(w, "Data export is not ready yet", http.StatusConflict)
+		return
+	}
+	if export.ExpiresAt != nil && time.Now().After(*export.ExpiresAt) {
+		WriteJSONError(w, "Data export has expired, please request a new one", http.StatusGone)
+		return
+	}
+
+	bucket, err := db.DataExportBucket()
+	if err != nil {
+		log.Printf("Error opening export bucket: %v", err)
+		WriteJSONError(w, "Error downloading data export", http.StatusInternalServerError)
+		return
+	}
+	stream, err := bucket.OpenDownloadStream(export.FileID)
+	if err != nil {
+		log.Printf("Error opening export archive %s: %v", export.FileID.Hex(), err)
+		WriteJSONError(w, "Error downloading data export", http.StatusInternalServerError)
+		return
+	}
+	defer stream.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="gridly-data-%s.zip"`, export.CreatedAt.Format("2006-01-02")))
+	w.Header().Set("Content-Length", strconv.FormatInt(export.Size, 10))
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, stream); err != nil {
+		log.Printf("Error streaming export archive %s: %v", export.FileID.Hex(), err)
+	}
+}
+
+// loadDataExport resolves the {id} route variable to an export owned by the caller,
+// writing an error response when it cannot.
+func loadDataExport(w http.ResponseWriter, r *http.Request) (*models.DataExport, bool) {
+	userIDStr, ok := r.Context().Value(userIDKey).(string)
+	if !ok || userIDStr == "" {
+		WriteJSONError(w, "User not authenticated", http.StatusUnauthorized)
+		return nil, false
+	}
+	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		WriteJSONError(w, "Invalid user ID", http.StatusBadRequest)
+		return nil, false
+	}
+	exportID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		WriteJSONError(w, "Invalid export ID format", http.StatusBadRequest)
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	export, err := db.GetDataExport(ctx, exportID, userID)
+	if err == db.ErrDataExportNotFound {
+		WriteJSONError(w, "Data export not found", http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		log.Printf("Error fetching data export: %v", err)
+		WriteJSONError(w, "Error fetching data export", http.StatusInternalServerError)
+		return nil, false
+	}
+	return export, true
+}
+
+// buildDataExport collects the user's data, stores the archive in GridFS and
+// notifies the user. It runs in its own goroutine.
+func buildDataExport(exportID, userID primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	err := db.UpdateDataExport(ctx, exportID, bson.M{
+		"status":    models.ExportStatusProcessing,
+		"startedAt": time.Now(),
+	}, models.ExportStatusPending)
+	if err != nil {
+		log.Printf("Error updating data export %s: %v", exportID.Hex(), err)
+		return
+	}
+
+	user, fileID, size, err := writeDataExport(ctx, exportID, userID)
+	if err != nil {
+		log.Printf("Error building data export %s: %v", exportID.Hex(), err)
+		if err := db.UpdateDataExport(ctx, exportID, bson.M{
+			"status": models.ExportStatusFailed,
+			"error":  "The archive could not be generated. Please try again later.",
+		}, models.ExportStatusProcessing); err != nil && err != db.ErrDataExportNotFound {
+			log.Printf("Error updating data export %s: %v", exportID.Hex(), err)
+		}
+		return
+	}
+
+	now := time.Now()
+	err = db.UpdateDataExport(ctx, exportID, bson.M{
+		"status":      models.ExportStatusReady,
+		"fileId":      fileID,
+		"size":        size,
+		"completedAt": now,
+		"expiresAt":   now.Add(dataExportTTL),
+	}, models.ExportStatusProcessing)
+	if err != nil {
+		// The export was given up on or deleted meanwhile; drop the orphaned archive.
+		log.Printf("Error updating data export %s: %v", exportID.Hex(), err)
+		if bucket, err := db.DataExportBucket(); err == nil {
+			if err := bucket.DeleteContext(ctx, fileID); err != nil {
+				log.Printf("Error deleting export archive %s: %v", fileID.Hex(), err)
+			}
+		}
+		return
+	}
+
+	log.Printf("Data export %s ready for user %s (%d bytes)", exportID.Hex(), userID.Hex(), size)
+
+	if user.ExpoPushToken != "" {
+		err := SendPushNotification(user.ExpoPushToken, "Your data export is ready",
+			"Your Gridly data archive is ready to download for the next 7 days.",
+			map[string]string{"type": "data_export", "exportId": exportID.Hex()})
+		if err != nil {
+			log.Printf("Error sending data export notification: %v", err)
+		}
+	}
+}
+
+// writeDataExport builds the zip archive and uploads it to GridFS.
+func writeDataExport(ctx context.Context, exportID, userID primitive.ObjectID) (*models.User, primitive.ObjectID, int64, error) {
+	user, err := db.Users.GetByID(ctx, userID)
+	if err != nil {
+		return nil, primitive.NilObjectID, 0, err
+	}
+
+	var products []models.Product
+	if err := findAll(ctx, "products", bson.M{"userId": userID}, &products); err != nil {
+		return nil, primitive.NilObjectID, 0, err
+	}
+	var gigs []models.Gig
+	if err := findAll(ctx, "gigs", bson.M{"userId": userID}, &gigs); err != nil {
+		return nil, primitive.NilObjectID, 0, err
+	}
+	for i := range gigs {
+		gigs[i].Embeddings = nil // Search vectors are derived data, not the user's
+	}
+	var productRequests []models.ProductRequest
+	if err := findAll(ctx, "product_requests", bson.M{"userId": userID}, &productRequests); err != nil {
+		return nil, primitive.NilObjectID, 0, err
+	}
+	var carts []models.Cart
+	if err := findAll(ctx, "carts", bson.M{"userId": userID}, &carts); err != nil {
+		return nil, primitive.NilObjectID, 0, err
+	}
+	var chatRequests []models.ChatRequest
+	participant := bson.M{"$or": []bson.M{{"buyerId": userID}, {"sellerId": userID}}}
+	if err := findAll(ctx, "chat_requests", participant, &chatRequests); err != nil {
+		return nil, primitive.NilObjectID, 0, err
+	}
+
+	likedProducts := []exportLikedProduct{}
+	if len(user.LikedProducts) > 0 {
+		var liked []models.Product
+		if err := findAll(ctx, "products", bson.M{"_id": bson.M{"$in": user.LikedProducts}}, &liked); err != nil {
+			return nil, primitive.NilObjectID, 0, err
+		}
+		for _, p := range liked {
+			likedProducts = append(likedProducts, exportLikedProduct{ID: p.ID.Hex(), Title: p.Title, Price: p.Price})
+		}
+	}
+
+	var chatDocs []models.Chat
+	if err := findAll(ctx, "chats", participant, &chatDocs); err != nil {
+		return nil, primitive.NilObjectID, 0, err
+	}
+	chats := make([]exportChat, 0, len(chatDocs))
+	messageCount := 0
+	for _, c := range chatDocs {
+		chat := exportChat{
+			ChatID:        c.ID.Hex(),
+			ReferenceID:   c.ReferenceID.Hex(),
+			ReferenceType: c.ReferenceType,
+			Role:          "buyer",
+			CreatedAt:     c.CreatedAt,
+		}
+		if c.SellerID == userID {
+			chat.Role = "seller"
+		}
+		messages, _, err := db.Messages.List(ctx, c.ID, db.MessageQuery{Ascending: true})
+		if err != nil {
+			return nil, primitive.NilObjectID, 0, err
+		}
+		chat.Messages = messages
+		messageCount += len(chat.Messages)
+		chats = append(chats, chat)
+	}
+
+	profile := exportProfile{
+		ID:          user.ID.Hex(),
+		Email:       user.Email,
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+		StudentType: user.StudentType,
+		Institution: user.Institution,
+		ProfilePic:  user.ProfilePic,
+		Grids:       user.Grids,
+		Roles:       user.Roles,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+		DeletedAt:   user.DeletedAt,
+	}
+	for _, id := range user.LikedProducts {
+		profile.LikedProducts = append(profile.LikedProducts, id.Hex())
+	}
+
+	var summary strings.Builder
+	fmt.Fprintf(&summary, "Gridly data export\n")
+	fmt.Fprintf(&summary, "Generated: %s\n\n", time.Now().UTC().Format(time.RFC1123))
+	fmt.Fprintf(&summary, "Account\n")
+	fmt.Fprintf(&summary, "  Name:         %s %s\n", user.FirstName, user.LastName)
+	fmt.Fprintf(&summary, "  Email:        %s\n", user.Email)
+	fmt.Fprintf(&summary, "  Institution:  %s (%s)\n", user.Institution, user.StudentType)
+	fmt.Fprintf(&summary, "  Member since: %s\n", user.CreatedAt.Format("January 2, 2006"))
+	fmt.Fprintf(&summary, "  Grids:        %d\n\n", user.Grids)
+	fmt.Fprintf(&summary, "Contents\n")
+	fmt.Fprintf(&summary, "  profile.json           your account details\n")
+	fmt.Fprintf(&summary, "  products.json          %d product listings\n", len(products))
+	fmt.Fprintf(&summary, "  gigs.json              %d services\n", len(gigs))
+	fmt.Fprintf(&summary, "  product_requests.json  %d product requests\n", len(productRequests))
+	fmt.Fprintf(&summary, "  cart.json              %d carts\n", len(carts))
+	fmt.Fprintf(&summary, "  liked_products.json    %d liked products\n", len(likedProducts))
+	fmt.Fprintf(&summary, "  chat_requests.json     %d chat requests\n", len(chatRequests))
+	fmt.Fprintf(&summary, "  chats.json             %d chats with %d messages\n\n", len(chats), messageCount)
+	fmt.Fprintf(&summary, "All files are JSON. Dates are in UTC.\n")
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", profile},
+		{"products.json", products},
+		{"gigs.json", gigs},
+		{"product_requests.json", productRequests},
+		{"cart.json", carts},
+		{"liked_products.json", likedProducts},
+		{"chat_requests.json", chatRequests},
+		{"chats.json", chats},
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	readme, err := zw.Create("README.txt")
+	if err != nil {
+		return nil, primitive.NilObjectID, 0, err
+	}
+	if _, err := io.WriteString(readme, summary.String()); err != nil {
+		return nil, primitive.NilObjectID, 0, err
+	}
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return nil, primitive.NilObjectID, 0, err
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			return nil, primitive.NilObjectID, 0, fmt.Errorf("error writing %s: %v", f.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, primitive.NilObjectID, 0, err
+	}
+
+	bucket, err := db.DataExportBucket()
+	if err != nil {
+		return nil, primitive.NilObjectID, 0, err
+	}
+	size := int64(buf.Len())
+	fileID, err := bucket.UploadFromStream(exportID.Hex()+".zip", &buf)
+	if err != nil {
+		return nil, primitive.NilObjectID, 0, fmt.Errorf("error uploading archive: %v", err)
+	}
+
+	return user, fileID, size, nil
+}
+
+// findAll decodes every document of the collection matching the filter into results.
+func findAll(ctx context.Context, colName string, filter bson.M, results interface{}) error {
+	cursor, err := db.GetCollection("gridlyapp", colName).Find(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("error fetching %s: %v", colName, err)
+	}
+	if err := cursor.All(ctx, results); err != nil {
+		return fmt.Errorf("error decoding %s: %v", colName, err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+// handlers/gigEmbeddings.go
+
+package handlers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"Thegridproduct/backend/db"
+	"Thegridproduct/backend/embeddings"
+	"Thegridproduct/backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// refreshGigEmbedding computes and stores the embedding of a gig so it shows up in
+// gig search. It is run in its own goroutine after a gig is posted or its title,
+// description or category change; the gig's embeddingStatus tells how it went.
+func refreshGigEmbedding(gigID primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	collection := db.GetCollection("gridlyapp", "gigs")
+
+	var gig models.Gig
+	if err := collection.FindOne(ctx, bson.M{"_id": gigID}).Decode(&gig); err != nil {
+		log.Printf("Error loading gig %s for embedding: %v", gigID.Hex(), err)
+		return
+	}
+	if gig.Status == "active" && !gig.Expired {
+		indexGigKeywords(gig)
+	}
+
+	// Only record the outcome if the text it was computed from is still current;
+	// otherwise a newer refresh is already on its way.
+	filter := bson.M{
+		"_id":         gigID,
+		"title":       gig.Title,
+		"description": gig.Description,
+		"category":    gig.Category,
+	}
+
+	now := time.Now()
+	embedder := embeddings.Default()
+	vector, err := embedder.Embed(ctx, embeddings.GigText(gig))
+	if err != nil {
+		log.Printf("Error generating embedding for gig %s: %v", gigID.Hex(), err)
+		update := bson.M{"$set": bson.M{
+			"embeddingStatus":    models.EmbeddingStatusFailed,
+			"embeddingError":     err.Error(),
+			"embeddingUpdatedAt": now,
+		}}
+		if _, err := collection.UpdateOne(ctx, filter, update); err != nil {
+			log.Printf("Error storing embedding status for gig %s: %v", gigID.Hex(), err)
+		}
+		return
+	}
+
+	fields := embeddings.Fields(embedder, vector)
+	fields["embeddingStatus"] = models.EmbeddingStatusReady
+	fields["embeddingUpdatedAt"] = now
+	update := bson.M{
+		"$set":   fields,
+		"$unset": bson.M{"embeddingError": ""},
+	}
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Printf("Error storing embedding for gig %s: %v", gigID.Hex(), err)
+		return
+	}
+	if result.MatchedCount > 0 {
+		indexListingVector("gigs", gigID, vector, gigMeta(gig))
+	}
+}
@@ -11,14 +11,12 @@ import (
 	"net/http"
 	"os"
 	"regexp"
-	"sort"
 	"strconv"
 	"strings"
 
 	"time"
 
 	"Thegridproduct/backend/db"
-	"Thegridproduct/backend/embeddings"
 	"Thegridproduct/backend/models"
 
 	"github.com/gorilla/mux"
@@ -172,11 +170,18 @@ func AddGigHandler(w http.ResponseWriter, r *http.Request) {
 		LikeCount:      0,
 		CampusPresence: campusPresence,
 		IsAnonymous:    isAnonymous,
+
+		EmbeddingStatus: models.EmbeddingStatusPending,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	if err := validateImageRefs(ctx, userObjID, gig.Images, nil); err != nil {
+		writeImageRefError(w, err)
+		return
+	}
+
 	// Insert the gig into MongoDB
 	collection := db.GetCollection("gridlyapp", "gigs")
 	result, err := collection.InsertOne(ctx, gig)
@@ -186,8 +191,13 @@ func AddGigHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Make the gig findable by gig search
+	if gigID, ok := result.InsertedID.(primitive.ObjectID); ok {
+		go refreshGigEmbedding(gigID)
+	}
+
 	// ✅ Increment the user's grids count
-	err = IncrementUserGrids(userObjID, studentType)
+	err = IncrementUserGrids(userObjID)
 	if err != nil {
 		log.Printf("Failed to increment grids: %v", err)
 	}
@@ -219,200 +229,8 @@ func AddGigHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func updateExpiredGigs() {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	collection := db.GetCollection("gridlyapp", "gigs")
-
-	filter := bson.M{
-		"expirationDate": bson.M{"$lt": time.Now()},
-		"expired":        false,
-	}
-	update := bson.M{
-		"$set": bson.M{"expired": true},
-	}
-
-	_, err := collection.UpdateMany(ctx, filter, update)
-	if err != nil {
-		log.Printf("Error updating expired gigs: %v", err)
-	}
-}
-
-func SearchGigsHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	if r.Method != http.MethodPost {
-		WriteJSONError(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
-	}
-
-	// 1️⃣ Retrieve authenticated user details
-	userID, ok := r.Context().Value(userIDKey).(string)
-	if !ok || userID == "" {
-		WriteJSONError(w, "User not authenticated", http.StatusUnauthorized)
-		return
-	}
-
-	userObjID, err := primitive.ObjectIDFromHex(userID)
-	if err != nil {
-		WriteJSONError(w, "Invalid user ID", http.StatusBadRequest)
-		return
-	}
-
-	university, ok := r.Context().Value(userInstitution).(string)
-	if !ok || university == "" {
-		WriteJSONError(w, "User university information missing", http.StatusUnauthorized)
-		return
-	}
-
-	// 2️⃣ Parse user query
-	var req struct {
-		Query string `json:"query"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("Error decoding request body: %v", err)
-		WriteJSONError(w, "Invalid input format", http.StatusBadRequest)
-		return
-	}
-	cleanedQuery := strings.TrimSpace(req.Query)
-	if cleanedQuery == "" {
-		WriteJSONError(w, "Query is required", http.StatusBadRequest)
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	refinedQuery, err := RefineQueryWithPrompt(cleanedQuery)
-	if err != nil {
-		log.Printf("Error refining query with GPT: %v", err)
-		WriteJSONError(w, "Error processing query", http.StatusInternalServerError)
-		return
-	}
-	log.Printf("🔍 Refined Query from GPT: %s", refinedQuery)
-
-	// 3️⃣ Apply the filter to restrict gigs to those visible to the user
-	filter := bson.M{
-		"status":  "active",
-		"expired": false,
-		"userId":  bson.M{"$ne": userObjID}, // Exclude user's own gigs
-		"requestedBy": bson.M{
-			"$nin": []primitive.ObjectID{userObjID}, // Exclude gigs already requested by user
-		},
-		"$or": []bson.M{
-			{"campusPresence": "flexible"},                           // Include all "flexible" gigs
-			{"campusPresence": "inCampus", "university": university}, // Include "inCampus" gigs from the same university
-		},
-		"embeddings": bson.M{"$exists": true}, // Ensure embeddings exist
-	}
-
-	// 4️⃣ Get the query embedding
-	queryEmbedding, err := embeddings.GetEmbeddingForText(ctx, refinedQuery)
-	if err != nil {
-		log.Printf("❌ Error generating query embedding: %v", err)
-		WriteJSONError(w, "Error generating query embedding", http.StatusInternalServerError)
-		return
-	}
-
-	// 5️⃣ Fetch only the gigs that match the filter
-	collection := db.GetCollection("gridlyapp", "gigs")
-	cursor, err := collection.Find(
-		ctx,
-		filter,
-		options.Find().SetProjection(bson.M{
-			"_id":         1,
-			"userId":      1, // ✅ Keep userId in response
-			"title":       1,
-			"description": 1,
-			"embeddings":  1,
-			"price":       1,
-			"category":    1,
-		}),
-	)
-	if err != nil {
-		log.Printf("❌ Error fetching gigs: %v", err)
-		WriteJSONError(w, "Error fetching gigs", http.StatusInternalServerError)
-		return
-	}
-	defer cursor.Close(ctx)
-
-	type GigMinimal struct {
-		ID          primitive.ObjectID `bson:"_id" json:"id"`
-		UserID      primitive.ObjectID `bson:"userId" json:"userId"`
-		Title       string             `bson:"title" json:"title"`
-		Description string             `bson:"description" json:"description"`
-		Embeddings  []float32          `bson:"embeddings"`
-		Price       string             `bson:"price" json:"price"`
-		Category    string             `bson:"category" json:"category"`
-	}
-
-	var gigs []GigMinimal
-	if err := cursor.All(ctx, &gigs); err != nil {
-		log.Printf("❌ Error decoding gigs: %v", err)
-		WriteJSONError(w, "Error decoding gigs", http.StatusInternalServerError)
-		return
-	}
-
-	// ✅ Debugging: Log how many gigs were retrieved after applying the filter
-	log.Printf("📊 Retrieved %d gigs matching the visibility filter", len(gigs))
-
-	type GigMatch struct {
-		ID          primitive.ObjectID `json:"id"`
-		UserID      primitive.ObjectID `json:"userId"`
-		Title       string             `json:"title"`
-		Description string             `json:"description"`
-		Price       string             `json:"price"`
-		Category    string             `json:"category"`
-		Similarity  float64            `json:"similarity"`
-	}
-
-	var matches []GigMatch
-	for _, gig := range gigs {
-		similarity := computeCosineSimilarity(queryEmbedding, gig.Embeddings)
-
-		// ✅ Debugging: Log similarity scores
-		log.Printf("🔍 Gig: %s | Similarity: %f", gig.Title, similarity)
-
-		if similarity >= 0.6 { // Adjusted similarity threshold for debugging
-			matches = append(matches, GigMatch{
-				ID:          gig.ID,
-				UserID:      gig.UserID,
-				Title:       gig.Title,
-				Description: gig.Description,
-				Price:       gig.Price,
-				Category:    gig.Category,
-				Similarity:  similarity,
-			})
-		}
-	}
-
-	// Sort by similarity
-	sort.Slice(matches, func(i, j int) bool {
-		return matches[i].Similarity > matches[j].Similarity
-	})
-
-	// Limit to top 5 results
-	if len(matches) > 5 {
-		matches = matches[:5]
-	}
-
-	if len(matches) == 0 {
-		log.Println("⚠️ No gigs matched the query after similarity check.")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode([]map[string]interface{}{
-			{
-				"message": "No gigs matched your query. Could you clarify your preferred category, price range, or other details?",
-			},
-		})
-		return
-	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(matches)
-}
-
-func RefineQueryWithPrompt(userQuery string) (string, error) {
+// RefineQueryWithPrompt asks GPT to rewrite a gig search query for semantic search.
+func RefineQueryWithPrompt(ctx context.Context, userQuery string) (string, error) {
 	client := openai.NewClient(os.Getenv("OPENAI_API_KEY"))
 
 	// Define the system prompt for refinement
@@ -423,7 +241,7 @@ You are an assistant specializing in understanding and refining user queries for
 - If the query is vague, make it more specific by adding synonyms or clarifications, but do not change user intent.
 - The goal is to help find the best matching gigs in a database.
 `
-	resp, err := client.CreateChatCompletion(context.Background(), openai.ChatCompletionRequest{
+	resp, err := client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
 		Model: openai.GPT4, // Or whichever model you use
 		Messages: []openai.ChatCompletionMessage{
 			{Role: "system", Content: systemPrompt},
@@ -511,9 +329,6 @@ func GetAllGigsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// ✅ Ensure expired gigs are updated before fetching
-	updateExpiredGigs()
-
 	// 🔥 Retrieve authenticated user details
 	userId, ok := r.Context().Value(userIDKey).(string)
 	if !ok || userId == "" {
@@ -527,15 +342,15 @@ func GetAllGigsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	page, err := parsePageRequest(r, gigSorts, "newest")
+	if err != nil {
+		WriteJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 	defer cancel()
-	userCollection := db.GetCollection("gridlyapp", "university_users")
-	var user models.User
-	err = userCollection.FindOne(ctx, bson.M{"_id": userObjID}).Decode(&user)
-	if err == mongo.ErrNoDocuments {
-		userCollection = db.GetCollection("gridlyapp", "highschool_users")
-		err = userCollection.FindOne(ctx, bson.M{"_id": userObjID}).Decode(&user)
-	}
+	user, err := db.Users.GetByID(ctx, userObjID)
 	if err != nil {
 		log.Printf("Error fetching user details: %v", err)
 		WriteJSONError(w, "Error fetching user details", http.StatusInternalServerError)
@@ -556,9 +371,10 @@ func GetAllGigsHandler(w http.ResponseWriter, r *http.Request) {
 	// - 🔥 Exclude gigs where `userId` matches the current user's ID
 	// - 🔥 Exclude gigs where current user's ID is in the `requestedBy` field
 	filter := bson.M{
-		"status":  bson.M{"$in": []string{"active"}},
-		"expired": false,
-		"userId":  bson.M{"$ne": userObjID}, // Exclude user's own gigs
+		"status":       bson.M{"$in": []string{"active"}},
+		"expired":      false,
+		"ownerDeleted": bson.M{"$ne": true},
+		"userId":       bson.M{"$ne": userObjID}, // Exclude user's own gigs
 		"requestedBy": bson.M{
 			"$nin": []primitive.ObjectID{userObjID},
 		},
@@ -568,23 +384,16 @@ func GetAllGigsHandler(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
-	cursor, err := collection.Find(ctx, filter)
+	var gigs []models.Gig
+	next, err := findPage(ctx, collection, filter, page, &gigs)
 	if err != nil {
 		log.Printf("Error fetching gigs: %v", err)
 		WriteJSONError(w, "Error fetching gigs", http.StatusInternalServerError)
 		return
 	}
-	defer cursor.Close(ctx)
-
-	var gigs []models.Gig
-	if err = cursor.All(ctx, &gigs); err != nil {
-		log.Printf("Error decoding gigs: %v", err)
-		WriteJSONError(w, "Error decoding gigs", http.StatusInternalServerError)
-		return
-	}
 
 	// ✅ Return filtered gigs
-	json.NewEncoder(w).Encode(gigs)
+	writeFeed(w, page, gigs, next)
 }
 
 func UpdateGigHandler(w http.ResponseWriter, r *http.Request) {
@@ -672,6 +481,10 @@ func UpdateGigHandler(w http.ResponseWriter, r *http.Request) {
 		updateFields["deliveryTime"] = strings.TrimSpace(*gigReq.DeliveryTime)
 	}
 	if gigReq.Images != nil && len(*gigReq.Images) > 0 {
+		if err := validateImageRefs(ctx, userObjID, *gigReq.Images, existingGig.Images); err != nil {
+			writeImageRefError(w, err)
+			return
+		}
 		updateFields["images"] = *gigReq.Images
 	}
 	if gigReq.ExpirationDate != nil {
@@ -702,6 +515,22 @@ func UpdateGigHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The embedding only depends on the text fields. The old one keeps the gig
+	// searchable until the new one is stored.
+	textChanged := false
+	if title, ok := updateFields["title"]; ok && title != existingGig.Title {
+		textChanged = true
+	}
+	if description, ok := updateFields["description"]; ok && description != existingGig.Description {
+		textChanged = true
+	}
+	if category, ok := updateFields["category"]; ok && category != existingGig.Category {
+		textChanged = true
+	}
+	if textChanged {
+		updateFields["embeddingStatus"] = models.EmbeddingStatusPending
+	}
+
 	update := bson.M{
 		"$set": updateFields,
 	}
@@ -718,6 +547,17 @@ func UpdateGigHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if textChanged {
+		go refreshGigEmbedding(gigID)
+	}
+	if presence, ok := updateFields["campusPresence"].(string); ok && presence != existingGig.CampusPresence {
+		updateListingMeta("gigs", gigID, listingMeta{
+			owner:      existingGig.UserID,
+			university: existingGig.University,
+			reach:      presence,
+		})
+	}
+
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message": "Gig updated successfully",
 	})
@@ -784,25 +624,39 @@ func DeleteGigHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deleteResult, err := collection.DeleteOne(ctx, bson.M{"_id": gigID})
+	deleted, err := removeGig(ctx, &existingGig)
 	if err != nil {
 		log.Printf("Error deleting gig: %v", err)
 		WriteJSONError(w, "Error deleting gig", http.StatusInternalServerError)
 		return
 	}
-
-	if deleteResult.DeletedCount == 0 {
+	if !deleted {
 		WriteJSONError(w, "Gig not found or already deleted", http.StatusNotFound)
 		return
 	}
 
-	// Optionally, handle removal from other collections or cleanup tasks
-
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message": "Gig deleted successfully",
 	})
 }
 
+// removeGig deletes a gig along with its search vectors and unused images. It
+// reports false when the gig was already gone.
+func removeGig(ctx context.Context, gig *models.Gig) (bool, error) {
+	collection := db.GetCollection("gridlyapp", "gigs")
+
+	deleteResult, err := collection.DeleteOne(ctx, bson.M{"_id": gig.ID})
+	if err != nil {
+		return false, err
+	}
+	if deleteResult.DeletedCount == 0 {
+		return false, nil
+	}
+	removeListingVectors("gigs", gig.ID)
+	releaseImages(ctx, gig.UserID, gig.Images)
+	return true, nil
+}
+
 // GetUserGigsHandler handles fetching all gigs posted by the authenticated user with optional pagination
 func GetUserGigsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
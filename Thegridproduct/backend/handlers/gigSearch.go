@@ -0,0 +1,380 @@
+// handlers/gigSearch.go
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"Thegridproduct/backend/db"
+	"Thegridproduct/backend/embeddings"
+	"Thegridproduct/backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// gigSearchCandidates is how many gigs each of the keyword and semantic rankings
+	// contributes before the two are fused.
+	gigSearchCandidates = 50
+	// gigSearchResults is how many gigs a search returns.
+	gigSearchResults = 5
+	// bm25HalfScore is the BM25 score that maps to a keyword score of 0.5. A rare
+	// term matching once scores about 5 to 7 against a few thousand gigs.
+	bm25HalfScore = 2.0
+)
+
+// GigSearchRequest is the body of a gig search.
+type GigSearchRequest struct {
+	Query string `json:"query"`
+	Debug bool   `json:"debug,omitempty"` // Explain every result's rank
+}
+
+// GigMatch is a gig search result.
+type GigMatch struct {
+	ID          primitive.ObjectID  `json:"id"`
+	UserID      primitive.ObjectID  `json:"userId"`
+	Title       string              `json:"title"`
+	Description string              `json:"description"`
+	Price       string              `json:"price"`
+	Category    string              `json:"category"`
+	Similarity  float64             `json:"similarity"` // Cosine similarity to the refined query
+	Score       float64             `json:"score"`      // Rank score, see GigRankExplanation
+	Explain     *GigRankExplanation `json:"explain,omitempty"`
+}
+
+// GigRankExplanation breaks a result's score down into its keyword and semantic
+// parts: Score = SemanticWeight*SemanticScore + KeywordWeight*KeywordScore.
+type GigRankExplanation struct {
+	Rank            int      `json:"rank"`
+	Query           string   `json:"query"`        // Keyword scores are computed for the query as typed
+	RefinedQuery    string   `json:"refinedQuery"` // Semantic scores for the rewritten query
+	RefinementError string   `json:"refinementError,omitempty"`
+	Similarity      *float64 `json:"similarity"`    // Null when the gig has no current embedding
+	SemanticScore   float64  `json:"semanticScore"` // Similarity rescaled to 0 at the model's threshold and 1 at identical
+	SemanticWeight  float64  `json:"semanticWeight"`
+	BM25            float64  `json:"bm25"`
+	KeywordScore    float64  `json:"keywordScore"` // BM25 squashed into [0, 1)
+	KeywordWeight   float64  `json:"keywordWeight"`
+	MatchedTerms    []string `json:"matchedTerms"`
+	Score           float64  `json:"score"`
+}
+
+// gigSearchWeights are the fusion weights from GIG_SEARCH_SEMANTIC_WEIGHT and
+// GIG_SEARCH_KEYWORD_WEIGHT, and the lowest score a result may have from
+// GIG_SEARCH_MIN_SCORE.
+func gigSearchWeights() (semantic, keyword, minScore float64) {
+	return envFloat("GIG_SEARCH_SEMANTIC_WEIGHT", 0.6),
+		envFloat("GIG_SEARCH_KEYWORD_WEIGHT", 0.4),
+		envFloat("GIG_SEARCH_MIN_SCORE", 0.05)
+}
+
+// envFloat reads a non-negative number from the environment.
+func envFloat(name string, fallback float64) float64 {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || f < 0 {
+		log.Printf("Invalid %s %q, using %g", name, v, fallback)
+		return fallback
+	}
+	return f
+}
+
+// gigKeywordText is the text keyword search matches. The title is repeated so its
+// terms weigh more than the same terms deep in a description.
+func gigKeywordText(gig models.Gig) string {
+	return strings.Join([]string{gig.Title, gig.Title, gig.Category, gig.Description}, "\n")
+}
+
+// gigCampusVisible is the campus part of the gig search filter, evaluated on the
+// search index entries. Keep the two in sync.
+func gigCampusVisible(userObjID primitive.ObjectID, university string) func(listingMeta) bool {
+	return func(m listingMeta) bool {
+		if m.owner == userObjID {
+			return false
+		}
+		return m.reach == "flexible" || (m.reach == "inCampus" && m.university == university)
+	}
+}
+
+// gigCandidate collects the keyword and semantic evidence for one gig.
+type gigCandidate struct {
+	similarity    float64
+	hasSimilarity bool
+	bm25          float64
+	matched       []string
+}
+
+// SearchGigsHandler ranks the gigs the caller can see by a weighted sum of keyword
+// relevance (BM25 over the query as typed, so course codes like "CS 61B" match
+// exactly) and semantic similarity (to the query as rewritten by GPT). Either half
+// keeps working when the other is unavailable: a failed rewrite falls back to the
+// original query, and a failed embedding to keyword ranking alone.
+// Endpoint: POST /services/search
+func SearchGigsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		WriteJSONError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 1️⃣ Retrieve authenticated user details
+	userID, ok := r.Context().Value(userIDKey).(string)
+	if !ok || userID == "" {
+		WriteJSONError(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		WriteJSONError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	university, ok := r.Context().Value(userInstitution).(string)
+	if !ok || university == "" {
+		WriteJSONError(w, "User university information missing", http.StatusUnauthorized)
+		return
+	}
+
+	// 2️⃣ Parse user query
+	var req GigSearchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("Error decoding request body: %v", err)
+		WriteJSONError(w, "Invalid input format", http.StatusBadRequest)
+		return
+	}
+	cleanedQuery := strings.TrimSpace(req.Query)
+	if cleanedQuery == "" {
+		WriteJSONError(w, "Query is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	// 3️⃣ Rewrite the query for semantic search, or use it as typed
+	refineCtx, cancelRefine := context.WithTimeout(ctx, 5*time.Second)
+	refinedQuery, err := RefineQueryWithPrompt(refineCtx, cleanedQuery)
+	cancelRefine()
+	refinementError := ""
+	if err != nil || refinedQuery == "" {
+		log.Printf("Error refining query with GPT, using it as typed: %v", err)
+		if err != nil {
+			refinementError = err.Error()
+		}
+		refinedQuery = cleanedQuery
+	}
+
+	// Gigs visible to the user
+	filter := bson.M{
+		"status":       "active",
+		"expired":      false,
+		"ownerDeleted": bson.M{"$ne": true},
+		"userId":       bson.M{"$ne": userObjID}, // Exclude user's own gigs
+		"requestedBy": bson.M{
+			"$nin": []primitive.ObjectID{userObjID}, // Exclude gigs already requested by user
+		},
+		"$or": []bson.M{
+			{"campusPresence": "flexible"},                           // Include all "flexible" gigs
+			{"campusPresence": "inCampus", "university": university}, // Include "inCampus" gigs from the same university
+		},
+	}
+	visible := gigCampusVisible(userObjID, university)
+	collection := db.GetCollection("gridlyapp", "gigs")
+
+	candidates := map[primitive.ObjectID]*gigCandidate{}
+	candidate := func(id primitive.ObjectID) *gigCandidate {
+		c := candidates[id]
+		if c == nil {
+			c = &gigCandidate{}
+			candidates[id] = c
+		}
+		return c
+	}
+
+	// 4️⃣ Keyword candidates
+	if index := gigKeywords.Load(); index != nil {
+		for _, hit := range index.Search(cleanedQuery, gigSearchCandidates, visible) {
+			c := candidate(hit.ID)
+			c.bm25, c.matched = hit.Score, hit.Matched
+		}
+	}
+
+	// 5️⃣ Semantic candidates, plus the similarity of the keyword candidates
+	embedder := embeddings.Default()
+	queryEmbedding, err := embedder.Embed(ctx, refinedQuery)
+	if err != nil {
+		log.Printf("❌ Error generating query embedding, ranking by keywords only: %v", err)
+	} else if index := gigVectors.Load(); index != nil {
+		results, err := index.Search(queryEmbedding, gigSearchCandidates, visible)
+		if err != nil {
+			log.Printf("❌ Error searching gig vectors: %v", err)
+		}
+		for _, r := range results {
+			c := candidate(r.ID)
+			c.similarity, c.hasSimilarity = r.Score, true
+		}
+		for id, c := range candidates {
+			if !c.hasSimilarity {
+				c.similarity, c.hasSimilarity = index.Similarity(queryEmbedding, id)
+			}
+		}
+	} else {
+		// Until the index is built, compare the query with every visible gig
+		scanFilter := bson.M{"$and": []bson.M{filter, embeddings.CurrentFilter(embedder)}}
+		cursor, err := collection.Find(ctx, scanFilter, options.Find().SetProjection(bson.M{"embeddings": 1}))
+		if err != nil {
+			log.Printf("❌ Error fetching gigs: %v", err)
+			WriteJSONError(w, "Error fetching gigs", http.StatusInternalServerError)
+			return
+		}
+		var gigs []struct {
+			ID         primitive.ObjectID `bson:"_id"`
+			Embeddings []float32          `bson:"embeddings"`
+		}
+		if err := cursor.All(ctx, &gigs); err != nil {
+			log.Printf("❌ Error decoding gigs: %v", err)
+			WriteJSONError(w, "Error decoding gigs", http.StatusInternalServerError)
+			return
+		}
+		for _, gig := range gigs {
+			c := candidate(gig.ID)
+			c.similarity, c.hasSimilarity = computeCosineSimilarity(queryEmbedding, gig.Embeddings), true
+		}
+	}
+
+	if len(candidates) == 0 {
+		writeNoGigMatches(w)
+		return
+	}
+
+	// 6️⃣ Load the candidates the user can actually see
+	ids := make([]primitive.ObjectID, 0, len(candidates))
+	for id := range candidates {
+		ids = append(ids, id)
+	}
+	cursor, err := collection.Find(ctx,
+		bson.M{"$and": []bson.M{filter, {"_id": bson.M{"$in": ids}}}},
+		options.Find().SetProjection(bson.M{
+			"_id":         1,
+			"userId":      1, // ✅ Keep userId in response
+			"title":       1,
+			"description": 1,
+			"price":       1,
+			"category":    1,
+		}),
+	)
+	if err != nil {
+		log.Printf("❌ Error fetching gigs: %v", err)
+		WriteJSONError(w, "Error fetching gigs", http.StatusInternalServerError)
+		return
+	}
+	var gigs []models.Gig
+	if err := cursor.All(ctx, &gigs); err != nil {
+		log.Printf("❌ Error decoding gigs: %v", err)
+		WriteJSONError(w, "Error decoding gigs", http.StatusInternalServerError)
+		return
+	}
+
+	// 7️⃣ Fuse the two rankings
+	semanticWeight, keywordWeight, minScore := gigSearchWeights()
+	minSimilarity := embedder.MinSimilarity()
+
+	var matches []GigMatch
+	for _, gig := range gigs {
+		c := candidates[gig.ID]
+
+		semanticScore := 0.0
+		if c.hasSimilarity && minSimilarity < 1 {
+			semanticScore = (c.similarity - minSimilarity) / (1 - minSimilarity)
+			semanticScore = max(0, min(1, semanticScore))
+		}
+		keywordScore := c.bm25 / (c.bm25 + bm25HalfScore)
+		score := semanticWeight*semanticScore + keywordWeight*keywordScore
+		if score <= 0 || score < minScore {
+			continue
+		}
+
+		match := GigMatch{
+			ID:          gig.ID,
+			UserID:      gig.UserID,
+			Title:       gig.Title,
+			Description: gig.Description,
+			Price:       gig.Price,
+			Category:    gig.Category,
+			Similarity:  c.similarity,
+			Score:       score,
+		}
+		if req.Debug {
+			explain := &GigRankExplanation{
+				Query:           cleanedQuery,
+				RefinedQuery:    refinedQuery,
+				RefinementError: refinementError,
+				SemanticScore:   semanticScore,
+				SemanticWeight:  semanticWeight,
+				BM25:            c.bm25,
+				KeywordScore:    keywordScore,
+				KeywordWeight:   keywordWeight,
+				MatchedTerms:    c.matched,
+				Score:           score,
+			}
+			if c.hasSimilarity {
+				similarity := c.similarity
+				explain.Similarity = &similarity
+			}
+			if explain.MatchedTerms == nil {
+				explain.MatchedTerms = []string{}
+			}
+			match.Explain = explain
+		}
+		matches = append(matches, match)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].ID.Hex() > matches[j].ID.Hex() // Newer first on ties
+	})
+	if len(matches) > gigSearchResults {
+		matches = matches[:gigSearchResults]
+	}
+	for i := range matches {
+		if matches[i].Explain != nil {
+			matches[i].Explain.Rank = i + 1
+		}
+	}
+
+	if len(matches) == 0 {
+		writeNoGigMatches(w)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(matches)
+}
+
+// writeNoGigMatches responds with the prompt the app shows when nothing matched.
+func writeNoGigMatches(w http.ResponseWriter) {
+	log.Println("⚠️ No gigs matched the query.")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode([]map[string]interface{}{
+		{
+			"message": "No gigs matched your query. Could you clarify your preferred category, price range, or other details?",
+		},
+	})
+}
@@ -0,0 +1,212 @@
+// handlers/inbox.go
+
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"Thegridproduct/backend/db"
+	"Thegridproduct/backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// previewLength is how many characters of the latest message the inbox shows.
+const previewLength = 100
+
+// messagePreview is the latest message of a chat as shown in the inbox.
+type messagePreview struct {
+	ID        string    `json:"id"`
+	SenderID  string    `json:"senderId"`
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// inboxChat is one conversation of the inbox summary.
+type inboxChat struct {
+	ChatID        string          `json:"chatId"`
+	ReferenceID   string          `json:"referenceId"`
+	ReferenceType string          `json:"referenceType"`
+	OtherUserID   string          `json:"otherUserId"`
+	Status        string          `json:"status"`
+	UnreadCount   int64           `json:"unreadCount"`
+	LastMessage   *messagePreview `json:"lastMessage"`
+
+	activity time.Time
+}
+
+// inboxSummary is the response of InboxSummaryHandler.
+type inboxSummary struct {
+	TotalUnread     int64       `json:"totalUnread"`
+	PendingRequests int64       `json:"pendingRequests"`
+	Chats           []inboxChat `json:"chats"`
+}
+
+// InboxSummaryHandler returns what the chat list needs in one request: the unread
+// count of every conversation of the caller and their total, a preview of each
+// conversation's latest message, and how many chat requests wait for the caller's
+// answer. Conversations are ordered by latest activity, newest first.
+// Endpoint: GET /inbox/summary
+func InboxSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, ok := r.Context().Value(userIDKey).(string)
+	if !ok || userID == "" {
+		WriteJSONError(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		WriteJSONError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	chats, err := db.FindChatsByUser(userID)
+	if err != nil {
+		WriteJSONError(w, "Error fetching inbox", http.StatusInternalServerError)
+		return
+	}
+	entries, err := inboxEntries(ctx, userObjID, chats)
+	if err != nil {
+		log.Printf("Error fetching inbox of user %s: %v", userID, err)
+		WriteJSONError(w, "Error fetching inbox", http.StatusInternalServerError)
+		return
+	}
+
+	pending, err := db.GetCollection("gridlyapp", "chat_requests").CountDocuments(ctx, bson.M{
+		"sellerId": userObjID,
+		"status":   models.ChatRequestStatusPending,
+	})
+	if err != nil {
+		log.Printf("Error counting chat requests of user %s: %v", userID, err)
+		WriteJSONError(w, "Error fetching inbox", http.StatusInternalServerError)
+		return
+	}
+
+	summary := inboxSummary{PendingRequests: pending, Chats: make([]inboxChat, 0, len(chats))}
+	for _, chat := range chats {
+		otherUserID := chat.BuyerID
+		if chat.BuyerID == userObjID {
+			otherUserID = chat.SellerID
+		}
+		item := inboxChat{
+			ChatID:        chat.ID.Hex(),
+			ReferenceID:   chat.ReferenceID.Hex(),
+			ReferenceType: chat.ReferenceType,
+			OtherUserID:   otherUserID.Hex(),
+			Status:        chat.Status,
+			activity:      chat.CreatedAt,
+		}
+		if entry, ok := entries[chat.ID]; ok {
+			item.UnreadCount = entry.UnreadCount
+			if msg := entry.LastMessage; msg != nil {
+				item.LastMessage = &messagePreview{
+					ID:        msg.ID.Hex(),
+					SenderID:  msg.SenderID,
+					Content:   preview(msg.Content),
+					Timestamp: msg.Timestamp,
+				}
+				item.activity = msg.Timestamp
+			}
+		}
+		summary.TotalUnread += item.UnreadCount
+		summary.Chats = append(summary.Chats, item)
+	}
+	sort.SliceStable(summary.Chats, func(i, j int) bool {
+		return summary.Chats[i].activity.After(summary.Chats[j].activity)
+	})
+
+	WriteJSON(w, summary, http.StatusOK)
+}
+
+// inboxEntries returns the inbox entries of a user for chats, by chat ID. New
+// chats are seeded when they are created; chats from before the inbox existed get
+// an empty entry first, so that RecordInboxMessage counts every message sent from
+// then on, and the unread messages sent before it are then counted from the
+// message history and read state and added to it.
+func inboxEntries(ctx context.Context, userID primitive.ObjectID, chats []models.Chat) (map[primitive.ObjectID]models.InboxEntry, error) {
+	stored, err := db.GetInbox(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[primitive.ObjectID]models.InboxEntry, len(chats))
+	for _, entry := range stored {
+		entries[entry.ChatID] = entry
+	}
+
+	var seeded []primitive.ObjectID
+	for _, chat := range chats {
+		if _, ok := entries[chat.ID]; ok {
+			continue
+		}
+		created, err := db.SeedInboxEntry(ctx, models.InboxEntry{ChatID: chat.ID, UserID: userID})
+		if err != nil {
+			return nil, err
+		}
+		if created {
+			seeded = append(seeded, chat.ID)
+			continue
+		}
+		// Another request seeded the entry just now and backfills it itself.
+		entry, err := db.GetInboxEntry(ctx, chat.ID, userID)
+		if err != nil {
+			return nil, err
+		}
+		entries[chat.ID] = *entry
+	}
+	if len(seeded) == 0 {
+		return entries, nil
+	}
+
+	// Messages sent from here on are recorded in the seeded entries, so only the
+	// ones sent before are counted from the history.
+	seededAt := time.Now()
+	latest, err := db.Messages.Latest(ctx, seeded)
+	if err != nil {
+		return nil, err
+	}
+	for _, chatID := range seeded {
+		var unread int64
+		var lastMessage *models.Message
+		if msg, ok := latest[chatID]; ok {
+			lastMessage = &msg
+
+			reads, err := db.GetChatReads(ctx, chatID)
+			if err != nil {
+				return nil, err
+			}
+			var since time.Time
+			var sinceID primitive.ObjectID
+			if read := readOf(reads, userID); read != nil {
+				since, sinceID = read.LastReadAt, read.LastReadMessageID
+			}
+			if unread, err = db.Messages.CountBetween(ctx, chatID, since, sinceID, seededAt, primitive.NilObjectID, userID.Hex()); err != nil {
+				return nil, err
+			}
+		}
+		entry, err := db.BackfillInboxEntry(ctx, chatID, userID, unread, lastMessage)
+		if err != nil {
+			return nil, err
+		}
+		entries[chatID] = *entry
+	}
+	return entries, nil
+}
+
+// preview shortens content to previewLength characters.
+func preview(content string) string {
+	if utf8.RuneCountInString(content) <= previewLength {
+		return content
+	}
+	runes := []rune(content)
+	return string(runes[:previewLength]) + "…"
+}
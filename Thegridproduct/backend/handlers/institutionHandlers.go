@@ -0,0 +1,299 @@
+// handlers/institutionHandlers.go
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"Thegridproduct/backend/db"
+	"Thegridproduct/backend/models"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// InstitutionRequest represents the payload for creating or updating a registry entry.
+type InstitutionRequest struct {
+	Name         string   `json:"name"`
+	Aliases      []string `json:"aliases"`
+	EmailDomains []string `json:"emailDomains"`
+	StudentType  string   `json:"studentType"`
+}
+
+// validate checks the required fields of an institution payload.
+func (req InstitutionRequest) validate() string {
+	if strings.TrimSpace(req.Name) == "" {
+		return "Name is required"
+	}
+	if req.StudentType != StudentTypeUniversity && req.StudentType != StudentTypeHighSchool {
+		return "studentType must be 'university' or 'highschool'"
+	}
+	for _, domain := range req.EmailDomains {
+		if db.NormalizeEmailDomain(domain) != "" {
+			return ""
+		}
+	}
+	return "At least one email domain is required"
+}
+
+// ListInstitutionsHandler returns the registry so the app can offer canonical institution names at signup.
+// Endpoint: GET /institutions?studentType=university
+func ListInstitutionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	institutions, err := db.ListInstitutions(ctx, r.URL.Query().Get("studentType"))
+	if err != nil {
+		log.Printf("Error listing institutions: %v", err)
+		WriteJSONError(w, "Error fetching institutions", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, institutions, http.StatusOK)
+}
+
+// CreateInstitutionHandler adds a new institution to the registry.
+func CreateInstitutionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req InstitutionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteJSONError(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		WriteJSONError(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	inst := models.Institution{
+		Name:         req.Name,
+		Aliases:      req.Aliases,
+		EmailDomains: req.EmailDomains,
+		StudentType:  req.StudentType,
+	}
+	if err := db.CreateInstitution(ctx, &inst); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			WriteJSONError(w, "Institution already exists", http.StatusConflict)
+			return
+		}
+		log.Printf("Error creating institution: %v", err)
+		WriteJSONError(w, "Error creating institution", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, inst, http.StatusCreated)
+}
+
+// UpdateInstitutionHandler replaces a registry entry. Renaming an institution also
+// rewrites the stored name on users and listings so campus filters keep matching.
+func UpdateInstitutionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	instID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		WriteJSONError(w, "Invalid institution ID format", http.StatusBadRequest)
+		return
+	}
+
+	var req InstitutionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteJSONError(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	if msg := req.validate(); msg != "" {
+		WriteJSONError(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	existing, err := db.GetInstitutionByID(ctx, instID)
+	if err == db.ErrInstitutionNotFound {
+		WriteJSONError(w, "Institution not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error fetching institution: %v", err)
+		WriteJSONError(w, "Error fetching institution", http.StatusInternalServerError)
+		return
+	}
+
+	inst := models.Institution{
+		ID:           instID,
+		Name:         req.Name,
+		Aliases:      req.Aliases,
+		EmailDomains: req.EmailDomains,
+		StudentType:  req.StudentType,
+		CreatedAt:    existing.CreatedAt,
+	}
+	if err := db.ReplaceInstitution(ctx, &inst); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			WriteJSONError(w, "Another institution already uses this name", http.StatusConflict)
+			return
+		}
+		log.Printf("Error updating institution: %v", err)
+		WriteJSONError(w, "Error updating institution", http.StatusInternalServerError)
+		return
+	}
+
+	if existing.Name != inst.Name {
+		if err := renameInstitutionReferences(ctx, existing.Name, &inst); err != nil {
+			log.Printf("Error renaming institution references from %q to %q: %v", existing.Name, inst.Name, err)
+			WriteJSONError(w, "Institution updated but renaming existing references failed", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	WriteJSON(w, inst, http.StatusOK)
+}
+
+// DeleteInstitutionHandler removes an institution from the registry.
+func DeleteInstitutionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	instID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		WriteJSONError(w, "Invalid institution ID format", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := db.DeleteInstitution(ctx, instID); err == db.ErrInstitutionNotFound {
+		WriteJSONError(w, "Institution not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error deleting institution: %v", err)
+		WriteJSONError(w, "Error deleting institution", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, map[string]string{"message": "Institution deleted successfully"}, http.StatusOK)
+}
+
+// renameInstitutionReferences rewrites the stored institution name on users and listings.
+func renameInstitutionReferences(ctx context.Context, oldName string, inst *models.Institution) error {
+	_, err := db.Users.UpdateMany(ctx,
+		bson.M{"$or": []bson.M{{"institutionId": inst.ID}, {"institution": oldName}}},
+		bson.M{"$set": bson.M{"institution": inst.Name, "institutionId": inst.ID}},
+	)
+	if err != nil {
+		return err
+	}
+	return renameListingInstitution(ctx, oldName, inst.Name)
+}
+
+// renameListingInstitution rewrites the institution name stored on products, gigs and product requests.
+func renameListingInstitution(ctx context.Context, oldName, newName string) error {
+	listingFields := map[string]string{
+		"products":         "university",
+		"gigs":             "university",
+		"product_requests": "institution",
+	}
+	for colName, field := range listingFields {
+		_, err := db.GetCollection("gridlyapp", colName).UpdateMany(ctx,
+			bson.M{field: oldName},
+			bson.M{"$set": bson.M{field: newName}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InstitutionMigrationReport summarizes a run of MigrateInstitutionsHandler.
+type InstitutionMigrationReport struct {
+	DryRun         bool              `json:"dryRun"`
+	UsersScanned   int               `json:"usersScanned"`
+	UsersMatched   int               `json:"usersMatched"`
+	NamesRewritten map[string]string `json:"namesRewritten"` // free-text name -> canonical name
+	Unmatched      map[string]int    `json:"unmatched"`      // free-text name -> number of users
+}
+
+// MigrateInstitutionsHandler links existing users whose institution is free text to the registry.
+// Each distinct free-text value is resolved by name or alias; matched users get the canonical
+// name and institution ID, and listings carrying the old text are renamed too. Values that do
+// not resolve are reported so admins can add them as aliases and run the migration again.
+// Endpoint: POST /admin/institutions/migrate?dryRun=true
+func MigrateInstitutionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	dryRun := r.URL.Query().Get("dryRun") == "true"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	report := InstitutionMigrationReport{
+		DryRun:         dryRun,
+		NamesRewritten: map[string]string{},
+		Unmatched:      map[string]int{},
+	}
+	resolved := map[string]*models.Institution{}
+
+	users, err := db.Users.Find(ctx, bson.M{"institutionId": bson.M{"$exists": false}})
+	if err != nil {
+		log.Printf("Error scanning users: %v", err)
+		WriteJSONError(w, "Error scanning users", http.StatusInternalServerError)
+		return
+	}
+
+	for _, user := range users {
+		report.UsersScanned++
+
+		inst, seen := resolved[user.Institution]
+		if !seen {
+			inst, err = db.FindInstitutionByName(ctx, user.Institution)
+			if err != nil && err != db.ErrInstitutionNotFound {
+				log.Printf("Error resolving institution %q: %v", user.Institution, err)
+				WriteJSONError(w, "Error resolving institutions", http.StatusInternalServerError)
+				return
+			}
+			resolved[user.Institution] = inst
+		}
+		if inst == nil {
+			report.Unmatched[user.Institution]++
+			continue
+		}
+
+		report.UsersMatched++
+		if user.Institution != inst.Name {
+			report.NamesRewritten[user.Institution] = inst.Name
+		}
+		if dryRun {
+			continue
+		}
+
+		err = db.Users.Update(ctx, user.ID, bson.M{"$set": bson.M{
+			"institution":   inst.Name,
+			"institutionId": inst.ID,
+		}})
+		if err != nil {
+			log.Printf("Error migrating user %s: %v", user.ID.Hex(), err)
+		}
+	}
+
+	if !dryRun {
+		for oldName, newName := range report.NamesRewritten {
+			if err := renameListingInstitution(ctx, oldName, newName); err != nil {
+				log.Printf("Error renaming listings from %q to %q: %v", oldName, newName, err)
+			}
+		}
+	}
+
+	WriteJSON(w, report, http.StatusOK)
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import "testing"
+
+func TestInstitutionRequestValidate(t *testing.T) {
+	valid := func() InstitutionRequest {
+		return InstitutionRequest{Name: "UC Berkeley", EmailDomains: []string{"berkeley.edu"}, StudentType: StudentTypeUniversity}
+	}
+	tests := []struct {
+		name    string
+		change  func(*InstitutionRequest)
+		wantErr bool
+	}{
+		{"valid", func(*InstitutionRequest) {}, false},
+		{"domain with a leading @", func(r *InstitutionRequest) { r.EmailDomains = []string{"@berkeley.edu"} }, false},
+		{"missing name", func(r *InstitutionRequest) { r.Name = "  " }, true},
+		{"unknown student type", func(r *InstitutionRequest) { r.StudentType = "college" }, true},
+		{"no domains", func(r *InstitutionRequest) { r.EmailDomains = nil }, true},
+		{"only blank domains", func(r *InstitutionRequest) { r.EmailDomains = []string{" ", "@"} }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid()
+			tt.change(&req)
+			if msg := req.validate(); (msg != "") != tt.wantErr {
+				t.Errorf("validate() = %q, wantErr %v", msg, tt.wantErr)
+			}
+		})
+	}
+}
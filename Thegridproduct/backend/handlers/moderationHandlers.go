@@ -0,0 +1,138 @@
+// handlers/moderationHandlers.go
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"Thegridproduct/backend/db"
+	"Thegridproduct/backend/models"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ModerationRemovalRequest carries the reason a moderator gives for taking a listing down.
+type ModerationRemovalRequest struct {
+	Reason string `json:"reason"`
+}
+
+// decodeRemovalReason reads the required removal reason from the request body.
+func decodeRemovalReason(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req ModerationRemovalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteJSONError(w, "Invalid input", http.StatusBadRequest)
+		return "", false
+	}
+	if req.Reason == "" {
+		WriteJSONError(w, "Reason is required", http.StatusBadRequest)
+		return "", false
+	}
+	return req.Reason, true
+}
+
+// ModerateRemoveProductHandler takes down a reported product regardless of who owns it.
+// Endpoint: DELETE /moderation/products/{id}
+func ModerateRemoveProductHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	moderatorID, ok := r.Context().Value(userIDKey).(string)
+	if !ok || moderatorID == "" {
+		WriteJSONError(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	productID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		WriteJSONError(w, "Invalid product ID format", http.StatusBadRequest)
+		return
+	}
+	reason, ok := decodeRemovalReason(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var product models.Product
+	err = db.GetCollection("gridlyapp", "products").FindOne(ctx, bson.M{"_id": productID}).Decode(&product)
+	if err == mongo.ErrNoDocuments {
+		WriteJSONError(w, "Product not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error fetching product: %v", err)
+		WriteJSONError(w, "Error fetching product data", http.StatusInternalServerError)
+		return
+	}
+
+	deleted, err := removeProduct(ctx, &product)
+	if err != nil {
+		log.Printf("Error removing product: %v", err)
+		WriteJSONError(w, "Error removing product", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		WriteJSONError(w, "Product not found or already deleted", http.StatusNotFound)
+		return
+	}
+	log.Printf("Moderator %s removed product %s of user %s: %s", moderatorID, productID.Hex(), product.UserID.Hex(), reason)
+
+	WriteJSON(w, map[string]string{"message": "Product removed"}, http.StatusOK)
+}
+
+// ModerateRemoveGigHandler takes down a reported gig regardless of who owns it.
+// Endpoint: DELETE /moderation/services/{id}
+func ModerateRemoveGigHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	moderatorID, ok := r.Context().Value(userIDKey).(string)
+	if !ok || moderatorID == "" {
+		WriteJSONError(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	gigID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		WriteJSONError(w, "Invalid gig ID format", http.StatusBadRequest)
+		return
+	}
+	reason, ok := decodeRemovalReason(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var gig models.Gig
+	err = db.GetCollection("gridlyapp", "gigs").FindOne(ctx, bson.M{"_id": gigID}).Decode(&gig)
+	if err == mongo.ErrNoDocuments {
+		WriteJSONError(w, "Gig not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error fetching gig: %v", err)
+		WriteJSONError(w, "Error fetching gig", http.StatusInternalServerError)
+		return
+	}
+
+	deleted, err := removeGig(ctx, &gig)
+	if err != nil {
+		log.Printf("Error removing gig: %v", err)
+		WriteJSONError(w, "Error removing gig", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		WriteJSONError(w, "Gig not found or already deleted", http.StatusNotFound)
+		return
+	}
+	log.Printf("Moderator %s removed gig %s of user %s: %s", moderatorID, gigID.Hex(), gig.UserID.Hex(), reason)
+
+	WriteJSON(w, map[string]string{"message": "Gig removed"}, http.StatusOK)
+}
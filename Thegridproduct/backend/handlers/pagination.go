@@ -0,0 +1,244 @@
+// handlers/pagination.go
+
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// sortSpec orders a feed by one field. Ties are broken by _id in the same
+// direction so the order is stable and cursors never skip or repeat items.
+type sortSpec struct {
+	field     string
+	direction int // 1 ascending, -1 descending
+}
+
+// Sort options shared by the listing feeds. Each feed accepts a subset.
+var (
+	sortNewest          = sortSpec{field: "postedDate", direction: -1}
+	sortPriceAsc        = sortSpec{field: "price", direction: 1}
+	sortPriceDesc       = sortSpec{field: "price", direction: -1}
+	sortMostLiked       = sortSpec{field: "likeCount", direction: -1}
+	sortNewestRequested = sortSpec{field: "createdAt", direction: -1}
+)
+
+// productSorts are the sort options of product feeds.
+var productSorts = map[string]sortSpec{
+	"newest":     sortNewest,
+	"price_asc":  sortPriceAsc,
+	"price_desc": sortPriceDesc,
+	"most_liked": sortMostLiked,
+}
+
+// gigSorts are the sort options of the gig feed. Gig prices are free text, so
+// they cannot be sorted by price.
+var gigSorts = map[string]sortSpec{
+	"newest":     sortNewest,
+	"most_liked": sortMostLiked,
+}
+
+// productRequestSorts are the sort options of the product request feed.
+var productRequestSorts = map[string]sortSpec{
+	"newest": sortNewestRequested,
+}
+
+// pageCursor is the position after the last item of a page. It is sent to
+// clients as opaque base64 so the format can change without breaking them.
+type pageCursor struct {
+	Sort  string             `bson:"s"`
+	Value interface{}        `bson:"v"`
+	ID    primitive.ObjectID `bson:"id"`
+}
+
+// pageRequest holds the pagination and sort query parameters of a feed request.
+type pageRequest struct {
+	paginate bool // Old app versions send no limit or cursor and get a bare array
+	limit    int64
+	sortName string
+	sort     sortSpec
+	sorted   bool
+	after    *pageCursor
+}
+
+// pageResponse is the envelope paginated feeds respond with.
+type pageResponse struct {
+	Items      interface{} `json:"items"`
+	NextCursor string      `json:"nextCursor,omitempty"`
+	HasMore    bool        `json:"hasMore"`
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// parsePageRequest reads limit, cursor and sort from the query string. Pagination is
+// only switched on when limit or cursor is present; sort works either way.
+func parsePageRequest(r *http.Request, sorts map[string]sortSpec, defaultSort string) (pageRequest, error) {
+	q := r.URL.Query()
+	page := pageRequest{limit: defaultPageSize, sortName: defaultSort, sort: sorts[defaultSort]}
+
+	if s := q.Get("sort"); s != "" {
+		spec, ok := sorts[s]
+		if !ok {
+			return page, fmt.Errorf("unsupported sort %q", s)
+		}
+		page.sortName, page.sort, page.sorted = s, spec, true
+	}
+
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.ParseInt(l, 10, 64)
+		if err != nil || n < 1 {
+			return page, errors.New("limit must be a positive number")
+		}
+		if n > maxPageSize {
+			n = maxPageSize
+		}
+		page.limit, page.paginate = n, true
+	}
+
+	if c := q.Get("cursor"); c != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(c)
+		if err != nil {
+			return page, errInvalidCursor
+		}
+		var cursor pageCursor
+		if err := bson.Unmarshal(raw, &cursor); err != nil || cursor.ID.IsZero() {
+			return page, errInvalidCursor
+		}
+		// A cursor only makes sense for the order it was created with.
+		if cursor.Sort != page.sortName {
+			return page, errors.New("cursor does not match the requested sort")
+		}
+		page.after, page.paginate = &cursor, true
+	}
+
+	if page.paginate {
+		page.sorted = true
+	}
+	return page, nil
+}
+
+// findPage runs filter on col in the requested order and decodes the matching
+// documents into results, which must be a pointer to a slice. When the request is
+// paginated only one page is returned together with the cursor of the next page.
+func findPage(ctx context.Context, col *mongo.Collection, filter bson.M, page pageRequest, results interface{}) (string, error) {
+	opts := options.Find()
+	if page.sorted {
+		opts.SetSort(bson.D{{Key: page.sort.field, Value: page.sort.direction}, {Key: "_id", Value: page.sort.direction}})
+	}
+	if !page.paginate {
+		cursor, err := col.Find(ctx, filter, opts)
+		if err != nil {
+			return "", err
+		}
+		return "", cursor.All(ctx, results)
+	}
+
+	if page.after != nil {
+		filter = bson.M{"$and": []bson.M{filter, afterCursor(page.sort, page.after)}}
+	}
+	// One extra document tells whether there is another page.
+	opts.SetLimit(page.limit + 1)
+
+	cursor, err := col.Find(ctx, filter, opts)
+	if err != nil {
+		return "", err
+	}
+	var docs []bson.Raw
+	if err := cursor.All(ctx, &docs); err != nil {
+		return "", err
+	}
+
+	next := ""
+	if int64(len(docs)) > page.limit {
+		docs = docs[:page.limit]
+		last := docs[len(docs)-1]
+		next, err = encodePageCursor(page.sortName, page.sort.field, last)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	slice := reflect.ValueOf(results).Elem()
+	items := reflect.MakeSlice(slice.Type(), len(docs), len(docs))
+	for i, doc := range docs {
+		if err := bson.Unmarshal(doc, items.Index(i).Addr().Interface()); err != nil {
+			return "", err
+		}
+	}
+	slice.Set(items)
+
+	return next, nil
+}
+
+// afterCursor matches the documents that come after cursor in the order of spec.
+// MongoDB sorts documents whose field is null or missing before all others, but
+// $gt and $lt never match them, so they need branches of their own.
+func afterCursor(spec sortSpec, cursor *pageCursor) bson.M {
+	op := "$gt"
+	if spec.direction < 0 {
+		op = "$lt"
+	}
+
+	var after []bson.M
+	if cursor.Value == nil {
+		after = []bson.M{{spec.field: nil, "_id": bson.M{op: cursor.ID}}}
+		if spec.direction > 0 {
+			after = append(after, bson.M{spec.field: bson.M{"$ne": nil}})
+		}
+	} else {
+		after = []bson.M{
+			{spec.field: bson.M{op: cursor.Value}},
+			{spec.field: cursor.Value, "_id": bson.M{op: cursor.ID}},
+		}
+		if spec.direction < 0 {
+			after = append(after, bson.M{spec.field: nil})
+		}
+	}
+	return bson.M{"$or": after}
+}
+
+// encodePageCursor builds the cursor pointing after doc.
+func encodePageCursor(sortName, field string, doc bson.Raw) (string, error) {
+	id, ok := doc.Lookup("_id").ObjectIDOK()
+	if !ok {
+		return "", errors.New("document has no ObjectID")
+	}
+
+	var value interface{}
+	if v, err := doc.LookupErr(field); err == nil {
+		if err := v.Unmarshal(&value); err != nil {
+			return "", err
+		}
+	}
+
+	raw, err := bson.Marshal(pageCursor{Sort: sortName, Value: value, ID: id})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// writeFeed responds with the envelope for paginated requests and the bare array
+// old app versions expect otherwise.
+func writeFeed(w http.ResponseWriter, page pageRequest, items interface{}, next string) {
+	if !page.paginate {
+		WriteJSON(w, items, http.StatusOK)
+		return
+	}
+	WriteJSON(w, pageResponse{Items: items, NextCursor: next, HasMore: next != ""}, http.StatusOK)
+}
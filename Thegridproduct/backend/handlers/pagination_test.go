@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPageCursorRoundTrip(t *testing.T) {
+	id := primitive.NewObjectID()
+	posted := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		sortName string
+		sorts    map[string]sortSpec
+		doc      bson.M
+		want     interface{}
+	}{
+		{"date", "newest", productSorts, bson.M{"_id": id, "postedDate": posted}, primitive.NewDateTimeFromTime(posted)},
+		{"float price", "price_asc", productSorts, bson.M{"_id": id, "price": 12.5}, 12.5},
+		{"int likes", "most_liked", productSorts, bson.M{"_id": id, "likeCount": int32(7)}, int32(7)},
+		{"missing field", "newest", gigSorts, bson.M{"_id": id}, nil},
+		{"null field", "newest", productRequestSorts, bson.M{"_id": id, "createdAt": nil}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := bson.Marshal(tt.doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			spec := tt.sorts[tt.sortName]
+			cursor, err := encodePageCursor(tt.sortName, spec.field, raw)
+			if err != nil {
+				t.Fatalf("encodePageCursor: %v", err)
+			}
+
+			r := httptest.NewRequest("GET", "/feed?sort="+tt.sortName+"&cursor="+url.QueryEscape(cursor), nil)
+			page, err := parsePageRequest(r, tt.sorts, "newest")
+			if err != nil {
+				t.Fatalf("parsePageRequest: %v", err)
+			}
+			if !page.paginate || page.after == nil {
+				t.Fatalf("cursor not applied: %+v", page)
+			}
+			if page.after.ID != id || page.after.Sort != tt.sortName {
+				t.Errorf("cursor = %+v, want id %s and sort %s", page.after, id.Hex(), tt.sortName)
+			}
+			if !reflect.DeepEqual(page.after.Value, tt.want) {
+				t.Errorf("cursor value = %#v, want %#v", page.after.Value, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePageRequestErrors(t *testing.T) {
+	raw, _ := bson.Marshal(bson.M{"_id": primitive.NewObjectID(), "price": 3.0})
+	priceCursor, _ := encodePageCursor("price_asc", "price", raw)
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"not base64", "cursor=!!!"},
+		{"not bson", "cursor=aGVsbG8"},
+		{"cursor of another sort", "sort=newest&cursor=" + priceCursor},
+		{"unknown sort", "sort=cheapest"},
+		{"zero limit", "limit=0"},
+		{"negative limit", "limit=-3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/feed", nil)
+			r.URL.RawQuery = tt.query
+			if _, err := parsePageRequest(r, productSorts, "newest"); err == nil {
+				t.Errorf("parsePageRequest(%q) succeeded, want an error", tt.query)
+			}
+		})
+	}
+}
+
+func TestParsePageRequestDefaults(t *testing.T) {
+	tests := []struct {
+		query    string
+		paginate bool
+		limit    int64
+	}{
+		{"", false, defaultPageSize},
+		{"sort=price_desc", false, defaultPageSize},
+		{"limit=5", true, 5},
+		{"limit=1000", true, maxPageSize},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/feed?"+tt.query, nil)
+		page, err := parsePageRequest(r, productSorts, "newest")
+		if err != nil {
+			t.Fatalf("parsePageRequest(%q): %v", tt.query, err)
+		}
+		if page.paginate != tt.paginate || page.limit != tt.limit {
+			t.Errorf("parsePageRequest(%q) = paginate %v limit %d, want %v %d", tt.query, page.paginate, page.limit, tt.paginate, tt.limit)
+		}
+	}
+}
+
+func TestAfterCursor(t *testing.T) {
+	id := primitive.NewObjectID()
+	posted := primitive.NewDateTimeFromTime(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		name   string
+		spec   sortSpec
+		cursor pageCursor
+		want   bson.M
+	}{
+		{
+			"descending value also takes documents without the field",
+			sortNewest, pageCursor{Value: posted, ID: id},
+			bson.M{"$or": []bson.M{
+				{"postedDate": bson.M{"$lt": posted}},
+				{"postedDate": posted, "_id": bson.M{"$lt": id}},
+				{"postedDate": nil},
+			}},
+		},
+		{
+			"descending past the values pages by _id",
+			sortNewest, pageCursor{Value: nil, ID: id},
+			bson.M{"$or": []bson.M{
+				{"postedDate": nil, "_id": bson.M{"$lt": id}},
+			}},
+		},
+		{
+			"ascending value",
+			sortPriceAsc, pageCursor{Value: 4.5, ID: id},
+			bson.M{"$or": []bson.M{
+				{"price": bson.M{"$gt": 4.5}},
+				{"price": 4.5, "_id": bson.M{"$gt": id}},
+			}},
+		},
+		{
+			"ascending among documents without the field",
+			sortPriceAsc, pageCursor{Value: nil, ID: id},
+			bson.M{"$or": []bson.M{
+				{"price": nil, "_id": bson.M{"$gt": id}},
+				{"price": bson.M{"$ne": nil}},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := afterCursor(tt.spec, &tt.cursor); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("afterCursor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+// handlers/passwordResetHandlers.go
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"Thegridproduct/backend/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// passwordResetCodeTTL is how long an emailed reset code stays valid.
+	passwordResetCodeTTL = 15 * time.Minute
+
+	// maxPasswordResetAttempts is how many times a code can be tried before it is burned.
+	maxPasswordResetAttempts = 5
+
+	// minPasswordLength is the minimum length accepted for a new password.
+	minPasswordLength = 8
+)
+
+// PasswordReset holds a pending password reset until its code is confirmed.
+type PasswordReset struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	UserID    primitive.ObjectID `bson:"userId"`
+	Email     string             `bson:"email"`
+	CodeHash  string             `bson:"codeHash"`
+	Attempts  int                `bson:"attempts"`
+	Used      bool               `bson:"used"`
+	ExpiresAt time.Time          `bson:"expiresAt"`
+	CreatedAt time.Time          `bson:"createdAt"`
+}
+
+// PasswordResetRequest represents the payload for requesting a reset code.
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+// PasswordResetConfirmRequest represents the payload for confirming a reset.
+type PasswordResetConfirmRequest struct {
+	Email       string `json:"email"`
+	Code        string `json:"code"`
+	NewPassword string `json:"newPassword"`
+}
+
+// RequestPasswordResetHandler emails a one-time reset code to the account owner.
+// It always responds the same way so it cannot be used to discover registered emails.
+func RequestPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		WriteJSONError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteJSONError(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	email := strings.TrimSpace(req.Email)
+	if email == "" {
+		WriteJSONError(w, "Email is required", http.StatusBadRequest)
+		return
+	}
+
+	response := map[string]string{
+		"message": "If an account exists for this email, a password reset code has been sent.",
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Limited whether or not the account exists, so the limit reveals nothing.
+	if !allowRateLimits(ctx, w, "Too many password reset requests.", map[rateLimit]string{
+		passwordResetEmailLimit:   email,
+		passwordResetEmailIPLimit: clientIP(r),
+	}) {
+		return
+	}
+
+	user, err := db.Users.GetByEmail(ctx, email)
+	if err == db.ErrUserNotFound {
+		WriteJSON(w, response, http.StatusOK)
+		return
+	} else if err != nil {
+		log.Printf("Error finding user for password reset: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	code, err := generateVerificationCode()
+	if err != nil {
+		log.Printf("Error generating password reset code: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	codeHash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	resetCollection := db.GetCollection("gridlyapp", "password_resets")
+
+	// Only the most recently requested code is valid.
+	if _, err := resetCollection.DeleteMany(ctx, bson.M{"userId": user.ID}); err != nil {
+		log.Printf("Error clearing old password resets: %v", err)
+	}
+
+	reset := PasswordReset{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID,
+		Email:     user.Email,
+		CodeHash:  string(codeHash),
+		ExpiresAt: time.Now().Add(passwordResetCodeTTL),
+		CreatedAt: time.Now(),
+	}
+	if _, err := resetCollection.InsertOne(ctx, reset); err != nil {
+		log.Printf("Error creating password reset: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Queue the reset email; a failure is logged but not revealed to the caller.
+	_ = sendPasswordResetEmail(user.Email, code)
+
+	WriteJSON(w, response, http.StatusOK)
+}
+
+// ConfirmPasswordResetHandler checks the emailed code, sets the new password and
+// revokes every existing session for the account.
+func ConfirmPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		WriteJSONError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PasswordResetConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteJSONError(w, "Invalid input", http.StatusBadRequest)
+		return
+	}
+	email := strings.TrimSpace(req.Email)
+	if email == "" || req.Code == "" || req.NewPassword == "" {
+		WriteJSONError(w, "Email, code and new password are required", http.StatusBadRequest)
+		return
+	}
+	if len(req.NewPassword) < minPasswordLength {
+		WriteJSONError(w, "Password must be at least 8 characters long", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	resetCollection := db.GetCollection("gridlyapp", "password_resets")
+
+	// Count the attempt before checking the code, in the same write that checks
+	// the limit, so parallel guesses cannot get past it.
+	var reset PasswordReset
+	err := resetCollection.FindOneAndUpdate(ctx,
+		bson.M{
+			"email":     email,
+			"used":      false,
+			"expiresAt": bson.M{"$gt": time.Now()},
+			"attempts":  bson.M{"$lt": maxPasswordResetAttempts},
+		},
+		bson.M{"$inc": bson.M{"attempts": 1}},
+	).Decode(&reset)
+	if err == mongo.ErrNoDocuments {
+		writePasswordResetUnavailable(ctx, w, email)
+		return
+	} else if err != nil {
+		log.Printf("Error finding password reset: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(reset.CodeHash), []byte(req.Code)) != nil {
+		WriteJSONError(w, "Invalid reset code", http.StatusUnauthorized)
+		return
+	}
+
+	// Burn the code before changing anything so it cannot be replayed concurrently.
+	res, err := resetCollection.UpdateOne(ctx,
+		bson.M{"_id": reset.ID, "used": false},
+		bson.M{"$set": bson.M{"used": true}},
+	)
+	if err != nil {
+		log.Printf("Error consuming password reset: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if res.ModifiedCount == 0 {
+		WriteJSONError(w, "Invalid or expired reset code", http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		WriteJSONError(w, "Error processing password", http.StatusInternalServerError)
+		return
+	}
+
+	update := bson.M{"$set": bson.M{"password": string(hashedPassword), "updatedAt": time.Now()}}
+	if err := db.Users.Update(ctx, reset.UserID, update); err != nil {
+		log.Printf("Error updating password: %v", err)
+		WriteJSONError(w, "Failed to update password", http.StatusInternalServerError)
+		return
+	}
+
+	// Log every device out; whoever had the old password loses access.
+	if _, err := db.RevokeUserSessions(ctx, reset.UserID); err != nil {
+		log.Printf("Error revoking sessions after password reset: %v", err)
+	}
+
+	WriteJSON(w, map[string]string{
+		"message": "Password has been reset. Please log in with your new password.",
+	}, http.StatusOK)
+}
+
+// writePasswordResetUnavailable explains why no reset code of email can be tried.
+func writePasswordResetUnavailable(ctx context.Context, w http.ResponseWriter, email string) {
+	resetCollection := db.GetCollection("gridlyapp", "password_resets")
+
+	var reset PasswordReset
+	err := resetCollection.FindOne(ctx, bson.M{"email": email, "used": false}).Decode(&reset)
+	if err == mongo.ErrNoDocuments {
+		WriteJSONError(w, "Invalid or expired reset code", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("Error finding password reset: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if time.Now().After(reset.ExpiresAt) {
+		_, _ = resetCollection.DeleteOne(ctx, bson.M{"_id": reset.ID})
+		WriteJSONError(w, "Reset code expired. Please request a new one.", http.StatusBadRequest)
+		return
+	}
+	WriteJSONError(w, "Too many incorrect attempts. Please request a new code.", http.StatusTooManyRequests)
+}
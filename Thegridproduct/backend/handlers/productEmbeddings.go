@@ -0,0 +1,236 @@
+// handlers/productEmbeddings.go
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"Thegridproduct/backend/db"
+	"Thegridproduct/backend/embeddings"
+	"Thegridproduct/backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultSemanticResults = 10
+	maxSemanticResults     = 50
+)
+
+// refreshProductEmbedding computes and stores the embedding of a product. It is run
+// in its own goroutine after a product is created or its text changes, so listing
+// never waits on the embeddings API, and by ReembedStaleListings to catch up.
+func refreshProductEmbedding(productID primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	collection := db.GetCollection("gridlyapp", "products")
+
+	var product models.Product
+	if err := collection.FindOne(ctx, bson.M{"_id": productID}).Decode(&product); err != nil {
+		log.Printf("Error loading product %s for embedding: %v", productID.Hex(), err)
+		return
+	}
+
+	embedder := embeddings.Default()
+	vector, err := embedder.Embed(ctx, embeddings.ProductText(product))
+	if err != nil {
+		log.Printf("Error generating embedding for product %s: %v", productID.Hex(), err)
+		return
+	}
+
+	// Only store the vector if the text it was computed from is still current;
+	// otherwise a newer refresh is already on its way. These are the fields of
+	// embeddings.ProductText.
+	filter := bson.M{
+		"_id":          productID,
+		"title":        product.Title,
+		"description":  product.Description,
+		"selectedTags": product.SelectedTags,
+		"condition":    product.Condition,
+	}
+	if product.Condition == "" {
+		// Stored with omitempty, so an empty condition is a missing field
+		filter["condition"] = bson.M{"$in": []interface{}{nil, ""}}
+	}
+	result, err := collection.UpdateOne(ctx, filter, bson.M{"$set": embeddings.Fields(embedder, vector)})
+	if err != nil {
+		log.Printf("Error storing embedding for product %s: %v", productID.Hex(), err)
+		return
+	}
+	if result.MatchedCount > 0 {
+		indexListingVector("products", productID, vector, listingMeta{
+			owner:      product.UserID,
+			university: product.University,
+			reach:      product.Availability,
+		})
+	}
+}
+
+// SemanticProductMatch is a product returned by semantic search.
+type SemanticProductMatch struct {
+	models.Product
+	Similarity float64 `json:"similarity"`
+}
+
+// SemanticSearchProductsHandler ranks the products the caller can see by how close
+// their meaning is to a free-text query.
+// Endpoint: POST /products/semantic-search
+func SemanticSearchProductsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		WriteJSONError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value(userIDKey).(string)
+	if !ok || userID == "" {
+		WriteJSONError(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		WriteJSONError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	university, ok := r.Context().Value(userInstitution).(string)
+	if !ok || university == "" {
+		WriteJSONError(w, "User university information missing", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Query string `json:"query"`
+		Mode  string `json:"mode"` // "outofcampus" to include other campuses
+		Limit int    `json:"limit"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteJSONError(w, "Invalid input format", http.StatusBadRequest)
+		return
+	}
+	query := strings.TrimSpace(req.Query)
+	if query == "" {
+		WriteJSONError(w, "Query is required", http.StatusBadRequest)
+		return
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultSemanticResults
+	} else if limit > maxSemanticResults {
+		limit = maxSemanticResults
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	embedder := embeddings.Default()
+	queryEmbedding, err := embedder.Embed(ctx, query)
+	if err != nil {
+		log.Printf("Error generating query embedding: %v", err)
+		WriteJSONError(w, "Error generating query embedding", http.StatusInternalServerError)
+		return
+	}
+
+	filter := productVisibilityFilter(userObjID, university, req.Mode)
+	collection := db.GetCollection("gridlyapp", "products")
+
+	var matches []SemanticProductMatch
+	if index := productVectors.Load(); index != nil {
+		visible := productCampusVisible(userObjID, university, req.Mode)
+		matches, err = indexedProductMatches(ctx, index, collection, queryEmbedding, visible, filter, limit, embedder.MinSimilarity())
+	} else {
+		filter = bson.M{"$and": []bson.M{filter, embeddings.CurrentFilter(embedder)}}
+		matches, err = scanProductMatches(ctx, collection, queryEmbedding, filter, limit, embedder.MinSimilarity())
+	}
+	if err != nil {
+		log.Printf("Error searching products: %v", err)
+		WriteJSONError(w, "Error fetching products", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, matches, http.StatusOK)
+}
+
+// indexedProductMatches finds the best matches with the product vector index.
+func indexedProductMatches(ctx context.Context, index *listingIndex, collection *mongo.Collection, query []float32,
+	visible func(listingMeta) bool, filter bson.M, limit int, minScore float64) ([]SemanticProductMatch, error) {
+
+	results, err := searchListingVectors(ctx, index, collection, query, visible, filter, limit, minScore)
+	if err != nil {
+		return nil, err
+	}
+	matches := []SemanticProductMatch{}
+	if len(results) == 0 {
+		return matches, nil
+	}
+
+	ids := make([]primitive.ObjectID, len(results))
+	for i, r := range results {
+		ids[i] = r.ID
+	}
+	cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}}, options.Find().SetProjection(bson.M{"embeddings": 0}))
+	if err != nil {
+		return nil, err
+	}
+	var products []models.Product
+	if err := cursor.All(ctx, &products); err != nil {
+		return nil, err
+	}
+	byID := make(map[primitive.ObjectID]models.Product, len(products))
+	for _, p := range products {
+		byID[p.ID] = p
+	}
+
+	for _, r := range results {
+		if product, ok := byID[r.ID]; ok {
+			matches = append(matches, SemanticProductMatch{Product: product, Similarity: r.Score})
+		}
+	}
+	return matches, nil
+}
+
+// scanProductMatches finds the best matches by comparing the query with every
+// visible product. It is used until the vector index is built.
+func scanProductMatches(ctx context.Context, collection *mongo.Collection, query []float32,
+	filter bson.M, limit int, minScore float64) ([]SemanticProductMatch, error) {
+
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	matches := []SemanticProductMatch{}
+	for cursor.Next(ctx) {
+		var product models.Product
+		if err := cursor.Decode(&product); err != nil {
+			log.Printf("Error decoding product: %v", err)
+			continue
+		}
+		similarity := computeCosineSimilarity(query, product.Embeddings)
+		if similarity >= minScore {
+			matches = append(matches, SemanticProductMatch{Product: product, Similarity: similarity})
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Similarity > matches[j].Similarity
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
@@ -67,6 +67,11 @@ func AddProductHandler(w http.ResponseWriter, r *http.Request) {
 	product.StudentType = studentType
 	product.PostedDate = time.Now()
 	product.Expired = false
+	expiresAt := product.PostedDate.Add(productListingLifetime())
+	product.ExpiresAt = &expiresAt
+	product.RenewedAt = nil
+	product.RelistedFrom = nil
+	product.RelistedTo = nil
 	product.LikeCount = 0
 
 	// **Initialize Workflow-Related Fields**
@@ -132,6 +137,12 @@ func AddProductHandler(w http.ResponseWriter, r *http.Request) {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
+
+	if err := validateImageRefs(ctx, userObjID, product.Images, nil); err != nil {
+		writeImageRefError(w, err)
+		return
+	}
+
 	collection := db.GetCollection("gridlyapp", "products")
 	result, err := collection.InsertOne(ctx, product)
 	if err != nil {
@@ -140,8 +151,13 @@ func AddProductHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Make the product findable by semantic search
+	if productID, ok := result.InsertedID.(primitive.ObjectID); ok {
+		go refreshProductEmbedding(productID)
+	}
+
 	// ✅ Increment the user's grids count
-	err = IncrementUserGrids(userObjID, studentType)
+	err = IncrementUserGrids(userObjID)
 	if err != nil {
 		log.Printf("Failed to increment grids: %v", err)
 	}
@@ -203,7 +219,7 @@ func GetSingleProductHandler(w http.ResponseWriter, r *http.Request) {
 
 	collection := db.GetCollection("gridlyapp", "products")
 	var product models.Product
-	err = collection.FindOne(ctx, bson.M{"_id": productID}).Decode(&product)
+	err = collection.FindOne(ctx, bson.M{"_id": productID, "ownerDeleted": bson.M{"$ne": true}}).Decode(&product)
 	if err != nil {
 		log.Printf("Error fetching product: %v", err)
 		WriteJSONError(w, "Product not found", http.StatusNotFound)
@@ -211,7 +227,7 @@ func GetSingleProductHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if the product is expired
-	if time.Since(product.PostedDate).Hours() > 90*24 {
+	if !product.Expired && product.Status == "inshop" && !productExpiresAt(product).After(time.Now()) {
 		_, err := collection.UpdateOne(ctx, bson.M{"_id": productID}, bson.M{"$set": bson.M{"expired": true}})
 		if err != nil {
 			log.Printf("Error updating product expiration: %v", err)
@@ -221,6 +237,60 @@ func GetSingleProductHandler(w http.ResponseWriter, r *http.Request) {
 
 	json.NewEncoder(w).Encode(product)
 }
+
+// productVisibilityFilter returns the products a user may see in the shop: available,
+// not expired, not their own or already requested, and either on their campus or,
+// in "outofcampus" mode, from any campus.
+func productVisibilityFilter(userObjID primitive.ObjectID, university, mode string) bson.M {
+	// ✅ Base filter to fetch products that are not expired and available in shop
+	baseFilter := bson.M{
+		"status":       bson.M{"$in": []string{"inshop"}},
+		"expired":      false,               // Exclude expired products
+		"ownerDeleted": bson.M{"$ne": true}, // Exclude products of deleted accounts
+		"requestedBy": bson.M{
+			"$ne": userObjID, // ✅ Exclude products where the user has already requested
+		},
+	}
+
+	if mode == "outofcampus" {
+		return bson.M{
+			"$and": []bson.M{
+				baseFilter,
+				notExpiredFilter(time.Now()),
+				{"userId": bson.M{"$ne": userObjID}},
+				{"availability": bson.M{"$in": []string{"Off Campus Only", "On and Off Campus", "In Campus Only"}}},
+			},
+		}
+	}
+	return bson.M{
+		"$and": []bson.M{
+			baseFilter,
+			notExpiredFilter(time.Now()),
+			{"userId": bson.M{"$ne": userObjID}},
+			{"university": university},
+			{"availability": "In Campus Only"},
+		},
+	}
+}
+
+// productCampusVisible is the campus part of productVisibilityFilter, evaluated on
+// the vector index entries. Keep the two in sync.
+func productCampusVisible(userObjID primitive.ObjectID, university, mode string) func(listingMeta) bool {
+	return func(m listingMeta) bool {
+		if m.owner == userObjID {
+			return false
+		}
+		if mode == "outofcampus" {
+			switch m.reach {
+			case "Off Campus Only", "On and Off Campus", "In Campus Only":
+				return true
+			}
+			return false
+		}
+		return m.university == university && m.reach == "In Campus Only"
+	}
+}
+
 func GetAllProductsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -248,61 +318,32 @@ func GetAllProductsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	page, err := parsePageRequest(r, productSorts, "newest")
+	if err != nil {
+		WriteJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	mode := r.URL.Query().Get("mode")
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	collection := db.GetCollection("gridlyapp", "products")
+	filter := productVisibilityFilter(userObjID, university, mode)
 
-	// ✅ Base filter to fetch products that are not expired and available in shop
-	baseFilter := bson.M{
-		"status":  bson.M{"$in": []string{"inshop"}},
-		"expired": false, // Exclude expired products
-		"requestedBy": bson.M{
-			"$ne": userObjID, // ✅ Exclude products where the user has already requested
-		},
-	}
-
-	var filter bson.M
-	if mode == "outofcampus" {
-		filter = bson.M{
-			"$and": []bson.M{
-				baseFilter,
-				{"userId": bson.M{"$ne": userObjID}},
-				{"availability": bson.M{"$in": []string{"Off Campus Only", "On and Off Campus", "In Campus Only"}}},
-			},
-		}
-	} else {
-		filter = bson.M{
-			"$and": []bson.M{
-				baseFilter,
-				{"userId": bson.M{"$ne": userObjID}},
-				{"university": university},
-				{"availability": "In Campus Only"},
-			},
-		}
-	}
-
-	cursor, err := collection.Find(ctx, filter)
+	var products []models.Product
+	next, err := findPage(ctx, collection, filter, page, &products)
 	if err != nil {
 		log.Println("Error fetching products:", err)
 		WriteJSONError(w, "Error fetching products", http.StatusInternalServerError)
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var products []models.Product
-	if err := cursor.All(ctx, &products); err != nil {
-		log.Println("Error decoding products:", err)
-		WriteJSONError(w, "Error decoding products", http.StatusInternalServerError)
-		return
-	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(products)
+	writeFeed(w, page, products, next)
 }
 
-// GetUserProductsHandler retrieves all products added by the authenticated user.
+// GetUserProductsHandler retrieves all products added by the authenticated user,
+// including sold and expired ones so they can be renewed or relisted.
 func GetUserProductsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -326,7 +367,7 @@ func GetUserProductsHandler(w http.ResponseWriter, r *http.Request) {
 	collection := db.GetCollection("gridlyapp", "products")
 
 	// Find products where UserID matches the authenticated user's ID
-	cursor, err := collection.Find(ctx, bson.M{"userId": userObjID})
+	cursor, err := collection.Find(ctx, bson.M{"userId": userObjID, "ownerDeleted": bson.M{"$ne": true}})
 	if err != nil {
 		log.Printf("Error retrieving products: %v", err)
 		WriteJSONError(w, "Error retrieving products", http.StatusInternalServerError)
@@ -414,6 +455,7 @@ func UpdateProductHandler(w http.ResponseWriter, r *http.Request) {
 		Images                 []string `json:"images,omitempty"`
 		IsAvailableOutOfCampus *bool    `json:"isAvailableOutOfCampus,omitempty"`
 		Availability           string   `json:"availability,omitempty"`
+		Condition              string   `json:"condition,omitempty"`
 	}
 
 	var updatedData ProductUpdate
@@ -507,7 +549,14 @@ func UpdateProductHandler(w http.ResponseWriter, r *http.Request) {
 	if updatedData.SelectedTags != nil {
 		updateFields["selectedTags"] = updatedData.SelectedTags
 	}
+	if updatedData.Condition != "" {
+		updateFields["condition"] = updatedData.Condition
+	}
 	if updatedData.Images != nil {
+		if err := validateImageRefs(ctx, userObjID, updatedData.Images, existingProduct.Images); err != nil {
+			writeImageRefError(w, err)
+			return
+		}
 		updateFields["images"] = updatedData.Images
 	}
 	if updatedData.IsAvailableOutOfCampus != nil {
@@ -547,6 +596,22 @@ func UpdateProductHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The embedding only depends on the fields in embeddings.ProductText
+	_, titleChanged := updateFields["title"]
+	_, descriptionChanged := updateFields["description"]
+	_, tagsChanged := updateFields["selectedTags"]
+	_, conditionChanged := updateFields["condition"]
+	if titleChanged || descriptionChanged || tagsChanged || conditionChanged {
+		go refreshProductEmbedding(productID)
+	}
+	if availability, ok := updateFields["availability"].(string); ok && availability != existingProduct.Availability {
+		updateListingMeta("products", productID, listingMeta{
+			owner:      existingProduct.UserID,
+			university: existingProduct.University,
+			reach:      availability,
+		})
+	}
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message": "Product updated successfully",
@@ -667,6 +732,11 @@ func AddMultipleProductsHandler(w http.ResponseWriter, r *http.Request) {
 		p.StudentType = studentType
 		p.PostedDate = time.Now()
 		p.Expired = false
+		expiresAt := p.PostedDate.Add(productListingLifetime())
+		p.ExpiresAt = &expiresAt
+		p.RenewedAt = nil
+		p.RelistedFrom = nil
+		p.RelistedTo = nil
 		p.Status = "inshop" // Set default status to "inshop"
 		p.ChatCount = 0     // Initialize chatCount to 0
 		p.LikeCount = 0     // Initialize LikeCount to 0
@@ -730,6 +800,15 @@ func AddMultipleProductsHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	var images []string
+	for _, p := range products {
+		images = append(images, p.Images...)
+	}
+	if err := validateImageRefs(ctx, userObjID, images, nil); err != nil {
+		writeImageRefError(w, err)
+		return
+	}
+
 	collection := db.GetCollection("gridlyapp", "products")
 	result, err := collection.InsertMany(ctx, insertDocs)
 	if err != nil {
@@ -738,6 +817,12 @@ func AddMultipleProductsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	for _, id := range result.InsertedIDs {
+		if productID, ok := id.(primitive.ObjectID); ok {
+			go refreshProductEmbedding(productID)
+		}
+	}
+
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"message":  "Products added successfully",
@@ -801,39 +886,51 @@ func DeleteProductHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Proceed to delete the product
-	deleteResult, err := collection.DeleteOne(ctx, bson.M{"_id": productID})
+	deleted, err := removeProduct(ctx, &existingProduct)
 	if err != nil {
 		log.Printf("Error deleting product: %v", err)
 		WriteJSONError(w, "Error deleting product", http.StatusInternalServerError)
 		return
 	}
-
-	if deleteResult.DeletedCount == 0 {
+	if !deleted {
 		WriteJSONError(w, "Product not found or already deleted", http.StatusNotFound)
 		return
 	}
 
-	// Optionally, remove the product from all users' likedProducts arrays
-	// to maintain consistency. This can be done using an UpdateMany operation.
+	// Respond with a success message
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Product deleted successfully",
+		"deleted": 1,
+	})
+}
+
+// removeProduct deletes a product along with its search vectors, unused images and
+// likes. It reports false when the product was already gone.
+func removeProduct(ctx context.Context, product *models.Product) (bool, error) {
+	collection := db.GetCollection("gridlyapp", "products")
 
-	userCollection := db.GetCollection("gridlyapp", "users")
-	_, err = userCollection.UpdateMany(
+	deleteResult, err := collection.DeleteOne(ctx, bson.M{"_id": product.ID})
+	if err != nil {
+		return false, err
+	}
+	if deleteResult.DeletedCount == 0 {
+		return false, nil
+	}
+	removeListingVectors("products", product.ID)
+	releaseImages(ctx, product.UserID, product.Images)
+
+	// Remove the product from all users' likedProducts arrays to maintain consistency.
+	_, err = db.Users.UpdateMany(
 		ctx,
-		bson.M{"likedProducts": productID},
-		bson.M{"$pull": bson.M{"likedProducts": productID}},
+		bson.M{"likedProducts": product.ID},
+		bson.M{"$pull": bson.M{"likedProducts": product.ID}},
 	)
 	if err != nil {
 		log.Printf("Error removing product from users' likedProducts: %v", err)
 		// Not critical, so you might choose not to return an error
 	}
-
-	// Respond with a success message
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"message": "Product deleted successfully",
-		"deleted": deleteResult.DeletedCount,
-	})
+	return true, nil
 }
 
 // ConfirmTransferHandler marks a product as "sold"
@@ -934,26 +1031,9 @@ func LikeProductHandler(w http.ResponseWriter, r *http.Request) {
 	defer session.EndSession(ctx)
 
 	callback := func(sc mongo.SessionContext) (interface{}, error) {
-		collections := []string{"university_users", "highschool_users"}
-		var user models.User
-		var userCollection *mongo.Collection
-		var foundUser bool
-
-		for _, col := range collections {
-			tempCollection := db.GetCollection("gridlyapp", col)
-			err := tempCollection.FindOne(sc, bson.M{"_id": userObjID}).Decode(&user)
-			if err == nil {
-				foundUser = true
-				userCollection = tempCollection
-				break
-			}
-			if err != mongo.ErrNoDocuments {
-				return nil, fmt.Errorf("error fetching user from %s: %v", col, err)
-			}
-		}
-
-		if !foundUser {
-			return nil, fmt.Errorf("user not found in any collection")
+		user, err := db.Users.GetByID(sc, userObjID)
+		if err != nil {
+			return nil, err
 		}
 
 		for _, pid := range user.LikedProducts {
@@ -967,7 +1047,7 @@ func LikeProductHandler(w http.ResponseWriter, r *http.Request) {
 				"likedProducts": productObjID,
 			},
 		}
-		_, err := userCollection.UpdateOne(sc, bson.M{"_id": userObjID}, updateUser)
+		err = db.Users.Update(sc, userObjID, updateUser)
 		if err != nil {
 			return nil, fmt.Errorf("error adding product to likedProducts: %v", err)
 		}
@@ -1062,26 +1142,9 @@ func UnlikeProductHandler(w http.ResponseWriter, r *http.Request) {
 	defer session.EndSession(ctx)
 
 	callback := func(sc mongo.SessionContext) (interface{}, error) {
-		collections := []string{"university_users", "highschool_users"}
-		var user models.User
-		var userCollection *mongo.Collection
-		var foundUser bool
-
-		for _, col := range collections {
-			tempCollection := db.GetCollection("gridlyapp", col)
-			err := tempCollection.FindOne(sc, bson.M{"_id": userObjID}).Decode(&user)
-			if err == nil {
-				foundUser = true
-				userCollection = tempCollection
-				break
-			}
-			if err != mongo.ErrNoDocuments {
-				return nil, fmt.Errorf("error fetching user from %s: %v", col, err)
-			}
-		}
-
-		if !foundUser {
-			return nil, fmt.Errorf("user not found in any collection")
+		user, err := db.Users.GetByID(sc, userObjID)
+		if err != nil {
+			return nil, err
 		}
 		// Check if the product is actually liked
 		found := false
@@ -1101,7 +1164,7 @@ func UnlikeProductHandler(w http.ResponseWriter, r *http.Request) {
 				"likedProducts": productObjID,
 			},
 		}
-		_, err = userCollection.UpdateOne(sc, bson.M{"_id": userObjID}, updateUser)
+		err = db.Users.Update(sc, userObjID, updateUser)
 		if err != nil {
 			return nil, fmt.Errorf("error removing product from likedProducts: %v", err)
 		}
@@ -1176,33 +1239,25 @@ func GetLikedProductsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	page, err := parsePageRequest(r, productSorts, "newest")
+	if err != nil {
+		WriteJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// Fetch user document
-	collections := []string{"university_users", "highschool_users"}
-	var user models.User
-	var found bool
-
-	for _, col := range collections {
-		collection := db.GetCollection("gridlyapp", col)
-		err := collection.FindOne(ctx, bson.M{"_id": userObjID}).Decode(&user)
-		if err == nil {
-			found = true
-			log.Printf("User found in collection: %s", col)
-			break
-		}
-		if err != mongo.ErrNoDocuments {
-			log.Printf("Error fetching user from %s: %v", col, err)
-			WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
-	}
-
-	if !found {
-		log.Printf("User not found in any collection")
+	user, err := db.Users.GetByID(ctx, userObjID)
+	if err == db.ErrUserNotFound {
+		log.Printf("User %s not found", userId)
 		WriteJSONError(w, "User not found", http.StatusNotFound)
 		return
+	} else if err != nil {
+		log.Printf("Error fetching user: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
 
 	// Log the LikedProducts
@@ -1210,8 +1265,7 @@ func GetLikedProductsHandler(w http.ResponseWriter, r *http.Request) {
 
 	if len(user.LikedProducts) == 0 {
 		log.Println("No liked products to fetch.")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode([]models.Product{})
+		writeFeed(w, page, []models.Product{}, "")
 		return
 	}
 
@@ -1236,30 +1290,18 @@ func GetLikedProductsHandler(w http.ResponseWriter, r *http.Request) {
 	productCollection := db.GetCollection("gridlyapp", "products")
 	filter := bson.M{"_id": bson.M{"$in": validLikedProducts}}
 
-	cursor, err := productCollection.Find(ctx, filter)
+	var likedProducts []models.Product
+	next, err := findPage(ctx, productCollection, filter, page, &likedProducts)
 	if err != nil {
 		log.Printf("Error fetching liked products: %v", err)
 		WriteJSONError(w, "Failed to fetch liked products", http.StatusInternalServerError)
 		return
 	}
-	defer cursor.Close(ctx)
-
-	var likedProducts []models.Product
-	if err := cursor.All(ctx, &likedProducts); err != nil {
-		log.Printf("Error decoding liked products: %v", err)
-		WriteJSONError(w, "Failed to decode liked products", http.StatusInternalServerError)
-		return
-	}
 
 	log.Printf("Retrieved Liked Products: %+v", likedProducts)
 
 	// Respond with liked products
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(likedProducts); err != nil {
-		log.Printf("Error encoding liked products to JSON: %v", err)
-		WriteJSONError(w, "Error encoding response", http.StatusInternalServerError)
-		return
-	}
+	writeFeed(w, page, likedProducts, next)
 }
 
 // GetProductsByUserIDHandler retrieves all products posted by a specific user,
@@ -1290,7 +1332,7 @@ func GetProductsByUserIDHandler(w http.ResponseWriter, r *http.Request) {
 	collection := db.GetCollection("gridlyapp", "products")
 
 	// Find all products where the userId field matches the provided user ID
-	cursor, err := collection.Find(ctx, bson.M{"userId": userObjID})
+	cursor, err := collection.Find(ctx, bson.M{"userId": userObjID, "ownerDeleted": bson.M{"$ne": true}})
 	if err != nil {
 		log.Printf("Error retrieving products: %v", err)
 		WriteJSONError(w, "Error retrieving products", http.StatusInternalServerError)
@@ -0,0 +1,332 @@
+// handlers/productLifecycle.go
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"Thegridproduct/backend/db"
+	"Thegridproduct/backend/models"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// defaultProductListingDays is used when PRODUCT_LISTING_DAYS is not set.
+	defaultProductListingDays = 90
+
+	// defaultProductExpiryReminderDays is used when PRODUCT_EXPIRY_REMINDER_DAYS is not set.
+	defaultProductExpiryReminderDays = 3
+)
+
+// productListingLifetime returns how long a product stays in the shop after it is
+// posted, renewed or relisted.
+func productListingLifetime() time.Duration {
+	return envDays("PRODUCT_LISTING_DAYS", defaultProductListingDays)
+}
+
+// productExpiryReminderLead returns how long before expiry the owner is reminded
+// to renew a listing.
+func productExpiryReminderLead() time.Duration {
+	return envDays("PRODUCT_EXPIRY_REMINDER_DAYS", defaultProductExpiryReminderDays)
+}
+
+// envDays reads a non-negative number of days from the environment.
+func envDays(name string, fallback int) time.Duration {
+	days := fallback
+	if v := os.Getenv(name); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			days = n
+		} else {
+			log.Printf("Invalid %s %q, using %d", name, v, fallback)
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// productExpiresAt returns when a product's listing ends. Products posted before
+// listings had an expiry date last a lifetime from their posted date.
+func productExpiresAt(product models.Product) time.Time {
+	if product.ExpiresAt != nil {
+		return *product.ExpiresAt
+	}
+	return product.PostedDate.Add(productListingLifetime())
+}
+
+// notExpiredFilter matches products whose listing has not ended yet. The expired
+// flag is only set by the expire-products job, so feeds check the date as well.
+func notExpiredFilter(now time.Time) bson.M {
+	return bson.M{"$or": []bson.M{
+		{"expiresAt": bson.M{"$gt": now}},
+		{"expiresAt": bson.M{"$exists": false}},
+	}}
+}
+
+// ExpireProducts marks products whose listing ended as expired and returns how many
+// it marked. Products posted before listings had an expiry date get one first.
+func ExpireProducts(ctx context.Context) (int, error) {
+	collection := db.GetCollection("gridlyapp", "products")
+	lifetimeMs := productListingLifetime().Milliseconds()
+	if _, err := collection.UpdateMany(ctx,
+		bson.M{"expiresAt": bson.M{"$exists": false}, "postedDate": bson.M{"$type": "date"}},
+		[]bson.M{{"$set": bson.M{"expiresAt": bson.M{"$add": []interface{}{"$postedDate", lifetimeMs}}}}},
+	); err != nil {
+		return 0, fmt.Errorf("error setting expiry dates of products: %v", err)
+	}
+
+	return expireListings(ctx, "products", bson.M{"status": "inshop", "expiresAt": bson.M{"$lte": time.Now()}})
+}
+
+// RemindExpiringProducts sends owners a push notification about listings that
+// expire within the reminder lead, once per listing lifetime, and returns how many
+// reminders it sent.
+func RemindExpiringProducts(ctx context.Context) (int, error) {
+	collection := db.GetCollection("gridlyapp", "products")
+	now := time.Now()
+
+	cursor, err := collection.Find(ctx, bson.M{
+		"status":               "inshop",
+		"expired":              false,
+		"ownerDeleted":         bson.M{"$ne": true},
+		"expiresAt":            bson.M{"$gt": now, "$lte": now.Add(productExpiryReminderLead())},
+		"expiryReminderSentAt": bson.M{"$exists": false},
+	}, options.Find().SetProjection(bson.M{"userId": 1, "title": 1, "expiresAt": 1}))
+	if err != nil {
+		return 0, fmt.Errorf("error finding expiring products: %v", err)
+	}
+	var products []models.Product
+	if err := cursor.All(ctx, &products); err != nil {
+		return 0, fmt.Errorf("error decoding expiring products: %v", err)
+	}
+
+	sent := 0
+	for _, product := range products {
+		owner, err := db.Users.GetByID(ctx, product.UserID)
+		if err != nil {
+			// Left unmarked so the next run tries again.
+			log.Printf("Error fetching owner of expiring product %s: %v", product.ID.Hex(), err)
+			continue
+		}
+		if owner.ExpoPushToken != "" {
+			body := fmt.Sprintf("%q leaves the shop on %s. Renew it to keep it listed.", product.Title, product.ExpiresAt.Format("Jan 2"))
+			data := map[string]string{
+				"type":      "product_expiring",
+				"productId": product.ID.Hex(),
+			}
+			if err := SendPushNotification(owner.ExpoPushToken, "Your listing is about to expire", body, data); err != nil {
+				log.Printf("Error sending expiry reminder for product %s: %v", product.ID.Hex(), err)
+				continue
+			}
+			sent++
+		}
+
+		// Owners without a push token are marked too, as there is nothing to retry.
+		if _, err := collection.UpdateOne(ctx,
+			bson.M{"_id": product.ID, "expiryReminderSentAt": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"expiryReminderSentAt": now}},
+		); err != nil {
+			return sent, fmt.Errorf("error marking reminder for product %s: %v", product.ID.Hex(), err)
+		}
+	}
+	return sent, nil
+}
+
+// ownedProduct loads the product in the URL and checks that the caller owns it. It
+// writes the error response and returns nil when it does not.
+func ownedProduct(ctx context.Context, w http.ResponseWriter, r *http.Request) *models.Product {
+	userId, ok := r.Context().Value(userIDKey).(string)
+	if !ok || userId == "" {
+		WriteJSONError(w, "User not authenticated", http.StatusUnauthorized)
+		return nil
+	}
+	userObjID, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		WriteJSONError(w, "Invalid user ID", http.StatusBadRequest)
+		return nil
+	}
+	productID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		WriteJSONError(w, "Invalid product ID format", http.StatusBadRequest)
+		return nil
+	}
+
+	var product models.Product
+	err = db.GetCollection("gridlyapp", "products").FindOne(ctx, bson.M{"_id": productID}).Decode(&product)
+	if err == mongo.ErrNoDocuments {
+		WriteJSONError(w, "Product not found", http.StatusNotFound)
+		return nil
+	} else if err != nil {
+		log.Printf("Error fetching product: %v", err)
+		WriteJSONError(w, "Error fetching product data", http.StatusInternalServerError)
+		return nil
+	}
+	if product.UserID != userObjID {
+		WriteJSONError(w, "Unauthorized to modify this product", http.StatusUnauthorized)
+		return nil
+	}
+	return &product
+}
+
+// RenewProductHandler extends the listing of one of the caller's products by a
+// full lifetime from now, bringing it back to the shop if it had expired.
+// Endpoint: POST /products/{id}/renew
+func RenewProductHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		WriteJSONError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	product := ownedProduct(ctx, w, r)
+	if product == nil {
+		return
+	}
+	if product.RelistedTo != nil {
+		WriteJSONError(w, "This product was relisted; renew the new listing instead", http.StatusConflict)
+		return
+	}
+	if product.Status != "inshop" {
+		WriteJSONError(w, "Only products in the shop can be renewed; relist sold products instead", http.StatusConflict)
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(productListingLifetime())
+	res, err := db.GetCollection("gridlyapp", "products").UpdateOne(ctx,
+		bson.M{"_id": product.ID, "status": "inshop", "relistedTo": bson.M{"$exists": false}},
+		bson.M{
+			"$set":   bson.M{"expiresAt": expiresAt, "expired": false, "renewedAt": now},
+			"$unset": bson.M{"expiryReminderSentAt": ""},
+		},
+	)
+	if err != nil {
+		log.Printf("Error renewing product: %v", err)
+		WriteJSONError(w, "Error renewing product", http.StatusInternalServerError)
+		return
+	}
+	if res.MatchedCount == 0 {
+		// Relisted or sold since it was loaded
+		WriteJSONError(w, "Only products in the shop can be renewed; relist sold products instead", http.StatusConflict)
+		return
+	}
+
+	// Expired products were dropped from the search index.
+	if product.Expired {
+		go refreshProductEmbedding(product.ID)
+	}
+
+	WriteJSON(w, map[string]interface{}{
+		"message":   "Product renewed successfully",
+		"expiresAt": expiresAt,
+	}, http.StatusOK)
+}
+
+// RelistProductHandler puts a sold or expired product of the caller back in the
+// shop as a new listing. The original stays as history but points to the new
+// listing; an expired original also leaves the shop with status "relisted", so it
+// can no longer be renewed. Each product can be relisted once.
+// Endpoint: POST /products/{id}/relist
+func RelistProductHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		WriteJSONError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	original := ownedProduct(ctx, w, r)
+	if original == nil {
+		return
+	}
+	now := time.Now()
+	expired := original.Expired || !productExpiresAt(*original).After(now)
+	if original.RelistedTo != nil {
+		WriteJSONError(w, "This product was already relisted", http.StatusConflict)
+		return
+	}
+	if original.Status != "sold" && !expired {
+		WriteJSONError(w, "Only sold or expired products can be relisted", http.StatusConflict)
+		return
+	}
+
+	expiresAt := now.Add(productListingLifetime())
+	product := *original
+	product.ID = primitive.NewObjectID()
+	product.BuyerID = nil
+	product.PostedDate = now
+	product.Expired = false
+	product.ExpiresAt = &expiresAt
+	product.ExpiryReminderSentAt = nil
+	product.RenewedAt = nil
+	product.RelistedFrom = &original.ID
+	product.RelistedTo = nil
+	product.Status = "inshop"
+	product.LikeCount = 0
+	product.ChatCount = 0
+	product.RequestedBy = nil
+	product.Embeddings = nil
+	product.EmbeddingModel = ""
+	product.EmbeddingDimensions = 0
+
+	// Retire the original first, so two concurrent relists cannot both succeed.
+	retire := bson.M{"relistedTo": product.ID}
+	if original.Status != "sold" {
+		retire["status"] = "relisted"
+	}
+	collection := db.GetCollection("gridlyapp", "products")
+	res, err := collection.UpdateOne(ctx,
+		bson.M{"_id": original.ID, "status": original.Status, "relistedTo": bson.M{"$exists": false}},
+		bson.M{"$set": retire},
+	)
+	if err != nil {
+		log.Printf("Error retiring relisted product %s: %v", original.ID.Hex(), err)
+		WriteJSONError(w, "Error relisting product", http.StatusInternalServerError)
+		return
+	}
+	if res.MatchedCount == 0 {
+		WriteJSONError(w, "This product was already relisted or changed; reload it and try again", http.StatusConflict)
+		return
+	}
+
+	if _, err := collection.InsertOne(ctx, product); err != nil {
+		log.Printf("Error relisting product: %v", err)
+		if _, err := collection.UpdateOne(ctx,
+			bson.M{"_id": original.ID, "relistedTo": product.ID},
+			bson.M{"$set": bson.M{"status": original.Status}, "$unset": bson.M{"relistedTo": ""}},
+		); err != nil {
+			log.Printf("Error restoring product %s after failed relist: %v", original.ID.Hex(), err)
+		}
+		WriteJSONError(w, "Error relisting product", http.StatusInternalServerError)
+		return
+	}
+	removeListingVectors("products", original.ID)
+	go refreshProductEmbedding(product.ID)
+
+	// A relisted product counts as a new grid, like a newly posted one.
+	if err := IncrementUserGrids(product.UserID); err != nil {
+		log.Printf("Failed to increment grids: %v", err)
+	}
+
+	WriteJSON(w, map[string]interface{}{
+		"message": "Product relisted successfully",
+		"id":      product.ID,
+		"product": product,
+	}, http.StatusCreated)
+}
@@ -0,0 +1,238 @@
+// handlers/productSearch.go
+
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"Thegridproduct/backend/db"
+	"Thegridproduct/backend/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FacetCount is the number of matching products for one facet value.
+type FacetCount struct {
+	Value string `json:"value" bson:"_id"`
+	Count int    `json:"count" bson:"count"`
+}
+
+// ProductSearchResponse is the result of a product search.
+type ProductSearchResponse struct {
+	Items  []models.Product        `json:"items"`
+	Total  int                     `json:"total"`
+	Limit  int                     `json:"limit"`
+	Offset int                     `json:"offset"`
+	Facets map[string][]FacetCount `json:"facets"`
+}
+
+// SearchProductsHandler searches the products the caller can see in the shop.
+// Query parameters:
+//
+//	q             text matched against title, description and tags
+//	minPrice      lowest price, inclusive
+//	maxPrice      highest price, inclusive
+//	listingType   e.g. "Selling" or "Renting"
+//	condition     product condition
+//	tags          comma separated; products must have all of them
+//	availability  e.g. "In Campus Only"
+//	university    only in "outofcampus" mode, since campus mode is limited to the caller's
+//	mode          "outofcampus" to include other campuses, like /products/all
+//	sort          relevance (default with q), newest, price_asc, price_desc or most_liked
+//	limit, offset paging
+//
+// The response carries facet counts per tag and per condition over every match.
+// Endpoint: GET /products/search
+func SearchProductsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodGet {
+		WriteJSONError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userId, ok := r.Context().Value(userIDKey).(string)
+	if !ok || userId == "" {
+		WriteJSONError(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+	university, ok := r.Context().Value(userInstitution).(string)
+	if !ok || university == "" {
+		WriteJSONError(w, "User university information missing", http.StatusUnauthorized)
+		return
+	}
+	userObjID, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		WriteJSONError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query()
+	text := strings.TrimSpace(q.Get("q"))
+
+	// Campus visibility comes first; the search filters can only narrow it down.
+	conditions := []bson.M{productVisibilityFilter(userObjID, university, q.Get("mode"))}
+
+	price := bson.M{}
+	for param, op := range map[string]string{"minPrice": "$gte", "maxPrice": "$lte"} {
+		if v := q.Get(param); v != "" {
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil || n < 0 {
+				WriteJSONError(w, param+" must be a non-negative number", http.StatusBadRequest)
+				return
+			}
+			price[op] = n
+		}
+	}
+	if len(price) > 0 {
+		conditions = append(conditions, bson.M{"price": price})
+	}
+
+	for param, field := range map[string]string{
+		"listingType":  "listingType",
+		"condition":    "condition",
+		"availability": "availability",
+		"university":   "university",
+	} {
+		if v := strings.TrimSpace(q.Get(param)); v != "" {
+			conditions = append(conditions, bson.M{field: v})
+		}
+	}
+
+	if v := q.Get("tags"); v != "" {
+		var tags []string
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+		if len(tags) > 0 {
+			conditions = append(conditions, bson.M{"selectedTags": bson.M{"$all": tags}})
+		}
+	}
+
+	limit, offset := defaultPageSize, 0
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			WriteJSONError(w, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		if n > maxPageSize {
+			n = maxPageSize
+		}
+		limit = n
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			WriteJSONError(w, "offset must be a non-negative number", http.StatusBadRequest)
+			return
+		}
+		offset = n
+	}
+
+	match := bson.M{"$and": conditions}
+	var sort bson.D
+	sortName := q.Get("sort")
+	if text != "" {
+		// $text has to be part of the first stage of the pipeline.
+		match["$text"] = bson.M{"$search": text}
+		if sortName == "" || sortName == "relevance" {
+			sort = bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}, {Key: "_id", Value: -1}}
+		}
+	} else if sortName == "relevance" {
+		sortName = ""
+	}
+	if sort == nil {
+		if sortName == "" {
+			sortName = "newest"
+		}
+		spec, ok := productSorts[sortName]
+		if !ok {
+			WriteJSONError(w, "unsupported sort \""+sortName+"\"", http.StatusBadRequest)
+			return
+		}
+		sort = bson.D{{Key: spec.field, Value: spec.direction}, {Key: "_id", Value: spec.direction}}
+	}
+
+	pipeline := []bson.M{
+		{"$match": match},
+		{"$facet": bson.M{
+			"items": []bson.M{
+				{"$sort": sort},
+				{"$skip": offset},
+				{"$limit": limit},
+				{"$project": bson.M{"embeddings": 0}},
+			},
+			"total": []bson.M{
+				{"$count": "count"},
+			},
+			"tags": []bson.M{
+				{"$unwind": "$selectedTags"},
+				{"$group": bson.M{"_id": "$selectedTags", "count": bson.M{"$sum": 1}}},
+				{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+			},
+			"conditions": []bson.M{
+				{"$match": bson.M{"condition": bson.M{"$nin": []interface{}{nil, ""}}}},
+				{"$group": bson.M{"_id": "$condition", "count": bson.M{"$sum": 1}}},
+				{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+			},
+		}},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cursor, err := db.GetCollection("gridlyapp", "products").Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Printf("Error searching products: %v", err)
+		WriteJSONError(w, "Error searching products", http.StatusInternalServerError)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Items []models.Product `bson:"items"`
+		Total []struct {
+			Count int `bson:"count"`
+		} `bson:"total"`
+		Tags       []FacetCount `bson:"tags"`
+		Conditions []FacetCount `bson:"conditions"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		log.Printf("Error decoding product search results: %v", err)
+		WriteJSONError(w, "Error searching products", http.StatusInternalServerError)
+		return
+	}
+
+	response := ProductSearchResponse{
+		Items:  []models.Product{},
+		Limit:  limit,
+		Offset: offset,
+		Facets: map[string][]FacetCount{"tags": {}, "conditions": {}},
+	}
+	if len(results) > 0 {
+		res := results[0]
+		if res.Items != nil {
+			response.Items = res.Items
+		}
+		if len(res.Total) > 0 {
+			response.Total = res.Total[0].Count
+		}
+		if res.Tags != nil {
+			response.Facets["tags"] = res.Tags
+		}
+		if res.Conditions != nil {
+			response.Facets["conditions"] = res.Conditions
+		}
+	}
+
+	WriteJSON(w, response, http.StatusOK)
+}
@@ -0,0 +1,213 @@
+// handlers/realtime.go
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"Thegridproduct/backend/db"
+	"Thegridproduct/backend/realtime"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// realtimeKeepAlive is how often idle streams are pinged, so proxies keep them
+	// open and both ends notice a dead connection.
+	realtimeKeepAlive = 30 * time.Second
+
+	// realtimeSessionCheck is how often a stream checks that the session it was
+	// opened with has not been revoked.
+	realtimeSessionCheck = time.Minute
+
+	// realtimeWriteTimeout bounds each write to an event stream. Streams are exempt
+	// from the server's WriteTimeout, which would end them, so they set their own
+	// deadline per write instead.
+	realtimeWriteTimeout = 10 * time.Second
+)
+
+var (
+	errSessionEnded = errors.New("session ended")
+	errStreamClosed = errors.New("event stream closed")
+)
+
+// chatRequestOutcome is the payload of the accepted and rejected chat request events.
+type chatRequestOutcome struct {
+	RequestID     string `json:"requestId"`
+	ChatID        string `json:"chatId,omitempty"`
+	ReferenceID   string `json:"referenceId"`
+	ReferenceType string `json:"referenceType"`
+	Status        string `json:"status"`
+}
+
+// RealtimeWebSocketHandler streams the caller's realtime events over a WebSocket,
+// one JSON text message {"type": ..., "data": ...} per event: new messages in the
+// caller's chats, chat requests and their outcome. The stream only carries what
+// happens while it is open, so after connecting clients fetch what they missed,
+// e.g. with the since parameter of GET /chats/{chatId}/messages.
+// Endpoint: GET /realtime/ws
+func RealtimeWebSocketHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value(userIDKey).(string)
+	sessionID, _ := r.Context().Value(sessionIDKey).(string)
+	if userID == "" {
+		WriteJSONError(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	// The hijacked connection outlives the request context, so the stream gets
+	// its own.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := realtime.Default().Subscribe(ctx, realtime.UserTopic(userID))
+	if err != nil {
+		log.Printf("Error subscribing to realtime events: %v", err)
+		WriteJSONError(w, "Realtime updates are unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	conn, err := realtime.Upgrade(w, r)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+
+	// Reading is how a closed connection is noticed.
+	go func() {
+		defer cancel()
+		if err := conn.ReadLoop(2 * realtimeKeepAlive); err != nil && err != io.EOF && !errors.Is(err, net.ErrClosed) {
+			log.Printf("WebSocket read error for user %s: %v", userID, err)
+		}
+	}()
+
+	err = streamEvents(ctx, sessionID, events, func(event realtime.Event) error {
+		return conn.WriteJSON(event)
+	}, conn.Ping)
+	switch err {
+	case errSessionEnded:
+		conn.Close(realtime.ClosePolicy, "session ended")
+	case errStreamClosed:
+		conn.Close(realtime.CloseGoingAway, "reconnect")
+	default:
+		conn.Close(realtime.CloseNormal, "")
+	}
+}
+
+// RealtimeEventsHandler is the server-sent events fallback of the WebSocket
+// stream, for clients that cannot open WebSockets. Every event is sent as a data
+// line holding the same JSON as the WebSocket messages.
+// Endpoint: GET /realtime/events
+func RealtimeEventsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := r.Context().Value(userIDKey).(string)
+	sessionID, _ := r.Context().Value(sessionIDKey).(string)
+	if userID == "" {
+		WriteJSONError(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	// The WebSocket connection sets its own deadlines once hijacked; this stream
+	// moves the server's write deadline forward before every write.
+	rc := http.NewResponseController(w)
+	write := func(format string, args ...interface{}) error {
+		if err := rc.SetWriteDeadline(time.Now().Add(realtimeWriteTimeout)); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	ctx := r.Context()
+	events, err := realtime.Default().Subscribe(ctx, realtime.UserTopic(userID))
+	if err != nil {
+		log.Printf("Error subscribing to realtime events: %v", err)
+		WriteJSONError(w, "Realtime updates are unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // keep nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+	if err := write("retry: 5000\n\n"); err != nil {
+		log.Printf("Error starting event stream of user %s: %v", userID, err)
+		return
+	}
+
+	err = streamEvents(ctx, sessionID, events, func(event realtime.Event) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		return write("data: %s\n\n", data)
+	}, func() error {
+		return write(": ping\n\n")
+	})
+	if err == errSessionEnded {
+		log.Printf("Closed event stream of user %s: session ended", userID)
+	}
+}
+
+// streamEvents passes events to send until ctx is done, the subscription ends or
+// sending fails. keepAlive is called on idle streams, and the stream ends with
+// errSessionEnded once the session is revoked.
+func streamEvents(ctx context.Context, sessionID string, events <-chan realtime.Event, send func(realtime.Event) error, keepAlive func() error) error {
+	keepAliveTicker := time.NewTicker(realtimeKeepAlive)
+	defer keepAliveTicker.Stop()
+	sessionTicker := time.NewTicker(realtimeSessionCheck)
+	defer sessionTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-events:
+			if !ok {
+				return errStreamClosed
+			}
+			if err := send(event); err != nil {
+				return err
+			}
+		case <-keepAliveTicker.C:
+			if err := keepAlive(); err != nil {
+				return err
+			}
+		case <-sessionTicker.C:
+			checkCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			active, err := db.IsSessionActive(checkCtx, sessionID)
+			cancel()
+			if err != nil {
+				log.Printf("Error checking session %s: %v", sessionID, err)
+			} else if !active {
+				return errSessionEnded
+			}
+		}
+	}
+}
+
+// publishEvent sends an event to the realtime streams of users. Delivery is best
+// effort: clients catch up on anything they missed through the REST endpoints.
+func publishEvent(eventType string, data interface{}, userIDs ...primitive.ObjectID) {
+	event, err := realtime.NewEvent(eventType, data)
+	if err != nil {
+		log.Printf("Error creating realtime event: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, id := range userIDs {
+		if err := realtime.Default().Publish(ctx, realtime.UserTopic(id.Hex()), event); err != nil {
+			log.Printf("Error publishing %s event to user %s: %v", eventType, id.Hex(), err)
+		}
+	}
+}
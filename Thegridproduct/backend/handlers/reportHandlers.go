@@ -4,14 +4,12 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
-	"net/smtp"
-	"os"
 	"time"
 
 	"Thegridproduct/backend/db"
+	"Thegridproduct/backend/mailer"
 	"Thegridproduct/backend/models"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -67,40 +65,18 @@ func GeneralReportHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create the email body
-	emailBody := fmt.Sprintf(`User Request:
-
-Request Type: %s
-Category: %s
-Description: %s
-
-User Details:
-    Name: %s %s
-    Email: %s
-    UserID: %s
-`, reportReq.Type, reportReq.Category, reportReq.Description,
-		user.FirstName, user.LastName, user.Email, userIDStr)
-
-	// Email subject & recipients
-	subject := "New User Report/Feedback"
-	recipients := []string{"thegridly@gmail.com"}
-	message := fmt.Sprintf("Subject: %s\n\n%s", subject, emailBody)
-
-	// SMTP Configuration (ensure these are set in your environment variables)
-	smtpHost := "smtp.gmail.com"
-	smtpPort := "587"
-	smtpUser := os.Getenv("SMTP_USER")
-	smtpPass := os.Getenv("SMTP_PASS")
-
-	if smtpUser == "" || smtpPass == "" {
-		WriteJSONError(w, "SMTP credentials not configured", http.StatusInternalServerError)
-		return
+	report := mailer.ReportData{
+		Type:        reportReq.Type,
+		Category:    reportReq.Category,
+		Description: reportReq.Description,
+		Reporter: mailer.ReportUser{
+			Name:   user.FirstName + " " + user.LastName,
+			Email:  user.Email,
+			UserID: userIDStr,
+		},
 	}
-
-	// Send email
-	auth := smtp.PlainAuth("", smtpUser, smtpPass, smtpHost)
-	if err := smtp.SendMail(smtpHost+":"+smtpPort, auth, smtpUser, recipients, []byte(message)); err != nil {
-		log.Printf("Error sending email: %v", err)
+	if err := mailer.SendTemplate(mailer.TemplateReportReceived, report, mailer.ReportsAddress()); err != nil {
+		log.Printf("Error queueing report email: %v", err)
 		WriteJSONError(w, "Error sending email", http.StatusInternalServerError)
 		return
 	}
@@ -180,7 +156,6 @@ func ReportChatHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Retrieve both users' details.
-	// (Assume db.GetUserByID looks in both "university_users" and "high_school_users")
 	reporter, err := db.GetUserByID(reporterIDStr)
 	if err != nil {
 		WriteJSONError(w, "Error fetching reporter details", http.StatusInternalServerError)
@@ -192,45 +167,23 @@ func ReportChatHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Compose the email body with all necessary details
-	emailBody := fmt.Sprintf(`User Report:
-
-Report Reason: %s
-Description: %s
-
-Chat ID: %s
-
-Reporter:
-    Name: %s %s
-    Email: %s
-    UserID: %s
-
-Reported User:
-    Name: %s %s
-    Email: %s
-    UserID: %s
-`, reportReq.Reason, reportReq.Description, reportReq.ChatID,
-		reporter.FirstName, reporter.LastName, reporter.Email, reporterIDStr,
-		reported.FirstName, reported.LastName, reported.Email, reportedUserID.Hex())
-
-	// Specify the email subject and recipients
-	subject := "User Report Notification"
-	recipients := []string{"thegridly@gmail.com"}
-	message := fmt.Sprintf("Subject: %s\n\n%s", subject, emailBody)
-
-	// SMTP configuration (ensure these are set in your environment variables)
-	smtpHost := "smtp.gmail.com"
-	smtpPort := "587"
-	smtpUser := os.Getenv("SMTP_USER") // e.g., the sender's email address
-	smtpPass := os.Getenv("SMTP_PASS") // the corresponding password or app password
-	if smtpUser == "" || smtpPass == "" {
-		WriteJSONError(w, "SMTP credentials not configured", http.StatusInternalServerError)
-		return
-	}
-
-	auth := smtp.PlainAuth("", smtpUser, smtpPass, smtpHost)
-	if err := smtp.SendMail(smtpHost+":"+smtpPort, auth, smtpUser, recipients, []byte(message)); err != nil {
-		log.Printf("Error sending email: %v", err)
+	report := mailer.ReportData{
+		Category:    reportReq.Reason,
+		Description: reportReq.Description,
+		ChatID:      reportReq.ChatID,
+		Reporter: mailer.ReportUser{
+			Name:   reporter.FirstName + " " + reporter.LastName,
+			Email:  reporter.Email,
+			UserID: reporterIDStr,
+		},
+		Reported: &mailer.ReportUser{
+			Name:   reported.FirstName + " " + reported.LastName,
+			Email:  reported.Email,
+			UserID: reportedUserID.Hex(),
+		},
+	}
+	if err := mailer.SendTemplate(mailer.TemplateReportReceived, report, mailer.ReportsAddress()); err != nil {
+		log.Printf("Error queueing report email: %v", err)
 		WriteJSONError(w, "Error sending report email", http.StatusInternalServerError)
 		return
 	}
@@ -41,16 +41,7 @@ func CreateProductRequestHandler(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	// 🔥 Fetch the user's details before saving the request
-	userCollection := db.GetCollection("gridlyapp", "university_users")
-	var user models.User
-	err = userCollection.FindOne(ctx, bson.M{"_id": userObjID}).Decode(&user)
-
-	if err == mongo.ErrNoDocuments {
-		userCollection = db.GetCollection("gridlyapp", "highschool_users")
-		err = userCollection.FindOne(ctx, bson.M{"_id": userObjID}).Decode(&user)
-	}
-
-	// 🚨 If user not found in both collections, return error
+	user, err := db.Users.GetByID(ctx, userObjID)
 	if err != nil {
 		log.Printf("Error fetching user details: %v", err)
 		WriteJSONError(w, "Error fetching user details", http.StatusInternalServerError)
@@ -92,7 +83,7 @@ func CreateProductRequestHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 🔥 Increment Grids after successful request creation
-	err = IncrementUserGrids(userObjID, user.StudentType)
+	err = IncrementUserGrids(userObjID)
 	if err != nil {
 		log.Printf("Failed to increment grids: %v", err)
 	}
@@ -189,19 +180,16 @@ func GetAllOtherProductRequestsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	page, err := parsePageRequest(r, productRequestSorts, "newest")
+	if err != nil {
+		WriteJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	userCollection := db.GetCollection("gridlyapp", "university_users")
-	var user models.User
-	err = userCollection.FindOne(ctx, bson.M{"_id": userObjID}).Decode(&user)
-
-	if err == mongo.ErrNoDocuments {
-		userCollection = db.GetCollection("gridlyapp", "highschool_users")
-		err = userCollection.FindOne(ctx, bson.M{"_id": userObjID}).Decode(&user)
-	}
-
-	// 🚨 If user not found in both collections, return error
+	user, err := db.Users.GetByID(ctx, userObjID)
 	if err != nil {
 		log.Printf("Error fetching user details: %v", err)
 		WriteJSONError(w, "Error fetching user details", http.StatusInternalServerError)
@@ -217,28 +205,22 @@ func GetAllOtherProductRequestsHandler(w http.ResponseWriter, r *http.Request) {
 	// 🔥 Fetch product requests from users in the same institution (excluding the current user and already requested ones)
 	productRequestCollection := db.GetCollection("gridlyapp", "product_requests")
 	filter := bson.M{
-		"userId":      bson.M{"$ne": userObjID}, // Exclude current user
-		"institution": user.Institution,         // Match institution
-		"requestedBy": bson.M{"$ne": userObjID}, // Exclude if user already requested
+		"userId":       bson.M{"$ne": userObjID}, // Exclude current user
+		"institution":  user.Institution,         // Match institution
+		"requestedBy":  bson.M{"$ne": userObjID}, // Exclude if user already requested
+		"ownerDeleted": bson.M{"$ne": true},      // Exclude requests of deleted accounts
 	}
 
-	cursor, err := productRequestCollection.Find(ctx, filter)
+	var productRequests []models.ProductRequest
+	next, err := findPage(ctx, productRequestCollection, filter, page, &productRequests)
 	if err != nil {
 		log.Printf("Error fetching product requests: %v", err)
 		WriteJSONError(w, "Error fetching product requests", http.StatusInternalServerError)
 		return
 	}
-	defer cursor.Close(ctx)
-
-	var productRequests []models.ProductRequest
-	if err := cursor.All(ctx, &productRequests); err != nil {
-		log.Printf("Error decoding product requests: %v", err)
-		WriteJSONError(w, "Error decoding product requests", http.StatusInternalServerError)
-		return
-	}
 
 	// ✅ Return only filtered product requests
-	WriteJSON(w, productRequests, http.StatusOK)
+	writeFeed(w, page, productRequests, next)
 }
 
 // DeleteProductRequestHandler deletes a product request by ID
@@ -0,0 +1,299 @@
+// handlers/scheduledJobs.go
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"Thegridproduct/backend/db"
+	"Thegridproduct/backend/embeddings"
+	"Thegridproduct/backend/models"
+	"Thegridproduct/backend/scheduler"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// pendingSignupRetention is how long a signup whose verification code expired is
+	// kept so a new code can still be requested.
+	pendingSignupRetention = 7 * 24 * time.Hour
+
+	// staleChatRequestAge is how long a chat request can wait for an answer, and how
+	// long a rejected one is kept.
+	staleChatRequestAge = 30 * 24 * time.Hour
+
+	// reembedBatchSize is how many products and how many gigs one run of the
+	// reembed-listings job embeds at most, to spread a model switch over runs.
+	reembedBatchSize = 200
+
+	// gigEmbeddingRetryAfter is how long a gig whose embedding failed waits before
+	// the reembed-listings job tries again.
+	gigEmbeddingRetryAfter = time.Hour
+)
+
+// RegisterJobs adds the background maintenance jobs to s. The schedule of a job can
+// be overridden with JOB_SCHEDULE_<NAME>, e.g. JOB_SCHEDULE_EXPIRE_GIGS="@every 1m".
+func RegisterJobs(s *scheduler.Scheduler) {
+	jobs := []scheduler.Job{
+		{Name: "expire-gigs", Schedule: scheduler.Every(5 * time.Minute), Run: ExpireGigs},
+		{Name: "expire-products", Schedule: scheduler.Every(15 * time.Minute), Run: ExpireProducts},
+		{Name: "remind-expiring-products", Schedule: scheduler.Every(time.Hour), Run: RemindExpiringProducts},
+		{Name: "purge-pending-users", Schedule: scheduler.Every(time.Hour), Run: PurgeStalePendingUsers},
+		{Name: "purge-chat-requests", Schedule: scheduler.Daily(3, 0), Run: PurgeStaleChatRequests},
+		{Name: "purge-deleted-accounts", Schedule: scheduler.Every(time.Hour), Run: PurgeDeletedAccounts},
+		{Name: "purge-data-exports", Schedule: scheduler.Every(time.Hour), Run: PurgeDataExports},
+		{Name: "reembed-listings", Schedule: scheduler.Every(10 * time.Minute), Run: ReembedStaleListings},
+	}
+	for _, job := range jobs {
+		job.Schedule = jobSchedule(job.Name, job.Schedule)
+		s.Register(job)
+	}
+}
+
+// jobSchedule returns the schedule configured for a job, or fallback.
+func jobSchedule(name string, fallback scheduler.Schedule) scheduler.Schedule {
+	envName := "JOB_SCHEDULE_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	spec := os.Getenv(envName)
+	if spec == "" {
+		return fallback
+	}
+	schedule, err := scheduler.Parse(spec)
+	if err != nil {
+		log.Printf("Invalid %s: %v, using the default", envName, err)
+		return fallback
+	}
+	return schedule
+}
+
+// ExpireGigs marks gigs past their expiration date as expired and returns how many
+// it marked.
+func ExpireGigs(ctx context.Context) (int, error) {
+	return expireListings(ctx, "gigs", bson.M{"expirationDate": bson.M{"$lt": time.Now()}})
+}
+
+// expireListings sets expired on the listings of colName matching due and drops
+// them from this replica's search indexes; other replicas confirm candidates against
+// MongoDB and lose them on their next rebuild.
+func expireListings(ctx context.Context, colName string, due bson.M) (int, error) {
+	collection := db.GetCollection("gridlyapp", colName)
+	filter := bson.M{"$and": []bson.M{{"expired": false}, due}}
+
+	cursor, err := collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, fmt.Errorf("error finding expired %s: %v", colName, err)
+	}
+	var docs []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return 0, fmt.Errorf("error decoding expired %s: %v", colName, err)
+	}
+	if len(docs) == 0 {
+		return 0, nil
+	}
+	ids := make([]primitive.ObjectID, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+
+	res, err := collection.UpdateMany(ctx,
+		bson.M{"$and": []bson.M{filter, {"_id": bson.M{"$in": ids}}}},
+		bson.M{"$set": bson.M{"expired": true}},
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error expiring %s: %v", colName, err)
+	}
+	removeListingVectors(colName, ids...)
+	return int(res.ModifiedCount), nil
+}
+
+// PurgeStalePendingUsers deletes signups that were never verified and returns how
+// many it deleted. Requesting a new code moves expiresAt, so only signups nobody
+// touched for the retention period go.
+func PurgeStalePendingUsers(ctx context.Context) (int, error) {
+	res, err := db.GetCollection("gridlyapp", "pending_users").DeleteMany(ctx,
+		bson.M{"expiresAt": bson.M{"$lt": time.Now().Add(-pendingSignupRetention)}})
+	if err != nil {
+		return 0, fmt.Errorf("error purging pending users: %v", err)
+	}
+	return int(res.DeletedCount), nil
+}
+
+// PurgeStaleChatRequests deletes chat requests that went unanswered or were
+// rejected longer than staleChatRequestAge ago, and returns how many it deleted.
+// Like withdrawing a request, deleting a pending one gives back its chat count.
+func PurgeStaleChatRequests(ctx context.Context) (int, error) {
+	chatRequests := db.GetCollection("gridlyapp", "chat_requests")
+	cutoff := time.Now().Add(-staleChatRequestAge)
+
+	res, err := chatRequests.DeleteMany(ctx, bson.M{
+		"status":    models.ChatRequestStatusRejected,
+		"createdAt": bson.M{"$lt": cutoff},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error purging rejected chat requests: %v", err)
+	}
+	purged := int(res.DeletedCount)
+
+	cursor, err := chatRequests.Find(ctx, bson.M{
+		"status":    models.ChatRequestStatusPending,
+		"createdAt": bson.M{"$lt": cutoff},
+	})
+	if err != nil {
+		return purged, fmt.Errorf("error finding stale chat requests: %v", err)
+	}
+	var stale []models.ChatRequest
+	if err := cursor.All(ctx, &stale); err != nil {
+		return purged, fmt.Errorf("error decoding stale chat requests: %v", err)
+	}
+
+	for _, chatReq := range stale {
+		// Skip requests accepted or withdrawn since they were read.
+		res, err := chatRequests.DeleteOne(ctx, bson.M{"_id": chatReq.ID, "status": models.ChatRequestStatusPending})
+		if err != nil {
+			return purged, fmt.Errorf("error deleting chat request %s: %v", chatReq.ID.Hex(), err)
+		}
+		if res.DeletedCount == 0 {
+			continue
+		}
+		purged++
+
+		colName, ok := referenceCollections[chatReq.ReferenceType]
+		if !ok {
+			log.Printf("Unknown referenceType %s on chat request %s", chatReq.ReferenceType, chatReq.ID.Hex())
+			continue
+		}
+		if _, err := db.GetCollection("gridlyapp", colName).UpdateOne(ctx,
+			bson.M{"_id": chatReq.ReferenceID},
+			bson.M{"$inc": bson.M{"chatCount": -1}},
+		); err != nil {
+			log.Printf("Error updating chatCount for referenceID %s: %v", chatReq.ReferenceID.Hex(), err)
+		}
+	}
+	return purged, nil
+}
+
+// PurgeDataExports marks exports stuck in pending or processing as failed, then
+// deletes expired archives and failed exports older than dataExportTTL. It
+// returns how many exports it failed or deleted.
+func PurgeDataExports(ctx context.Context) (int, error) {
+	now := time.Now()
+	failed, err := db.FailStaleDataExports(ctx, bson.M{}, now.Add(-dataExportStaleAfter))
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := db.DeleteDataExports(ctx, bson.M{"$or": []bson.M{
+		{"status": models.ExportStatusReady, "expiresAt": bson.M{"$lt": now}},
+		{"status": models.ExportStatusFailed, "createdAt": bson.M{"$lt": now.Add(-dataExportTTL)}},
+	}})
+	if err != nil {
+		return failed, err
+	}
+	return failed + deleted, nil
+}
+
+// ReembedStaleListings embeds listings that have no vector from the configured
+// model, such as all of them after EMBEDDINGS_PROVIDER, EMBEDDINGS_MODEL or
+// EMBEDDINGS_DIMENSIONS changed, and gigs whose embedding is pending or failed a
+// while ago. Only listings search can show are picked up, newest first; hidden
+// ones are embedded when they come back. It returns how many listings it
+// embedded or tried to.
+func ReembedStaleListings(ctx context.Context) (int, error) {
+	embedder := embeddings.Default()
+	opts := options.Find().
+		SetSort(bson.M{"_id": -1}).
+		SetLimit(reembedBatchSize).
+		SetProjection(bson.M{"_id": 1})
+
+	targets := []struct {
+		colName string
+		filter  bson.M
+		refresh func(primitive.ObjectID)
+	}{
+		{"products", embeddings.StaleFilter(embedder), refreshProductEmbedding},
+		// Failed gigs have no current vector, so they are stale too; skip the ones that
+		// failed recently so they cannot fill every batch and starve older listings.
+		{"gigs", bson.M{"$or": []bson.M{
+			{"$and": []bson.M{
+				embeddings.StaleFilter(embedder),
+				{"$nor": []bson.M{{
+					"embeddingStatus":    models.EmbeddingStatusFailed,
+					"embeddingUpdatedAt": bson.M{"$gte": time.Now().Add(-gigEmbeddingRetryAfter)},
+				}}},
+			}},
+			{"embeddingStatus": models.EmbeddingStatusPending},
+		}}, refreshGigEmbedding},
+	}
+
+	embedded := 0
+	for _, t := range targets {
+		filter := bson.M{"$and": []bson.M{vectorIndexSources[t.colName].visible, t.filter}}
+		cursor, err := db.GetCollection("gridlyapp", t.colName).Find(ctx, filter, opts)
+		if err != nil {
+			return embedded, fmt.Errorf("error finding stale %s: %v", t.colName, err)
+		}
+		var docs []struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.All(ctx, &docs); err != nil {
+			return embedded, fmt.Errorf("error decoding stale %s: %v", t.colName, err)
+		}
+		for _, doc := range docs {
+			if err := ctx.Err(); err != nil {
+				return embedded, err
+			}
+			t.refresh(doc.ID)
+			embedded++
+		}
+	}
+	return embedded, nil
+}
+
+// referenceCollections maps the reference type of a chat request to the collection
+// of the listing it is about.
+var referenceCollections = map[string]string{
+	"product":         "products",
+	"gig":             "gigs",
+	"product_request": "product_requests",
+}
+
+// GetJobRunsHandler returns the latest runs of the background jobs, optionally of
+// one job only.
+// Endpoint: GET /admin/jobs/runs?job=expire-gigs&limit=50
+func GetJobRunsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	limit := int64(50)
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 1 || n > 500 {
+			WriteJSONError(w, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	runs, err := scheduler.RecentRuns(ctx, r.URL.Query().Get("job"), limit)
+	if err != nil {
+		log.Printf("Error fetching job runs: %v", err)
+		WriteJSONError(w, "Error fetching job runs", http.StatusInternalServerError)
+		return
+	}
+	if runs == nil {
+		runs = []scheduler.Run{}
+	}
+	WriteJSON(w, map[string]interface{}{"runs": runs}, http.StatusOK)
+}
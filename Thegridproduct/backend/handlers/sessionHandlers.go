@@ -0,0 +1,246 @@
+// handlers/sessionHandlers.go
+
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"Thegridproduct/backend/db"
+	"Thegridproduct/backend/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// accessTokenTTL is how long an access token is accepted by AuthMiddleware.
+	accessTokenTTL = 15 * time.Minute
+
+	// refreshTokenTTL is how long a session can be kept alive without a refresh.
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// TokenPair is returned whenever a session is started or refreshed.
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn"` // Access token lifetime in seconds
+}
+
+// RefreshRequest represents the payload for refreshing a session.
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// LogoutRequest represents the payload for logging out.
+type LogoutRequest struct {
+	AllDevices bool `json:"allDevices"`
+}
+
+// newRefreshToken returns a random opaque refresh token and the hash stored for it.
+func newRefreshToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashRefreshToken(token), nil
+}
+
+// hashRefreshToken hashes a refresh token so raw tokens are never stored.
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueSession creates a new session for the user and returns its token pair.
+func issueSession(ctx context.Context, r *http.Request, userID primitive.ObjectID, institution, studentType string, roles []string) (*TokenPair, error) {
+	refreshToken, refreshHash, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &models.Session{
+		ID:               primitive.NewObjectID(),
+		UserID:           userID,
+		RefreshTokenHash: refreshHash,
+		UserAgent:        r.UserAgent(),
+		IPAddress:        clientIP(r),
+		CreatedAt:        time.Now(),
+		ExpiresAt:        time.Now().Add(refreshTokenTTL),
+	}
+	if err := db.CreateSession(ctx, session); err != nil {
+		return nil, err
+	}
+
+	accessToken, err := generateToken(userID, institution, studentType, roles, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(accessTokenTTL.Seconds()),
+	}, nil
+}
+
+// RefreshTokenHandler exchanges a refresh token for a new access token and a rotated refresh token.
+func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		WriteJSONError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		WriteJSONError(w, "Refresh token is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	presentedHash := hashRefreshToken(req.RefreshToken)
+
+	session, err := db.FindSessionByRefreshHash(ctx, presentedHash)
+	if err == db.ErrSessionNotFound {
+		// A token that was already rotated is being replayed: assume it was stolen
+		// and kill the whole session so neither party can keep using it.
+		if reused, reuseErr := db.FindSessionByPreviousHash(ctx, presentedHash); reuseErr == nil {
+			log.Printf("Refresh token reuse detected for session %s; revoking", reused.ID.Hex())
+			if err := db.RevokeSession(ctx, reused.ID); err != nil {
+				log.Printf("Error revoking session: %v", err)
+			}
+		}
+		WriteJSONError(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		log.Printf("Error finding session: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		WriteJSONError(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	// Reload the user so the new access token reflects the current profile and roles.
+	user, err := db.GetUserByID(session.UserID.Hex())
+	if err != nil {
+		log.Printf("Error loading user for session %s: %v", session.ID.Hex(), err)
+		WriteJSONError(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+	if user.DeletedAt != nil {
+		WriteJSONError(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	refreshToken, refreshHash, err := newRefreshToken()
+	if err != nil {
+		log.Printf("Error generating refresh token: %v", err)
+		WriteJSONError(w, "Could not generate token", http.StatusInternalServerError)
+		return
+	}
+
+	err = db.RotateSession(ctx, session.ID, presentedHash, refreshHash, time.Now().Add(refreshTokenTTL))
+	if err == db.ErrSessionNotFound {
+		// Another request rotated this token first.
+		WriteJSONError(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		log.Printf("Error rotating session: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	accessToken, err := generateToken(user.ID, user.Institution, user.StudentType, user.Roles, session.ID)
+	if err != nil {
+		log.Printf("Error generating token: %v", err)
+		WriteJSONError(w, "Could not generate token", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(accessTokenTTL.Seconds()),
+	}, http.StatusOK)
+}
+
+// LogoutHandler revokes the caller's current session, or all of their sessions when allDevices is set.
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		WriteJSONError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value(userIDKey).(string)
+	if !ok || userID == "" {
+		WriteJSONError(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+	sessionID, ok := r.Context().Value(sessionIDKey).(string)
+	if !ok || sessionID == "" {
+		WriteJSONError(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	// The body is optional; an empty body logs out the current device only.
+	var req LogoutRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			WriteJSONError(w, "Invalid input", http.StatusBadRequest)
+			return
+		}
+	}
+
+	userObjID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		WriteJSONError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	sessionObjID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		WriteJSONError(w, "Invalid session", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if req.AllDevices {
+		revoked, err := db.RevokeUserSessions(ctx, userObjID)
+		if err != nil {
+			log.Printf("Error revoking sessions for user %s: %v", userID, err)
+			WriteJSONError(w, "Failed to log out", http.StatusInternalServerError)
+			return
+		}
+		WriteJSON(w, map[string]interface{}{
+			"message":         "Logged out from all devices",
+			"revokedSessions": revoked,
+		}, http.StatusOK)
+		return
+	}
+
+	if err := db.RevokeSession(ctx, sessionObjID); err != nil {
+		log.Printf("Error revoking session %s: %v", sessionID, err)
+		WriteJSONError(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, map[string]string{"message": "Logged out successfully"}, http.StatusOK)
+}
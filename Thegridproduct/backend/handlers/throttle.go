@@ -0,0 +1,221 @@
+// handlers/throttle.go
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"Thegridproduct/backend/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// throttlePolicy describes how failures against a single key are punished.
+// The first freeAttempts failures are not delayed; after that each failure
+// locks the key for baseDelay, doubling per failure up to maxDelay.
+type throttlePolicy struct {
+	scope        string
+	freeAttempts int
+	baseDelay    time.Duration
+	maxDelay     time.Duration
+	window       time.Duration // Failures older than this are forgotten
+}
+
+var (
+	// loginAccountPolicy limits password guesses against a single email.
+	loginAccountPolicy = throttlePolicy{scope: "login", freeAttempts: 5, baseDelay: 30 * time.Second, maxDelay: time.Hour, window: 24 * time.Hour}
+
+	// loginIPPolicy limits password guesses from a single IP across all accounts.
+	loginIPPolicy = throttlePolicy{scope: "login-ip", freeAttempts: 20, baseDelay: time.Minute, maxDelay: time.Hour, window: 24 * time.Hour}
+
+	// verifyAccountPolicy limits verification code guesses against a single email.
+	verifyAccountPolicy = throttlePolicy{scope: "verify", freeAttempts: 5, baseDelay: time.Minute, maxDelay: time.Hour, window: 24 * time.Hour}
+
+	// verifyIPPolicy limits verification code guesses from a single IP.
+	verifyIPPolicy = throttlePolicy{scope: "verify-ip", freeAttempts: 20, baseDelay: time.Minute, maxDelay: time.Hour, window: 24 * time.Hour}
+
+	// twoFactorPolicy limits two-factor code guesses for an account.
+	twoFactorPolicy = throttlePolicy{scope: "2fa", freeAttempts: 5, baseDelay: time.Minute, maxDelay: time.Hour, window: 24 * time.Hour}
+)
+
+// rateLimit allows at most limit events per fixed window for a key.
+type rateLimit struct {
+	scope  string
+	limit  int
+	window time.Duration
+}
+
+var (
+	// verificationEmailLimit caps how many verification emails one address can receive.
+	verificationEmailLimit = rateLimit{scope: "verify-send", limit: 3, window: 15 * time.Minute}
+
+	// verificationEmailIPLimit caps how many verification emails one IP can trigger.
+	verificationEmailIPLimit = rateLimit{scope: "verify-send-ip", limit: 10, window: time.Hour}
+
+	// passwordResetEmailLimit caps how many reset codes one address can receive.
+	passwordResetEmailLimit = rateLimit{scope: "reset-send", limit: 3, window: 15 * time.Minute}
+
+	// passwordResetEmailIPLimit caps how many reset codes one IP can request.
+	passwordResetEmailIPLimit = rateLimit{scope: "reset-send-ip", limit: 10, window: time.Hour}
+)
+
+// authAttempt is a counter document in the auth_attempts collection.
+type authAttempt struct {
+	Key         string    `bson:"_id"` // scope:key
+	Count       int       `bson:"count"`
+	WindowStart time.Time `bson:"windowStart"`
+	LastAt      time.Time `bson:"lastAt"`
+	LockedUntil time.Time `bson:"lockedUntil,omitempty"`
+	ExpiresAt   time.Time `bson:"expiresAt"`
+}
+
+// throttleKey normalizes the subject of a throttle so "A@x.edu " and "a@x.edu" share a counter.
+func throttleKey(scope, subject string) string {
+	return scope + ":" + strings.ToLower(strings.TrimSpace(subject))
+}
+
+// lockedUntil returns when the key becomes usable again, or the zero time if it is not locked.
+func (p throttlePolicy) lockedUntil(ctx context.Context, subject string) (time.Time, error) {
+	col := db.GetCollection("gridlyapp", "auth_attempts")
+
+	var attempt authAttempt
+	err := col.FindOne(ctx, bson.M{
+		"_id":         throttleKey(p.scope, subject),
+		"lockedUntil": bson.M{"$gt": time.Now()},
+	}).Decode(&attempt)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+	return attempt.LockedUntil, nil
+}
+
+// recordFailure counts a failed attempt and locks the key once the free attempts are used up.
+func (p throttlePolicy) recordFailure(ctx context.Context, subject string) error {
+	col := db.GetCollection("gridlyapp", "auth_attempts")
+	key := throttleKey(p.scope, subject)
+	now := time.Now()
+
+	// Forget failures that fell out of the window before counting this one.
+	if _, err := col.DeleteOne(ctx, bson.M{"_id": key, "lastAt": bson.M{"$lt": now.Add(-p.window)}}); err != nil {
+		return err
+	}
+
+	var attempt authAttempt
+	err := col.FindOneAndUpdate(ctx,
+		bson.M{"_id": key},
+		bson.M{
+			"$inc":         bson.M{"count": 1},
+			"$set":         bson.M{"lastAt": now, "expiresAt": now.Add(p.window)},
+			"$setOnInsert": bson.M{"windowStart": now},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&attempt)
+	if err != nil {
+		return err
+	}
+
+	if attempt.Count <= p.freeAttempts {
+		return nil
+	}
+
+	delay := time.Duration(float64(p.baseDelay) * math.Pow(2, float64(attempt.Count-p.freeAttempts-1)))
+	if delay <= 0 || delay > p.maxDelay {
+		delay = p.maxDelay
+	}
+	_, err = col.UpdateOne(ctx, bson.M{"_id": key}, bson.M{"$set": bson.M{"lockedUntil": now.Add(delay)}})
+	return err
+}
+
+// reset clears the failure counter after a successful attempt.
+func (p throttlePolicy) reset(ctx context.Context, subject string) error {
+	col := db.GetCollection("gridlyapp", "auth_attempts")
+	_, err := col.DeleteOne(ctx, bson.M{"_id": throttleKey(p.scope, subject)})
+	return err
+}
+
+// allow counts an event and reports whether it fits in the current window.
+// When it does not, it also returns how long until the window resets.
+func (l rateLimit) allow(ctx context.Context, subject string) (bool, time.Duration, error) {
+	col := db.GetCollection("gridlyapp", "auth_attempts")
+	key := throttleKey(l.scope, subject)
+	now := time.Now()
+
+	// Start a fresh window once the previous one has ended.
+	if _, err := col.DeleteOne(ctx, bson.M{"_id": key, "windowStart": bson.M{"$lte": now.Add(-l.window)}}); err != nil {
+		return false, 0, err
+	}
+
+	var attempt authAttempt
+	err := col.FindOneAndUpdate(ctx,
+		bson.M{"_id": key},
+		bson.M{
+			"$inc":         bson.M{"count": 1},
+			"$set":         bson.M{"lastAt": now},
+			"$setOnInsert": bson.M{"windowStart": now, "expiresAt": now.Add(l.window)},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&attempt)
+	if err != nil {
+		return false, 0, err
+	}
+
+	if attempt.Count > l.limit {
+		return false, attempt.WindowStart.Add(l.window).Sub(now), nil
+	}
+	return true, 0, nil
+}
+
+// checkLockouts returns the latest lock among the given policies for their subjects.
+func checkLockouts(ctx context.Context, checks map[throttlePolicy]string) (time.Time, error) {
+	var latest time.Time
+	for policy, subject := range checks {
+		until, err := policy.lockedUntil(ctx, subject)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if until.After(latest) {
+			latest = until
+		}
+	}
+	return latest, nil
+}
+
+// allowRateLimits counts an event against each limit for its subject. When one is
+// exceeded it responds with 429 and message and returns false.
+func allowRateLimits(ctx context.Context, w http.ResponseWriter, message string, checks map[rateLimit]string) bool {
+	for limit, subject := range checks {
+		allowed, retryAfter, err := limit.allow(ctx, subject)
+		if err != nil {
+			log.Printf("Error checking %s rate limit: %v", limit.scope, err)
+			WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+			return false
+		}
+		if !allowed {
+			writeTooManyRequests(w, message, retryAfter)
+			return false
+		}
+	}
+	return true
+}
+
+// writeTooManyRequests responds with 429 and a Retry-After header.
+func writeTooManyRequests(w http.ResponseWriter, message string, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	WriteJSONError(w, fmt.Sprintf("%s Try again in %d seconds.", message, seconds), http.StatusTooManyRequests)
+}
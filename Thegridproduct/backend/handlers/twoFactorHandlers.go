@@ -0,0 +1,494 @@
+// handlers/twoFactorHandlers.go
+
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"Thegridproduct/backend/db"
+	"Thegridproduct/backend/models"
+	"Thegridproduct/backend/totp"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// twoFactorChallengeTTL is how long a login challenge token can be exchanged.
+	twoFactorChallengeTTL = 5 * time.Minute
+
+	// twoFactorChallengeAudience marks challenge tokens so they cannot be confused with access tokens.
+	twoFactorChallengeAudience = "2fa-challenge"
+
+	// twoFactorRestoreAudience marks challenge tokens that restore a deleted account
+	// instead of logging in, so neither can be exchanged at the other endpoint.
+	twoFactorRestoreAudience = "2fa-restore"
+
+	// twoFactorIssuer is the account issuer shown in authenticator apps.
+	twoFactorIssuer = "Gridly"
+
+	// recoveryCodeCount is how many recovery codes are issued at a time.
+	recoveryCodeCount = 10
+
+	// totpSkew is how many 30 second steps of clock drift are tolerated either way.
+	totpSkew = 1
+)
+
+// TwoFactorCodeRequest carries a TOTP or recovery code.
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// DisableTwoFactorRequest represents the payload for turning two-factor authentication off.
+type DisableTwoFactorRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// TwoFactorLoginRequest represents the second step of a login.
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"`
+}
+
+// EnrollTwoFactorHandler starts two-factor enrollment by generating a new secret.
+// The secret only takes effect once a code from it is confirmed.
+// Endpoint: POST /2fa/enroll
+func EnrollTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, ok := loadCaller(ctx, w, r)
+	if !ok {
+		return
+	}
+	if user.TwoFactorEnabled {
+		WriteJSONError(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Printf("Error generating TOTP secret: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	err = db.Users.Update(ctx, user.ID, bson.M{"$set": bson.M{"twoFactorPendingSecret": secret, "updatedAt": time.Now()}})
+	if err != nil {
+		log.Printf("Error storing TOTP secret: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, map[string]interface{}{
+		"secret":          secret,
+		"provisioningUri": totp.ProvisioningURI(secret, twoFactorIssuer, user.Email),
+	}, http.StatusOK)
+}
+
+// ConfirmTwoFactorHandler enables two-factor authentication once the user proves their
+// authenticator app works, and returns a fresh set of recovery codes.
+// Endpoint: POST /2fa/confirm
+func ConfirmTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		WriteJSONError(w, "Code is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, ok := loadCaller(ctx, w, r)
+	if !ok {
+		return
+	}
+	if user.TwoFactorEnabled {
+		WriteJSONError(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if user.TwoFactorPendingSecret == "" {
+		WriteJSONError(w, "Start enrollment before confirming", http.StatusBadRequest)
+		return
+	}
+	if !checkTwoFactorLockout(ctx, w, user.ID) {
+		return
+	}
+
+	step, valid := totp.Validate(user.TwoFactorPendingSecret, req.Code, time.Now(), totpSkew, 0)
+	if !valid {
+		recordTwoFactorFailure(ctx, user.ID)
+		WriteJSONError(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+	resetTwoFactorFailures(ctx, user.ID)
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		log.Printf("Error generating recovery codes: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	err = db.Users.Update(ctx, user.ID, bson.M{
+		"$set": bson.M{
+			"twoFactorEnabled":  true,
+			"twoFactorSecret":   user.TwoFactorPendingSecret,
+			"twoFactorLastStep": step,
+			"recoveryCodes":     hashes,
+			"updatedAt":         time.Now(),
+		},
+		"$unset": bson.M{"twoFactorPendingSecret": ""},
+	})
+	if err != nil {
+		log.Printf("Error enabling two-factor authentication: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, map[string]interface{}{
+		"message":       "Two-factor authentication enabled. Store your recovery codes somewhere safe; each can be used once.",
+		"recoveryCodes": codes,
+	}, http.StatusOK)
+}
+
+// RegenerateRecoveryCodesHandler replaces the caller's recovery codes.
+// Endpoint: POST /2fa/recovery-codes
+func RegenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		WriteJSONError(w, "Code is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, ok := loadCaller(ctx, w, r)
+	if !ok {
+		return
+	}
+	if !user.TwoFactorEnabled {
+		WriteJSONError(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+	if !verifySecondFactor(ctx, w, user, req.Code) {
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		log.Printf("Error generating recovery codes: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := db.Users.Update(ctx, user.ID, bson.M{"$set": bson.M{"recoveryCodes": hashes, "updatedAt": time.Now()}}); err != nil {
+		log.Printf("Error storing recovery codes: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, map[string]interface{}{"recoveryCodes": codes}, http.StatusOK)
+}
+
+// DisableTwoFactorHandler turns two-factor authentication off. It needs both the
+// password and a current TOTP or recovery code.
+// Endpoint: POST /2fa/disable
+func DisableTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req DisableTwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Password == "" || req.Code == "" {
+		WriteJSONError(w, "Password and code are required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, ok := loadCaller(ctx, w, r)
+	if !ok {
+		return
+	}
+	if !user.TwoFactorEnabled {
+		WriteJSONError(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)) != nil {
+		WriteJSONError(w, "Invalid password", http.StatusUnauthorized)
+		return
+	}
+	if !verifySecondFactor(ctx, w, user, req.Code) {
+		return
+	}
+
+	err := db.Users.Update(ctx, user.ID, bson.M{
+		"$unset": bson.M{
+			"twoFactorEnabled":       "",
+			"twoFactorSecret":        "",
+			"twoFactorPendingSecret": "",
+			"twoFactorLastStep":      "",
+			"recoveryCodes":          "",
+		},
+		"$set": bson.M{"updatedAt": time.Now()},
+	})
+	if err != nil {
+		log.Printf("Error disabling two-factor authentication: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, map[string]string{"message": "Two-factor authentication disabled"}, http.StatusOK)
+}
+
+// TwoFactorLoginHandler completes a login for an account with two-factor authentication
+// by exchanging the challenge token from LoginHandler and a code for a session.
+// Endpoint: POST /login/2fa
+func TwoFactorLoginHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		WriteJSONError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ChallengeToken == "" || req.Code == "" {
+		WriteJSONError(w, "Challenge token and code are required", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := parseTwoFactorChallenge(req.ChallengeToken, twoFactorChallengeAudience)
+	if err != nil {
+		WriteJSONError(w, "Invalid or expired challenge token", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	user, err := db.Users.GetByID(ctx, userID)
+	if err == db.ErrUserNotFound {
+		WriteJSONError(w, "Invalid or expired challenge token", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		log.Printf("Error finding user: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !user.TwoFactorEnabled || user.DeletedAt != nil {
+		WriteJSONError(w, "Invalid or expired challenge token", http.StatusUnauthorized)
+		return
+	}
+	if !verifySecondFactor(ctx, w, user, req.Code) {
+		return
+	}
+
+	tokens, err := issueSession(ctx, r, user.ID, user.Institution, user.StudentType, user.Roles)
+	if err != nil {
+		log.Printf("Error generating token: %v", err)
+		WriteJSONError(w, "Could not generate token", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, map[string]interface{}{
+		"token":        tokens.AccessToken,
+		"refreshToken": tokens.RefreshToken,
+		"expiresIn":    tokens.ExpiresIn,
+		"userId":       user.ID.Hex(),
+		"institution":  user.Institution,
+		"studentType":  user.StudentType,
+		"roles":        user.Roles,
+	}, http.StatusOK)
+}
+
+// generateTwoFactorChallenge issues the token LoginHandler and RestoreAccountHandler
+// return instead of a session when the account has two-factor authentication enabled.
+// The audience says which endpoint the token can be exchanged at.
+func generateTwoFactorChallenge(userID primitive.ObjectID, audience string) (string, error) {
+	jwtKey := []byte(os.Getenv("JWT_SECRET_KEY"))
+	if len(jwtKey) == 0 {
+		return "", errors.New("JWT_SECRET_KEY is not set")
+	}
+
+	claims := &TwoFactorClaims{
+		UserID: userID.Hex(),
+		StandardClaims: jwt.StandardClaims{
+			Audience:  audience,
+			ExpiresAt: time.Now().Add(twoFactorChallengeTTL).Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Issuer:    "TheGridlyApp",
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtKey)
+}
+
+// parseTwoFactorChallenge validates a challenge token for the given audience and
+// returns the user it was issued for.
+func parseTwoFactorChallenge(tokenString, audience string) (primitive.ObjectID, error) {
+	jwtKey := []byte(os.Getenv("JWT_SECRET_KEY"))
+	if len(jwtKey) == 0 {
+		return primitive.NilObjectID, errors.New("JWT_SECRET_KEY is not set")
+	}
+
+	claims := &TwoFactorClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return jwtKey, nil
+	})
+	if err != nil || !token.Valid {
+		return primitive.NilObjectID, errors.New("invalid challenge token")
+	}
+	if !claims.VerifyAudience(audience, true) {
+		return primitive.NilObjectID, errors.New("not a challenge token")
+	}
+	return primitive.ObjectIDFromHex(claims.UserID)
+}
+
+// verifySecondFactor checks a TOTP or recovery code for a user with two-factor
+// authentication enabled, applying the two-factor throttle. A used TOTP step or
+// recovery code is consumed so it cannot be replayed. It writes the error
+// response and returns false when the code is not accepted.
+func verifySecondFactor(ctx context.Context, w http.ResponseWriter, user *models.User, code string) bool {
+	if !checkTwoFactorLockout(ctx, w, user.ID) {
+		return false
+	}
+
+	accepted, err := consumeSecondFactor(ctx, user, code)
+	if err != nil {
+		log.Printf("Error checking two-factor code: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	if !accepted {
+		recordTwoFactorFailure(ctx, user.ID)
+		WriteJSONError(w, "Invalid code", http.StatusUnauthorized)
+		return false
+	}
+
+	resetTwoFactorFailures(ctx, user.ID)
+	return true
+}
+
+// consumeSecondFactor reports whether code is a valid TOTP or unused recovery code.
+func consumeSecondFactor(ctx context.Context, user *models.User, code string) (bool, error) {
+	if step, ok := totp.Validate(user.TwoFactorSecret, code, time.Now(), totpSkew, user.TwoFactorLastStep); ok {
+		// Only advance the step if no concurrent request used this code first.
+		return db.Users.UpdateOneWhere(ctx,
+			bson.M{"_id": user.ID, "twoFactorLastStep": bson.M{"$not": bson.M{"$gte": step}}},
+			bson.M{"$set": bson.M{"twoFactorLastStep": step}},
+		)
+	}
+
+	hash := hashRecoveryCode(code)
+	used, err := db.Users.UpdateOneWhere(ctx,
+		bson.M{"_id": user.ID, "recoveryCodes": hash},
+		bson.M{"$pull": bson.M{"recoveryCodes": hash}},
+	)
+	if err == nil && used {
+		log.Printf("User %s used a recovery code", user.ID.Hex())
+	}
+	return used, err
+}
+
+// generateRecoveryCodes returns new recovery codes and the hashes to store.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(encoding.EncodeToString(buf)) // 8 characters
+		code := raw[:4] + "-" + raw[4:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode normalizes and hashes a recovery code. The codes are random
+// enough that a plain SHA-256 is sufficient, like refresh tokens.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkTwoFactorLockout writes a 429 and returns false while the account is locked
+// out of two-factor attempts.
+func checkTwoFactorLockout(ctx context.Context, w http.ResponseWriter, userID primitive.ObjectID) bool {
+	lockedUntil, err := twoFactorPolicy.lockedUntil(ctx, userID.Hex())
+	if err != nil {
+		log.Printf("Error checking two-factor lockout: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	if !lockedUntil.IsZero() {
+		writeTooManyRequests(w, "Too many invalid codes.", time.Until(lockedUntil))
+		return false
+	}
+	return true
+}
+
+func recordTwoFactorFailure(ctx context.Context, userID primitive.ObjectID) {
+	if err := twoFactorPolicy.recordFailure(ctx, userID.Hex()); err != nil {
+		log.Printf("Error recording failed two-factor attempt: %v", err)
+	}
+}
+
+func resetTwoFactorFailures(ctx context.Context, userID primitive.ObjectID) {
+	if err := twoFactorPolicy.reset(ctx, userID.Hex()); err != nil {
+		log.Printf("Error resetting two-factor attempts: %v", err)
+	}
+}
+
+// loadCaller loads the authenticated user, writing the error response when it cannot.
+func loadCaller(ctx context.Context, w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	userIDStr, ok := r.Context().Value(userIDKey).(string)
+	if !ok || userIDStr == "" {
+		WriteJSONError(w, "User not authenticated", http.StatusUnauthorized)
+		return nil, false
+	}
+	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		WriteJSONError(w, "Invalid user ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	user, err := db.Users.GetByID(ctx, userID)
+	if err == db.ErrUserNotFound {
+		WriteJSONError(w, "User not found", http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		log.Printf("Error fetching user %s: %v", userIDStr, err)
+		WriteJSONError(w, "Error fetching user", http.StatusInternalServerError)
+		return nil, false
+	}
+	return user, true
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestTwoFactorChallengeAudiences(t *testing.T) {
+	t.Setenv("JWT_SECRET_KEY", "test-secret")
+	userID := primitive.NewObjectID()
+
+	audiences := []string{twoFactorChallengeAudience, twoFactorRestoreAudience}
+	for _, issued := range audiences {
+		token, err := generateTwoFactorChallenge(userID, issued)
+		if err != nil {
+			t.Fatalf("generateTwoFactorChallenge(%s): %v", issued, err)
+		}
+		for _, expected := range audiences {
+			got, err := parseTwoFactorChallenge(token, expected)
+			if issued == expected && (err != nil || got != userID) {
+				t.Errorf("%s token at %s = %s, %v; want %s", issued, expected, got.Hex(), err, userID.Hex())
+			}
+			if issued != expected && err == nil {
+				t.Errorf("%s token accepted at %s", issued, expected)
+			}
+		}
+	}
+
+	if _, err := parseTwoFactorChallenge("not-a-token", twoFactorChallengeAudience); err == nil {
+		t.Error("parseTwoFactorChallenge accepted garbage")
+	}
+}
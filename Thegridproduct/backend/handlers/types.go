@@ -16,13 +16,29 @@ const (
 
 	// userStudentType is the context key for the authenticated user's student type.
 	userStudentType contextKey = "studentType"
+
+	// sessionIDKey is the context key for the session the access token belongs to.
+	sessionIDKey contextKey = "sessionID"
+
+	// userRolesKey is the context key for the authenticated user's roles.
+	userRolesKey contextKey = "roles"
 )
 
 // Claims defines the structure of JWT claims.
 type Claims struct {
-	UserID      string `json:"userId"`
-	Institution string `json:"institution"`
-	StudentType string `json:"studentType"` // "highschool" or "university"
+	UserID      string   `json:"userId"`
+	Institution string   `json:"institution"`
+	StudentType string   `json:"studentType"`     // "highschool" or "university"
+	SessionID   string   `json:"sid"`             // Session backing this access token
+	Roles       []string `json:"roles,omitempty"` // Roles at the time the token was issued
+	jwt.StandardClaims
+}
+
+// TwoFactorClaims is carried by the short-lived challenge token Login returns when
+// the account has two-factor authentication enabled. It has no session, so
+// AuthMiddleware never accepts it as an access token.
+type TwoFactorClaims struct {
+	UserID string `json:"userId"`
 	jwt.StandardClaims
 }
 
@@ -0,0 +1,312 @@
+// handlers/uploadHandlers.go
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"Thegridproduct/backend/db"
+	"Thegridproduct/backend/imaging"
+	"Thegridproduct/backend/models"
+	"Thegridproduct/backend/storage"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxUploadBytes is the largest image file accepted by the upload endpoint.
+const maxUploadBytes = 10 << 20
+
+// uploadLimit caps how many images a user can upload.
+var uploadLimit = rateLimit{scope: "upload", limit: 100, window: time.Hour}
+
+// errInvalidImageRef is returned when a listing or profile refers to an image the
+// upload service did not store for the user.
+var errInvalidImageRef = errors.New("images must be uploaded through POST /uploads first")
+
+// UploadImageHandler stores an image sent as the "file" field of a multipart form.
+// The image is re-encoded without metadata, scaled down to at most 2048 pixels on
+// its longest side and stored with a 400 pixel thumbnail. The returned url is what
+// product, gig and profile requests refer to the image by.
+// Endpoint: POST /uploads
+func UploadImageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != http.MethodPost {
+		WriteJSONError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userIDStr, ok := r.Context().Value(userIDKey).(string)
+	if !ok || userIDStr == "" {
+		WriteJSONError(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+	userID, err := primitive.ObjectIDFromHex(userIDStr)
+	if err != nil {
+		WriteJSONError(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	allowed, retryAfter, err := uploadLimit.allow(ctx, userIDStr)
+	if err != nil {
+		log.Printf("Error checking upload rate limit: %v", err)
+		WriteJSONError(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		writeTooManyRequests(w, "Too many uploads.", retryAfter)
+		return
+	}
+
+	// Leave room for the multipart framing around the file.
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes+64<<10)
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			WriteJSONError(w, "Image must be at most 10 MB", http.StatusRequestEntityTooLarge)
+			return
+		}
+		WriteJSONError(w, "Expected an image in the \"file\" form field", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxUploadBytes+1))
+	if err != nil {
+		WriteJSONError(w, "Error reading image", http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxUploadBytes {
+		WriteJSONError(w, "Image must be at most 10 MB", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	full, thumbnail, err := imaging.Process(data, imaging.DefaultOptions())
+	switch {
+	case errors.Is(err, imaging.ErrUnsupportedFormat):
+		WriteJSONError(w, "Only JPEG, PNG and GIF images are supported", http.StatusUnsupportedMediaType)
+		return
+	case errors.Is(err, imaging.ErrTooManyPixels):
+		WriteJSONError(w, "Image dimensions are too large", http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		WriteJSONError(w, "Invalid image file", http.StatusBadRequest)
+		return
+	}
+
+	// Keys never change, so URLs stay valid for as long as the upload exists.
+	uploadID := primitive.NewObjectID()
+	prefix := "uploads/" + userID.Hex() + "/" + uploadID.Hex()
+	store := storage.Default()
+	upload := models.Upload{
+		ID:           uploadID,
+		UserID:       userID,
+		Key:          prefix + full.Extension(),
+		ThumbnailKey: prefix + "_thumb" + thumbnail.Extension(),
+		ContentType:  full.ContentType,
+		Width:        full.Width,
+		Height:       full.Height,
+		Size:         int64(len(full.Data)),
+	}
+	upload.URL = store.URL(upload.Key)
+	upload.ThumbnailURL = store.URL(upload.ThumbnailKey)
+
+	if err := store.Put(ctx, upload.Key, full.Data, full.ContentType); err != nil {
+		log.Printf("Error storing upload: %v", err)
+		WriteJSONError(w, "Error storing image", http.StatusInternalServerError)
+		return
+	}
+	if err := store.Put(ctx, upload.ThumbnailKey, thumbnail.Data, thumbnail.ContentType); err != nil {
+		log.Printf("Error storing thumbnail: %v", err)
+		deleteUploadBlobs(ctx, upload)
+		WriteJSONError(w, "Error storing image", http.StatusInternalServerError)
+		return
+	}
+	if err := db.CreateUpload(ctx, &upload); err != nil {
+		log.Printf("Error recording upload: %v", err)
+		deleteUploadBlobs(ctx, upload)
+		WriteJSONError(w, "Error storing image", http.StatusInternalServerError)
+		return
+	}
+
+	WriteJSON(w, upload, http.StatusCreated)
+}
+
+// ServeMediaHandler serves stored images. Blobs are immutable, so they can be
+// cached for good.
+// Endpoint: GET /media/{key}
+func ServeMediaHandler(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+	if !storage.ValidKey(key) {
+		http.NotFound(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	blob, info, err := storage.Default().Open(ctx, key)
+	if err == storage.ErrNotFound || err == storage.ErrInvalidKey {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		log.Printf("Error opening media %s: %v", key, err)
+		http.Error(w, "Error fetching media", http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if info.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	if !info.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if _, err := io.Copy(w, blob); err != nil {
+		log.Printf("Error sending media %s: %v", key, err)
+	}
+}
+
+// validateImageRefs checks that every reference in refs is the URL of an image
+// the user uploaded. References in allowed, such as the images a listing already
+// had before uploads went through this service, are accepted as they are.
+func validateImageRefs(ctx context.Context, userID primitive.ObjectID, refs []string, allowed []string) error {
+	known := make(map[string]bool, len(allowed))
+	for _, ref := range allowed {
+		known[ref] = true
+	}
+	var pending []string
+	for _, ref := range refs {
+		if !known[ref] {
+			pending = append(pending, ref)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	uploads, err := db.FindUploads(ctx, bson.M{"userId": userID, "url": bson.M{"$in": pending}})
+	if err != nil {
+		return err
+	}
+	for _, upload := range uploads {
+		known[upload.URL] = true
+	}
+	for _, ref := range pending {
+		if !known[ref] {
+			return errInvalidImageRef
+		}
+	}
+	return nil
+}
+
+// defaultLegacyImageURLPrefixes is used when LEGACY_IMAGE_URL_PREFIXES is not set:
+// the Cloudinary folder the app uploaded to before this service existed.
+const defaultLegacyImageURLPrefixes = "https://res.cloudinary.com/ds0zpfht9/"
+
+// legacyImageRefs returns the refs that point to where clients stored images
+// before uploads went through this service, as configured by the comma-separated
+// LEGACY_IMAGE_URL_PREFIXES. They can be passed to validateImageRefs as allowed.
+func legacyImageRefs(refs []string) []string {
+	prefixes := os.Getenv("LEGACY_IMAGE_URL_PREFIXES")
+	if prefixes == "" {
+		prefixes = defaultLegacyImageURLPrefixes
+	}
+	var legacy []string
+	for _, ref := range refs {
+		for _, prefix := range strings.Split(prefixes, ",") {
+			if prefix = strings.TrimSpace(prefix); prefix != "" && strings.HasPrefix(ref, prefix) {
+				legacy = append(legacy, ref)
+				break
+			}
+		}
+	}
+	return legacy
+}
+
+// writeImageRefError responds to a failed validateImageRefs.
+func writeImageRefError(w http.ResponseWriter, err error) {
+	if err == errInvalidImageRef {
+		WriteJSONError(w, "Images must be uploaded through POST /uploads first", http.StatusBadRequest)
+		return
+	}
+	log.Printf("Error validating image references: %v", err)
+	WriteJSONError(w, "Error validating images", http.StatusInternalServerError)
+}
+
+// releaseImages deletes the uploads of a user among refs that no product, gig or
+// profile refers to anymore, such as the images of a deleted listing. Relisted
+// products share their images with the original, so those are kept while either
+// exists. It is best effort: failures are logged and leave the files behind.
+func releaseImages(ctx context.Context, userID primitive.ObjectID, refs []string) {
+	if len(refs) == 0 {
+		return
+	}
+	uploads, err := db.FindUploads(ctx, bson.M{"userId": userID, "url": bson.M{"$in": refs}})
+	if err != nil {
+		log.Printf("Error finding uploads to release: %v", err)
+		return
+	}
+	for _, upload := range uploads {
+		inUse, err := imageInUse(ctx, upload.URL)
+		if err != nil {
+			log.Printf("Error checking references to upload %s: %v", upload.ID.Hex(), err)
+			continue
+		}
+		if inUse {
+			continue
+		}
+		if err := db.DeleteUploads(ctx, bson.M{"_id": upload.ID}); err != nil {
+			log.Printf("Error deleting upload %s: %v", upload.ID.Hex(), err)
+			continue
+		}
+		deleteUploadBlobs(ctx, upload)
+	}
+}
+
+// imageInUse reports whether a product, gig or profile refers to the image url.
+func imageInUse(ctx context.Context, url string) (bool, error) {
+	refs := map[string]bson.M{
+		"products": {"images": url},
+		"gigs":     {"images": url},
+		"users":    {"profilePic": url},
+	}
+	for colName, filter := range refs {
+		n, err := db.GetCollection("gridlyapp", colName).CountDocuments(ctx, filter, options.Count().SetLimit(1))
+		if err != nil {
+			return false, err
+		}
+		if n > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// deleteUploadBlobs removes the stored files of an upload.
+func deleteUploadBlobs(ctx context.Context, upload models.Upload) {
+	store := storage.Default()
+	for _, key := range []string{upload.Key, upload.ThumbnailKey} {
+		if err := store.Delete(ctx, key); err != nil {
+			log.Printf("Error deleting blob %s: %v", key, err)
+		}
+	}
+}
@@ -11,12 +11,10 @@ import (
 	"time"
 
 	"Thegridproduct/backend/db"
-	"Thegridproduct/backend/models"
 
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -56,37 +54,18 @@ func GetUserHandler(w http.ResponseWriter, r *http.Request) {
 
 	findOptions := options.FindOne().SetProjection(projection)
 
-	var user models.User
-
-	// Try to fetch user from university_users collection
-	universityUsersCollection := db.GetCollection("gridlyapp", "university_users")
-	err = universityUsersCollection.FindOne(ctx, bson.M{"_id": userID}, findOptions).Decode(&user)
-	if err == nil {
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(user)
+	user, err := db.Users.GetByID(ctx, userID, findOptions)
+	if err == db.ErrUserNotFound || (err == nil && user.DeletedAt != nil) {
+		WriteJSONError(w, "User not found", http.StatusNotFound)
 		return
-	} else if err != mongo.ErrNoDocuments {
-		log.Printf("Error fetching user from university_users: %v", err)
+	} else if err != nil {
+		log.Printf("Error fetching user: %v", err)
 		WriteJSONError(w, "Error fetching user data", http.StatusInternalServerError)
 		return
 	}
 
-	// If not found, try to fetch user from highschool_users collection
-	highSchoolUsersCollection := db.GetCollection("gridlyapp", "highschool_users")
-	err = highSchoolUsersCollection.FindOne(ctx, bson.M{"_id": userID}, findOptions).Decode(&user)
-	if err == nil {
-		// User found in highschool_users collection
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(user)
-		return
-	} else if err != mongo.ErrNoDocuments {
-		log.Printf("Error fetching user from highschool_users: %v", err)
-		WriteJSONError(w, "Error fetching user data", http.StatusInternalServerError)
-		return
-	}
-
-	// User not found in either collection
-	WriteJSONError(w, "User not found", http.StatusNotFound)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(user)
 }
 
 // GetPublicUserHandler fetches a user's public details by ID, including profilePic and Grids, without requiring authentication.
@@ -120,41 +99,25 @@ func GetPublicUserHandler(w http.ResponseWriter, r *http.Request) {
 		"institution": 1,
 		"studentType": 1,
 		"grids":       1, // ✅ Fetching Grids
+		"deletedAt":   1, // Needed to hide accounts scheduled for deletion
 	}
 
 	findOptions := options.FindOne().SetProjection(projection)
 
-	var user models.User
-
-	// Try to fetch user from university_users collection
-	universityUsersCollection := db.GetCollection("gridlyapp", "university_users")
-	err = universityUsersCollection.FindOne(ctx, bson.M{"_id": userID}, findOptions).Decode(&user)
-	if err == nil {
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(user)
+	user, err := db.Users.GetByID(ctx, userID, findOptions)
+	if err == db.ErrUserNotFound || (err == nil && user.DeletedAt != nil) {
+		// Accounts scheduled for deletion are no longer public; deletedAt stays nil
+		// on the ones we return, so it is left out of the response.
+		WriteJSONError(w, "User not found", http.StatusNotFound)
 		return
-	} else if err != mongo.ErrNoDocuments {
-		log.Printf("Error fetching user from university_users: %v", err)
+	} else if err != nil {
+		log.Printf("Error fetching user: %v", err)
 		WriteJSONError(w, "Error fetching user data", http.StatusInternalServerError)
 		return
 	}
 
-	// If not found, try to fetch user from highschool_users collection
-	highSchoolUsersCollection := db.GetCollection("gridlyapp", "highschool_users")
-	err = highSchoolUsersCollection.FindOne(ctx, bson.M{"_id": userID}, findOptions).Decode(&user)
-	if err == nil {
-		// User found in highschool_users collection
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(user)
-		return
-	} else if err != mongo.ErrNoDocuments {
-		log.Printf("Error fetching user from highschool_users: %v", err)
-		WriteJSONError(w, "Error fetching user data", http.StatusInternalServerError)
-		return
-	}
-
-	// User not found in either collection
-	WriteJSONError(w, "User not found", http.StatusNotFound)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(user)
 }
 
 func StorePushTokenHandler(w http.ResponseWriter, r *http.Request) {
@@ -184,58 +147,25 @@ func StorePushTokenHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	universityUsersCollection := db.GetCollection("gridlyapp", "university_users")
-	highSchoolUsersCollection := db.GetCollection("gridlyapp", "highschool_users")
-
 	// Define the update operation
 	update := bson.M{"$set": bson.M{"expoPushToken": req.ExpoPushToken}}
-	opts := options.Update().SetUpsert(true)
-
-	// First, check if the user exists in university_users
-	var universityUser bson.M
-	err = universityUsersCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&universityUser)
-	if err == nil {
-		// User exists in university_users, update them there
-		_, err = universityUsersCollection.UpdateOne(ctx, bson.M{"_id": userID}, update, opts)
-		if err != nil {
-			log.Printf("Error updating push token in university_users: %v", err)
-			http.Error(w, "Failed to update push token", http.StatusInternalServerError)
-			return
-		}
-		log.Printf("Push token updated successfully in university_users for user %s", req.UserID)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Push token stored successfully"})
-		return
-	}
 
-	// If not found in university_users, check highschool_users
-	var highSchoolUser bson.M
-	err = highSchoolUsersCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&highSchoolUser)
-	if err == nil {
-		// User exists in highschool_users, update them there
-		_, err = highSchoolUsersCollection.UpdateOne(ctx, bson.M{"_id": userID}, update, opts)
-		if err != nil {
-			log.Printf("Error updating push token in highschool_users: %v", err)
-			http.Error(w, "Failed to update push token", http.StatusInternalServerError)
-			return
-		}
-		log.Printf("Push token updated successfully in highschool_users for user %s", req.UserID)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Push token stored successfully"})
+	err = db.Users.Update(ctx, userID, update)
+	if err == db.ErrUserNotFound {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error updating push token: %v", err)
+		http.Error(w, "Failed to update push token", http.StatusInternalServerError)
 		return
 	}
 
-	// If user is found in neither collection
-	http.Error(w, "User not found in any collection", http.StatusNotFound)
+	log.Printf("Push token updated successfully for user %s", req.UserID)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Push token stored successfully"})
 }
-func IncrementUserGrids(userID primitive.ObjectID, studentType string) error {
-	// Determine the correct collection based on student type.
-	var collectionName string
-	if studentType == StudentTypeUniversity {
-		collectionName = "university_users"
-	} else {
-		collectionName = "highschool_users"
-	}
-	userCollection := db.GetCollection("gridlyapp", collectionName)
 
+// IncrementUserGrids awards the user a random number of grids.
+func IncrementUserGrids(userID primitive.ObjectID) error {
 	// Generate a random increment between 4 and 10 inclusive.
 	// rand.Intn(n) returns a value in [0, n), so use rand.Intn(7) + 4.
 	increment := rand.Intn(7) + 4
@@ -245,7 +175,7 @@ func IncrementUserGrids(userID primitive.ObjectID, studentType string) error {
 
 	// Use the $inc operator to increment the grids field.
 	update := bson.M{"$inc": bson.M{"grids": increment}}
-	_, err := userCollection.UpdateOne(ctx, bson.M{"_id": userID}, update)
+	err := db.Users.Update(ctx, userID, update)
 	if err != nil {
 		log.Printf("Error incrementing grids for user %s: %v", userID.Hex(), err)
 	}
@@ -2,7 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"log"
+	"net"
 	"net/http"
+	"os"
+	"strings"
+	"sync"
 )
 
 // WriteJSONError writes a standardized JSON error response.
@@ -18,3 +23,85 @@ func WriteJSON(w http.ResponseWriter, payload interface{}, statusCode int) {
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(payload)
 }
+
+// trustedProxies are the proxies allowed to report the caller's address in
+// X-Forwarded-For, read once from TRUSTED_PROXIES: a comma-separated list of IPs
+// or CIDR ranges, e.g. "10.0.0.0/8,127.0.0.1".
+var (
+	trustedProxiesOnce sync.Once
+	trustedProxies     []*net.IPNet
+)
+
+// parseTrustedProxies parses a TRUSTED_PROXIES value, skipping invalid entries.
+func parseTrustedProxies(value string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Printf("Ignoring invalid TRUSTED_PROXIES entry %q: %v", entry, err)
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+// isTrustedProxy reports whether ip belongs to one of the trusted proxies.
+func isTrustedProxy(ip string) bool {
+	trustedProxiesOnce.Do(func() {
+		trustedProxies = parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+	})
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, ipNet := range trustedProxies {
+		if ipNet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the caller's IP address, used to key the per-IP throttles.
+// X-Forwarded-For is only believed when the connection comes from a trusted
+// proxy, and then read from the right: every trusted proxy appends the address
+// it received the request from, so the right-most entry that is not a trusted
+// proxy is the caller. Entries to its left are whatever the client sent.
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	if !isTrustedProxy(ip) {
+		return ip
+	}
+
+	var hops []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			// Not an address a proxy would write; stop at the last known-good one.
+			break
+		}
+		ip = hop
+		if !isTrustedProxy(hop) {
+			break
+		}
+	}
+	return ip
+}
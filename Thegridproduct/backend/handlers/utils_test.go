@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+func setTrustedProxies(t *testing.T, value string) {
+	t.Helper()
+	trustedProxiesOnce.Do(func() {})
+	previous := trustedProxies
+	trustedProxies = parseTrustedProxies(value)
+	t.Cleanup(func() { trustedProxies = previous })
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		proxies    string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"direct", "", "203.0.113.7:4000", nil, "203.0.113.7"},
+		{"header ignored without trusted proxies", "", "203.0.113.7:4000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"header ignored from untrusted peer", "10.0.0.0/8", "203.0.113.7:4000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy", "10.0.0.0/8", "10.1.2.3:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed entries left of the caller", "10.0.0.0/8", "10.1.2.3:4000", []string{"1.1.1.1, 2.2.2.2, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.0/8,192.0.2.1", "10.1.2.3:4000", []string{"6.6.6.6, 198.51.100.1, 192.0.2.1"}, "198.51.100.1"},
+		{"repeated headers", "10.0.0.0/8", "10.1.2.3:4000", []string{"6.6.6.6", "198.51.100.1"}, "198.51.100.1"},
+		{"garbage from the client", "10.0.0.0/8", "10.1.2.3:4000", []string{"not-an-ip"}, "10.1.2.3"},
+		{"single trusted ip", "127.0.0.1", "127.0.0.1:4000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"ipv6 peer", "", "[2001:db8::1]:4000", []string{"198.51.100.1"}, "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTrustedProxies(t, tt.proxies)
+			r := httptest.NewRequest("POST", "/login", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if got := clientIP(r); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// A client rotating X-Forwarded-For values must keep hitting the same per-IP
+// counter, or the IP throttles could be reset at will.
+func TestClientIPSpoofedHeaderDoesNotResetLimit(t *testing.T) {
+	for _, proxies := range []string{"", "10.0.0.0/8"} {
+		setTrustedProxies(t, proxies)
+		remoteAddr := "203.0.113.7:4000"
+		if proxies != "" {
+			remoteAddr = "10.1.2.3:4000"
+		}
+
+		limit := verificationEmailIPLimit.limit
+		counts := map[string]int{}
+		allowed := 0
+		for i := 0; i < limit+5; i++ {
+			r := httptest.NewRequest("POST", "/signup", nil)
+			r.RemoteAddr = remoteAddr
+			spoofed := fmt.Sprintf("198.18.0.%d", i)
+			if proxies != "" {
+				// The proxy appends the real caller after the spoofed value.
+				r.Header.Set("X-Forwarded-For", spoofed+", 203.0.113.7")
+			} else {
+				r.Header.Set("X-Forwarded-For", spoofed)
+			}
+			key := throttleKey(verificationEmailIPLimit.scope, clientIP(r))
+			counts[key]++
+			if counts[key] <= limit {
+				allowed++
+			}
+		}
+		if len(counts) != 1 || allowed != limit {
+			t.Errorf("proxies %q: %d keys, %d requests allowed; want 1 key and %d allowed", proxies, len(counts), allowed, limit)
+		}
+	}
+}
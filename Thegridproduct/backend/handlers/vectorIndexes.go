@@ -0,0 +1,497 @@
+// handlers/vectorIndexes.go
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"Thegridproduct/backend/bm25"
+	"Thegridproduct/backend/db"
+	"Thegridproduct/backend/embeddings"
+	"Thegridproduct/backend/models"
+	"Thegridproduct/backend/realtime"
+	"Thegridproduct/backend/vectorindex"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// listingMeta is what the vector indexes know about a listing to pre-filter search
+// by campus visibility. Everything else (status, expiry, requests) is checked
+// against MongoDB for the few candidates the index returns.
+type listingMeta struct {
+	owner      primitive.ObjectID
+	university string
+	reach      string // Product availability or gig campusPresence
+}
+
+type listingIndex = vectorindex.Index[primitive.ObjectID, listingMeta]
+type keywordIndex = bm25.Index[primitive.ObjectID, listingMeta]
+
+// The search indexes of products and gigs. They are nil until first built, and
+// searches fall back to scanning MongoDB meanwhile.
+var (
+	productVectors atomic.Pointer[listingIndex]
+	gigVectors     atomic.Pointer[listingIndex]
+	gigKeywords    atomic.Pointer[keywordIndex]
+)
+
+// searchSource is what the search indexes of a collection are built from:
+// listings that can show up in search, with an embedding from the current model
+// for the vector index.
+type searchSource struct {
+	index    *atomic.Pointer[listingIndex]
+	keywords *atomic.Pointer[keywordIndex] // nil without keyword search
+	visible  bson.M
+
+	// mu orders writes against the swap of a rebuilt index. While an index is
+	// being rebuilt its writes are journaled too, and replayed into the new index
+	// before it replaces the old one, so none are lost.
+	mu             sync.Mutex
+	vectorJournal  []func(*listingIndex)
+	keywordJournal []func(*keywordIndex)
+}
+
+var vectorIndexSources = map[string]*searchSource{
+	"products": {index: &productVectors, visible: bson.M{"status": "inshop", "expired": false, "ownerDeleted": bson.M{"$ne": true}}},
+	"gigs":     {index: &gigVectors, keywords: &gigKeywords, visible: bson.M{"status": "active", "expired": false, "ownerDeleted": bson.M{"$ne": true}}},
+}
+
+// writeVectors applies op to the vector index, and to its replacement if one is
+// being built.
+func (s *searchSource) writeVectors(op func(*listingIndex)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if index := s.index.Load(); index != nil {
+		op(index)
+	}
+	if s.vectorJournal != nil {
+		s.vectorJournal = append(s.vectorJournal, op)
+	}
+}
+
+// writeKeywords applies op to the keyword index, and to its replacement if one is
+// being built.
+func (s *searchSource) writeKeywords(op func(*keywordIndex)) {
+	if s.keywords == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if index := s.keywords.Load(); index != nil {
+		op(index)
+	}
+	if s.keywordJournal != nil {
+		s.keywordJournal = append(s.keywordJournal, op)
+	}
+}
+
+// StartVectorIndexes builds the product and gig search indexes in the background
+// and rebuilds them every interval. Writes keep the indexes in sync in between,
+// on every instance: each instance announces its writes on the realtime pub/sub
+// and applies those of the others. The rebuild picks up changes made outside the
+// server, such as a backfill run, or announcements an instance missed, and drops
+// the tombstones of removed entries.
+func StartVectorIndexes(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	go followSearchIndexUpdates(ctx)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			for colName := range vectorIndexSources {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+				start := time.Now()
+				size, err := rebuildVectorIndex(ctx, colName)
+				cancel()
+				if err != nil {
+					log.Printf("Error building %s vector index: %v", colName, err)
+				} else {
+					log.Printf("Built %s vector index with %d entries in %s", colName, size, time.Since(start).Round(time.Millisecond))
+				}
+
+				if vectorIndexSources[colName].keywords == nil {
+					continue
+				}
+				ctx, cancel = context.WithTimeout(context.Background(), 5*time.Minute)
+				size, err = rebuildKeywordIndex(ctx, colName)
+				cancel()
+				if err != nil {
+					log.Printf("Error building %s keyword index: %v", colName, err)
+				} else {
+					log.Printf("Built %s keyword index with %d entries", colName, size)
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		cancel()
+	}
+}
+
+// listingDoc holds the fields of a listing the vector index needs.
+type listingDoc struct {
+	ID             primitive.ObjectID `bson:"_id"`
+	UserID         primitive.ObjectID `bson:"userId"`
+	University     string             `bson:"university"`
+	Availability   string             `bson:"availability"`
+	CampusPresence string             `bson:"campusPresence"`
+	Embeddings     []float32          `bson:"embeddings"`
+}
+
+// listingDocProjection loads only the fields of listingDoc.
+var listingDocProjection = bson.M{
+	"userId":         1,
+	"university":     1,
+	"availability":   1,
+	"campusPresence": 1,
+	"embeddings":     1,
+}
+
+// meta is the campus visibility of a listing of colName.
+func (doc listingDoc) meta(colName string) listingMeta {
+	meta := listingMeta{owner: doc.UserID, university: doc.University, reach: doc.Availability}
+	if colName == "gigs" {
+		meta.reach = doc.CampusPresence
+	}
+	return meta
+}
+
+// rebuildVectorIndex loads the vectors of a collection into a new index and swaps
+// it in. It returns the number of entries.
+func rebuildVectorIndex(ctx context.Context, colName string) (int, error) {
+	source := vectorIndexSources[colName]
+	embedder := embeddings.Default()
+
+	source.mu.Lock()
+	source.vectorJournal = []func(*listingIndex){}
+	source.mu.Unlock()
+	defer func() {
+		source.mu.Lock()
+		source.vectorJournal = nil
+		source.mu.Unlock()
+	}()
+
+	filter := bson.M{"$and": []bson.M{source.visible, embeddings.CurrentFilter(embedder)}}
+	cursor, err := db.GetCollection("gridlyapp", colName).Find(ctx, filter, options.Find().SetProjection(listingDocProjection))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	index := vectorindex.New[primitive.ObjectID, listingMeta](embedder.Dimensions(), vectorindex.DefaultOptions())
+	for cursor.Next(ctx) {
+		var doc listingDoc
+		if err := cursor.Decode(&doc); err != nil {
+			log.Printf("Error decoding %s vector: %v", colName, err)
+			continue
+		}
+		if err := index.Add(doc.ID, doc.Embeddings, doc.meta(colName)); err != nil {
+			log.Printf("Skipping %s %s in vector index: %v", colName, doc.ID.Hex(), err)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return 0, err
+	}
+
+	source.mu.Lock()
+	for _, op := range source.vectorJournal {
+		op(index)
+	}
+	source.index.Store(index)
+	source.mu.Unlock()
+	return index.Len(), nil
+}
+
+// rebuildKeywordIndex loads the text of a collection's visible listings into a new
+// keyword index and swaps it in. It returns the number of entries. Listings are
+// keyword searchable as soon as they are posted, before they have an embedding.
+// Only gigs have a keyword index so far.
+func rebuildKeywordIndex(ctx context.Context, colName string) (int, error) {
+	source := vectorIndexSources[colName]
+
+	source.mu.Lock()
+	source.keywordJournal = []func(*keywordIndex){}
+	source.mu.Unlock()
+	defer func() {
+		source.mu.Lock()
+		source.keywordJournal = nil
+		source.mu.Unlock()
+	}()
+
+	cursor, err := db.GetCollection("gridlyapp", colName).Find(ctx, source.visible,
+		options.Find().SetProjection(bson.M{"embeddings": 0}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	index := bm25.New[primitive.ObjectID, listingMeta]()
+	for cursor.Next(ctx) {
+		var gig models.Gig
+		if err := cursor.Decode(&gig); err != nil {
+			log.Printf("Error decoding %s text: %v", colName, err)
+			continue
+		}
+		index.Add(gig.ID, gigKeywordText(gig), gigMeta(gig))
+	}
+	if err := cursor.Err(); err != nil {
+		return 0, err
+	}
+
+	source.mu.Lock()
+	for _, op := range source.keywordJournal {
+		op(index)
+	}
+	source.keywords.Store(index)
+	source.mu.Unlock()
+	return index.Len(), nil
+}
+
+// indexGigKeywords adds or replaces a gig in the keyword index.
+func indexGigKeywords(gig models.Gig) {
+	addGigKeywords(gig)
+	announceIndexUpdate("gigs", gig.ID)
+}
+
+func addGigKeywords(gig models.Gig) {
+	text, meta := gigKeywordText(gig), gigMeta(gig)
+	vectorIndexSources["gigs"].writeKeywords(func(index *keywordIndex) {
+		index.Add(gig.ID, text, meta)
+	})
+}
+
+// gigMeta is the campus visibility of a gig.
+func gigMeta(gig models.Gig) listingMeta {
+	return listingMeta{owner: gig.UserID, university: gig.University, reach: gig.CampusPresence}
+}
+
+// indexListingVector adds or replaces a listing in the vector index of colName.
+func indexListingVector(colName string, id primitive.ObjectID, vector []float32, meta listingMeta) {
+	addListingVector(colName, id, vector, meta)
+	announceIndexUpdate(colName, id)
+}
+
+func addListingVector(colName string, id primitive.ObjectID, vector []float32, meta listingMeta) {
+	vectorIndexSources[colName].writeVectors(func(index *listingIndex) {
+		if err := index.Add(id, vector, meta); err != nil {
+			log.Printf("Error indexing %s %s: %v", colName, id.Hex(), err)
+		}
+	})
+}
+
+// updateListingMeta records a change of the campus visibility of a listing.
+func updateListingMeta(colName string, id primitive.ObjectID, meta listingMeta) {
+	source := vectorIndexSources[colName]
+	source.writeVectors(func(index *listingIndex) { index.SetMeta(id, meta) })
+	source.writeKeywords(func(index *keywordIndex) { index.SetMeta(id, meta) })
+	announceIndexUpdate(colName, id)
+}
+
+// removeListingVectors drops listings from the search indexes of colName.
+func removeListingVectors(colName string, ids ...primitive.ObjectID) {
+	dropListings(colName, ids...)
+	announceIndexUpdate(colName, ids...)
+}
+
+func dropListings(colName string, ids ...primitive.ObjectID) {
+	source := vectorIndexSources[colName]
+	source.writeVectors(func(index *listingIndex) {
+		for _, id := range ids {
+			index.Remove(id)
+		}
+	})
+	source.writeKeywords(func(index *keywordIndex) {
+		for _, id := range ids {
+			index.Remove(id)
+		}
+	})
+}
+
+// searchIndexTopic is the realtime topic instances announce their index writes on.
+const searchIndexTopic = "search-index"
+
+// searchIndexOrigin tells this instance's announcements apart from the others'.
+var searchIndexOrigin = primitive.NewObjectID().Hex()
+
+// searchIndexUpdate announces that listings changed. It only names them: the
+// other instances load their current state from MongoDB, so announcements that
+// arrive out of order still leave every index right.
+type searchIndexUpdate struct {
+	Origin     string               `json:"origin"`
+	Collection string               `json:"collection"`
+	IDs        []primitive.ObjectID `json:"ids"`
+}
+
+// announceIndexUpdate tells the other instances to refresh listings of colName
+// in their search indexes. It does not wait for the announcement to go out.
+func announceIndexUpdate(colName string, ids ...primitive.ObjectID) {
+	if len(ids) == 0 {
+		return
+	}
+	event, err := realtime.NewEvent("search_index", searchIndexUpdate{Origin: searchIndexOrigin, Collection: colName, IDs: ids})
+	if err != nil {
+		log.Printf("Error creating search index update: %v", err)
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := realtime.Default().Publish(ctx, searchIndexTopic, event); err != nil {
+			log.Printf("Error announcing %s index update: %v", colName, err)
+		}
+	}()
+}
+
+// followSearchIndexUpdates applies the index writes announced by other instances
+// until ctx is done. Updates sent while it is not subscribed are picked up by the
+// next rebuild.
+func followSearchIndexUpdates(ctx context.Context) {
+	for {
+		events, err := realtime.Default().Subscribe(ctx, searchIndexTopic)
+		if err != nil {
+			log.Printf("Error subscribing to search index updates: %v", err)
+		} else {
+			for event := range events {
+				var update searchIndexUpdate
+				if err := json.Unmarshal(event.Data, &update); err != nil {
+					log.Printf("Error decoding search index update: %v", err)
+					continue
+				}
+				if update.Origin == searchIndexOrigin || vectorIndexSources[update.Collection] == nil {
+					continue
+				}
+				for _, id := range update.IDs {
+					syncCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+					if err := syncListing(syncCtx, update.Collection, id); err != nil {
+						log.Printf("Error refreshing %s %s in search index: %v", update.Collection, id.Hex(), err)
+					}
+					cancel()
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// syncListing brings the search indexes of colName up to date with a listing as
+// stored in MongoDB.
+func syncListing(ctx context.Context, colName string, id primitive.ObjectID) error {
+	source := vectorIndexSources[colName]
+	col := db.GetCollection("gridlyapp", colName)
+
+	raw, err := col.FindOne(ctx, bson.M{"$and": []bson.M{{"_id": id}, source.visible}}).Raw()
+	if err == mongo.ErrNoDocuments {
+		dropListings(colName, id)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var doc listingDoc
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+	current, err := col.CountDocuments(ctx, bson.M{"$and": []bson.M{{"_id": id}, embeddings.CurrentFilter(embeddings.Default())}})
+	if err != nil {
+		return err
+	}
+	if current > 0 {
+		addListingVector(colName, id, doc.Embeddings, doc.meta(colName))
+	} else {
+		source.writeVectors(func(index *listingIndex) { index.Remove(id) })
+	}
+
+	if source.keywords != nil {
+		var gig models.Gig
+		if err := bson.Unmarshal(raw, &gig); err != nil {
+			return err
+		}
+		addGigKeywords(gig)
+	}
+	return nil
+}
+
+// searchListingVectors returns up to k listings of col that match filter, ranked by
+// similarity to query and no less similar than minScore. The index narrows the
+// listings down by campus visibility and similarity; MongoDB then confirms filter
+// for the candidates only. When too few candidates survive, the index is asked for
+// more until it has no more above minScore.
+func searchListingVectors(ctx context.Context, index *listingIndex, col *mongo.Collection, query []float32,
+	visible func(listingMeta) bool, filter bson.M, k int, minScore float64) ([]vectorindex.Result[primitive.ObjectID], error) {
+
+	for n := 4 * k; ; n *= 4 {
+		results, err := index.Search(query, n, visible)
+		if err != nil {
+			return nil, err
+		}
+		exhausted := len(results) < n
+		for i, r := range results {
+			if r.Score < minScore {
+				results, exhausted = results[:i], true
+				break
+			}
+		}
+		if len(results) == 0 {
+			return nil, nil
+		}
+
+		ids := make([]primitive.ObjectID, len(results))
+		for i, r := range results {
+			ids[i] = r.ID
+		}
+		cursor, err := col.Find(ctx,
+			bson.M{"$and": []bson.M{filter, {"_id": bson.M{"$in": ids}}}},
+			options.Find().SetProjection(bson.M{"_id": 1}),
+		)
+		if err != nil {
+			return nil, err
+		}
+		var docs []struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.All(ctx, &docs); err != nil {
+			return nil, err
+		}
+		matching := make(map[primitive.ObjectID]bool, len(docs))
+		for _, doc := range docs {
+			matching[doc.ID] = true
+		}
+
+		kept := results[:0]
+		for _, r := range results {
+			if matching[r.ID] {
+				kept = append(kept, r)
+			}
+		}
+		if len(kept) >= k || exhausted || n >= index.Len() {
+			if len(kept) > k {
+				kept = kept[:k]
+			}
+			return kept, nil
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Package imaging prepares uploaded pictures for storage. Images are decoded and
+// encoded again, which drops every metadata block (EXIF, GPS, XMP, comments) the
+// original carried; the EXIF orientation is applied to the pixels first so photos
+// still show the right way up. Large images are scaled down and a thumbnail is
+// generated alongside.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+var (
+	// ErrUnsupportedFormat is returned for anything but JPEG, PNG and GIF images.
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+
+	// ErrTooManyPixels is returned for images whose decoded size exceeds
+	// Options.MaxPixels, which guards against decompression bombs.
+	ErrTooManyPixels = errors.New("image dimensions too large")
+)
+
+// Options controls Process.
+type Options struct {
+	MaxDimension       int // longest side of the stored image
+	ThumbnailDimension int // longest side of the thumbnail
+	MaxPixels          int // largest width*height accepted for decoding
+	JPEGQuality        int
+}
+
+// DefaultOptions are suitable for listing photos and profile pictures.
+func DefaultOptions() Options {
+	return Options{
+		MaxDimension:       2048,
+		ThumbnailDimension: 400,
+		MaxPixels:          50_000_000,
+		JPEGQuality:        85,
+	}
+}
+
+// Image is an encoded image ready to be stored.
+type Image struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Extension returns the file extension for the image's content type.
+func (img Image) Extension() string {
+	if img.ContentType == "image/png" {
+		return ".png"
+	}
+	return ".jpg"
+}
+
+// DetectContentType sniffs the content type of an image from its first bytes,
+// ignoring what the client claimed. It returns ErrUnsupportedFormat for anything
+// Process cannot handle.
+func DetectContentType(data []byte) (string, error) {
+	switch contentType := http.DetectContentType(data); contentType {
+	case "image/jpeg", "image/png", "image/gif":
+		return contentType, nil
+	default:
+		return "", ErrUnsupportedFormat
+	}
+}
+
+// Process decodes an uploaded image and returns it re-encoded without metadata,
+// scaled to fit opts.MaxDimension, together with a thumbnail. JPEG stays JPEG; PNG
+// and GIF (first frame) become PNG so transparency survives.
+func Process(data []byte, opts Options) (full, thumbnail Image, err error) {
+	contentType, err := DetectContentType(data)
+	if err != nil {
+		return Image{}, Image{}, err
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, Image{}, fmt.Errorf("invalid image: %v", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > opts.MaxPixels {
+		return Image{}, Image{}, ErrTooManyPixels
+	}
+
+	var src image.Image
+	switch contentType {
+	case "image/jpeg":
+		src, err = jpeg.Decode(bytes.NewReader(data))
+	case "image/png":
+		src, err = png.Decode(bytes.NewReader(data))
+	case "image/gif":
+		src, err = gif.Decode(bytes.NewReader(data))
+	}
+	if err != nil {
+		return Image{}, Image{}, fmt.Errorf("invalid image: %v", err)
+	}
+
+	rgba := toRGBA(src)
+	if contentType == "image/jpeg" {
+		rgba = orient(rgba, jpegOrientation(data))
+	}
+
+	outputType := "image/png"
+	if contentType == "image/jpeg" {
+		outputType = "image/jpeg"
+	}
+
+	scaled := fit(rgba, opts.MaxDimension)
+	if full, err = encode(scaled, outputType, opts.JPEGQuality); err != nil {
+		return Image{}, Image{}, err
+	}
+	if thumbnail, err = encode(fit(scaled, opts.ThumbnailDimension), outputType, opts.JPEGQuality); err != nil {
+		return Image{}, Image{}, err
+	}
+	return full, thumbnail, nil
+}
+
+func toRGBA(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+	return dst
+}
+
+func encode(img *image.RGBA, contentType string, quality int) (Image, error) {
+	var buf bytes.Buffer
+	var err error
+	if contentType == "image/jpeg" {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return Image{}, fmt.Errorf("error encoding image: %v", err)
+	}
+	b := img.Bounds()
+	return Image{Data: buf.Bytes(), ContentType: contentType, Width: b.Dx(), Height: b.Dy()}, nil
+}
@@ -0,0 +1,151 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func solid(w, h int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = c.R, c.G, c.B, c.A
+	}
+	return img
+}
+
+func TestFitBounds(t *testing.T) {
+	tests := []struct {
+		name         string
+		w, h, limit  int
+		wantW, wantH int
+	}{
+		{"smaller than the limit", 300, 200, 400, 300, 200},
+		{"exactly the limit", 400, 400, 400, 400, 400},
+		{"landscape", 4000, 3000, 2048, 2048, 1536},
+		{"portrait", 3000, 4000, 2048, 1536, 2048},
+		{"square", 1000, 1000, 400, 400, 400},
+		{"odd ratio rounds down", 1001, 333, 400, 400, 133},
+		{"very wide keeps a row", 5000, 2, 400, 400, 1},
+		{"very tall keeps a column", 2, 5000, 400, 1, 400},
+		{"no limit", 5000, 5000, 0, 5000, 5000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := solid(tt.w, tt.h, color.RGBA{10, 20, 30, 255})
+			got := fit(src, tt.limit).Bounds()
+			if got.Dx() != tt.wantW || got.Dy() != tt.wantH {
+				t.Errorf("fit(%dx%d, %d) = %dx%d, want %dx%d", tt.w, tt.h, tt.limit, got.Dx(), got.Dy(), tt.wantW, tt.wantH)
+			}
+			if tt.limit > 0 && (got.Dx() > tt.limit || got.Dy() > tt.limit) {
+				t.Errorf("fit(%dx%d, %d) exceeds the limit", tt.w, tt.h, tt.limit)
+			}
+		})
+	}
+}
+
+func TestDownscaleAverages(t *testing.T) {
+	// Two columns, black and white, average to grey.
+	src := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	src.SetRGBA(0, 0, color.RGBA{0, 0, 0, 255})
+	src.SetRGBA(1, 0, color.RGBA{255, 255, 255, 255})
+
+	got := downscale(src, 1, 1).RGBAAt(0, 0)
+	want := color.RGBA{128, 128, 128, 255}
+	if got != want {
+		t.Errorf("downscale = %v, want %v", got, want)
+	}
+
+	// A solid colour stays the same however it is scaled.
+	c := color.RGBA{200, 100, 50, 255}
+	scaled := downscale(solid(97, 61, c), 13, 7)
+	for y := 0; y < 7; y++ {
+		for x := 0; x < 13; x++ {
+			if got := scaled.RGBAAt(x, y); got != c {
+				t.Fatalf("pixel %d,%d = %v, want %v", x, y, got, c)
+			}
+		}
+	}
+}
+
+func encodeWith(t *testing.T, img image.Image, format string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "png":
+		err = png.Encode(&buf, img)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcess(t *testing.T) {
+	opts := Options{MaxDimension: 200, ThumbnailDimension: 50, MaxPixels: 1_000_000, JPEGQuality: 80}
+	src := solid(400, 100, color.RGBA{0, 128, 255, 255})
+
+	tests := []struct {
+		format   string
+		wantType string
+	}{
+		{"jpeg", "image/jpeg"},
+		{"png", "image/png"},
+		{"gif", "image/png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			full, thumbnail, err := Process(encodeWith(t, src, tt.format), opts)
+			if err != nil {
+				t.Fatalf("Process: %v", err)
+			}
+			if full.ContentType != tt.wantType || thumbnail.ContentType != tt.wantType {
+				t.Errorf("content types = %s, %s; want %s", full.ContentType, thumbnail.ContentType, tt.wantType)
+			}
+			if full.Width != 200 || full.Height != 50 {
+				t.Errorf("full = %dx%d, want 200x50", full.Width, full.Height)
+			}
+			if thumbnail.Width != 50 || thumbnail.Height != 12 {
+				t.Errorf("thumbnail = %dx%d, want 50x12", thumbnail.Width, thumbnail.Height)
+			}
+			decoded, _, err := image.DecodeConfig(bytes.NewReader(full.Data))
+			if err != nil || decoded.Width != full.Width || decoded.Height != full.Height {
+				t.Errorf("stored image decodes to %dx%d, %v", decoded.Width, decoded.Height, err)
+			}
+		})
+	}
+}
+
+func TestProcessRejects(t *testing.T) {
+	opts := Options{MaxDimension: 200, ThumbnailDimension: 50, MaxPixels: 10_000, JPEGQuality: 80}
+
+	if _, _, err := Process([]byte("GIF89a but not really"), opts); err == nil {
+		t.Error("Process accepted a truncated GIF")
+	}
+	if _, _, err := Process([]byte("<svg xmlns='http://www.w3.org/2000/svg'/>"), opts); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("SVG: err = %v, want ErrUnsupportedFormat", err)
+	}
+	big := encodeWith(t, solid(101, 100, color.RGBA{A: 255}), "png")
+	if _, _, err := Process(big, opts); !errors.Is(err, ErrTooManyPixels) {
+		t.Errorf("101x100 with MaxPixels 10000: err = %v, want ErrTooManyPixels", err)
+	}
+}
+
+func TestExtension(t *testing.T) {
+	if got := (Image{ContentType: "image/png"}).Extension(); got != ".png" {
+		t.Errorf("png extension = %s", got)
+	}
+	if got := (Image{ContentType: "image/jpeg"}).Extension(); got != ".jpg" {
+		t.Errorf("jpeg extension = %s", got)
+	}
+}
@@ -0,0 +1,64 @@
+package imaging
+
+import "image"
+
+// fit scales src down so its longest side is at most limit, keeping the aspect
+// ratio. Smaller images are returned as they are.
+func fit(src *image.RGBA, limit int) *image.RGBA {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	if limit <= 0 || (w <= limit && h <= limit) {
+		return src
+	}
+	dw, dh := limit, h*limit/w
+	if h > w {
+		dw, dh = w*limit/h, limit
+	}
+	if dw < 1 {
+		dw = 1
+	}
+	if dh < 1 {
+		dh = 1
+	}
+	return downscale(src, dw, dh)
+}
+
+// downscale resizes src to dw×dh by averaging the source pixels each destination
+// pixel covers (a box filter), which is cheap and free of aliasing when shrinking.
+// RGBA pixels are alpha-premultiplied, so averaging them is correct for
+// transparent images too.
+func downscale(src *image.RGBA, dw, dh int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, (y+1)*sh/dh
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, (x+1)*sw/dw
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a uint64
+			for sy := y0; sy < y1; sy++ {
+				i := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint64(src.Pix[i])
+					g += uint64(src.Pix[i+1])
+					b += uint64(src.Pix[i+2])
+					a += uint64(src.Pix[i+3])
+					i += 4
+				}
+			}
+			n := uint64((y1 - y0) * (x1 - x0))
+			di := dst.PixOffset(x, y)
+			dst.Pix[di] = uint8((r + n/2) / n)
+			dst.Pix[di+1] = uint8((g + n/2) / n)
+			dst.Pix[di+2] = uint8((b + n/2) / n)
+			dst.Pix[di+3] = uint8((a + n/2) / n)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,78 @@
+// Package mailer sends transactional email. Handlers render a template from the
+// catalog and enqueue the message; a background queue delivers it through the
+// configured Mailer and retries transient failures, so requests never wait on SMTP.
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Message is a single email with a plain-text part and an optional HTML part.
+type Message struct {
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// ErrNoRecipients is returned when a message has nobody to go to.
+var ErrNoRecipients = errors.New("message has no recipients")
+
+// FromEnv builds the Mailer selected by MAIL_DRIVER:
+//
+//	smtp   (default) deliver through SMTP_HOST:SMTP_PORT with SMTP_USER/SMTP_PASS
+//	file   write .eml files to MAIL_OUTBOX_DIR (default "outbox") for local development
+//	memory keep messages in memory, for tests
+//
+// MAIL_FROM overrides the sender address, which defaults to SMTP_USER.
+func FromEnv() (Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = os.Getenv("SMTP_USER")
+	}
+
+	switch driver := os.Getenv("MAIL_DRIVER"); driver {
+	case "", "smtp":
+		m := &SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     os.Getenv("SMTP_PORT"),
+			Username: os.Getenv("SMTP_USER"),
+			Password: os.Getenv("SMTP_PASS"),
+			From:     from,
+		}
+		if m.Host == "" || m.Port == "" || m.Username == "" || m.Password == "" {
+			return nil, errors.New("SMTP_HOST, SMTP_PORT, SMTP_USER and SMTP_PASS must be set for the smtp mail driver")
+		}
+		return m, nil
+	case "file":
+		dir := os.Getenv("MAIL_OUTBOX_DIR")
+		if dir == "" {
+			dir = "outbox"
+		}
+		return NewFileOutbox(dir, from)
+	case "memory":
+		return NewMemoryOutbox(), nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_DRIVER %q", driver)
+	}
+}
+
+// ReportsAddress returns where user reports and feedback are sent, from REPORTS_EMAIL.
+// It falls back to the sender address so reports are never silently dropped.
+func ReportsAddress() string {
+	if addr := os.Getenv("REPORTS_EMAIL"); addr != "" {
+		return addr
+	}
+	if addr := os.Getenv("MAIL_FROM"); addr != "" {
+		return addr
+	}
+	return os.Getenv("SMTP_USER")
+}
@@ -0,0 +1,81 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileOutbox writes every message to an .eml file instead of sending it.
+// Open the files with any mail client to check how an email looks.
+type FileOutbox struct {
+	dir  string
+	from string
+}
+
+// NewFileOutbox creates the outbox directory if needed.
+func NewFileOutbox(dir, from string) (*FileOutbox, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating mail outbox %s: %v", dir, err)
+	}
+	if from == "" {
+		from = "gridly@localhost"
+	}
+	return &FileOutbox{dir: dir, from: from}, nil
+}
+
+func (o *FileOutbox) Send(ctx context.Context, msg Message) error {
+	if len(msg.To) == 0 {
+		return ErrNoRecipients
+	}
+
+	now := time.Now()
+	raw, err := buildMIME(o.from, msg, now)
+	if err != nil {
+		return err
+	}
+
+	recipient := strings.NewReplacer("@", "_at_", "/", "_", "\\", "_").Replace(msg.To[0])
+	name := fmt.Sprintf("%s-%s.eml", now.Format("20060102-150405.000000000"), recipient)
+	path := filepath.Join(o.dir, name)
+	if err := os.WriteFile(path, raw, 0o644); err != nil {
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+
+	log.Printf("Mail to %v written to %s", msg.To, path)
+	return nil
+}
+
+// MemoryOutbox keeps sent messages in memory.
+type MemoryOutbox struct {
+	mu   sync.Mutex
+	sent []Message
+}
+
+// NewMemoryOutbox returns an empty in-memory outbox.
+func NewMemoryOutbox() *MemoryOutbox {
+	return &MemoryOutbox{}
+}
+
+func (o *MemoryOutbox) Send(ctx context.Context, msg Message) error {
+	if len(msg.To) == 0 {
+		return ErrNoRecipients
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.sent = append(o.sent, msg)
+	return nil
+}
+
+// Sent returns a copy of every message sent so far.
+func (o *MemoryOutbox) Sent() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]Message(nil), o.sent...)
+}
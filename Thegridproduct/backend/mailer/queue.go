@@ -0,0 +1,165 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrQueueFull is returned when the send queue cannot take more messages.
+	ErrQueueFull = errors.New("mail queue is full")
+
+	// ErrQueueClosed is returned when enqueueing after the queue was stopped.
+	ErrQueueClosed = errors.New("mail queue is closed")
+)
+
+const (
+	queueSize       = 256
+	maxSendAttempts = 5
+	sendTimeout     = 30 * time.Second
+)
+
+// baseRetryDelay is the wait before the first retry; it doubles after every attempt.
+var baseRetryDelay = 2 * time.Second
+
+// Queue delivers messages in the background, retrying failed sends with
+// exponential backoff.
+type Queue struct {
+	mailer Mailer
+	jobs   chan Message
+	done   chan struct{}
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewQueue starts workers that deliver enqueued messages through m.
+func NewQueue(m Mailer, workers int) *Queue {
+	q := &Queue{
+		mailer: m,
+		jobs:   make(chan Message, queueSize),
+		done:   make(chan struct{}),
+	}
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	return q
+}
+
+// Enqueue schedules a message for delivery without blocking.
+func (q *Queue) Enqueue(msg Message) error {
+	if len(msg.To) == 0 {
+		return ErrNoRecipients
+	}
+
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	select {
+	case q.jobs <- msg:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Stop stops accepting messages and waits for queued ones to be sent, giving up
+// on retries once ctx is done.
+func (q *Queue) Stop(ctx context.Context) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.jobs)
+	q.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		close(q.done)
+		<-finished
+	}
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+	for msg := range q.jobs {
+		q.deliver(msg)
+	}
+}
+
+// deliver sends one message, retrying up to maxSendAttempts times.
+func (q *Queue) deliver(msg Message) {
+	delay := baseRetryDelay
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		err := q.mailer.Send(ctx, msg)
+		cancel()
+		if err == nil {
+			return
+		}
+
+		if attempt == maxSendAttempts || err == ErrNoRecipients {
+			log.Printf("Giving up on email %q to %v after %d attempts: %v", msg.Subject, msg.To, attempt, err)
+			return
+		}
+		log.Printf("Error sending email %q to %v (attempt %d), retrying in %s: %v", msg.Subject, msg.To, attempt, delay, err)
+
+		select {
+		case <-time.After(delay):
+		case <-q.done:
+			log.Printf("Dropping email %q to %v: shutting down", msg.Subject, msg.To)
+			return
+		}
+		delay *= 2
+	}
+}
+
+// defaultQueue is the queue used by the package-level helpers; it is set up by Start.
+var defaultQueue *Queue
+
+// Start sets up the queue used by Enqueue and SendTemplate.
+func Start(m Mailer, workers int) {
+	defaultQueue = NewQueue(m, workers)
+}
+
+// Stop drains the default queue.
+func Stop(ctx context.Context) {
+	if defaultQueue != nil {
+		defaultQueue.Stop(ctx)
+	}
+}
+
+// Enqueue schedules a message on the default queue.
+func Enqueue(msg Message) error {
+	if defaultQueue == nil {
+		return errors.New("mailer not started")
+	}
+	return defaultQueue.Enqueue(msg)
+}
+
+// SendTemplate renders a catalog template and schedules it for the recipients.
+func SendTemplate(name string, data interface{}, to ...string) error {
+	msg, err := Render(name, data)
+	if err != nil {
+		return err
+	}
+	msg.To = to
+	return Enqueue(msg)
+}
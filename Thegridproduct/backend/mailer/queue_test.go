@@ -0,0 +1,148 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyMailer fails its first `failures` sends and records when each attempt was made.
+type flakyMailer struct {
+	mu       sync.Mutex
+	failures int
+	attempts []time.Time
+	sent     []Message
+	delay    time.Duration
+}
+
+func (m *flakyMailer) Send(ctx context.Context, msg Message) error {
+	if m.delay > 0 {
+		time.Sleep(m.delay)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attempts = append(m.attempts, time.Now())
+	if len(m.attempts) <= m.failures {
+		return errors.New("temporary failure")
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func (m *flakyMailer) snapshot() ([]time.Time, []Message) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]time.Time(nil), m.attempts...), append([]Message(nil), m.sent...)
+}
+
+func setRetryDelay(t *testing.T, d time.Duration) {
+	t.Helper()
+	previous := baseRetryDelay
+	baseRetryDelay = d
+	t.Cleanup(func() { baseRetryDelay = previous })
+}
+
+func message(subject string) Message {
+	return Message{To: []string{"sam@example.edu"}, Subject: subject, Text: "hello"}
+}
+
+func TestQueueRetriesWithBackoff(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	setRetryDelay(t, delay)
+	m := &flakyMailer{failures: 2}
+	q := NewQueue(m, 1)
+
+	if err := q.Enqueue(message("retried")); err != nil {
+		t.Fatal(err)
+	}
+	q.Stop(context.Background())
+
+	attempts, sent := m.snapshot()
+	if len(attempts) != 3 || len(sent) != 1 {
+		t.Fatalf("%d attempts and %d sent, want 3 and 1", len(attempts), len(sent))
+	}
+	for i, want := range []time.Duration{delay, 2 * delay} {
+		if gap := attempts[i+1].Sub(attempts[i]); gap < want {
+			t.Errorf("retry %d after %s, want at least %s", i+1, gap, want)
+		}
+	}
+}
+
+func TestQueueGivesUp(t *testing.T) {
+	setRetryDelay(t, time.Millisecond)
+	m := &flakyMailer{failures: 1000}
+	q := NewQueue(m, 1)
+
+	q.Enqueue(message("hopeless"))
+	q.Stop(context.Background())
+
+	if attempts, sent := m.snapshot(); len(attempts) != maxSendAttempts || len(sent) != 0 {
+		t.Errorf("%d attempts and %d sent, want %d and 0", len(attempts), len(sent), maxSendAttempts)
+	}
+}
+
+func TestQueueStopDrains(t *testing.T) {
+	m := &flakyMailer{delay: 5 * time.Millisecond}
+	q := NewQueue(m, 2)
+
+	for i := 0; i < 20; i++ {
+		if err := q.Enqueue(message("queued")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	q.Stop(context.Background())
+
+	if _, sent := m.snapshot(); len(sent) != 20 {
+		t.Errorf("Stop returned after %d of 20 messages were sent", len(sent))
+	}
+	if err := q.Enqueue(message("late")); err != ErrQueueClosed {
+		t.Errorf("Enqueue after Stop = %v, want ErrQueueClosed", err)
+	}
+	q.Stop(context.Background()) // stopping twice is harmless
+}
+
+func TestQueueStopGivesUpOnRetriesWhenContextEnds(t *testing.T) {
+	setRetryDelay(t, time.Hour)
+	m := &flakyMailer{failures: 1000}
+	q := NewQueue(m, 1)
+	q.Enqueue(message("stuck"))
+
+	// Wait for the first attempt so the worker is sleeping before its retry.
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		if attempts, _ := m.snapshot(); len(attempts) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the message was never attempted")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	q.Stop(ctx)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Stop took %s, want it to return soon after its context ended", elapsed)
+	}
+	if attempts, _ := m.snapshot(); len(attempts) != 1 {
+		t.Errorf("%d attempts, want the pending retry dropped", len(attempts))
+	}
+}
+
+func TestQueueRejects(t *testing.T) {
+	q := NewQueue(NewMemoryOutbox(), 0) // no workers, so nothing leaves the queue
+	if err := q.Enqueue(Message{Subject: "nobody"}); err != ErrNoRecipients {
+		t.Errorf("Enqueue without recipients = %v, want ErrNoRecipients", err)
+	}
+	for i := 0; i < queueSize; i++ {
+		if err := q.Enqueue(message("filler")); err != nil {
+			t.Fatalf("Enqueue %d: %v", i, err)
+		}
+	}
+	if err := q.Enqueue(message("overflow")); err != ErrQueueFull {
+		t.Errorf("Enqueue on a full queue = %v, want ErrQueueFull", err)
+	}
+}
@@ -0,0 +1,104 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPMailer sends messages through an SMTP server using PLAIN auth.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send delivers the message. net/smtp has no context support, so ctx is only
+// checked before dialing.
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if len(msg.To) == 0 {
+		return ErrNoRecipients
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	raw, err := buildMIME(m.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	auth := smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	if err := smtp.SendMail(m.Host+":"+m.Port, auth, m.From, msg.To, raw); err != nil {
+		return fmt.Errorf("smtp send failed: %v", err)
+	}
+	return nil
+}
+
+// buildMIME renders the message as RFC 5322 text. Messages with an HTML part are
+// sent as multipart/alternative so clients without HTML still show the text part.
+func buildMIME(from string, msg Message, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = from[at+1:]
+	}
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(msg.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+
+	if msg.HTML == "" {
+		fmt.Fprintf(&buf, "Content-Type: text/plain; charset=UTF-8\r\n")
+		fmt.Fprintf(&buf, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&buf, msg.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	boundary := "gridly-" + hex.EncodeToString(id)
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+
+	parts := []struct{ contentType, body string }{
+		{"text/plain", msg.Text},
+		{"text/html", msg.HTML},
+	}
+	for _, part := range parts {
+		fmt.Fprintf(&buf, "--%s\r\n", boundary)
+		fmt.Fprintf(&buf, "Content-Type: %s; charset=UTF-8\r\n", part.contentType)
+		fmt.Fprintf(&buf, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&buf, part.body); err != nil {
+			return nil, err
+		}
+		buf.WriteString("\r\n")
+	}
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(buf *bytes.Buffer, body string) error {
+	qp := quotedprintable.NewWriter(buf)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
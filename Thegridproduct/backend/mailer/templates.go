@@ -0,0 +1,107 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+// Templates in the catalog. Each has a subject, a text part (templates/<name>.txt)
+// and an HTML part (templates/<name>.html) rendered inside templates/layout.html.
+const (
+	TemplateVerification   = "verification"
+	TemplatePasswordReset  = "password_reset"
+	TemplateReportReceived = "report_received"
+	TemplateDigest         = "digest"
+)
+
+// subjects holds the subject line of every template in the catalog.
+var subjects = map[string]string{
+	TemplateVerification:   "Your Gridly Verification Code",
+	TemplatePasswordReset:  "Your Gridly Password Reset Code",
+	TemplateReportReceived: "{{if .ChatID}}User Report Notification{{else}}New User Report/Feedback{{end}}",
+	TemplateDigest:         "{{.FirstName}}, here's what you missed on Gridly",
+}
+
+// CodeData is used by the verification and password reset templates.
+type CodeData struct {
+	Code             string
+	ExpiresInMinutes int
+}
+
+// ReportUser identifies a user in a report email.
+type ReportUser struct {
+	Name   string
+	Email  string
+	UserID string
+}
+
+// ReportData is used by the report received template. ChatID and Reported are only
+// set for reports about another user in a chat.
+type ReportData struct {
+	Type        string
+	Category    string
+	Description string
+	ChatID      string
+	Reporter    ReportUser
+	Reported    *ReportUser
+}
+
+// DigestItem is one line of a digest email.
+type DigestItem struct {
+	Title  string
+	Detail string
+}
+
+// DigestData is used by the digest template.
+type DigestData struct {
+	FirstName string
+	Items     []DigestItem
+}
+
+//go:embed templates/*
+var templateFS embed.FS
+
+type catalogEntry struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+// catalog is parsed once at startup so a broken template fails fast.
+var catalog = mustParseCatalog()
+
+func mustParseCatalog() map[string]catalogEntry {
+	entries := map[string]catalogEntry{}
+	for name, subject := range subjects {
+		entries[name] = catalogEntry{
+			subject: texttemplate.Must(texttemplate.New(name + ".subject").Parse(subject)),
+			text:    texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/"+name+".txt")),
+			html:    htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/layout.html", "templates/"+name+".html")),
+		}
+	}
+	return entries
+}
+
+// Render builds a message from a catalog template. The caller sets the recipients.
+func Render(name string, data interface{}) (Message, error) {
+	entry, ok := catalog[name]
+	if !ok {
+		return Message{}, fmt.Errorf("unknown email template %q", name)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := entry.subject.Execute(&subject, data); err != nil {
+		return Message{}, fmt.Errorf("error rendering %s subject: %v", name, err)
+	}
+	if err := entry.text.Execute(&text, data); err != nil {
+		return Message{}, fmt.Errorf("error rendering %s text: %v", name, err)
+	}
+	if err := entry.html.ExecuteTemplate(&html, "layout", data); err != nil {
+		return Message{}, fmt.Errorf("error rendering %s html: %v", name, err)
+	}
+
+	return Message{Subject: subject.String(), Text: text.String(), HTML: html.String()}, nil
+}
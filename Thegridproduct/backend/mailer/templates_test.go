@@ -0,0 +1,110 @@
+package mailer
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestSendTemplateThroughMemoryOutbox(t *testing.T) {
+	reporter := ReportUser{Name: "Sam Lee", Email: "sam@example.edu", UserID: "u1"}
+	tests := []struct {
+		template string
+		data     interface{}
+		subject  string
+		contains []string // in both the text and the HTML part
+	}{
+		{TemplateVerification, CodeData{Code: "482913", ExpiresInMinutes: 10}, "Your Gridly Verification Code", []string{"482913", "10 minutes"}},
+		{TemplatePasswordReset, CodeData{Code: "730155", ExpiresInMinutes: 15}, "Your Gridly Password Reset Code", []string{"730155", "15 minutes"}},
+		{
+			TemplateReportReceived,
+			ReportData{Type: "feedback", Description: "Love the app", Reporter: reporter},
+			"New User Report/Feedback",
+			[]string{"feedback", "Love the app", "sam@example.edu"},
+		},
+		{
+			TemplateReportReceived,
+			ReportData{Category: "Spam", Description: "Sends links", ChatID: "c1", Reporter: reporter, Reported: &ReportUser{Name: "Alex Kim", Email: "alex@example.edu", UserID: "u2"}},
+			"User Report Notification",
+			[]string{"Spam", "c1", "Sends links", "alex@example.edu"},
+		},
+		{
+			TemplateDigest,
+			DigestData{FirstName: "Sam", Items: []DigestItem{{Title: "2 new messages", Detail: "from Alex"}, {Title: "Your listing expires soon"}}},
+			"Sam, here's what you missed on Gridly",
+			[]string{"2 new messages", "from Alex", "Your listing expires soon"},
+		},
+	}
+
+	outbox := NewMemoryOutbox()
+	Start(outbox, 1)
+	for _, tt := range tests {
+		if err := SendTemplate(tt.template, tt.data, "to@example.edu"); err != nil {
+			t.Fatalf("SendTemplate(%s): %v", tt.template, err)
+		}
+	}
+	Stop(context.Background())
+
+	sent := outbox.Sent()
+	if len(sent) != len(tests) {
+		t.Fatalf("%d messages sent, want %d", len(sent), len(tests))
+	}
+	for i, tt := range tests {
+		msg := sent[i]
+		if len(msg.To) != 1 || msg.To[0] != "to@example.edu" {
+			t.Errorf("%s: To = %v", tt.template, msg.To)
+		}
+		if msg.Subject != tt.subject {
+			t.Errorf("%s: subject = %q, want %q", tt.template, msg.Subject, tt.subject)
+		}
+		if !strings.Contains(msg.HTML, "<!DOCTYPE html>") {
+			t.Errorf("%s: HTML part is not wrapped in the layout", tt.template)
+		}
+		for _, s := range tt.contains {
+			if !strings.Contains(msg.Text, s) {
+				t.Errorf("%s: text part lacks %q:\n%s", tt.template, s, msg.Text)
+			}
+			if !strings.Contains(msg.HTML, s) {
+				t.Errorf("%s: HTML part lacks %q", tt.template, s)
+			}
+		}
+	}
+}
+
+func TestRenderEscapesHTML(t *testing.T) {
+	msg, err := Render(TemplateReportReceived, ReportData{Description: "<script>alert(1)</script>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(msg.HTML, "<script>") {
+		t.Error("HTML part contains unescaped user input")
+	}
+	if !strings.Contains(msg.Text, "<script>alert(1)</script>") {
+		t.Error("text part should carry the description as written")
+	}
+}
+
+func TestRenderUnknownTemplate(t *testing.T) {
+	if _, err := Render("missing", nil); err == nil {
+		t.Error("Render accepted an unknown template")
+	}
+}
+
+func TestEveryTemplateRenders(t *testing.T) {
+	samples := map[string]interface{}{
+		TemplateVerification:   CodeData{Code: "1", ExpiresInMinutes: 1},
+		TemplatePasswordReset:  CodeData{Code: "1", ExpiresInMinutes: 1},
+		TemplateReportReceived: ReportData{Description: "d"},
+		TemplateDigest:         DigestData{FirstName: "Sam"},
+	}
+	for name := range subjects {
+		data, ok := samples[name]
+		if !ok {
+			t.Errorf("template %s has no sample data in this test", name)
+			continue
+		}
+		if _, err := Render(name, data); err != nil {
+			t.Errorf("Render(%s): %v", name, err)
+		}
+	}
+}
@@ -10,7 +10,13 @@ import (
 	"time"
 
 	"Thegridproduct/backend/db"
+	"Thegridproduct/backend/embeddings"
 	"Thegridproduct/backend/handlers"
+	"Thegridproduct/backend/mailer"
+	"Thegridproduct/backend/models"
+	"Thegridproduct/backend/realtime"
+	"Thegridproduct/backend/scheduler"
+	"Thegridproduct/backend/storage"
 
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
@@ -23,17 +29,35 @@ func main() {
 		log.Println("Error loading .env file, proceeding with system environment variables")
 	}
 
-	// Load SMTP Credentials
-	smtpUser := os.Getenv("SMTP_USER")
-	smtpPass := os.Getenv("SMTP_PASS")
-	smtpHost := os.Getenv("SMTP_HOST")
-	smtpPort := os.Getenv("SMTP_PORT")
+	// Set up outgoing mail; messages are delivered by a background queue
+	mail, err := mailer.FromEnv()
+	if err != nil {
+		log.Fatalf("Mailer configuration error: %v", err)
+	}
+	mailer.Start(mail, 2)
+	log.Println("Mailer started successfully")
 
-	if smtpUser == "" || smtpPass == "" || smtpHost == "" || smtpPort == "" {
-		log.Fatal("SMTP credentials are missing. Check .env file or system environment variables.")
-	} else {
-		log.Println("SMTP credentials loaded successfully")
+	// Pick the embeddings provider used by semantic search
+	embedder, err := embeddings.FromEnv()
+	if err != nil {
+		log.Fatalf("Embeddings configuration error: %v", err)
 	}
+	embeddings.SetDefault(embedder)
+	log.Printf("Embeddings: %s (%d dimensions)", embedder.Model(), embedder.Dimensions())
+
+	// Pick where uploaded images are stored
+	store, err := storage.FromEnv()
+	if err != nil {
+		log.Fatalf("Storage configuration error: %v", err)
+	}
+	storage.SetDefault(store)
+
+	// Pick how realtime events reach the instances clients are connected to
+	pubsub, err := realtime.FromEnv()
+	if err != nil {
+		log.Fatalf("Realtime configuration error: %v", err)
+	}
+	realtime.SetDefault(pubsub)
 
 	// Retrieve and validate JWT secret key
 	jwtSecret := os.Getenv("JWT_SECRET_KEY")
@@ -52,6 +76,13 @@ func main() {
 		log.Println("MongoDB disconnected successfully.")
 	}()
 
+	// Chat messages live in MongoDB; copy them to the Firestore chat rooms for
+	// clients that still read them there
+	if handlers.FirestoreMirrorEnabled() {
+		db.Messages = handlers.NewFirestoreMirror(db.Messages)
+		log.Println("Mirroring chat messages to Firestore")
+	}
+
 	// Initialize router
 	router := mux.NewRouter()
 
@@ -60,9 +91,17 @@ func main() {
 
 	// Public Routes
 	router.HandleFunc("/login", handlers.LoginHandler).Methods("POST")
+	router.HandleFunc("/login/2fa", handlers.TwoFactorLoginHandler).Methods("POST")
 	router.HandleFunc("/verify", handlers.VerifyEmailHandler).Methods("POST")
+	router.HandleFunc("/verify/resend", handlers.ResendVerificationHandler).Methods("POST")
 	router.HandleFunc("/signup", handlers.SignupHandler).Methods("POST")
-	router.HandleFunc("/user/delete", handlers.DeleteAccountHandler).Methods("DELETE")
+	router.HandleFunc("/auth/refresh", handlers.RefreshTokenHandler).Methods("POST")
+	router.HandleFunc("/password/reset/request", handlers.RequestPasswordResetHandler).Methods("POST")
+	router.HandleFunc("/password/reset/confirm", handlers.ConfirmPasswordResetHandler).Methods("POST")
+	router.HandleFunc("/account/restore", handlers.RestoreAccountHandler).Methods("POST")
+	router.HandleFunc("/account/restore/2fa", handlers.RestoreAccountTwoFactorHandler).Methods("POST")
+	router.HandleFunc("/institutions", handlers.ListInstitutionsHandler).Methods("GET")
+	router.HandleFunc("/media/{key:.+}", handlers.ServeMediaHandler).Methods("GET")
 
 	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("Welcome to The Gridly API"))
@@ -72,14 +111,25 @@ func main() {
 	protected := router.PathPrefix("/").Subrouter()
 	protected.Use(handlers.AuthMiddleware)
 
+	protected.HandleFunc("/auth/logout", handlers.LogoutHandler).Methods("POST")
+	protected.HandleFunc("/user/delete", handlers.DeleteAccountHandler).Methods("DELETE")
+	protected.HandleFunc("/2fa/enroll", handlers.EnrollTwoFactorHandler).Methods("POST")
+	protected.HandleFunc("/2fa/confirm", handlers.ConfirmTwoFactorHandler).Methods("POST")
+	protected.HandleFunc("/2fa/recovery-codes", handlers.RegenerateRecoveryCodesHandler).Methods("POST")
+	protected.HandleFunc("/2fa/disable", handlers.DisableTwoFactorHandler).Methods("POST")
+	protected.HandleFunc("/user/export", handlers.RequestDataExportHandler).Methods("POST")
+	protected.HandleFunc("/user/export/{id}", handlers.GetDataExportHandler).Methods("GET")
+	protected.HandleFunc("/user/export/{id}/download", handlers.DownloadDataExportHandler).Methods("GET")
+	protected.HandleFunc("/uploads", handlers.UploadImageHandler).Methods("POST")
 	protected.HandleFunc("/products", handlers.AddProductHandler).Methods("POST")
 	router.HandleFunc("/user/push-token", handlers.StorePushTokenHandler).Methods("POST")
-	protected.HandleFunc("/api/test/push-notification", handlers.ManualPushNotificationHandler).Methods("POST")
 
 	protected.HandleFunc("/products/user", handlers.GetUserProductsHandler).Methods("GET")
 	router.HandleFunc("/products/user/{userId}", handlers.GetProductsByUserIDHandler).Methods("GET")
 	router.HandleFunc("/public/users/{id}", handlers.GetPublicUserHandler).Methods("GET")
 	protected.HandleFunc("/products/all", handlers.GetAllProductsHandler).Methods("GET")
+	protected.HandleFunc("/products/search", handlers.SearchProductsHandler).Methods("GET")
+	protected.HandleFunc("/products/semantic-search", handlers.SemanticSearchProductsHandler).Methods("POST")
 	protected.HandleFunc("/products/by-ids", handlers.GetProductsByIDsHandler).Methods("GET")
 	protected.HandleFunc("/products/liked", handlers.GetLikedProductsHandler).Methods("GET")
 	protected.HandleFunc("/products/{id}", handlers.GetSingleProductHandler).Methods("GET")
@@ -88,6 +138,8 @@ func main() {
 	protected.HandleFunc("/products/{id}", handlers.UpdateProductHandler).Methods("PUT")
 
 	// Liked Products
+	protected.HandleFunc("/products/{id}/renew", handlers.RenewProductHandler).Methods("POST")
+	protected.HandleFunc("/products/{id}/relist", handlers.RelistProductHandler).Methods("POST")
 	protected.HandleFunc("/products/{id}/like", handlers.LikeProductHandler).Methods("POST")
 	protected.HandleFunc("/products/{id}/unlike", handlers.UnlikeProductHandler).Methods("POST")
 
@@ -108,7 +160,10 @@ func main() {
 	protected.HandleFunc("/chats/{chatId}", handlers.GetChatHandler).Methods("GET")
 	protected.HandleFunc("/chats/{chatId}/messages", handlers.AddMessageHandler).Methods("POST")
 	protected.HandleFunc("/chats/{chatId}/messages", handlers.GetMessagesHandler).Methods("GET")
-	protected.HandleFunc("/chat/test-send-message", handlers.TestSendMessageHandler).Methods("POST")
+	protected.HandleFunc("/chats/{chatId}/read", handlers.MarkChatReadHandler).Methods("POST")
+	protected.HandleFunc("/inbox/summary", handlers.InboxSummaryHandler).Methods("GET")
+	protected.HandleFunc("/realtime/ws", handlers.RealtimeWebSocketHandler).Methods("GET")
+	protected.HandleFunc("/realtime/events", handlers.RealtimeEventsHandler).Methods("GET")
 	protected.HandleFunc("/users/{id}", handlers.GetUserHandler).Methods("GET")
 
 	protected.HandleFunc("/requests", handlers.CreateProductRequestHandler).Methods("POST")
@@ -131,16 +186,54 @@ func main() {
 	protected.HandleFunc("/chat_requests/{requestId}", handlers.DeleteChatRequestHandler).Methods("DELETE")
 	protected.HandleFunc("/general-report", handlers.GeneralReportHandler).Methods("POST")
 
+	// Admin Routes
+	admin := protected.PathPrefix("/admin").Subrouter()
+	admin.Use(handlers.RequireRole(models.RoleAdmin))
+
+	admin.HandleFunc("/users/{id}/roles", handlers.UpdateUserRolesHandler).Methods("PUT")
+	admin.HandleFunc("/jobs/runs", handlers.GetJobRunsHandler).Methods("GET")
+	admin.HandleFunc("/test/push-notification", handlers.ManualPushNotificationHandler).Methods("POST")
+	admin.HandleFunc("/test/send-message", handlers.TestSendMessageHandler).Methods("POST")
+
+	admin.HandleFunc("/institutions", handlers.ListInstitutionsHandler).Methods("GET")
+	admin.HandleFunc("/institutions", handlers.CreateInstitutionHandler).Methods("POST")
+	admin.HandleFunc("/institutions/migrate", handlers.MigrateInstitutionsHandler).Methods("POST")
+	admin.HandleFunc("/institutions/{id}", handlers.UpdateInstitutionHandler).Methods("PUT")
+	admin.HandleFunc("/institutions/{id}", handlers.DeleteInstitutionHandler).Methods("DELETE")
+
+	// Moderation Routes: admins can moderate too
+	moderation := protected.PathPrefix("/moderation").Subrouter()
+	moderation.Use(handlers.RequireRole(models.RoleAdmin, models.RoleModerator))
+
+	moderation.HandleFunc("/products/{id}", handlers.ModerateRemoveProductHandler).Methods("DELETE")
+	moderation.HandleFunc("/services/{id}", handlers.ModerateRemoveGigHandler).Methods("DELETE")
+
 	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handlers.WriteJSONError(w, "Endpoint not found", http.StatusNotFound)
 	})
 
 	port := getEnv("PORT", "8080")
+	// WriteTimeout caps ordinary responses. The realtime streams outlive it: the
+	// WebSocket sets its own deadlines once hijacked and the event stream moves the
+	// deadline forward before each write.
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%s", port),
-		Handler: router,
+		Addr:              fmt.Sprintf(":%s", port),
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
+		WriteTimeout:      2 * time.Minute,
+		IdleTimeout:       2 * time.Minute,
 	}
 
+	// Run expirations and other maintenance in the background; a lease in MongoDB
+	// keeps replicas from running the same job twice.
+	jobs := scheduler.New()
+	handlers.RegisterJobs(jobs)
+	jobs.Start()
+
+	// Keep semantic search vectors in memory; rebuilt periodically to pick up
+	// changes made outside the server.
+	stopVectorIndexes := handlers.StartVectorIndexes(30 * time.Minute)
+
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt)
 
@@ -153,13 +246,26 @@ func main() {
 
 	<-stop
 	log.Println("Shutting down server...")
+	stopVectorIndexes()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	// Each step gets its own deadline, so a slow job cannot use up the time
+	// in-flight requests and queued emails have to finish.
+	jobsCtx, cancelJobs := context.WithTimeout(context.Background(), 10*time.Second)
+	jobs.Stop(jobsCtx)
+	cancelJobs()
 
-	if err := server.Shutdown(ctx); err != nil {
+	// End realtime streams so Shutdown does not wait for them
+	pubsub.Close()
+
+	serverCtx, cancelServer := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelServer()
+	if err := server.Shutdown(serverCtx); err != nil {
 		log.Fatalf("Server shutdown failed: %v", err)
 	}
+
+	mailerCtx, cancelMailer := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelMailer()
+	mailer.Stop(mailerCtx)
 	log.Println("Server gracefully stopped")
 }
 
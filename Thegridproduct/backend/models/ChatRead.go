@@ -0,0 +1,30 @@
+// models/ChatRead.go
+
+package models
+
+import (
+	"bytes"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ChatRead records how far a participant has read a chat: up to and including the
+// message LastReadMessageID, sent at LastReadAt.
+type ChatRead struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	ChatID            primitive.ObjectID `bson:"chatId" json:"chatId"`
+	UserID            primitive.ObjectID `bson:"userId" json:"userId"`
+	LastReadMessageID primitive.ObjectID `bson:"lastReadMessageId" json:"lastReadMessageId"`
+	LastReadAt        time.Time          `bson:"lastReadAt" json:"lastReadAt"`
+	ReadAt            time.Time          `bson:"readAt" json:"readAt"` // when the chat was marked read
+}
+
+// Covers reports whether msg is at or before the read position. Messages are
+// ordered by timestamp, ties broken by ID.
+func (r ChatRead) Covers(msg Message) bool {
+	if !msg.Timestamp.Equal(r.LastReadAt) {
+		return msg.Timestamp.Before(r.LastReadAt)
+	}
+	return bytes.Compare(msg.ID[:], r.LastReadMessageID[:]) <= 0
+}
@@ -0,0 +1,35 @@
+// models/DataExport.go
+
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Data export states. An export starts pending and ends ready or failed; one that
+// stops making progress, e.g. because the server restarted while building it, is
+// marked failed.
+const (
+	ExportStatusPending    = "pending"
+	ExportStatusProcessing = "processing"
+	ExportStatusReady      = "ready"
+	ExportStatusFailed     = "failed"
+)
+
+// DataExport tracks a personal data archive built for a user.
+// The archive itself lives in GridFS and is referenced by FileID once ready.
+type DataExport struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID      primitive.ObjectID `bson:"userId" json:"userId"`
+	Status      string             `bson:"status" json:"status"`
+	FileID      primitive.ObjectID `bson:"fileId,omitempty" json:"-"`
+	Size        int64              `bson:"size,omitempty" json:"size,omitempty"` // Archive size in bytes
+	Error       string             `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedAt   time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt   time.Time          `bson:"updatedAt" json:"updatedAt"` // Last status change; stuck exports stop moving it
+	StartedAt   *time.Time         `bson:"startedAt,omitempty" json:"startedAt,omitempty"`
+	CompletedAt *time.Time         `bson:"completedAt,omitempty" json:"completedAt,omitempty"`
+	ExpiresAt   *time.Time         `bson:"expiresAt,omitempty" json:"expiresAt,omitempty"` // Download link stops working after this
+}
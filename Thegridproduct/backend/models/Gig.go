@@ -6,6 +6,14 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Embedding states of a gig. A gig is pending from the moment it is posted or its
+// text changes until its embedding is stored (ready) or could not be computed (failed).
+const (
+	EmbeddingStatusPending = "pending"
+	EmbeddingStatusReady   = "ready"
+	EmbeddingStatusFailed  = "failed"
+)
+
 // Add the new field `IsAnonymous` to the Gig struct
 type Gig struct {
 	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
@@ -22,11 +30,16 @@ type Gig struct {
 	PostedDate     time.Time          `bson:"postedDate" json:"postedDate"`
 	Expired        bool               `bson:"expired" json:"expired,omitempty"`
 
-	Status         string               `bson:"status" json:"status"` // e.g., "active", "completed"
-	LikeCount      int                  `bson:"likeCount" json:"likeCount"`
-	CampusPresence string               `bson:"campusPresence" json:"campusPresence"` // "inCampus" or "flexible"
-	Embeddings     []float32            `bson:"embeddings,omitempty" json:"embeddings,omitempty"`
-	RequestedBy    []primitive.ObjectID `bson:"requestedBy,omitempty"`
+	Status              string               `bson:"status" json:"status"` // e.g., "active", "completed"
+	LikeCount           int                  `bson:"likeCount" json:"likeCount"`
+	CampusPresence      string               `bson:"campusPresence" json:"campusPresence"` // "inCampus" or "flexible"
+	Embeddings          []float32            `bson:"embeddings,omitempty" json:"-"`        // Semantic search vector, never sent to clients
+	EmbeddingModel      string               `bson:"embeddingModel,omitempty" json:"-"`    // Model the vector was computed with
+	EmbeddingDimensions int                  `bson:"embeddingDimensions,omitempty" json:"-"`
+	EmbeddingStatus     string               `bson:"embeddingStatus,omitempty" json:"embeddingStatus,omitempty"`
+	EmbeddingError      string               `bson:"embeddingError,omitempty" json:"-"`
+	EmbeddingUpdatedAt  *time.Time           `bson:"embeddingUpdatedAt,omitempty" json:"embeddingUpdatedAt,omitempty"`
+	RequestedBy         []primitive.ObjectID `bson:"requestedBy,omitempty"`
 
 	// ✅ New field for anonymous gigs, defaults to false
 	IsAnonymous bool `bson:"isAnonymous" json:"isAnonymous"`
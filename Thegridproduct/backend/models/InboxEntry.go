@@ -0,0 +1,16 @@
+// models/InboxEntry.go
+
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// InboxEntry holds the counters the inbox of a participant shows for one chat.
+// They are kept up to date as messages are sent and read, so the inbox never
+// has to scan message history.
+type InboxEntry struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	ChatID      primitive.ObjectID `bson:"chatId" json:"chatId"`
+	UserID      primitive.ObjectID `bson:"userId" json:"userId"`
+	UnreadCount int64              `bson:"unreadCount" json:"unreadCount"`
+	LastMessage *Message           `bson:"lastMessage,omitempty" json:"lastMessage"`
+}
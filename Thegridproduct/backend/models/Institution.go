@@ -0,0 +1,24 @@
+// models/Institution.go
+
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Institution is a canonical school or university entry in the institution registry.
+// Signup resolves the free-text institution a user types against Name and Aliases,
+// and checks the user's email against EmailDomains; entries without domains reject signups.
+type Institution struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name              string             `bson:"name" json:"name"`
+	NormalizedName    string             `bson:"normalizedName" json:"-"`
+	Aliases           []string           `bson:"aliases" json:"aliases"`
+	NormalizedAliases []string           `bson:"normalizedAliases" json:"-"`
+	EmailDomains      []string           `bson:"emailDomains" json:"emailDomains"` // e.g. "berkeley.edu"; empty rejects every email
+	StudentType       string             `bson:"studentType" json:"studentType"`   // "highschool" or "university"
+	CreatedAt         time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt         time.Time          `bson:"updatedAt" json:"updatedAt"`
+}
@@ -2,14 +2,18 @@
 
 package models
 
-import "time"
+import (
+	"time"
 
-// Message represents a single message within a chat
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Message is a single chat message, stored as its own document in the messages
+// collection.
 type Message struct {
-	ID        string    `bson:"_id,omitempty" json:"_id"`
-	Sender    string    `bson:"sender" json:"sender"` // "user" or "other"
-	SenderID  string    `bson:"senderId" json:"senderID"`
-	Content   string    `bson:"content" json:"content"`
-	Timestamp time.Time `bson:"timestamp" json:"timestamp"`
-	ChatID    string    `bson:"chatId,omitempty" json:"chatID,omitempty"` // Optional, for WebSocket
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id"`
+	ChatID    primitive.ObjectID `bson:"chatId" json:"chatId"`
+	SenderID  string             `bson:"senderId" json:"senderId"`
+	Content   string             `bson:"content" json:"content"`
+	Timestamp time.Time          `bson:"timestamp" json:"timestamp"`
 }
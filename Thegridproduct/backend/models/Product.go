@@ -20,6 +20,11 @@ type Product struct {
 	Images                 []string             `json:"images" bson:"images"`
 	PostedDate             time.Time            `json:"postedDate,omitempty" bson:"postedDate,omitempty"`
 	Expired                bool                 `json:"expired" bson:"expired"`
+	ExpiresAt              *time.Time           `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"` // End of the listing lifetime; renewing moves it
+	ExpiryReminderSentAt   *time.Time           `json:"-" bson:"expiryReminderSentAt,omitempty"`        // Set once the owner was reminded of ExpiresAt
+	RenewedAt              *time.Time           `json:"renewedAt,omitempty" bson:"renewedAt,omitempty"`
+	RelistedFrom           *primitive.ObjectID  `json:"relistedFrom,omitempty" bson:"relistedFrom,omitempty"` // The sold or expired product this one was cloned from
+	RelistedTo             *primitive.ObjectID  `json:"relistedTo,omitempty" bson:"relistedTo,omitempty"`     // The listing that replaced this one when it was relisted
 	IsAvailableOutOfCampus bool                 `json:"isAvailableOutOfCampus" bson:"isAvailableOutOfCampus"`
 	Rating                 int                  `json:"rating" bson:"rating"`
 	ListingType            string               `json:"listingType" bson:"listingType"`
@@ -31,4 +36,7 @@ type Product struct {
 	LikeCount              int                  `json:"likeCount" bson:"likeCount"`
 	ChatCount              int                  `json:"chatCount,omitempty" bson:"chatCount,omitempty"`
 	RequestedBy            []primitive.ObjectID `json:"requestedBy,omitempty" bson:"requestedBy,omitempty"` // ✅ New Field
+	Embeddings             []float32            `json:"-" bson:"embeddings,omitempty"`                      // Semantic search vector, computed from the text fields
+	EmbeddingModel         string               `json:"-" bson:"embeddingModel,omitempty"`                  // Model the vector was computed with
+	EmbeddingDimensions    int                  `json:"-" bson:"embeddingDimensions,omitempty"`
 }
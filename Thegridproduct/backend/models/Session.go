@@ -0,0 +1,25 @@
+// models/Session.go
+
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session represents a login session backing a rotating refresh token.
+// Access tokens carry the session ID so a revoked session logs the device out
+// even before its access token expires.
+type Session struct {
+	ID                primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID            primitive.ObjectID `bson:"userId" json:"userId"`
+	RefreshTokenHash  string             `bson:"refreshTokenHash" json:"-"`
+	PreviousTokenHash string             `bson:"previousTokenHash,omitempty" json:"-"` // Used to detect refresh token reuse
+	UserAgent         string             `bson:"userAgent,omitempty" json:"userAgent,omitempty"`
+	IPAddress         string             `bson:"ipAddress,omitempty" json:"ipAddress,omitempty"`
+	CreatedAt         time.Time          `bson:"createdAt" json:"createdAt"`
+	LastUsedAt        time.Time          `bson:"lastUsedAt" json:"lastUsedAt"`
+	ExpiresAt         time.Time          `bson:"expiresAt" json:"expiresAt"`
+	RevokedAt         *time.Time         `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+}
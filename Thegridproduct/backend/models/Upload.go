@@ -0,0 +1,25 @@
+// models/Upload.go
+
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Upload is an image stored by the upload service. Listings and profiles refer to
+// it by URL; only URLs recorded here are accepted as image references.
+type Upload struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID       primitive.ObjectID `bson:"userId" json:"userId"`
+	Key          string             `bson:"key" json:"-"`
+	ThumbnailKey string             `bson:"thumbnailKey" json:"-"`
+	URL          string             `bson:"url" json:"url"`
+	ThumbnailURL string             `bson:"thumbnailUrl" json:"thumbnailUrl"`
+	ContentType  string             `bson:"contentType" json:"contentType"`
+	Width        int                `bson:"width" json:"width"`
+	Height       int                `bson:"height" json:"height"`
+	Size         int64              `bson:"size" json:"size"` // Stored size in bytes, thumbnail excluded
+	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"`
+}
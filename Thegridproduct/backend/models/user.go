@@ -6,6 +6,16 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Roles that can be granted to a user. Users without roles are regular members;
+// moderators can take down reported listings and admins can do everything.
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+)
+
+// ValidRoles lists every role that may be stored on a user.
+var ValidRoles = []string{RoleAdmin, RoleModerator}
+
 type User struct {
 	ID               primitive.ObjectID   `json:"id,omitempty" bson:"_id,omitempty"`
 	Email            string               `json:"email" bson:"email"`
@@ -14,6 +24,7 @@ type User struct {
 	LastName         string               `json:"lastName" bson:"lastName"`
 	StudentType      string               `json:"studentType" bson:"studentType"` // "highschool" or "university"
 	Institution      string               `json:"institution" bson:"institution"`
+	InstitutionID    primitive.ObjectID   `json:"institutionId,omitempty" bson:"institutionId,omitempty"` // Registry entry the institution was resolved to
 	ProfilePic       string               `json:"profilePic,omitempty" bson:"profilePic,omitempty"`
 	CreatedAt        time.Time            `json:"createdAt" bson:"createdAt"`
 	UpdatedAt        time.Time            `json:"updatedAt" bson:"updatedAt"`
@@ -21,4 +32,14 @@ type User struct {
 	LikedProducts    []primitive.ObjectID `json:"likedProducts,omitempty" bson:"likedProducts,omitempty"`
 	ExpoPushToken    string               `json:"expoPushToken" bson:"expoPushToken"`
 	Grids            int                  `json:"grids" bson:"grids"` // NEW: score for the user
+	Roles            []string             `json:"roles,omitempty" bson:"roles,omitempty"`
+	DeletedAt        *time.Time           `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`   // Set while the account is waiting to be purged
+	PurgeAfter       *time.Time           `json:"purgeAfter,omitempty" bson:"purgeAfter,omitempty"` // When the account and its data are removed for good
+
+	// Two-factor authentication. Secrets and recovery codes are never sent to clients.
+	TwoFactorEnabled       bool     `json:"twoFactorEnabled,omitempty" bson:"twoFactorEnabled,omitempty"`
+	TwoFactorSecret        string   `json:"-" bson:"twoFactorSecret,omitempty"`
+	TwoFactorPendingSecret string   `json:"-" bson:"twoFactorPendingSecret,omitempty"` // Set between enroll and confirm
+	TwoFactorLastStep      int64    `json:"-" bson:"twoFactorLastStep,omitempty"`      // Last accepted TOTP step, so a code works only once
+	RecoveryCodes          []string `json:"-" bson:"recoveryCodes,omitempty"`          // SHA-256 hashes of unused recovery codes
 }
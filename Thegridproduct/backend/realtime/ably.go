@@ -0,0 +1,402 @@
+package realtime
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ably is a PubSub relaying events through Ably channels, so events published on
+// one instance reach the subscribers on every instance. Events are published with
+// Ably's REST API. Subscriptions use Ably's server-sent events endpoint, which
+// takes a list of channels: the topics with local subscribers share a few long
+// lived streams of up to ablyChannelsPerStream channels each, and their events
+// are fanned out in memory. A stream reconnects when topics join it. Events
+// published while a stream is (re)connecting may be missed, which subscribers
+// handle like any other gap.
+//
+// It talks to Ably over plain HTTP rather than through the ably-go SDK, whose
+// realtime client is far heavier than the one publish call and one event stream
+// the gateway needs.
+type Ably struct {
+	key    string // "<app>.<key id>:<secret>"
+	prefix string
+
+	RESTURL string       // defaults to https://rest.ably.io
+	SSEURL  string       // defaults to https://realtime.ably.io/sse
+	Client  *http.Client // for publishing; defaults to a client with a 10 second timeout
+
+	local *Memory
+
+	mu       sync.Mutex
+	refs     map[string]int         // local subscriptions per topic
+	streamOf map[string]*ablyStream // stream carrying each subscribed topic
+	streams  map[*ablyStream]struct{}
+	closed   bool
+}
+
+// ablyStream is one server-sent events connection to Ably carrying the channels of
+// several topics.
+type ablyStream struct {
+	topics  map[string]struct{}
+	changed chan struct{} // signalled when a topic joins, so the stream reconnects
+	cancel  context.CancelFunc
+}
+
+const (
+	// ablyChannelsPerStream caps the channels of one stream, keeping it under the
+	// number of channels Ably lets a connection attach.
+	ablyChannelsPerStream = 100
+
+	// ablyMaxBackoff is the longest wait before reconnecting a failed stream.
+	ablyMaxBackoff = 30 * time.Second
+)
+
+// ablySettleDelay is how long a stream waits after a change before (re)connecting,
+// so a burst of new subscriptions costs one reconnect.
+var ablySettleDelay = 500 * time.Millisecond
+
+var defaultAblyClient = &http.Client{Timeout: 10 * time.Second}
+
+// NewAbly returns a PubSub using the Ably API key, with channel names made of
+// prefix and the topic.
+func NewAbly(key, prefix string) *Ably {
+	return &Ably{
+		key:      key,
+		prefix:   prefix,
+		RESTURL:  "https://rest.ably.io",
+		SSEURL:   "https://realtime.ably.io/sse",
+		local:    NewMemory(),
+		refs:     map[string]int{},
+		streamOf: map[string]*ablyStream{},
+		streams:  map[*ablyStream]struct{}{},
+	}
+}
+
+func (a *Ably) Publish(ctx context.Context, topic string, event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("error encoding event: %v", err)
+	}
+	// The event travels as a string so Ably hands it back untouched.
+	body, err := json.Marshal(map[string]string{"name": event.Type, "data": string(data)})
+	if err != nil {
+		return fmt.Errorf("error encoding event: %v", err)
+	}
+
+	endpoint := strings.TrimSuffix(a.RESTURL, "/") + "/channels/" + url.PathEscape(a.prefix+topic) + "/messages"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	a.authorize(req)
+
+	client := a.Client
+	if client == nil {
+		client = defaultAblyClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error publishing to Ably: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("error publishing to Ably: %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+	return nil
+}
+
+func (a *Ably) Subscribe(ctx context.Context, topic string) (<-chan Event, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return nil, ErrClosed
+	}
+
+	ch, err := a.local.Subscribe(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+	a.refs[topic]++
+	if a.refs[topic] == 1 {
+		a.attach(topic)
+	}
+
+	go func() {
+		<-ctx.Done()
+		a.release(topic)
+	}()
+	return ch, nil
+}
+
+// attach adds topic to a stream with room for it, starting a new stream when all
+// are full. a.mu must be held.
+func (a *Ably) attach(topic string) {
+	var stream *ablyStream
+	for s := range a.streams {
+		if len(s.topics) < ablyChannelsPerStream {
+			stream = s
+			break
+		}
+	}
+	if stream == nil {
+		streamCtx, cancel := context.WithCancel(context.Background())
+		stream = &ablyStream{topics: map[string]struct{}{}, changed: make(chan struct{}, 1), cancel: cancel}
+		a.streams[stream] = struct{}{}
+		go a.run(streamCtx, stream)
+	}
+
+	stream.topics[topic] = struct{}{}
+	a.streamOf[topic] = stream
+	select {
+	case stream.changed <- struct{}{}:
+	default:
+	}
+}
+
+// release drops a local subscriber of topic. After the last one the topic leaves
+// its stream, and a stream without topics is closed. A stream does not reconnect
+// when a topic leaves: events on the dropped channel find no local subscribers
+// until the next reconnect leaves it out.
+func (a *Ably) release(topic string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.refs[topic]--; a.refs[topic] > 0 {
+		return
+	}
+	delete(a.refs, topic)
+
+	stream := a.streamOf[topic]
+	if stream == nil {
+		return
+	}
+	delete(a.streamOf, topic)
+	delete(stream.topics, topic)
+	if len(stream.topics) == 0 {
+		stream.cancel()
+		delete(a.streams, stream)
+	}
+}
+
+func (a *Ably) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return nil
+	}
+	a.closed = true
+	for stream := range a.streams {
+		stream.cancel()
+	}
+	a.streams = map[*ablyStream]struct{}{}
+	a.streamOf = map[string]*ablyStream{}
+	a.refs = map[string]int{}
+	return a.local.Close()
+}
+
+// channels returns the sorted Ably channels of the stream's topics.
+func (a *Ably) channels(stream *ablyStream) []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	channels := make([]string, 0, len(stream.topics))
+	for topic := range stream.topics {
+		channels = append(channels, a.prefix+topic)
+	}
+	slices.Sort(channels)
+	return channels
+}
+
+// run keeps the stream connected until ctx is done, reconnecting with the current
+// channels whenever topics join it.
+func (a *Ably) run(ctx context.Context, stream *ablyStream) {
+	var connected []string
+	lastEventID := ""
+	backoff := time.Second
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(ablySettleDelay):
+		}
+		select {
+		case <-stream.changed:
+		default:
+		}
+
+		channels := a.channels(stream)
+		if !slices.Equal(channels, connected) {
+			// Resume positions belong to the previous set of channels.
+			lastEventID = ""
+			connected = channels
+		}
+
+		connCtx, cancel := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func() { done <- a.stream(connCtx, channels, &lastEventID, &backoff) }()
+
+		select {
+		case <-ctx.Done():
+			cancel()
+			<-done
+			return
+		case <-stream.changed:
+			cancel()
+			<-done
+			// Put the signal back so the settle delay runs before reconnecting.
+			select {
+			case stream.changed <- struct{}{}:
+			default:
+			}
+		case err := <-done:
+			cancel()
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Ably stream for %d channels ended, reconnecting in %s: %v", len(channels), backoff, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > ablyMaxBackoff {
+				backoff = ablyMaxBackoff
+			}
+		}
+	}
+}
+
+// stream reads one server-sent events connection to Ably, passing its messages to
+// the local subscribers. lastEventID lets a reconnect resume where it left off and
+// backoff is reset once connected.
+func (a *Ably) stream(ctx context.Context, channels []string, lastEventID *string, backoff *time.Duration) error {
+	escaped := make([]string, len(channels))
+	for i, channel := range channels {
+		escaped[i] = url.QueryEscape(channel)
+	}
+	endpoint := a.SSEURL + "?v=1.2&channels=" + strings.Join(escaped, ",")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if *lastEventID != "" {
+		req.Header.Set("Last-Event-ID", *lastEventID)
+	}
+	a.authorize(req)
+
+	// No timeout: the stream stays open for as long as it is needed.
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("Ably returned %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+	*backoff = time.Second
+
+	// A message names its channel; with a single channel it may be left out.
+	fallback := ""
+	if len(channels) == 1 {
+		fallback = channels[0]
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	var id, name string
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// A blank line ends an event.
+			if name == "error" {
+				return fmt.Errorf("Ably sent an error: %s", data.String())
+			}
+			if data.Len() > 0 {
+				a.deliver(data.String(), fallback)
+				if id != "" {
+					*lastEventID = id
+				}
+			}
+			id, name = "", ""
+			data.Reset()
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue // keep-alive comment
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "id":
+			id = value
+		case "event":
+			name = value
+		case "data":
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// deliver decodes an Ably message carrying an event and passes the event on to
+// the local subscribers of the message's channel, or of fallback when the message
+// does not name one.
+func (a *Ably) deliver(raw, fallback string) {
+	var message struct {
+		Channel string          `json:"channel"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(raw), &message); err != nil {
+		log.Printf("Ignoring malformed Ably message: %v", err)
+		return
+	}
+	channel := message.Channel
+	if channel == "" {
+		channel = fallback
+	}
+	topic, ok := strings.CutPrefix(channel, a.prefix)
+	if !ok || topic == "" {
+		log.Printf("Ignoring Ably message on unexpected channel %q", channel)
+		return
+	}
+
+	payload := []byte(message.Data)
+	var s string
+	if err := json.Unmarshal(message.Data, &s); err == nil {
+		payload = []byte(s)
+	}
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil || event.Type == "" {
+		log.Printf("Ignoring malformed event on %s", topic)
+		return
+	}
+	if err := a.local.Publish(context.Background(), topic, event); err != nil && err != ErrClosed {
+		log.Printf("Error delivering event on %s: %v", topic, err)
+	}
+}
+
+// authorize adds HTTP basic authentication with the API key.
+func (a *Ably) authorize(req *http.Request) {
+	name, secret, _ := strings.Cut(a.key, ":")
+	req.SetBasicAuth(name, secret)
+}
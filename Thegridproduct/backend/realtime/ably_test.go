@@ -0,0 +1,212 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sseConn is a subscription stream opened against the fake Ably server.
+type sseConn struct {
+	channels []string
+	events   chan string // raw Ably messages to send
+	closed   chan struct{}
+}
+
+// fakeAbly serves Ably's publish and server-sent events endpoints.
+type fakeAbly struct {
+	*httptest.Server
+	conns     chan *sseConn
+	published chan *http.Request
+	bodies    chan string
+}
+
+func newFakeAbly(t *testing.T) *fakeAbly {
+	t.Helper()
+	f := &fakeAbly{conns: make(chan *sseConn, 16), published: make(chan *http.Request, 16), bodies: make(chan string, 16)}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			body, _ := io.ReadAll(r.Body)
+			f.published <- r
+			f.bodies <- string(body)
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+
+		conn := &sseConn{
+			channels: strings.Split(r.URL.Query().Get("channels"), ","),
+			events:   make(chan string, 16),
+			closed:   make(chan struct{}),
+		}
+		defer close(conn.closed)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		f.conns <- conn
+		for i := 1; ; i++ {
+			select {
+			case <-r.Context().Done():
+				return
+			case raw := <-conn.events:
+				fmt.Fprintf(w, "id: %d\ndata: %s\n\n", i, raw)
+				w.(http.Flusher).Flush()
+			}
+		}
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// nextConn waits for the next subscription stream.
+func (f *fakeAbly) nextConn(t *testing.T) *sseConn {
+	t.Helper()
+	select {
+	case conn := <-f.conns:
+		return conn
+	case <-time.After(2 * time.Second):
+		t.Fatal("no Ably stream was opened")
+		return nil
+	}
+}
+
+func newTestAbly(t *testing.T, f *fakeAbly) *Ably {
+	t.Helper()
+	previous := ablySettleDelay
+	ablySettleDelay = 20 * time.Millisecond
+	t.Cleanup(func() { ablySettleDelay = previous })
+
+	a := NewAbly("app.key:secret", "p:")
+	a.RESTURL = f.URL
+	a.SSEURL = f.URL + "/sse"
+	t.Cleanup(func() { a.Close() })
+	return a
+}
+
+func ablyMessage(channel string, event Event) string {
+	data, _ := json.Marshal(event)
+	raw, _ := json.Marshal(map[string]string{"channel": channel, "name": event.Type, "data": string(data)})
+	return string(raw)
+}
+
+func receive(t *testing.T, ch <-chan Event) Event {
+	t.Helper()
+	select {
+	case event := <-ch:
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event received")
+		return Event{}
+	}
+}
+
+func TestAblyTopicsShareOneStream(t *testing.T) {
+	f := newFakeAbly(t)
+	a := newTestAbly(t, f)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	alice, _ := a.Subscribe(ctx, "user:alice")
+	bob, _ := a.Subscribe(ctx, "user:bob")
+
+	conn := f.nextConn(t)
+	if got := strings.Join(conn.channels, ","); got != "p:user:alice,p:user:bob" {
+		t.Fatalf("stream channels = %s, want both topics on one stream", got)
+	}
+
+	conn.events <- ablyMessage("p:user:bob", Event{Type: EventMessage, Data: json.RawMessage(`{"text":"hi"}`)})
+	if event := receive(t, bob); event.Type != EventMessage || string(event.Data) != `{"text":"hi"}` {
+		t.Errorf("bob received %+v", event)
+	}
+	select {
+	case event := <-alice:
+		t.Errorf("alice received bob's event %+v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// A new topic joins the stream by reconnecting with every channel.
+	carol, _ := a.Subscribe(ctx, "user:carol")
+	next := f.nextConn(t)
+	if got := strings.Join(next.channels, ","); got != "p:user:alice,p:user:bob,p:user:carol" {
+		t.Errorf("stream channels after a new topic = %s", got)
+	}
+	select {
+	case <-conn.closed:
+	case <-time.After(2 * time.Second):
+		t.Error("the previous stream was not closed")
+	}
+	next.events <- ablyMessage("p:user:carol", Event{Type: EventRead})
+	if event := receive(t, carol); event.Type != EventRead {
+		t.Errorf("carol received %+v", event)
+	}
+}
+
+func TestAblyStreamsAreCapped(t *testing.T) {
+	f := newFakeAbly(t)
+	a := newTestAbly(t, f)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for i := 0; i <= ablyChannelsPerStream; i++ {
+		if _, err := a.Subscribe(ctx, fmt.Sprintf("user:%03d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	total := 0
+	for i := 0; i < 2; i++ {
+		conn := f.nextConn(t)
+		if len(conn.channels) > ablyChannelsPerStream {
+			t.Errorf("stream carries %d channels", len(conn.channels))
+		}
+		total += len(conn.channels)
+	}
+	if total != ablyChannelsPerStream+1 {
+		t.Errorf("streams carry %d channels, want %d", total, ablyChannelsPerStream+1)
+	}
+}
+
+func TestAblyClosesUnusedStream(t *testing.T) {
+	f := newFakeAbly(t)
+	a := newTestAbly(t, f)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	a.Subscribe(ctx, "user:alice")
+	conn := f.nextConn(t)
+	cancel()
+	select {
+	case <-conn.closed:
+	case <-time.After(2 * time.Second):
+		t.Error("stream stayed open after its last subscriber left")
+	}
+}
+
+func TestAblyPublish(t *testing.T) {
+	f := newFakeAbly(t)
+	a := newTestAbly(t, f)
+
+	event := Event{Type: EventMessage, Data: json.RawMessage(`{"text":"hi"}`)}
+	if err := a.Publish(context.Background(), "user:bob", event); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	r := <-f.published
+	if r.URL.EscapedPath() != "/channels/p:user:bob/messages" {
+		t.Errorf("published to %s", r.URL.EscapedPath())
+	}
+	if user, pass, _ := r.BasicAuth(); user != "app.key" || pass != "secret" {
+		t.Errorf("basic auth = %s:%s", user, pass)
+	}
+
+	// The stored message carries the event the subscribers decode.
+	var body struct{ Name, Data string }
+	json.Unmarshal([]byte(<-f.bodies), &body)
+	var got Event
+	if err := json.Unmarshal([]byte(body.Data), &got); err != nil || body.Name != EventMessage || got.Type != EventMessage {
+		t.Errorf("message = %+v, event %+v, %v", body, got, err)
+	}
+}
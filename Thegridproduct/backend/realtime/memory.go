@@ -0,0 +1,90 @@
+package realtime
+
+import (
+	"context"
+	"sync"
+)
+
+// subscriptionBuffer is how many events a subscriber may fall behind before it is
+// dropped.
+const subscriptionBuffer = 64
+
+// Memory is a PubSub delivering events within the process. It is all a single
+// instance needs, and the local fan-out of the other implementations.
+type Memory struct {
+	mu     sync.Mutex
+	topics map[string]map[chan Event]struct{}
+	closed bool
+}
+
+// NewMemory returns an empty in-process PubSub.
+func NewMemory() *Memory {
+	return &Memory{topics: map[string]map[chan Event]struct{}{}}
+}
+
+// Publish never blocks: subscribers whose buffer is full are dropped instead.
+func (m *Memory) Publish(ctx context.Context, topic string, event Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	for ch := range m.topics[topic] {
+		select {
+		case ch <- event:
+		default:
+			m.remove(topic, ch)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Subscribe(ctx context.Context, topic string) (<-chan Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	ch := make(chan Event, subscriptionBuffer)
+	if m.topics[topic] == nil {
+		m.topics[topic] = map[chan Event]struct{}{}
+	}
+	m.topics[topic][ch] = struct{}{}
+
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		m.remove(topic, ch)
+		m.mu.Unlock()
+	}()
+	return ch, nil
+}
+
+// remove ends a subscription unless that already happened. m.mu must be held.
+func (m *Memory) remove(topic string, ch chan Event) {
+	subs := m.topics[topic]
+	if _, ok := subs[ch]; !ok {
+		return
+	}
+	delete(subs, ch)
+	if len(subs) == 0 {
+		delete(m.topics, topic)
+	}
+	close(ch)
+}
+
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	for topic, subs := range m.topics {
+		for ch := range subs {
+			m.remove(topic, ch)
+		}
+	}
+	return nil
+}
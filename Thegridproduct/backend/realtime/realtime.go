@@ -0,0 +1,112 @@
+// Package realtime fans out events, such as new chat messages, to the WebSocket and
+// server-sent event streams of connected users. Events are published to topics
+// through the PubSub interface, so every backend instance receives the events for
+// the users connected to it no matter which instance handled the request.
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+// Event types sent to clients.
+const (
+	EventMessage             = "message"
+	EventChatRequest         = "chat_request"
+	EventChatRequestAccepted = "chat_request_accepted"
+	EventChatRequestRejected = "chat_request_rejected"
+	EventRead                = "read"
+)
+
+// ErrClosed is returned when using a PubSub after Close.
+var ErrClosed = errors.New("pubsub closed")
+
+// Event is a single realtime notification. Data is the JSON payload for the type.
+type Event struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// NewEvent returns an event of the given type carrying data encoded as JSON.
+func NewEvent(eventType string, data interface{}) (Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, fmt.Errorf("error encoding %s event: %v", eventType, err)
+	}
+	return Event{Type: eventType, Data: raw}, nil
+}
+
+// PubSub delivers events published to a topic to its subscribers.
+type PubSub interface {
+	// Publish sends event to every current subscriber of topic.
+	Publish(ctx context.Context, topic string, event Event) error
+
+	// Subscribe returns the events published to topic from now on. The channel is
+	// closed when ctx is done, when the PubSub is closed, or when the subscriber
+	// falls too far behind; a subscriber that sees it close early should catch up
+	// through the REST endpoints before subscribing again.
+	Subscribe(ctx context.Context, topic string) (<-chan Event, error)
+
+	// Close ends every subscription.
+	Close() error
+}
+
+// UserTopic is the topic carrying the events for a user.
+func UserTopic(userID string) string {
+	return "user:" + userID
+}
+
+// FromEnv builds the PubSub selected by REALTIME_DRIVER:
+//
+//	memory (default) delivers events within this process only
+//	ably             relays events through Ably, for running several instances;
+//	                 needs ABLY_API_KEY, channels are prefixed with
+//	                 ABLY_CHANNEL_PREFIX (default "gridly:")
+func FromEnv() (PubSub, error) {
+	switch driver := os.Getenv("REALTIME_DRIVER"); driver {
+	case "", "memory":
+		return NewMemory(), nil
+	case "ably":
+		key := os.Getenv("ABLY_API_KEY")
+		if key == "" {
+			return nil, errors.New("ABLY_API_KEY must be set for the ably realtime driver")
+		}
+		prefix, ok := os.LookupEnv("ABLY_CHANNEL_PREFIX")
+		if !ok {
+			prefix = "gridly:"
+		}
+		return NewAbly(key, prefix), nil
+	default:
+		return nil, fmt.Errorf("unknown REALTIME_DRIVER %q", driver)
+	}
+}
+
+var (
+	defaultOnce   sync.Once
+	defaultPubSub PubSub
+)
+
+// Default returns the process-wide PubSub. It is configured from the environment on
+// first use unless SetDefault was called before.
+func Default() PubSub {
+	defaultOnce.Do(func() {
+		p, err := FromEnv()
+		if err != nil {
+			log.Printf("Realtime configuration error, delivering events in memory: %v", err)
+			p = NewMemory()
+		}
+		defaultPubSub = p
+	})
+	return defaultPubSub
+}
+
+// SetDefault replaces the process-wide PubSub. Call it at startup.
+func SetDefault(p PubSub) {
+	defaultOnce.Do(func() {})
+	defaultPubSub = p
+}
@@ -0,0 +1,268 @@
+package realtime
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pipe returns a server Conn and the client end of an in-memory connection.
+func pipe(t *testing.T) (*Conn, net.Conn) {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+	return &Conn{conn: server, br: bufio.NewReader(server)}, client
+}
+
+// clientFrame encodes a final frame the way a client must: masked.
+func clientFrame(opcode byte, payload []byte) []byte {
+	frame := []byte{0x80 | opcode, 0}
+	switch n := len(payload); {
+	case n < 126:
+		frame[1] = byte(n)
+	case n <= 0xFFFF:
+		frame[1] = 126
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame[1] = 127
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	frame[1] |= 0x80
+	mask := []byte{0x37, 0xfa, 0x21, 0x3d}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+// readServerFrame decodes one frame sent by the server, checking it is final and
+// unmasked, and returns its raw header too.
+func readServerFrame(t *testing.T, r io.Reader) (header []byte, opcode byte, payload []byte) {
+	t.Helper()
+	header = make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		t.Fatalf("reading frame header: %v", err)
+	}
+	if header[0]&0x80 == 0 {
+		t.Error("server frame is not final")
+	}
+	if header[1]&0x80 != 0 {
+		t.Error("server frame is masked")
+	}
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		ext := make([]byte, 2)
+		io.ReadFull(r, ext)
+		header = append(header, ext...)
+		length = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		io.ReadFull(r, ext)
+		header = append(header, ext...)
+		length = binary.BigEndian.Uint64(ext)
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatalf("reading frame payload: %v", err)
+	}
+	return header, header[0] & 0x0F, payload
+}
+
+func TestWriteFrameLengths(t *testing.T) {
+	tests := []struct {
+		size       int
+		wantHeader []byte
+	}{
+		{0, []byte{0x81, 0}},
+		{125, []byte{0x81, 125}},
+		{126, []byte{0x81, 126, 0x00, 0x7E}},
+		{0xFFFF, []byte{0x81, 126, 0xFF, 0xFF}},
+		{0x10000, []byte{0x81, 127, 0, 0, 0, 0, 0, 0x01, 0x00, 0x00}},
+	}
+	for _, tt := range tests {
+		c, client := pipe(t)
+		payload := bytes.Repeat([]byte("x"), tt.size)
+		errs := make(chan error, 1)
+		go func() { errs <- c.writeFrame(opText, payload) }()
+
+		header, opcode, got := readServerFrame(t, client)
+		if err := <-errs; err != nil {
+			t.Fatalf("size %d: writeFrame: %v", tt.size, err)
+		}
+		if !bytes.Equal(header, tt.wantHeader) {
+			t.Errorf("size %d: header = % x, want % x", tt.size, header, tt.wantHeader)
+		}
+		if opcode != opText || !bytes.Equal(got, payload) {
+			t.Errorf("size %d: got opcode %d and %d bytes", tt.size, opcode, len(got))
+		}
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		opcode  byte
+		payload []byte
+	}{
+		{"empty", opPing, nil},
+		{"short text", opText, []byte(`{"type":"hello"}`)},
+		{"16 bit length", opBinary, bytes.Repeat([]byte{0xAB}, 300)},
+		{"64 bit length", opBinary, bytes.Repeat([]byte{0xCD}, maxFramePayload)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, client := pipe(t)
+			go client.Write(clientFrame(tt.opcode, tt.payload))
+
+			opcode, payload, err := c.readFrame()
+			if err != nil {
+				t.Fatalf("readFrame: %v", err)
+			}
+			if opcode != tt.opcode || !bytes.Equal(payload, tt.payload) {
+				t.Errorf("readFrame = %d with %d bytes, want %d with %d bytes", opcode, len(payload), tt.opcode, len(tt.payload))
+			}
+		})
+	}
+}
+
+func TestReadFrameTooLarge(t *testing.T) {
+	c, client := pipe(t)
+	frame := []byte{0x82, 0x80 | 127}
+	frame = binary.BigEndian.AppendUint64(frame, maxFramePayload+1)
+	go client.Write(frame)
+
+	if _, _, err := c.readFrame(); err != errFrameTooLarge {
+		t.Errorf("readFrame err = %v, want errFrameTooLarge", err)
+	}
+}
+
+func TestReadLoopAnswersPingAndClose(t *testing.T) {
+	c, client := pipe(t)
+	done := make(chan error, 1)
+	go func() { done <- c.ReadLoop(time.Second) }()
+
+	// Data frames are ignored, pings answered with the same payload.
+	client.Write(clientFrame(opText, []byte("ignored")))
+	client.Write(clientFrame(opPing, []byte("are you there")))
+	_, opcode, payload := readServerFrame(t, client)
+	if opcode != opPong || string(payload) != "are you there" {
+		t.Errorf("ping answered with opcode %d %q", opcode, payload)
+	}
+
+	// The close handshake echoes the client's code.
+	closePayload := binary.BigEndian.AppendUint16(nil, CloseGoingAway)
+	client.Write(clientFrame(opClose, closePayload))
+	_, opcode, payload = readServerFrame(t, client)
+	if opcode != opClose || len(payload) < 2 || binary.BigEndian.Uint16(payload) != CloseGoingAway {
+		t.Errorf("close answered with opcode %d % x", opcode, payload)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("ReadLoop = %v, want nil after a clean close", err)
+	}
+	if err := c.WriteJSON("late"); err != net.ErrClosed {
+		t.Errorf("WriteJSON after close = %v, want net.ErrClosed", err)
+	}
+}
+
+func TestReadLoopRejectsUnknownOpcode(t *testing.T) {
+	c, client := pipe(t)
+	done := make(chan error, 1)
+	go func() { done <- c.ReadLoop(time.Second) }()
+
+	client.Write(clientFrame(0x3, nil))
+	_, opcode, payload := readServerFrame(t, client)
+	if opcode != opClose || binary.BigEndian.Uint16(payload) != ClosePolicy {
+		t.Errorf("unknown opcode answered with opcode %d % x", opcode, payload)
+	}
+	if err := <-done; err == nil {
+		t.Error("ReadLoop = nil, want an error")
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	upgraded := make(chan *Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err == nil {
+			upgraded <- conn
+		}
+	}))
+	defer srv.Close()
+
+	send := func(t *testing.T, headers map[string]string) (*http.Response, net.Conn) {
+		t.Helper()
+		conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		req, _ := http.NewRequest("GET", srv.URL+"/realtime/ws", nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		if err := req.Write(conn); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, conn
+	}
+	valid := func() map[string]string {
+		return map[string]string{
+			"Connection":            "keep-alive, Upgrade",
+			"Upgrade":               "websocket",
+			"Sec-WebSocket-Version": "13",
+			"Sec-WebSocket-Key":     "dGhlIHNhbXBsZSBub25jZQ==", // RFC 6455, section 1.3
+		}
+	}
+
+	t.Run("handshake", func(t *testing.T) {
+		resp, _ := send(t, valid())
+		if resp.StatusCode != http.StatusSwitchingProtocols {
+			t.Fatalf("status = %d, want 101", resp.StatusCode)
+		}
+		if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+			t.Errorf("Sec-WebSocket-Accept = %q", got)
+		}
+		select {
+		case conn := <-upgraded:
+			conn.Close(CloseNormal, "")
+		case <-time.After(time.Second):
+			t.Error("handler did not get a connection")
+		}
+	})
+
+	tests := []struct {
+		name   string
+		change func(map[string]string)
+		status int
+	}{
+		{"not an upgrade", func(h map[string]string) { delete(h, "Upgrade") }, http.StatusBadRequest},
+		{"old version", func(h map[string]string) { h["Sec-WebSocket-Version"] = "8" }, http.StatusUpgradeRequired},
+		{"bad key", func(h map[string]string) { h["Sec-WebSocket-Key"] = "short" }, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := valid()
+			tt.change(headers)
+			resp, _ := send(t, headers)
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
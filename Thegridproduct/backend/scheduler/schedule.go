@@ -0,0 +1,120 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule decides when a job runs next.
+type Schedule interface {
+	// Next returns the first run time strictly after t.
+	Next(t time.Time) time.Time
+}
+
+// every runs at the multiples of an interval.
+type every time.Duration
+
+// Every runs a job at the times time.Truncate rounds to, so every replica agrees
+// on the run times: Every(time.Hour) runs on the hour and Every(15*time.Minute) at
+// :00, :15, :30 and :45.
+func Every(d time.Duration) Schedule {
+	if d <= 0 {
+		panic("scheduler: interval must be positive")
+	}
+	return every(d)
+}
+
+func (e every) Next(t time.Time) time.Time {
+	d := time.Duration(e)
+	return t.Truncate(d).Add(d)
+}
+
+func (e every) String() string {
+	return "@every " + time.Duration(e).String()
+}
+
+// daily runs once a day at a fixed UTC time.
+type daily struct {
+	hour, minute int
+}
+
+// Daily runs a job once a day at hour:minute UTC.
+func Daily(hour, minute int) Schedule {
+	if hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		panic(fmt.Sprintf("scheduler: invalid time of day %d:%d", hour, minute))
+	}
+	return daily{hour: hour, minute: minute}
+}
+
+func (d daily) Next(t time.Time) time.Time {
+	t = t.UTC()
+	next := time.Date(t.Year(), t.Month(), t.Day(), d.hour, d.minute, 0, 0, time.UTC)
+	if !next.After(t) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+func (d daily) String() string {
+	return fmt.Sprintf("@daily %02d:%02d", d.hour, d.minute)
+}
+
+// Parse reads a schedule written the way cron abbreviates common ones:
+//
+//	@every 5m      at the multiples of a Go duration
+//	@hourly        on the hour
+//	@daily         at midnight UTC
+//	@daily 03:30   at 03:30 UTC
+func Parse(spec string) (Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("empty schedule")
+	}
+
+	switch fields[0] {
+	case "@every":
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid schedule %q: @every takes a duration", spec)
+		}
+		d, err := time.ParseDuration(fields[1])
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid schedule %q: bad duration", spec)
+		}
+		return Every(d), nil
+	case "@hourly":
+		if len(fields) != 1 {
+			return nil, fmt.Errorf("invalid schedule %q", spec)
+		}
+		return Every(time.Hour), nil
+	case "@daily":
+		switch len(fields) {
+		case 1:
+			return Daily(0, 0), nil
+		case 2:
+			hour, minute, ok := parseTimeOfDay(fields[1])
+			if !ok {
+				return nil, fmt.Errorf("invalid schedule %q: time of day must be HH:MM", spec)
+			}
+			return Daily(hour, minute), nil
+		}
+	}
+	return nil, fmt.Errorf("invalid schedule %q", spec)
+}
+
+func parseTimeOfDay(s string) (hour, minute int, ok bool) {
+	h, m, found := strings.Cut(s, ":")
+	if !found {
+		return 0, 0, false
+	}
+	hour, err := strconv.Atoi(h)
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, 0, false
+	}
+	minute, err = strconv.Atoi(m)
+	if err != nil || minute < 0 || minute > 59 || len(m) != 2 {
+		return 0, 0, false
+	}
+	return hour, minute, true
+}
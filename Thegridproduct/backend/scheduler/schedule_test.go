@@ -0,0 +1,123 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{spec: "@every 5m", want: "@every 5m0s"},
+		{spec: "  @every   90s ", want: "@every 1m30s"},
+		{spec: "@hourly", want: "@every 1h0m0s"},
+		{spec: "@daily", want: "@daily 00:00"},
+		{spec: "@daily 03:30", want: "@daily 03:30"},
+		{spec: "@daily 23:59", want: "@daily 23:59"},
+		{spec: "", wantErr: true},
+		{spec: "@every", wantErr: true},
+		{spec: "@every 5", wantErr: true},
+		{spec: "@every 0s", wantErr: true},
+		{spec: "@every -1m", wantErr: true},
+		{spec: "@every 5m 10m", wantErr: true},
+		{spec: "@hourly 5", wantErr: true},
+		{spec: "@daily 3:30pm", wantErr: true},
+		{spec: "@daily 24:00", wantErr: true},
+		{spec: "@daily 12:60", wantErr: true},
+		{spec: "@daily 12:5", wantErr: true},
+		{spec: "@daily 12", wantErr: true},
+		{spec: "@daily 01:00 02:00", wantErr: true},
+		{spec: "*/5 * * * *", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			schedule, err := Parse(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Parse(%q) = %v, want an error", tt.spec, schedule)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.spec, err)
+			}
+			if got := fmt.Sprint(schedule); got != tt.want {
+				t.Errorf("Parse(%q) = %s, want %s", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNext(t *testing.T) {
+	at := func(value string) time.Time {
+		t.Helper()
+		parsed, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	berlin := time.FixedZone("CEST", 2*60*60)
+
+	tests := []struct {
+		name     string
+		schedule Schedule
+		from     time.Time
+		want     time.Time
+	}{
+		{"every 15m mid-interval", Every(15 * time.Minute), at("2024-05-01T10:07:12Z"), at("2024-05-01T10:15:00Z")},
+		{"every 15m on a boundary", Every(15 * time.Minute), at("2024-05-01T10:15:00Z"), at("2024-05-01T10:30:00Z")},
+		{"every 15m just before", Every(15 * time.Minute), at("2024-05-01T10:14:59.999Z"), at("2024-05-01T10:15:00Z")},
+		{"every hour across midnight", Every(time.Hour), at("2024-05-01T23:30:00Z"), at("2024-05-02T00:00:00Z")},
+		{"daily later today", Daily(3, 30), at("2024-05-01T01:00:00Z"), at("2024-05-01T03:30:00Z")},
+		{"daily at the run time", Daily(3, 30), at("2024-05-01T03:30:00Z"), at("2024-05-02T03:30:00Z")},
+		{"daily after the run time", Daily(3, 30), at("2024-05-01T03:30:01Z"), at("2024-05-02T03:30:00Z")},
+		{"daily across a month", Daily(0, 0), at("2024-02-29T12:00:00Z"), at("2024-03-01T00:00:00Z")},
+		{"daily is UTC", Daily(3, 0), at("2024-05-01T04:00:00+02:00").In(berlin), at("2024-05-01T03:00:00Z")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.schedule.Next(tt.from)
+			if !got.Equal(tt.want) {
+				t.Errorf("Next(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+			if !got.After(tt.from) {
+				t.Errorf("Next(%s) = %s is not after it", tt.from, got)
+			}
+		})
+	}
+}
+
+func TestEveryAgreesAcrossReplicas(t *testing.T) {
+	// Replicas starting at different moments must pick the same run times.
+	schedule := Every(5 * time.Minute)
+	base := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	want := base.Add(5 * time.Minute)
+	for _, offset := range []time.Duration{0, time.Second, 2*time.Minute + 17*time.Second, 5*time.Minute - time.Nanosecond} {
+		if got := schedule.Next(base.Add(offset)); !got.Equal(want) {
+			t.Errorf("Next(base+%s) = %s, want %s", offset, got, want)
+		}
+	}
+}
+
+func TestInvalidSchedulesPanic(t *testing.T) {
+	for name, build := range map[string]func(){
+		"zero interval":     func() { Every(0) },
+		"negative interval": func() { Every(-time.Minute) },
+		"hour out of range": func() { Daily(24, 0) },
+		"negative minute":   func() { Daily(1, -1) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("did not panic")
+				}
+			}()
+			build()
+		})
+	}
+}
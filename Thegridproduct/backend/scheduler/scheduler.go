@@ -0,0 +1,280 @@
+// Package scheduler runs recurring background jobs. Every replica of the server
+// runs the scheduler; a lease in MongoDB makes sure each run of a job happens on one
+// replica only, and every run is recorded in the job_runs collection.
+//
+// The lease document of a job also holds its next run time, so a run is not
+// repeated by a replica that wakes up a moment later, and a restart does not rerun
+// jobs that already ran for the current slot.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"Thegridproduct/backend/db"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	locksCollection = "scheduler_locks"
+	runsCollection  = "job_runs"
+
+	defaultJobTimeout = 10 * time.Minute
+
+	// leaseMargin is added to a job's timeout for the lease, so a run that is
+	// cancelled at its deadline still releases the lease itself.
+	leaseMargin = time.Minute
+)
+
+// Job is a registered unit of background work.
+type Job struct {
+	Name     string
+	Schedule Schedule
+	Timeout  time.Duration // defaults to 10 minutes
+
+	// Run does the work and returns how many records it affected, which is kept in
+	// the run history.
+	Run func(ctx context.Context) (int, error)
+}
+
+// Run is a job run as recorded in the job_runs collection.
+type Run struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Job        string             `bson:"job" json:"job"`
+	Owner      string             `bson:"owner" json:"owner"`
+	StartedAt  time.Time          `bson:"startedAt" json:"startedAt"`
+	FinishedAt time.Time          `bson:"finishedAt" json:"finishedAt"`
+	DurationMs int64              `bson:"durationMs" json:"durationMs"`
+	Affected   int                `bson:"affected" json:"affected"`
+	Error      string             `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+// Scheduler runs registered jobs on their schedules.
+type Scheduler struct {
+	owner string
+	jobs  []Job
+
+	ctx    context.Context // cancelled when Stop gives up waiting
+	cancel context.CancelFunc
+	done   chan struct{}
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	started bool
+}
+
+// New returns a scheduler without jobs. Its lease owner name identifies this
+// process in the locks and run history.
+func New() *Scheduler {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		owner:  fmt.Sprintf("%s:%d:%s", host, os.Getpid(), primitive.NewObjectID().Hex()[18:]),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+}
+
+// Register adds a job. It panics on an incomplete job, a duplicate name or when the
+// scheduler is already running.
+func (s *Scheduler) Register(job Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if job.Name == "" || job.Schedule == nil || job.Run == nil {
+		panic("scheduler: job needs a name, a schedule and a run function")
+	}
+	if s.started {
+		panic("scheduler: register " + job.Name + " after start")
+	}
+	for _, registered := range s.jobs {
+		if registered.Name == job.Name {
+			panic("scheduler: duplicate job " + job.Name)
+		}
+	}
+	if job.Timeout <= 0 {
+		job.Timeout = defaultJobTimeout
+	}
+	s.jobs = append(s.jobs, job)
+}
+
+// Start runs every registered job that is due now, then each on its schedule,
+// until Stop is called.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return
+	}
+	s.started = true
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(job)
+	}
+	log.Printf("Scheduler started with %d jobs as %s", len(s.jobs), s.owner)
+}
+
+// Stop stops scheduling runs and waits for running jobs to finish, cancelling them
+// once ctx is done.
+func (s *Scheduler) Stop(ctx context.Context) {
+	s.mu.Lock()
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+	s.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		s.cancel()
+		<-finished
+	}
+}
+
+func (s *Scheduler) loop(job Job) {
+	defer s.wg.Done()
+
+	for {
+		s.runIfDue(job)
+
+		timer := time.NewTimer(time.Until(job.Schedule.Next(time.Now())))
+		select {
+		case <-timer.C:
+		case <-s.done:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// runIfDue runs job if no replica holds its lease and its next run time has come.
+func (s *Scheduler) runIfDue(job Job) {
+	// MongoDB stores milliseconds; the start time has to match the lease exactly.
+	start := time.Now().Truncate(time.Millisecond)
+	acquired, err := s.acquire(job, start)
+	if err != nil {
+		log.Printf("Error acquiring lease for job %s: %v", job.Name, err)
+		return
+	}
+	if !acquired {
+		return
+	}
+
+	run := Run{Job: job.Name, Owner: s.owner, StartedAt: start}
+	ctx, cancel := context.WithTimeout(s.ctx, job.Timeout)
+	affected, err := runJob(ctx, job)
+	cancel()
+
+	run.FinishedAt = time.Now()
+	run.DurationMs = run.FinishedAt.Sub(run.StartedAt).Milliseconds()
+	run.Affected = affected
+	if err != nil {
+		run.Error = err.Error()
+		log.Printf("Job %s failed after %s: %v", job.Name, run.FinishedAt.Sub(run.StartedAt).Round(time.Millisecond), err)
+	} else if affected > 0 {
+		log.Printf("Job %s affected %d records", job.Name, affected)
+	}
+
+	// Bookkeeping gets its own deadline so it happens even for a cancelled run.
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.release(ctx, job, run); err != nil {
+		log.Printf("Error releasing lease for job %s: %v", job.Name, err)
+	}
+	if _, err := db.GetCollection("gridlyapp", runsCollection).InsertOne(ctx, run); err != nil {
+		log.Printf("Error recording run of job %s: %v", job.Name, err)
+	}
+}
+
+// runJob calls the job, turning a panic into an error so one broken job does not
+// take the server down.
+func runJob(ctx context.Context, job Job) (affected int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return job.Run(ctx)
+}
+
+// acquire takes the lease of job if it is free and the job is due. The lease
+// document is created on the first run; a concurrent insert by another replica
+// shows up as a duplicate key error, which means the lease is taken.
+func (s *Scheduler) acquire(job Job, now time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{
+		"_id":         job.Name,
+		"lockedUntil": bson.M{"$not": bson.M{"$gt": now}},
+		"nextRunAt":   bson.M{"$not": bson.M{"$gt": now}},
+	}
+	update := bson.M{"$set": bson.M{
+		"owner":       s.owner,
+		"lockedUntil": now.Add(job.Timeout + leaseMargin),
+		"startedAt":   now,
+	}}
+
+	res, err := db.GetCollection("gridlyapp", locksCollection).UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0 || res.UpsertedCount > 0, nil
+}
+
+// release frees the lease of job and sets its next run time, unless the lease
+// expired and another replica took it over meanwhile.
+func (s *Scheduler) release(ctx context.Context, job Job, run Run) error {
+	_, err := db.GetCollection("gridlyapp", locksCollection).UpdateOne(ctx,
+		bson.M{"_id": job.Name, "owner": s.owner, "startedAt": run.StartedAt},
+		bson.M{"$set": bson.M{
+			"lockedUntil": run.FinishedAt,
+			"nextRunAt":   job.Schedule.Next(run.FinishedAt),
+			"lastRunAt":   run.StartedAt,
+			"lastError":   run.Error,
+		}},
+	)
+	return err
+}
+
+// RecentRuns returns the latest runs of a job, newest first; of every job when
+// name is empty.
+func RecentRuns(ctx context.Context, name string, limit int64) ([]Run, error) {
+	filter := bson.M{}
+	if name != "" {
+		filter["job"] = name
+	}
+	cursor, err := db.GetCollection("gridlyapp", runsCollection).Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "startedAt", Value: -1}}).SetLimit(limit))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching job runs: %v", err)
+	}
+	var runs []Run
+	if err := cursor.All(ctx, &runs); err != nil {
+		return nil, fmt.Errorf("error decoding job runs: %v", err)
+	}
+	return runs, nil
+}
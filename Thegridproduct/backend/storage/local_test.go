@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"uploads/abc123/full.jpg", true},
+		{"a", true},
+		{"user_1/photo-2.thumb.png", true},
+		{"", false},
+		{"/etc/passwd", false},
+		{"../secret", false},
+		{"uploads/../../secret", false},
+		{"uploads/./x.jpg", false},
+		{"uploads/.hidden", false},
+		{"uploads//x.jpg", false},
+		{"uploads/x.jpg/", false},
+		{`uploads\x.jpg`, false},
+		{"uploads/x y.jpg", false},
+		{"uploads/%2e%2e/x.jpg", false},
+		{strings.Repeat("a", 512), true},
+		{strings.Repeat("a", 513), false},
+	}
+	for _, tt := range tests {
+		if got := ValidKey(tt.key); got != tt.want {
+			t.Errorf("ValidKey(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func newLocalStore(t *testing.T) (*LocalStore, string) {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "media")
+	s, err := NewLocalStore(dir, "https://api.example.com/media/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, dir
+}
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	s, dir := newLocalStore(t)
+	ctx := context.Background()
+	key := "uploads/u1/photo.png"
+
+	if err := s.Put(ctx, key, []byte("first"), "image/png"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := s.Put(ctx, key, []byte("second"), "image/png"); err != nil {
+		t.Fatalf("Put replacing the blob: %v", err)
+	}
+
+	r, info, err := s.Open(ctx, key)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "second" {
+		t.Errorf("content = %q, want %q", data, "second")
+	}
+	if info.ContentType != "image/png" || info.Size != int64(len("second")) || info.ModTime.IsZero() {
+		t.Errorf("info = %+v", info)
+	}
+
+	// No temporary files are left next to the blob.
+	entries, _ := os.ReadDir(filepath.Join(dir, "uploads", "u1"))
+	if len(entries) != 1 {
+		t.Errorf("blob directory holds %d entries, want 1", len(entries))
+	}
+
+	if got := s.URL(key); got != "https://api.example.com/media/uploads/u1/photo.png" {
+		t.Errorf("URL = %s", got)
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, _, err := s.Open(ctx, key); err != ErrNotFound {
+		t.Errorf("Open after Delete = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		t.Errorf("deleting a missing blob = %v, want nil", err)
+	}
+}
+
+func TestLocalStoreOpenDirectory(t *testing.T) {
+	s, _ := newLocalStore(t)
+	ctx := context.Background()
+	if err := s.Put(ctx, "uploads/u1/photo.png", []byte("x"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Open(ctx, "uploads/u1"); err != ErrNotFound {
+		t.Errorf("Open(directory) = %v, want ErrNotFound", err)
+	}
+}
+
+func TestLocalStoreRejectsTraversal(t *testing.T) {
+	s, dir := newLocalStore(t)
+	ctx := context.Background()
+
+	// A file next to the store that a traversing key would reach.
+	outside := filepath.Join(filepath.Dir(dir), "secret.txt")
+	if err := os.WriteFile(outside, []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"../secret.txt", "uploads/../../secret.txt", "/" + outside, ".."} {
+		if err := s.Put(ctx, key, []byte("overwritten"), "text/plain"); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q) = %v, want ErrInvalidKey", key, err)
+		}
+		if _, _, err := s.Open(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Open(%q) = %v, want ErrInvalidKey", key, err)
+		}
+		if err := s.Delete(ctx, key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Delete(%q) = %v, want ErrInvalidKey", key, err)
+		}
+	}
+
+	if data, err := os.ReadFile(outside); err != nil || string(data) != "secret" {
+		t.Errorf("file outside the store = %q, %v", data, err)
+	}
+}
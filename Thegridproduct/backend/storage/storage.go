@@ -0,0 +1,122 @@
+// Package storage keeps uploaded files behind the BlobStore interface, so the
+// handlers neither know nor care whether blobs live on local disk or in an
+// S3-compatible bucket. Every blob has a stable public URL derived from its key.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when no blob exists under a key.
+	ErrNotFound = errors.New("blob not found")
+
+	// ErrInvalidKey is returned for keys that could escape the store, such as
+	// absolute paths or ones containing "..".
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// Info describes a stored blob.
+type Info struct {
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+}
+
+// BlobStore stores immutable blobs under slash-separated keys.
+type BlobStore interface {
+	// Put stores data under key, replacing any blob with the same key.
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+
+	// Open returns the content of a blob. The caller closes it.
+	Open(ctx context.Context, key string) (io.ReadCloser, Info, error)
+
+	// Delete removes a blob. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+
+	// URL returns the public URL a blob is served from.
+	URL(key string) string
+}
+
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*(/[A-Za-z0-9_-][A-Za-z0-9._-]*)*$`)
+
+// ValidKey reports whether key is safe to use with every store: slash-separated
+// segments of letters, digits, '.', '_' and '-', none starting with a dot.
+func ValidKey(key string) bool {
+	return len(key) <= 512 && keyPattern.MatchString(key)
+}
+
+// FromEnv builds the BlobStore selected by STORAGE_DRIVER:
+//
+//	local (default) files under STORAGE_LOCAL_DIR (default "media")
+//	s3    an S3-compatible bucket: S3_ENDPOINT, S3_REGION, S3_BUCKET,
+//	      S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY
+//
+// Blobs are served by the API's /media route under MEDIA_BASE_URL (default
+// API_BASE_URL + "/media"). An s3 bucket that is publicly readable can be served
+// directly instead by setting S3_PUBLIC_URL.
+func FromEnv() (BlobStore, error) {
+	mediaURL := os.Getenv("MEDIA_BASE_URL")
+	if mediaURL == "" {
+		mediaURL = strings.TrimSuffix(os.Getenv("API_BASE_URL"), "/") + "/media"
+	}
+
+	switch driver := os.Getenv("STORAGE_DRIVER"); driver {
+	case "", "local":
+		dir := os.Getenv("STORAGE_LOCAL_DIR")
+		if dir == "" {
+			dir = "media"
+		}
+		return NewLocalStore(dir, mediaURL)
+	case "s3":
+		s := &S3Store{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PublicURL:       os.Getenv("S3_PUBLIC_URL"),
+			MediaURL:        mediaURL,
+		}
+		if s.Endpoint == "" || s.Region == "" || s.Bucket == "" || s.AccessKeyID == "" || s.SecretAccessKey == "" {
+			return nil, errors.New("S3_ENDPOINT, S3_REGION, S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY must be set for the s3 storage driver")
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_DRIVER %q", driver)
+	}
+}
+
+var (
+	defaultOnce  sync.Once
+	defaultStore BlobStore
+)
+
+// Default returns the process-wide BlobStore. It is configured from the environment
+// on first use unless SetDefault was called before.
+func Default() BlobStore {
+	defaultOnce.Do(func() {
+		s, err := FromEnv()
+		if err != nil {
+			log.Printf("Storage configuration error, using local storage: %v", err)
+			s, _ = NewLocalStore("media", "/media")
+		}
+		defaultStore = s
+	})
+	return defaultStore
+}
+
+// SetDefault replaces the process-wide BlobStore. Call it at startup.
+func SetDefault(s BlobStore) {
+	defaultOnce.Do(func() {})
+	defaultStore = s
+}
@@ -0,0 +1,147 @@
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key of the RFC 6238 test vectors, "12345678901234567890",
+// in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeAtRFC6238(t *testing.T) {
+	// The RFC lists 8 digit codes; 6 digit codes are their last six digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		step := Step(time.Unix(tt.unix, 0))
+		got, err := CodeAt(rfcSecret, step)
+		if err != nil {
+			t.Fatalf("CodeAt(%d): %v", step, err)
+		}
+		if got != tt.want {
+			t.Errorf("code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestCodeAtSecretFormat(t *testing.T) {
+	want, _ := CodeAt(rfcSecret, 1)
+	for _, secret := range []string{strings.ToLower(rfcSecret), " " + rfcSecret + "\n"} {
+		if got, err := CodeAt(secret, 1); err != nil || got != want {
+			t.Errorf("CodeAt(%q) = %q, %v; want %q", secret, got, err, want)
+		}
+	}
+	if _, err := CodeAt("not base32!", 1); err == nil {
+		t.Error("CodeAt accepted an invalid secret")
+	}
+}
+
+func TestStep(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want int64
+	}{
+		{0, 0},
+		{29, 0},
+		{30, 1},
+		{59, 1},
+		{60, 2},
+	}
+	for _, tt := range tests {
+		if got := Step(time.Unix(tt.unix, 0)); got != tt.want {
+			t.Errorf("Step(%d) = %d, want %d", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := Step(now)
+	code := func(step int64) string {
+		c, err := CodeAt(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		skew     int
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", code(current), 1, 0, current, true},
+		{"with spaces", code(current)[:3] + " " + code(current)[3:], 1, 0, current, true},
+		{"previous step within skew", code(current - 1), 1, 0, current - 1, true},
+		{"next step within skew", code(current + 1), 1, 0, current + 1, true},
+		{"outside skew", code(current - 2), 1, 0, 0, false},
+		{"no skew", code(current - 1), 0, 0, 0, false},
+		{"replayed step", code(current), 1, current, 0, false},
+		{"newer step after replay", code(current + 1), 1, current, current + 1, true},
+		{"wrong code", "000000", 1, 0, 0, false},
+		{"too short", code(current)[:5], 1, 0, 0, false},
+		{"too long", code(current) + "0", 1, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.name == "wrong code" && tt.code == code(current) {
+				t.Skip("000000 happens to be the current code")
+			}
+			step, ok := Validate(rfcSecret, tt.code, now, tt.skew, tt.lastStep)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("Validate() = %d, %v; want %d, %v", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := GenerateSecret()
+	if a == b {
+		t.Error("GenerateSecret returned the same secret twice")
+	}
+	key, err := encoding.DecodeString(a)
+	if err != nil || len(key) != secretSize {
+		t.Errorf("secret %q decodes to %d bytes, %v; want %d", a, len(key), err, secretSize)
+	}
+	if _, err := CodeAt(a, 1); err != nil {
+		t.Errorf("CodeAt with a generated secret: %v", err)
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI(rfcSecret, "Gridly", "sam@example.edu")
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Scheme != "otpauth" || parsed.Host != "totp" || parsed.Path != "/Gridly:sam@example.edu" {
+		t.Errorf("URI = %s", uri)
+	}
+	q := parsed.Query()
+	want := map[string]string{"secret": rfcSecret, "issuer": "Gridly", "algorithm": "SHA1", "digits": "6", "period": "30"}
+	for key, value := range want {
+		if q.Get(key) != value {
+			t.Errorf("%s = %q, want %q", key, q.Get(key), value)
+		}
+	}
+}
@@ -0,0 +1,478 @@
+// Package vectorindex is an in-memory approximate nearest-neighbour index over
+// embedding vectors, so semantic search does not have to load and compare every
+// stored vector on each query.
+//
+// It implements HNSW (Malkov & Yashunin, "Efficient and robust approximate nearest
+// neighbor search using Hierarchical Navigable Small World graphs"). Vectors are
+// compared by cosine similarity. Each entry carries metadata of any type which
+// searches can filter on while walking the graph, so filtered searches still return
+// k results when enough entries pass the filter.
+package vectorindex
+
+import (
+	"container/heap"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// exactScanLimit is the number of entries passing a search filter up to which a
+// plain scan of those entries beats walking the graph, which has to visit many
+// entries that the filter then rejects.
+const exactScanLimit = 2000
+
+// ErrDimension is returned for vectors whose length differs from the index's.
+var ErrDimension = errors.New("vector has the wrong dimension")
+
+// Options tune the index. Larger values give better recall for more memory and
+// slower inserts (M, EfConstruction) or searches (EfSearch).
+type Options struct {
+	M              int   // Links per node and layer; layer 0 has twice as many
+	EfConstruction int   // Candidate list size while inserting
+	EfSearch       int   // Minimum candidate list size while searching
+	Seed           int64 // Seed of the level generator, for reproducible graphs
+}
+
+// DefaultOptions work well for a few hundred thousand vectors.
+func DefaultOptions() Options {
+	return Options{M: 16, EfConstruction: 100, EfSearch: 64, Seed: 1}
+}
+
+// Result is a search hit. Score is the cosine similarity to the query.
+type Result[K comparable] struct {
+	ID    K
+	Score float64
+}
+
+type node[K comparable, M any] struct {
+	id      K
+	vector  []float32 // Unit length
+	meta    M
+	friends [][]int32 // Neighbours per layer, up to the node's level
+	deleted bool
+}
+
+// Index is an HNSW graph keyed by K with metadata M. It is safe for concurrent use.
+//
+// Removed and replaced entries stay in the graph as tombstones that searches walk
+// through but never return; rebuild the index from time to time when entries
+// change a lot.
+type Index[K comparable, M any] struct {
+	mu        sync.RWMutex
+	opts      Options
+	dim       int
+	levelMult float64
+	rng       *rand.Rand
+
+	nodes    []node[K, M]
+	ids      map[K]int32
+	entry    int32
+	maxLevel int
+}
+
+// New returns an empty index for vectors of length dim. With dim 0 the length is
+// taken from the first vector added.
+func New[K comparable, M any](dim int, opts Options) *Index[K, M] {
+	defaults := DefaultOptions()
+	if opts.M < 2 {
+		opts.M = defaults.M
+	}
+	if opts.EfConstruction <= 0 {
+		opts.EfConstruction = defaults.EfConstruction
+	}
+	if opts.EfSearch <= 0 {
+		opts.EfSearch = defaults.EfSearch
+	}
+	return &Index[K, M]{
+		opts:      opts,
+		dim:       dim,
+		levelMult: 1 / math.Log(float64(opts.M)),
+		rng:       rand.New(rand.NewSource(opts.Seed)),
+		ids:       make(map[K]int32),
+		entry:     -1,
+	}
+}
+
+// Len returns the number of entries.
+func (x *Index[K, M]) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.ids)
+}
+
+// Add inserts an entry, replacing any entry with the same id.
+func (x *Index[K, M]) Add(id K, vector []float32, meta M) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.dim == 0 {
+		x.dim = len(vector)
+	}
+	if len(vector) != x.dim || x.dim == 0 {
+		return ErrDimension
+	}
+	if old, ok := x.ids[id]; ok {
+		x.nodes[old].deleted = true
+	}
+	x.insert(id, normalize(vector), meta)
+	return nil
+}
+
+// Remove deletes an entry. It reports whether the entry existed.
+func (x *Index[K, M]) Remove(id K) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	i, ok := x.ids[id]
+	if !ok {
+		return false
+	}
+	x.nodes[i].deleted = true
+	delete(x.ids, id)
+	return true
+}
+
+// SetMeta replaces the metadata of an entry. It reports whether the entry exists.
+func (x *Index[K, M]) SetMeta(id K, meta M) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	i, ok := x.ids[id]
+	if ok {
+		x.nodes[i].meta = meta
+	}
+	return ok
+}
+
+// Similarity returns the cosine similarity between query and the entry with id.
+// It reports false when there is no such entry or the query has the wrong length.
+func (x *Index[K, M]) Similarity(query []float32, id K) (float64, bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	i, ok := x.ids[id]
+	if !ok || len(query) != x.dim {
+		return 0, false
+	}
+	return float64(dot(normalize(query), x.nodes[i].vector)), true
+}
+
+// Search returns up to k entries most similar to query that pass filter, best
+// first. A nil filter accepts every entry.
+//
+// The graph is walked without regard to the filter, but only passing entries are
+// collected, so results stay accurate for loose filters. Selective filters, which
+// leave few entries or make the walk come back with fewer than k, are answered by
+// an exact scan of the passing entries instead.
+func (x *Index[K, M]) Search(query []float32, k int, filter func(M) bool) ([]Result[K], error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	if len(query) != x.dim && x.dim != 0 {
+		return nil, ErrDimension
+	}
+	if k <= 0 || len(x.ids) == 0 {
+		return nil, nil
+	}
+	q := normalize(query)
+
+	if filter != nil {
+		passing := 0
+		for i := range x.nodes {
+			if !x.nodes[i].deleted && filter(x.nodes[i].meta) {
+				if passing++; passing > exactScanLimit {
+					break
+				}
+			}
+		}
+		if passing <= exactScanLimit {
+			return x.exact(q, k, filter), nil
+		}
+	}
+
+	ep := x.entry
+	for l := x.maxLevel; l > 0; l-- {
+		ep = x.greedy(q, ep, l)
+	}
+
+	accept := func(i int32) bool {
+		n := &x.nodes[i]
+		return !n.deleted && (filter == nil || filter(n.meta))
+	}
+	ef := x.opts.EfSearch
+	if k > ef {
+		ef = k
+	}
+	found := x.searchLayer(q, ep, ef, 0, accept, 32*ef)
+	if len(found) < k && len(found) < len(x.ids) {
+		return x.exact(q, k, filter), nil
+	}
+	if len(found) > k {
+		found = found[:k]
+	}
+
+	results := make([]Result[K], len(found))
+	for i, c := range found {
+		results[i] = Result[K]{ID: x.nodes[c.node].id, Score: float64(c.score)}
+	}
+	return results, nil
+}
+
+// Exact returns the same as Search but compares query with every entry. It is the
+// baseline the approximate search is measured against.
+func (x *Index[K, M]) Exact(query []float32, k int, filter func(M) bool) ([]Result[K], error) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	if len(query) != x.dim && x.dim != 0 {
+		return nil, ErrDimension
+	}
+	if k <= 0 || len(x.ids) == 0 {
+		return nil, nil
+	}
+	return x.exact(normalize(query), k, filter), nil
+}
+
+func (x *Index[K, M]) exact(q []float32, k int, filter func(M) bool) []Result[K] {
+	top := &minHeap{}
+	for i := range x.nodes {
+		n := &x.nodes[i]
+		if n.deleted || (filter != nil && !filter(n.meta)) {
+			continue
+		}
+		s := dot(q, n.vector)
+		if top.Len() < k {
+			heap.Push(top, candidate{node: int32(i), score: s})
+		} else if s > (*top)[0].score {
+			(*top)[0] = candidate{node: int32(i), score: s}
+			heap.Fix(top, 0)
+		}
+	}
+
+	results := make([]Result[K], top.Len())
+	for i := len(results) - 1; i >= 0; i-- {
+		c := heap.Pop(top).(candidate)
+		results[i] = Result[K]{ID: x.nodes[c.node].id, Score: float64(c.score)}
+	}
+	return results
+}
+
+func (x *Index[K, M]) insert(id K, vector []float32, meta M) {
+	level := int(math.Floor(-math.Log(1-x.rng.Float64()) * x.levelMult))
+	n := int32(len(x.nodes))
+	x.nodes = append(x.nodes, node[K, M]{id: id, vector: vector, meta: meta, friends: make([][]int32, level+1)})
+	x.ids[id] = n
+
+	if x.entry < 0 {
+		x.entry, x.maxLevel = n, level
+		return
+	}
+
+	ep := x.entry
+	for l := x.maxLevel; l > level; l-- {
+		ep = x.greedy(vector, ep, l)
+	}
+	for l := min(level, x.maxLevel); l >= 0; l-- {
+		found := x.searchLayer(vector, ep, x.opts.EfConstruction, l, nil, 0)
+		neighbours := x.selectNeighbours(found, x.opts.M)
+		x.nodes[n].friends[l] = neighbours
+		for _, nb := range neighbours {
+			x.link(nb, n, l)
+		}
+		ep = found[0].node
+	}
+	if level > x.maxLevel {
+		x.entry, x.maxLevel = n, level
+	}
+}
+
+// link adds an edge from a to b on layer l. When a has too many edges it keeps the
+// closest ones; running the neighbour heuristic here as well costs more than half
+// of the insert time for little gain in recall.
+func (x *Index[K, M]) link(a, b int32, l int) {
+	maxLinks := x.opts.M
+	if l == 0 {
+		maxLinks *= 2
+	}
+	friends := append(x.nodes[a].friends[l], b)
+	if len(friends) > maxLinks {
+		scored := make([]candidate, len(friends))
+		for i, f := range friends {
+			scored[i] = candidate{node: f, score: dot(x.nodes[a].vector, x.nodes[f].vector)}
+		}
+		sort.Slice(scored, func(i, j int) bool { return scored[i].score > scored[j].score })
+		friends = friends[:0]
+		for _, c := range scored[:maxLinks] {
+			friends = append(friends, c.node)
+		}
+	}
+	x.nodes[a].friends[l] = friends
+}
+
+// selectNeighbours picks up to m of the candidates, which are sorted best first,
+// with the HNSW heuristic: a candidate closer to an already picked neighbour than
+// to the base node is skipped, so links spread out in all directions instead of
+// piling up inside one cluster. Skipped candidates fill any remaining slots.
+func (x *Index[K, M]) selectNeighbours(candidates []candidate, m int) []int32 {
+	picked := make([]int32, 0, m)
+	var skipped []int32
+	for _, c := range candidates {
+		if len(picked) >= m {
+			break
+		}
+		good := true
+		for _, p := range picked {
+			if dot(x.nodes[c.node].vector, x.nodes[p].vector) > c.score {
+				good = false
+				break
+			}
+		}
+		if good {
+			picked = append(picked, c.node)
+		} else {
+			skipped = append(skipped, c.node)
+		}
+	}
+	for _, s := range skipped {
+		if len(picked) >= m {
+			break
+		}
+		picked = append(picked, s)
+	}
+	return picked
+}
+
+// greedy walks layer l from ep towards q and returns the closest node it reaches.
+func (x *Index[K, M]) greedy(q []float32, ep int32, l int) int32 {
+	best, bestScore := ep, dot(q, x.nodes[ep].vector)
+	for changed := true; changed; {
+		changed = false
+		for _, f := range x.nodes[best].friends[l] {
+			if s := dot(q, x.nodes[f].vector); s > bestScore {
+				best, bestScore, changed = f, s, true
+			}
+		}
+	}
+	return best
+}
+
+// searchLayer returns up to ef nodes of layer l close to q that pass accept (all
+// nodes when accept is nil), best first. maxVisits bounds the walk; 0 means no bound.
+func (x *Index[K, M]) searchLayer(q []float32, ep int32, ef, l int, accept func(int32) bool, maxVisits int) []candidate {
+	visited := make([]uint64, (len(x.nodes)+63)/64)
+	visit := func(i int32) bool {
+		word, bit := i/64, uint64(1)<<(i%64)
+		if visited[word]&bit != 0 {
+			return false
+		}
+		visited[word] |= bit
+		return true
+	}
+
+	candidates := &maxHeap{}
+	results := &minHeap{}
+	consider := func(i int32) {
+		s := dot(q, x.nodes[i].vector)
+		if results.Len() >= ef && s <= (*results)[0].score {
+			return
+		}
+		heap.Push(candidates, candidate{node: i, score: s})
+		if accept == nil || accept(i) {
+			heap.Push(results, candidate{node: i, score: s})
+			if results.Len() > ef {
+				heap.Pop(results)
+			}
+		}
+	}
+
+	visit(ep)
+	consider(ep)
+	visits := 1
+	for candidates.Len() > 0 {
+		c := heap.Pop(candidates).(candidate)
+		if results.Len() >= ef && c.score < (*results)[0].score {
+			break
+		}
+		if maxVisits > 0 && visits >= maxVisits {
+			break
+		}
+		for _, f := range x.nodes[c.node].friends[l] {
+			if visit(f) {
+				visits++
+				consider(f)
+			}
+		}
+	}
+
+	found := make([]candidate, results.Len())
+	for i := len(found) - 1; i >= 0; i-- {
+		found[i] = heap.Pop(results).(candidate)
+	}
+	return found
+}
+
+type candidate struct {
+	node  int32
+	score float32
+}
+
+// minHeap keeps the worst candidate on top; maxHeap the best.
+type minHeap []candidate
+type maxHeap []candidate
+
+func (h minHeap) Len() int            { return len(h) }
+func (h minHeap) Less(i, j int) bool  { return h[i].score < h[j].score }
+func (h minHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *minHeap) Push(v interface{}) { *h = append(*h, v.(candidate)) }
+func (h *minHeap) Pop() interface{} {
+	old := *h
+	v := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return v
+}
+
+func (h maxHeap) Len() int            { return len(h) }
+func (h maxHeap) Less(i, j int) bool  { return h[i].score > h[j].score }
+func (h maxHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *maxHeap) Push(v interface{}) { *h = append(*h, v.(candidate)) }
+func (h *maxHeap) Pop() interface{} {
+	old := *h
+	v := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return v
+}
+
+func dot(a, b []float32) float32 {
+	b = b[:len(a)]
+	var s0, s1, s2, s3 float32
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		s0 += a[i] * b[i]
+		s1 += a[i+1] * b[i+1]
+		s2 += a[i+2] * b[i+2]
+		s3 += a[i+3] * b[i+3]
+	}
+	for ; i < len(a); i++ {
+		s0 += a[i] * b[i]
+	}
+	return s0 + s1 + s2 + s3
+}
+
+// normalize returns a unit length copy of v, or a zero copy for the zero vector.
+func normalize(v []float32) []float32 {
+	var norm float64
+	for _, f := range v {
+		norm += float64(f) * float64(f)
+	}
+	out := make([]float32, len(v))
+	if norm == 0 {
+		return out
+	}
+	inv := 1 / math.Sqrt(norm)
+	for i, f := range v {
+		out[i] = float32(float64(f) * inv)
+	}
+	return out
+}
@@ -0,0 +1,277 @@
+package vectorindex
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+type campus struct {
+	university string
+	flexible   bool
+}
+
+// dataset is a set of clustered unit vectors, like embeddings of listings that
+// fall into a few topics.
+type dataset struct {
+	vectors [][]float32
+	metas   []campus
+	queries [][]float32
+}
+
+func newDataset(n, dim, queries int, seed int64) dataset {
+	rng := rand.New(rand.NewSource(seed))
+	centres := make([][]float32, 50)
+	for i := range centres {
+		centres[i] = randomVector(rng, dim, nil, 0)
+	}
+	sample := func() []float32 {
+		return randomVector(rng, dim, centres[rng.Intn(len(centres))], 0.35)
+	}
+
+	d := dataset{
+		vectors: make([][]float32, n),
+		metas:   make([]campus, n),
+		queries: make([][]float32, queries),
+	}
+	for i := range d.vectors {
+		d.vectors[i] = sample()
+		d.metas[i] = campus{university: fmt.Sprintf("campus-%d", rng.Intn(10)), flexible: rng.Float64() < 0.2}
+	}
+	for i := range d.queries {
+		d.queries[i] = sample()
+	}
+	return d
+}
+
+func (d dataset) index(tb testing.TB) *Index[int, campus] {
+	tb.Helper()
+	index := New[int, campus](len(d.vectors[0]), DefaultOptions())
+	for i, v := range d.vectors {
+		if err := index.Add(i, v, d.metas[i]); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	return index
+}
+
+func randomVector(rng *rand.Rand, dim int, centre []float32, noise float64) []float32 {
+	v := make([]float32, dim)
+	var norm float64
+	for i := range v {
+		f := rng.NormFloat64()
+		if centre != nil {
+			f = float64(centre[i]) + f*noise/math.Sqrt(float64(dim))
+		}
+		v[i] = float32(f)
+		norm += f * f
+	}
+	norm = math.Sqrt(norm)
+	for i := range v {
+		v[i] = float32(float64(v[i]) / norm)
+	}
+	return v
+}
+
+func visibleFrom(university string) func(campus) bool {
+	return func(m campus) bool { return m.flexible || m.university == university }
+}
+
+// recall is the average share of the exact top k that Search returns.
+func recall(tb testing.TB, index *Index[int, campus], queries [][]float32, k int, filter func(campus) bool) float64 {
+	tb.Helper()
+	var total float64
+	for _, q := range queries {
+		exact, err := index.Exact(q, k, filter)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		approx, err := index.Search(q, k, filter)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		found := make(map[int]bool, len(approx))
+		for _, r := range approx {
+			found[r.ID] = true
+		}
+		hits := 0
+		for _, r := range exact {
+			if found[r.ID] {
+				hits++
+			}
+		}
+		if len(exact) == 0 {
+			total++
+			continue
+		}
+		total += float64(hits) / float64(len(exact))
+	}
+	return total / float64(len(queries))
+}
+
+func TestSearchRecall(t *testing.T) {
+	// Large enough that the campus filter passes more than exactScanLimit entries
+	// and is answered by walking the graph.
+	d := newDataset(12000, 48, 100, 1)
+	index := d.index(t)
+
+	tests := []struct {
+		name   string
+		filter func(campus) bool
+		min    float64
+	}{
+		{"unfiltered", nil, 0.95},
+		{"campus filter", visibleFrom("campus-0"), 0.95},
+		{"selective filter", func(m campus) bool { return m.university == "campus-3" && !m.flexible }, 0.99},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := recall(t, index, d.queries, 10, tt.filter); got < tt.min {
+				t.Errorf("recall@10 = %.3f, want at least %.2f", got, tt.min)
+			}
+		})
+	}
+}
+
+func TestSearchOrderAndScores(t *testing.T) {
+	d := newDataset(500, 16, 10, 2)
+	index := d.index(t)
+	for _, q := range d.queries {
+		results, err := index.Search(q, 10, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 10 {
+			t.Fatalf("got %d results, want 10", len(results))
+		}
+		for i, r := range results {
+			if i > 0 && r.Score > results[i-1].Score {
+				t.Errorf("results not sorted by score: %v", results)
+			}
+			if s, _ := index.Similarity(q, r.ID); math.Abs(s-r.Score) > 1e-6 {
+				t.Errorf("score of %d = %f, similarity %f", r.ID, r.Score, s)
+			}
+		}
+	}
+}
+
+func TestSearchNeverReturnsRemovedOrReplacedEntries(t *testing.T) {
+	d := newDataset(1000, 32, 20, 3)
+	index := d.index(t)
+
+	for i := 0; i < len(d.vectors); i += 2 {
+		if !index.Remove(i) {
+			t.Fatalf("Remove(%d) = false", i)
+		}
+	}
+	if index.Remove(0) {
+		t.Error("removing twice reported the entry as existing")
+	}
+	if got, want := index.Len(), len(d.vectors)/2; got != want {
+		t.Errorf("Len() = %d, want %d", got, want)
+	}
+
+	// Move entry 1 onto the first query; it has to come back first, once.
+	if err := index.Add(1, d.queries[0], campus{}); err != nil {
+		t.Fatal(err)
+	}
+	results, err := index.Search(d.queries[0], 20, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].ID != 1 {
+		t.Errorf("replaced entry not ranked first: %v", results[:3])
+	}
+	seen := map[int]bool{}
+	for _, r := range results {
+		if r.ID%2 == 0 {
+			t.Errorf("removed entry %d returned", r.ID)
+		}
+		if seen[r.ID] {
+			t.Errorf("entry %d returned twice", r.ID)
+		}
+		seen[r.ID] = true
+	}
+}
+
+func TestSetMetaAffectsFilter(t *testing.T) {
+	d := newDataset(200, 16, 1, 4)
+	index := d.index(t)
+	only := func(m campus) bool { return m.university == "moved" }
+
+	if results, _ := index.Search(d.queries[0], 5, only); len(results) != 0 {
+		t.Fatalf("filter matched before SetMeta: %v", results)
+	}
+	if !index.SetMeta(7, campus{university: "moved"}) {
+		t.Fatal("SetMeta(7) = false")
+	}
+	if index.SetMeta(-1, campus{}) {
+		t.Error("SetMeta of a missing entry reported true")
+	}
+	results, _ := index.Search(d.queries[0], 5, only)
+	if len(results) != 1 || results[0].ID != 7 {
+		t.Errorf("Search with filter = %v, want only entry 7", results)
+	}
+}
+
+func TestDimension(t *testing.T) {
+	index := New[string, struct{}](0, DefaultOptions())
+	if results, err := index.Search([]float32{1, 0}, 3, nil); err != nil || results != nil {
+		t.Errorf("Search on empty index = %v, %v", results, err)
+	}
+	if err := index.Add("a", []float32{1, 0, 0}, struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := index.Add("b", []float32{1, 0}, struct{}{}); err != ErrDimension {
+		t.Errorf("Add with wrong length = %v, want ErrDimension", err)
+	}
+	if _, err := index.Search([]float32{1, 0}, 3, nil); err != ErrDimension {
+		t.Errorf("Search with wrong length = %v, want ErrDimension", err)
+	}
+	if _, ok := index.Similarity([]float32{1, 0}, "a"); ok {
+		t.Error("Similarity with wrong length reported ok")
+	}
+}
+
+func BenchmarkAdd(b *testing.B) {
+	d := newDataset(b.N, 256, 0, 5)
+	index := New[int, campus](256, DefaultOptions())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		index.Add(i, d.vectors[i], d.metas[i])
+	}
+}
+
+var (
+	benchOnce  sync.Once
+	benchData  dataset
+	benchIndex *Index[int, campus]
+)
+
+func benchmarkSearch(b *testing.B, filter func(campus) bool, exact bool) {
+	benchOnce.Do(func() {
+		benchData = newDataset(20000, 256, 200, 6)
+		benchIndex = benchData.index(b)
+	})
+	d, index := benchData, benchIndex
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		q := d.queries[i%len(d.queries)]
+		if exact {
+			index.Exact(q, 10, filter)
+		} else {
+			index.Search(q, 10, filter)
+		}
+	}
+	b.StopTimer()
+	if !exact {
+		b.ReportMetric(recall(b, index, d.queries, 10, filter), "recall@10")
+	}
+}
+
+func BenchmarkSearch(b *testing.B)         { benchmarkSearch(b, nil, false) }
+func BenchmarkSearchFiltered(b *testing.B) { benchmarkSearch(b, visibleFrom("campus-0"), false) }
+func BenchmarkExact(b *testing.B)          { benchmarkSearch(b, nil, true) }
+func BenchmarkExactFiltered(b *testing.B)  { benchmarkSearch(b, visibleFrom("campus-0"), true) }